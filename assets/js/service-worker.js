@@ -0,0 +1,100 @@
+// Magi service worker, caches the application shell and the pages of the chapter being read.
+const SHELL_CACHE = "magi-shell-v1";
+const CHAPTER_CACHE = "magi-chapter-v1";
+
+const SHELL_ASSETS = [
+  "/assets/css/styles.css",
+  "/assets/js/htmx.min.js",
+  "/assets/js/uikit.min.js",
+  "/assets/js/uikit-icons.min.js",
+  "/assets/js/lazysizes.min.js",
+  "/assets/img/icon.png",
+];
+
+self.addEventListener("install", (event) => {
+  event.waitUntil(
+    caches.open(SHELL_CACHE).then((cache) => cache.addAll(SHELL_ASSETS))
+  );
+  self.skipWaiting();
+});
+
+self.addEventListener("activate", (event) => {
+  event.waitUntil(
+    caches
+      .keys()
+      .then((keys) =>
+        Promise.all(
+          keys
+            .filter((key) => key !== SHELL_CACHE && key !== CHAPTER_CACHE)
+            .map((key) => caches.delete(key))
+        )
+      )
+      .then(() => self.clients.claim())
+  );
+});
+
+self.addEventListener("fetch", (event) => {
+  const request = event.request;
+  if (request.method !== "GET") {
+    return;
+  }
+
+  const url = new URL(request.url);
+  if (url.origin !== self.location.origin) {
+    return;
+  }
+
+  if (SHELL_ASSETS.includes(url.pathname)) {
+    event.respondWith(
+      caches
+        .match(request)
+        .then((cached) => cached || fetch(request))
+    );
+    return;
+  }
+
+  if (url.pathname === "/api/comic") {
+    event.respondWith(chapterPage(request, url));
+  }
+
+  // Everything else, including pages and authentication, always goes to the network
+});
+
+// chapterPage fetches a page from the network and keeps it for offline reading,
+// falling back to the cached copy only when the network is unavailable.
+async function chapterPage(request, url) {
+  const cache = await caches.open(CHAPTER_CACHE);
+  try {
+    const response = await fetch(request);
+    // Never store failed or unauthorized responses, so an expired session is not masked
+    if (response.ok) {
+      await forgetOtherChapters(cache, url);
+      await cache.put(request, response.clone());
+    }
+    return response;
+  } catch (error) {
+    const cached = await cache.match(request);
+    if (cached) {
+      return cached;
+    }
+    throw error;
+  }
+}
+
+// forgetOtherChapters only keeps the pages of the chapter currently being read.
+async function forgetOtherChapters(cache, url) {
+  const manga = url.searchParams.get("manga");
+  const chapter = url.searchParams.get("chapter");
+  const keys = await cache.keys();
+  await Promise.all(
+    keys
+      .filter((key) => {
+        const cachedURL = new URL(key.url);
+        return (
+          cachedURL.searchParams.get("manga") !== manga ||
+          cachedURL.searchParams.get("chapter") !== chapter
+        );
+      })
+      .map((key) => cache.delete(key))
+  );
+}
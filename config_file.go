@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/gofiber/fiber/v2/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables overriding the configuration file, flags override both
+const (
+	configEnv        = "MAGI_CONFIG"
+	dataDirectoryEnv = "MAGI_DATA_DIRECTORY"
+)
+
+var configPath string
+
+func init() {
+	flag.StringVar(&configPath, "config", "", "Path to a YAML or JSON configuration file, also read from "+configEnv)
+}
+
+// configFile is the optional startup configuration. AppConfig uses the keys of the stored configuration and only
+// seeds it, once stored the configuration is managed from the admin area.
+type configFile struct {
+	DataDirectory string         `yaml:"data_directory"`
+	AppConfig     map[string]any `yaml:"app_config"`
+}
+
+// loadConfigFile reads and validates a configuration file, returning it along with the app configuration it seeds
+func loadConfigFile(path string) (configFile, *models.AppConfig, error) {
+	var file configFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, nil, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return file, nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	if file.AppConfig == nil {
+		return file, nil, nil
+	}
+
+	// The section goes through JSON so it has the keys and the defaults of the stored configuration
+	encoded, err := json.Marshal(file.AppConfig)
+	if err != nil {
+		return file, nil, fmt.Errorf("invalid app_config in %s: %w", path, err)
+	}
+	config := models.DefaultAppConfig()
+	jsonDecoder := json.NewDecoder(bytes.NewReader(encoded))
+	jsonDecoder.DisallowUnknownFields()
+	if err := jsonDecoder.Decode(&config); err != nil {
+		return file, nil, fmt.Errorf("invalid app_config in %s: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return file, nil, fmt.Errorf("invalid app_config in %s: %w", path, err)
+	}
+	return file, &config, nil
+}
+
+// resolveOptions applies the configuration file and the environment to the options whose flag wasn't set, flags take
+// precedence over the environment, which takes precedence over the file. It returns the app configuration to seed.
+func resolveOptions(flags *flag.FlagSet) (*models.AppConfig, error) {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	path := configPath
+	if !set["config"] {
+		path = os.Getenv(configEnv)
+	}
+	var file configFile
+	var appConfig *models.AppConfig
+	if path != "" {
+		var err error
+		if file, appConfig, err = loadConfigFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if !set["data-directory"] {
+		if env := os.Getenv(dataDirectoryEnv); env != "" {
+			dataDirectory = env
+		} else if file.DataDirectory != "" {
+			dataDirectory = file.DataDirectory
+		}
+	}
+	return appConfig, nil
+}
+
+// runConfig runs a configuration file command, "validate" checks a file without starting the server
+func runConfig(args []string) error {
+	if len(args) != 2 || args[0] != "validate" {
+		return fmt.Errorf("usage: magi config validate <file>")
+	}
+	if _, _, err := loadConfigFile(args[1]); err != nil {
+		return err
+	}
+	log.Infof("%s is valid", args[1])
+	return nil
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+const activityPageSize = 50
+
+// HandleActivityLog renders the activity log page
+func HandleActivityLog(c *fiber.Ctx) error {
+	filter := activityLogFilter(c)
+	entries, total, page, err := getActivityLog(c, filter)
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.ActivityLog(entries, total, page, c.Query("from"), c.Query("to"), filter))
+}
+
+// HandleActivityLogTable renders only the activity log table, used for filtering and paging
+func HandleActivityLogTable(c *fiber.Ctx) error {
+	filter := activityLogFilter(c)
+	entries, total, page, err := getActivityLog(c, filter)
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.ActivityLogTable(entries, total, page, c.Query("from"), c.Query("to"), filter))
+}
+
+func getActivityLog(c *fiber.Ctx, filter models.ActivityLogFilter) ([]models.ActivityLogEntry, int, int, error) {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	entries, total, err := models.GetActivityLog(filter, page, activityPageSize)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return entries, total, page, nil
+}
+
+// activityLogFilter builds the filter from the query, ignoring dates that fail to parse
+func activityLogFilter(c *fiber.Ctx) models.ActivityLogFilter {
+	filter := models.ActivityLogFilter{
+		Type:  c.Query("type"),
+		Actor: c.Query("actor"),
+	}
+	if from, err := time.ParseInLocation(time.DateOnly, c.Query("from"), time.Local); err == nil {
+		filter.From = from
+	}
+	if to, err := time.ParseInLocation(time.DateOnly, c.Query("to"), time.Local); err == nil {
+		filter.To = to
+	}
+	return filter
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/alexander-bruun/magi/models"
 	"github.com/alexander-bruun/magi/views"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -41,12 +42,21 @@ func LoginUserHandler(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create access token"})
 	}
 
-	refreshToken, err := models.GenerateNewRefreshToken(user.Username)
+	session, err := models.NewSession(c.FormValue("remember_me") == "true")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create session"})
+	}
+
+	refreshToken, err := models.GenerateNewRefreshToken(user.Username, session)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create refresh token"})
 	}
 
-	setAuthCookies(c, accessToken, refreshToken)
+	setAuthCookies(c, accessToken, refreshToken, session)
+	logActivityAs(user.Username, "user_login", user.Username)
+	if err := models.RecordVisit(user.Username, true); err != nil {
+		log.Errorf("Failed to record visit of '%s': %v", user.Username, err)
+	}
 	c.Set("HX-Redirect", "/")
 	return c.SendStatus(fiber.StatusOK)
 }
@@ -58,6 +68,7 @@ func LogoutHandler(c *fiber.Ctx) error {
 		if userName, ok := claims["user_name"].(string); ok {
 			if user, err := models.FindUserByUsername(userName); err == nil {
 				models.IncrementRefreshTokenVersion(user.Username)
+				clearDeviceOfflineChapters(c, user.Username)
 			}
 		}
 	}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// WarmCaches prepares the images of the most popular mangas, so the first readers after a start don't wait on them.
+// Posters missing their cropped version are generated and the first chapter of each manga can have its pages listed
+// and extracted. Cached items are skipped and the work is spread over as many workers as cover downloads may run.
+func WarmCaches() {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+		return
+	}
+	if config.CacheWarmCount == 0 || (!config.CacheWarmPosters && !config.CacheWarmFirstChapters) {
+		return
+	}
+
+	mangas, err := models.GetAllMangas()
+	if err != nil {
+		log.Errorf("Failed to get mangas to warm: %v", err)
+		return
+	}
+	models.SortMangas(mangas, config.CacheWarmOrder, "desc")
+	if len(mangas) > config.CacheWarmCount {
+		mangas = mangas[:config.CacheWarmCount]
+	}
+
+	start := time.Now()
+	queue := make(chan models.Manga)
+	var wg sync.WaitGroup
+	for range max(config.CoverDownloadConcurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for manga := range queue {
+				if config.CacheWarmPosters {
+					posterPath(manga.CoverArtURL)
+				}
+				if config.CacheWarmFirstChapters {
+					warmFirstChapter(manga)
+				}
+			}
+		}()
+	}
+	for _, manga := range mangas {
+		queue <- manga
+	}
+	close(queue)
+	wg.Wait()
+	log.Infof("Warmed the caches of %d mangas in %s", len(mangas), time.Since(start))
+}
+
+// warmFirstChapter lists the pages of the first chapter of a manga and opens its first page, which extracts the
+// archive when archive pages are extracted
+func warmFirstChapter(manga models.Manga) {
+	chapters, err := models.GetChapters(manga.Slug)
+	if err != nil || len(chapters) == 0 {
+		return
+	}
+	chapterPath := filepath.Join(manga.Path, chapters[0].File)
+	images, err := utils.CachedChapterImages(chapterPath)
+	if err != nil || len(images) == 0 {
+		log.Debugf("Failed to warm the first chapter of '%s': %v", manga.Slug, err)
+		return
+	}
+	page, err := utils.OpenCachedChapterPage(chapterPath, images, 0)
+	if err != nil {
+		log.Debugf("Failed to warm the first chapter of '%s': %v", manga.Slug, err)
+		return
+	}
+	page.Close()
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleCleanup renders the page hiding the mangas matching a filter in bulk
+func HandleCleanup(c *fiber.Ctx) error {
+	libraries, err := models.GetLibraries()
+	if err != nil {
+		return handleError(c, err)
+	}
+	tags, err := models.GetAllTags()
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.Cleanup(libraries, tags))
+}
+
+// HandleCleanupPreview lists the mangas a bulk change would apply to without changing anything, the preview is
+// required before applying the change
+func HandleCleanupPreview(c *fiber.Ctx) error {
+	filter, action, err := parseCleanupRequest(c)
+	if err != nil {
+		return HandleView(c, views.CleanupResult(err.Error(), true))
+	}
+	mangas, err := models.FindMedia(filter)
+	if err != nil {
+		return HandleView(c, views.CleanupResult(err.Error(), true))
+	}
+	if len(mangas) == 0 {
+		return HandleView(c, views.CleanupResult("No mangas match the filter", true))
+	}
+	return HandleView(c, views.CleanupPreview(filter, action, mangas, models.MediaDigest(mangas)))
+}
+
+// HandleCleanupApply hides or unhides the mangas matching a filter in a single transaction, refusing when they
+// differ from the previewed ones
+func HandleCleanupApply(c *fiber.Ctx) error {
+	filter, action, err := parseCleanupRequest(c)
+	if err != nil {
+		return HandleView(c, views.CleanupResult(err.Error(), true))
+	}
+	mangas, err := models.FindMedia(filter)
+	if err != nil {
+		return HandleView(c, views.CleanupResult(err.Error(), true))
+	}
+	if c.FormValue("digest") == "" || c.FormValue("digest") != models.MediaDigest(mangas) {
+		return HandleView(c, views.CleanupResult("The matching mangas changed since the preview, preview the change again", true))
+	}
+
+	slugs := make([]string, len(mangas))
+	for i, manga := range mangas {
+		slugs[i] = manga.Slug
+	}
+	updated, err := models.SetMediaHidden(slugs, action == "hide")
+	if err != nil {
+		return HandleView(c, views.CleanupResult(err.Error(), true))
+	}
+	logActivity(c, "media_bulk_"+action, fmt.Sprintf("%s (%d of %d mangas)", filter, updated, len(mangas)))
+
+	return HandleView(c, views.CleanupResult(fmt.Sprintf("%d of %d matching mangas updated", updated, len(mangas)), false))
+}
+
+// parseCleanupRequest reads the filter and action of a bulk change, a filter matching everything may only unhide
+func parseCleanupRequest(c *fiber.Ctx) (models.MediaFilter, string, error) {
+	var filter models.MediaFilter
+	if err := c.BodyParser(&filter); err != nil {
+		return filter, "", err
+	}
+	action := c.FormValue("action")
+	if action != "hide" && action != "unhide" {
+		return filter, "", fmt.Errorf("invalid action: %s", action)
+	}
+	if action == "hide" && filter.Empty() {
+		return filter, "", fmt.Errorf("pick at least one filter, hiding every manga is not allowed")
+	}
+	return filter, action, nil
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"archive/zip"
 	"io"
 	"os"
 	"path/filepath"
@@ -9,9 +8,10 @@ import (
 	"strings"
 
 	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
 	"github.com/alexander-bruun/magi/views"
 	"github.com/gofiber/fiber/v2"
-	"github.com/nwaples/rardecode"
+	"github.com/gofiber/fiber/v2/log"
 )
 
 // ComicHandler processes requests to serve comic book pages based on the provided query parameters.
@@ -29,11 +29,21 @@ func ComicHandler(c *fiber.Ctx) error {
 		return HandleView(c, views.Error(err.Error()))
 	}
 
+	if err := checkMangaAccess(c, manga, true); err != nil {
+		return err
+	}
+
 	chapter, err := models.GetChapter(mangaSlug, chapterSlug)
 	if err != nil {
 		return HandleView(c, views.Error(err.Error()))
 	}
 
+	return sendChapterPage(c, manga, chapter, chapterPage)
+}
+
+// sendChapterPage serves a page of a chapter whose access was already checked, chapters made of a single image are
+// sent as is
+func sendChapterPage(c *fiber.Ctx, manga *models.Manga, chapter *models.Chapter, chapterPage string) error {
 	filePath := filepath.Join(manga.Path, chapter.File)
 
 	fileInfo, err := os.Stat(filePath)
@@ -42,107 +52,56 @@ func ComicHandler(c *fiber.Ctx) error {
 	}
 
 	lowerFileName := strings.ToLower(fileInfo.Name())
-
-	// Serve the file based on its extension
-	switch {
-	case strings.HasSuffix(lowerFileName, ".jpg"), strings.HasSuffix(lowerFileName, ".png"):
-		return c.SendFile(filePath)
-	case strings.HasSuffix(lowerFileName, ".cbr"), strings.HasSuffix(lowerFileName, ".rar"):
-		return serveComicBookArchiveFromRAR(c, filePath)
-	case strings.HasSuffix(lowerFileName, ".cbz"), strings.HasSuffix(lowerFileName, ".zip"):
-		return serveComicBookArchiveFromZIP(c, filePath)
-	default:
-		return HandleView(c, views.Error("Unsupported file type"))
-	}
-}
-
-// serveComicBookArchiveFromRAR handles serving images from a RAR archive.
-func serveComicBookArchiveFromRAR(c *fiber.Ctx, filePath string) error {
-	pageStr := c.Query("page")
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		return c.Status(fiber.StatusBadRequest).SendString("Invalid page number")
-	}
-
-	rarFile, err := os.Open(filePath)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Failed to open RAR file")
-	}
-	defer rarFile.Close()
-
-	rarReader, err := rardecode.NewReader(rarFile, "")
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Failed to create RAR reader")
-	}
-
-	currentPage := 0
-	for {
-		header, err := rarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to read archive entry")
-		}
-
-		if !header.IsDir && (strings.HasSuffix(strings.ToLower(header.Name), ".jpg") || strings.HasSuffix(strings.ToLower(header.Name), ".png")) {
-			currentPage++
-			if currentPage == page {
-				contentType := getContentType(header.Name)
-				c.Set("Content-Type", contentType)
-
-				if _, err := io.Copy(c.Response().BodyWriter(), rarReader); err != nil {
-					return c.Status(fiber.StatusInternalServerError).SendString("Failed to write image to response")
-				}
-				return nil
+	if !fileInfo.IsDir() && (strings.HasSuffix(lowerFileName, ".jpg") || strings.HasSuffix(lowerFileName, ".png")) {
+		if utils.NormalizeOrientation() && isJPEG(lowerFileName) {
+			file, err := os.Open(filePath)
+			if err != nil {
+				return HandleView(c, views.Error(err.Error()))
 			}
+			defer file.Close()
+			return sendNormalizedJPEG(c, file)
 		}
+		return c.SendFile(filePath)
 	}
 
-	return c.Status(fiber.StatusNotFound).SendString("Page not found in archive")
+	return serveChapterImage(c, filePath, manga.Slug, chapter.Slug, chapterPage)
 }
 
-// serveComicBookArchiveFromZIP handles serving images from a ZIP archive.
-func serveComicBookArchiveFromZIP(c *fiber.Ctx, filePath string) error {
-	pageStr := c.Query("page")
-	page, err := strconv.Atoi(pageStr)
+// serveChapterImage serves a page of a chapter archive or folder, pages are numbered in natural order of the file names.
+// A page that can't be read is recorded as an issue of its chapter for the admins.
+func serveChapterImage(c *fiber.Ctx, filePath, mangaSlug, chapterSlug, chapterPage string) error {
+	page, err := strconv.Atoi(chapterPage)
 	if err != nil || page < 1 {
 		return c.Status(fiber.StatusBadRequest).SendString("Invalid page number")
 	}
 
-	zipFile, err := os.Open(filePath)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Failed to open ZIP file")
+	if utils.ChapterFormatOf(filePath) == nil {
+		return HandleView(c, views.Error("Unsupported file type"))
 	}
-	defer zipFile.Close()
 
-	zipReader, err := zip.OpenReader(filePath)
+	images, err := utils.CachedChapterImages(filePath)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Failed to create ZIP reader")
-	}
-	defer zipReader.Close()
-
-	var imageFiles []*zip.File
-	for _, file := range zipReader.File {
-		if !file.FileInfo().IsDir() && (strings.HasSuffix(strings.ToLower(file.Name), ".jpg") || strings.HasSuffix(strings.ToLower(file.Name), ".png")) {
-			imageFiles = append(imageFiles, file)
-		}
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to read chapter")
 	}
-
-	if page > len(imageFiles) {
+	if page > len(images) {
 		return c.Status(fiber.StatusBadRequest).SendString("Page number out of range")
 	}
 
-	imageFile := imageFiles[page-1]
-	contentType := getContentType(imageFile.Name)
-	c.Set("Content-Type", contentType)
-
-	rc, err := imageFile.Open()
+	rc, err := utils.OpenCachedChapterPage(filePath, images, page-1)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Failed to read image from archive")
+		issue := utils.PageIssue{Page: page, Name: images[page-1], Error: err.Error()}
+		if err := models.RecordPageIssue(mangaSlug, chapterSlug, issue); err != nil {
+			log.Errorf("Failed to record page issue of '%s' - '%s': %v", mangaSlug, chapterSlug, err)
+		}
+		return c.Status(fiber.StatusUnprocessableEntity).SendString("This page could not be read")
 	}
 	defer rc.Close()
 
+	if utils.NormalizeOrientation() && isJPEG(images[page-1]) {
+		return sendNormalizedJPEG(c, rc)
+	}
+
+	c.Set("Content-Type", getContentType(images[page-1]))
 	if _, err := io.Copy(c.Response().BodyWriter(), rc); err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString("Failed to write image to response")
 	}
@@ -150,10 +109,42 @@ func serveComicBookArchiveFromZIP(c *fiber.Ctx, filePath string) error {
 	return nil
 }
 
+// sendNormalizedJPEG sends a JPEG with its EXIF orientation applied and its metadata stripped, a JPEG that can't be
+// normalized is sent as is
+func sendNormalizedJPEG(c *fiber.Ctx, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to read image")
+	}
+	normalized, err := utils.NormalizeJPEG(data)
+	if err != nil {
+		log.Warnf("Failed to normalize JPEG, sending it as is: %v", err)
+		normalized = data
+	}
+
+	c.Set("Content-Type", "image/jpeg")
+	return c.Send(normalized)
+}
+
+func isJPEG(fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
 // getContentType determines the Content-Type header based on file extension.
 func getContentType(fileName string) string {
-	if strings.HasSuffix(strings.ToLower(fileName), ".png") {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".png":
 		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	case ".bmp":
+		return "image/bmp"
+	case ".tiff":
+		return "image/tiff"
+	default:
+		return "image/jpeg"
 	}
-	return "image/jpeg"
 }
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+const commentsPageSize = 10
+
+// HandleChapterComments renders a page of the comments of a chapter
+func HandleChapterComments(c *fiber.Ctx) error {
+	return renderChapterComments(c, "", false)
+}
+
+// HandleCreateChapterComment adds a comment, or a reply when a parent is given, to a chapter
+func HandleCreateChapterComment(c *fiber.Ctx) error {
+	mangaSlug := c.Params("manga")
+	chapterSlug := c.Params("chapter")
+
+	if _, err := models.GetChapter(mangaSlug, chapterSlug); err != nil {
+		return renderChapterComments(c, err.Error(), true)
+	}
+
+	parentID, _ := strconv.ParseUint(c.FormValue("parent_id"), 10, 64)
+	if _, err := models.CreateChapterComment(mangaSlug, chapterSlug, actorName(c), c.FormValue("body"), parentID); err != nil {
+		return renderChapterComments(c, err.Error(), true)
+	}
+
+	return renderChapterComments(c, "", false)
+}
+
+// HandleDeleteChapterComment removes a comment, allowed for its author and moderators
+func HandleDeleteChapterComment(c *fiber.Ctx) error {
+	mangaSlug := c.Params("manga")
+	chapterSlug := c.Params("chapter")
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return renderChapterComments(c, "Invalid comment", true)
+	}
+
+	comment, err := models.GetChapterComment(mangaSlug, chapterSlug, id)
+	if err != nil {
+		return renderChapterComments(c, err.Error(), true)
+	}
+
+	user, err := getCurrentUser(c)
+	if err != nil || user == nil {
+		return renderChapterComments(c, "You must be logged in to delete comments", true)
+	}
+	if comment.Username != user.Username && !canModerate(user) {
+		return renderChapterComments(c, "You can only delete your own comments", true)
+	}
+
+	if err := models.DeleteChapterComment(mangaSlug, chapterSlug, id); err != nil {
+		return renderChapterComments(c, err.Error(), true)
+	}
+	if comment.Username != user.Username {
+		logActivity(c, "comment_delete", comment.Username)
+	}
+
+	return renderChapterComments(c, "", false)
+}
+
+// renderChapterComments renders the comments section of a chapter, respecting the access rules of the manga
+func renderChapterComments(c *fiber.Ctx, message string, failed bool) error {
+	mangaSlug := c.Params("manga")
+	chapterSlug := c.Params("chapter")
+
+	manga, err := models.GetManga(mangaSlug)
+	if err != nil {
+		return handleError(c, err)
+	}
+	if err := checkMangaAccess(c, manga, true); err != nil {
+		return handleAccessError(c, err)
+	}
+
+	page := getPageNumber(c.FormValue("page"))
+	threads, total, err := models.GetChapterComments(mangaSlug, chapterSlug, page, commentsPageSize)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	user, _ := getCurrentUser(c)
+	viewer := views.CommentViewer{}
+	if user != nil {
+		viewer.Username = user.Username
+		viewer.CanModerate = canModerate(user)
+	}
+
+	return HandleView(c, views.ChapterComments(mangaSlug, chapterSlug, threads, total, page, commentsPageSize, viewer, message, failed))
+}
+
+func canModerate(user *models.User) bool {
+	return roleHierarchy[user.Role] >= roleHierarchy["moderator"]
+}
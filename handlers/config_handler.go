@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alexander-bruun/magi/indexer"
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+func HandleConfig(c *fiber.Ctx) error {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.Config(config, configLibraries(), defaultCoverPath() != "", models.CompactionScheduled()))
+}
+
+func HandleUpdateConfig(c *fiber.Ctx) error {
+	var config models.AppConfig
+	if err := c.BodyParser(&config); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	if err := models.UpdateAppConfig(&config); err != nil {
+		return HandleView(c, views.ConfigForm(config, configLibraries(), err.Error(), true))
+	}
+	logActivity(c, "config_update", "app_config")
+
+	return HandleView(c, views.ConfigForm(config, configLibraries(), "Configuration saved", false))
+}
+
+// configLibraries lists the libraries that can be picked as the default library
+func configLibraries() []models.Library {
+	libraries, err := models.GetLibraries()
+	if err != nil {
+		log.Errorf("Failed to get libraries: %v", err)
+	}
+	return libraries
+}
+
+// HandleIntegrityCheck verifies the consistency of the database, refusing to run while a library is being indexed
+func HandleIntegrityCheck(c *fiber.Ctx) error {
+	problems, err := models.CheckIntegrity()
+	if err != nil {
+		return HandleView(c, views.IntegrityCheckResult(nil, maintenanceErrorMessage(err), true))
+	}
+	logActivity(c, "integrity_check", "database")
+
+	if len(problems) > 0 {
+		return HandleView(c, views.IntegrityCheckResult(problems, fmt.Sprintf("%d problems found", len(problems)), true))
+	}
+	return HandleView(c, views.IntegrityCheckResult(nil, "No problems found", false))
+}
+
+// HandleScheduleCompaction compacts the database, the bbolt equivalent of a vacuum, the next time Magi starts. The
+// compaction reopens the database, so it can't run while the server is using it.
+func HandleScheduleCompaction(c *fiber.Ctx) error {
+	if err := models.ScheduleCompaction(); err != nil {
+		return HandleView(c, views.CompactionResult(maintenanceErrorMessage(err), true))
+	}
+	logActivity(c, "database_compaction", "database")
+	return HandleView(c, views.CompactionResult("Compaction scheduled, it runs the next time Magi starts", false))
+}
+
+// maintenanceErrorMessage explains why a maintenance task failed, maintenance waits for indexing to finish
+func maintenanceErrorMessage(err error) string {
+	if errors.Is(err, models.ErrIndexingInProgress) {
+		return "A library is being indexed, run the maintenance again once indexing has finished"
+	}
+	return err.Error()
+}
+
+// HandlePageCheck starts checking the pages of every chapter in the background
+func HandlePageCheck(c *fiber.Ctx) error {
+	if err := indexer.StartPageCheck(); err != nil {
+		return HandleView(c, views.PageCheckResult(nil, err.Error(), true))
+	}
+	logActivity(c, "page_check", "chapters")
+	return HandleView(c, views.PageCheckResult(nil, "Page check started, reload the list once it has finished", false))
+}
+
+// HandleChapterIssues lists the chapters with unreadable pages
+func HandleChapterIssues(c *fiber.Ctx) error {
+	issues, err := models.GetChapterIssues()
+	if err != nil {
+		return HandleView(c, views.PageCheckResult(nil, err.Error(), true))
+	}
+	return HandleView(c, views.PageCheckResult(issues, "", false))
+}
+
+// HandleChapterDuplicates lists the chapter numbers found in several files of a series
+func HandleChapterDuplicates(c *fiber.Ctx) error {
+	duplicates, err := models.GetChapterDuplicates()
+	if err != nil {
+		return HandleView(c, views.ChapterDuplicates(nil, err.Error(), true))
+	}
+	return HandleView(c, views.ChapterDuplicates(duplicates, "", false))
+}
+
+// HandleResolveChapterDuplicate keeps the file an admin picked out of the files of a duplicate chapter
+func HandleResolveChapterDuplicate(c *fiber.Ctx) error {
+	mangaSlug, number := c.Params("manga"), c.Params("number")
+	message := "Chapter kept"
+	failed := false
+	if err := indexer.ResolveChapterDuplicate(mangaSlug, number, c.FormValue("file")); err != nil {
+		message, failed = err.Error(), true
+	} else {
+		logActivity(c, "chapter_duplicate_resolve", fmt.Sprintf("%s/%s", mangaSlug, number))
+	}
+
+	duplicates, err := models.GetChapterDuplicates()
+	if err != nil {
+		return HandleView(c, views.ChapterDuplicates(nil, err.Error(), true))
+	}
+	return HandleView(c, views.ChapterDuplicates(duplicates, message, failed))
+}
+
+// HandleSchemaStatus returns the applied schema version and the migrations still pending
+func HandleSchemaStatus(c *fiber.Ctx) error {
+	current, pending, err := models.PendingMigrations()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"schema_version": current,
+		"latest_version": models.LatestSchemaVersion(),
+		"pending":        pending,
+	})
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/alexander-bruun/magi/models"
+)
+
+func TestMaintenanceErrorMessage(t *testing.T) {
+	indexing := fmt.Errorf("integrity check: %w", models.ErrIndexingInProgress)
+	if got, want := maintenanceErrorMessage(indexing), "A library is being indexed, run the maintenance again once indexing has finished"; got != want {
+		t.Errorf("got '%s', want '%s'", got, want)
+	}
+	if got := maintenanceErrorMessage(errors.New("disk full")); got != "disk full" {
+		t.Errorf("got '%s', want the error itself", got)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+// contentGateCookie remembers the age confirmation of an anonymous visitor for their browser session, logged in users
+// confirm on their account instead so an admin can reset it
+const contentGateCookie = "content_gate"
+
+// errContentGate is returned by checkMangaAccess while the age confirmation of a gated manga is missing
+var errContentGate = fiber.NewError(fiber.StatusForbidden, "confirm your age to view this content")
+
+// contentGateConfirmed reports whether the user, or the browser session of an anonymous visitor, confirmed their age
+func contentGateConfirmed(c *fiber.Ctx) bool {
+	if getUserName(c) == "" {
+		return c.Cookies(contentGateCookie) == "confirmed"
+	}
+	user, err := getCurrentUser(c)
+	return err == nil && user != nil && !user.ContentGateAt.IsZero()
+}
+
+// HandleContentGate renders the age confirmation for the page the visitor was trying to open
+func HandleContentGate(c *fiber.Ctx) error {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.ContentGate(config.ContentGateText, contentGateRedirect(c.Query("redirect"))))
+}
+
+// HandleConfirmContentGate records the age confirmation, for good when logged in and for the browser session
+// otherwise, then returns to the gated page
+func HandleConfirmContentGate(c *fiber.Ctx) error {
+	if userName := getUserName(c); userName != "" {
+		if err := models.ConfirmContentGate(userName); err != nil {
+			return handleError(c, err)
+		}
+	} else {
+		c.Cookie(&fiber.Cookie{
+			Name:     contentGateCookie,
+			Value:    "confirmed",
+			HTTPOnly: true,
+			SameSite: fiber.CookieSameSiteLaxMode,
+		})
+	}
+	return c.Redirect(contentGateRedirect(c.FormValue("redirect")), fiber.StatusSeeOther)
+}
+
+// contentGateRedirect keeps the return address on this site, anything else goes to the home page
+func contentGateRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
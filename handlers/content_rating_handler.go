@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleContentRatings renders the number of mangas and chapters per content rating of the catalog
+func HandleContentRatings(c *fiber.Ctx) error {
+	libraries, err := models.GetLibraries()
+	if err != nil {
+		return handleError(c, err)
+	}
+	breakdown, err := models.GetGlobalContentRatingBreakdown()
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.ContentRatings(libraries, breakdown))
+}
+
+// HandleContentRatingBreakdown renders the content rating counts of a library, or of every library without one
+func HandleContentRatingBreakdown(c *fiber.Ctx) error {
+	breakdown, err := models.GetContentRatingBreakdown(c.Query("library"))
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.ContentRatingBreakdown(breakdown))
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+const (
+	// revealedCoversCookie lists the mangas whose blurred cover was revealed during the browser session
+	revealedCoversCookie = "revealed_covers"
+	// maxRevealedCovers keeps the cookie small, the oldest reveals are forgotten first
+	maxRevealedCovers = 100
+)
+
+// coverBlurApplies reports whether the cover of a manga is blurred for the viewers who didn't reveal it
+func coverBlurApplies(manga *models.Manga) bool {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+		return false
+	}
+	return config.IsCoverBlurred(manga)
+}
+
+// coverBlurred reports whether the current request gets the blurred cover of a manga. Admins always see the covers,
+// others once they revealed it and only while they may view the manga.
+func coverBlurred(c *fiber.Ctx, manga *models.Manga) bool {
+	if !coverBlurApplies(manga) || isAdmin(c) {
+		return false
+	}
+	if !slices.Contains(revealedCovers(c), manga.Slug) {
+		return true
+	}
+	return checkMangaAccess(c, manga, false) != nil
+}
+
+// revealedCovers returns the slugs of the mangas whose cover was revealed during the browser session
+func revealedCovers(c *fiber.Ctx) []string {
+	value := c.Cookies(revealedCoversCookie)
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// HandleRevealCover shows the cover of a manga unblurred for the rest of the browser session
+func HandleRevealCover(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return handleError(c, err)
+	}
+	if err := checkMangaAccess(c, manga, false); err != nil {
+		return handleAccessError(c, err)
+	}
+
+	revealed := revealedCovers(c)
+	if !slices.Contains(revealed, manga.Slug) {
+		revealed = append(revealed, manga.Slug)
+		if len(revealed) > maxRevealedCovers {
+			revealed = revealed[len(revealed)-maxRevealedCovers:]
+		}
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     revealedCoversCookie,
+		Value:    strings.Join(revealed, ","),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	user, _ := getCurrentUser(c)
+	return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), user != nil && canModerate(user), false, "", false))
+}
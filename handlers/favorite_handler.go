@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleFavorites lists the favorites of the current user
+func HandleFavorites(c *fiber.Ctx) error {
+	favorites, err := models.GetFavoriteMangas(actorName(c), getContentRatingLimit(c))
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.Favorites(favorites))
+}
+
+// HandleFavoriteButton renders the favorite toggle of a manga for the current user
+func HandleFavoriteButton(c *fiber.Ctx) error {
+	favorite, err := models.IsFavorite(actorName(c), c.Params("manga"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	return HandleView(c, views.FavoriteButton(c.Params("manga"), favorite))
+}
+
+// HandleAddFavorite marks a manga as a favorite of the current user
+func HandleAddFavorite(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString("Manga not found")
+	}
+	if err := checkMangaAccess(c, manga, false); err != nil {
+		return err
+	}
+
+	if err := models.AddFavorite(actorName(c), manga.Slug); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	return HandleView(c, views.FavoriteButton(manga.Slug, true))
+}
+
+// HandleRemoveFavorite unmarks a manga as a favorite of the current user
+func HandleRemoveFavorite(c *fiber.Ctx) error {
+	if err := models.RemoveFavorite(actorName(c), c.Params("manga")); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	return HandleView(c, views.FavoriteButton(c.Params("manga"), false))
+}
+
+// HandleExportFavorites downloads the favorites of the current user as an OPML document
+func HandleExportFavorites(c *fiber.Ctx) error {
+	favorites, err := models.GetFavoriteMangas(actorName(c), "")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	outlines := make([]utils.OPMLOutline, 0, len(favorites))
+	for _, manga := range favorites {
+		outlines = append(outlines, utils.OPMLOutline{
+			Text:    manga.Name,
+			Title:   manga.Name,
+			Type:    "link",
+			HTMLURL: fmt.Sprintf("%s/mangas/%s", c.BaseURL(), manga.Slug),
+		})
+	}
+	document, err := utils.EncodeOPML(fmt.Sprintf("Favorites of %s", actorName(c)), outlines)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, "text/x-opml; charset=utf-8")
+	c.Attachment("magi-favorites.opml")
+	return c.Send(document)
+}
+
+// HandleImportFavorites adds the series of an uploaded OPML document that match a local manga to the favorites
+func HandleImportFavorites(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return HandleView(c, views.FavoritesImportResult(models.FavoriteImportResult{}, "No file was uploaded", true))
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return HandleView(c, views.FavoritesImportResult(models.FavoriteImportResult{}, err.Error(), true))
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return HandleView(c, views.FavoritesImportResult(models.FavoriteImportResult{}, err.Error(), true))
+	}
+	titles, err := utils.ParseOPMLTitles(data)
+	if err != nil {
+		return HandleView(c, views.FavoritesImportResult(models.FavoriteImportResult{}, err.Error(), true))
+	}
+
+	result, err := models.ImportFavorites(actorName(c), titles, getContentRatingLimit(c))
+	if err != nil {
+		return HandleView(c, views.FavoritesImportResult(models.FavoriteImportResult{}, err.Error(), true))
+	}
+	return HandleView(c, views.FavoritesImportResult(result, fmt.Sprintf("Imported %d of %d series", len(result.Added), len(titles)), false))
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleFeaturedMedia returns the featured mangas within their window, filtered like the rest of the listings
+func HandleFeaturedMedia(c *fiber.Ctx) error {
+	mangas, err := models.GetFeaturedMedia(getContentRatingLimit(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"mangas": mangas})
+}
+
+// HandleFeaturedForm renders the form placing a manga on the featured row
+func HandleFeaturedForm(c *fiber.Ctx) error {
+	return renderFeaturedForm(c, c.Params("manga"), "")
+}
+
+// HandleFeatureManga places a manga on the featured row at the given position, between the optional start and
+// end dates, both inclusive
+func HandleFeatureManga(c *fiber.Ctx) error {
+	slug := c.Params("manga")
+	order, err := strconv.Atoi(c.FormValue("order"))
+	if err != nil {
+		return renderFeaturedForm(c, slug, "Invalid featured order")
+	}
+	startsAt, err := featuredDate(c.FormValue("starts_at"), false)
+	if err != nil {
+		return renderFeaturedForm(c, slug, "Invalid start date")
+	}
+	endsAt, err := featuredDate(c.FormValue("ends_at"), true)
+	if err != nil {
+		return renderFeaturedForm(c, slug, "Invalid end date")
+	}
+
+	if err := models.SetFeaturedMedia(slug, order, startsAt, endsAt); err != nil {
+		return renderFeaturedForm(c, slug, err.Error())
+	}
+	logActivity(c, "manga_update", slug)
+	return renderFeaturedForm(c, slug, "Featured")
+}
+
+// HandleUnfeatureManga removes a manga from the featured row
+func HandleUnfeatureManga(c *fiber.Ctx) error {
+	slug := c.Params("manga")
+	if err := models.DeleteFeaturedMedia(slug); err != nil {
+		return renderFeaturedForm(c, slug, err.Error())
+	}
+	logActivity(c, "manga_update", slug)
+	return renderFeaturedForm(c, slug, "Removed from the featured row")
+}
+
+// renderFeaturedForm renders the featured form of a manga with its current entry and a message
+func renderFeaturedForm(c *fiber.Ctx, slug, message string) error {
+	entry, err := models.GetFeaturedEntry(slug)
+	return HandleView(c, views.FeaturedForm(slug, entry, err == nil, message))
+}
+
+// featuredDate parses a date of the featured window, an end date covers its whole day. An empty value leaves that
+// side of the window open.
+func featuredDate(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		date = date.AddDate(0, 0, 1)
+	}
+	return &date, nil
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/alexander-bruun/magi/models"
+)
+
+// setupTestDB opens a fresh database in a temporary directory for the duration of a test
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	if err := models.Initialize(t.TempDir()); err != nil {
+		t.Fatalf("failed to initialize the database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := models.Close(); err != nil {
+			t.Errorf("failed to close the database: %v", err)
+		}
+	})
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"github.com/alexander-bruun/magi/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// readiness is the state reported by the readiness probe
+type readiness struct {
+	Status         string `json:"status"`
+	CacheFreeBytes uint64 `json:"cache_free_bytes"`
+	CacheLowSpace  bool   `json:"cache_low_space"`
+}
+
+// HandleReadiness reports the instance ready along with the free disk space of the cache. A disk low on space doesn't
+// make the instance unready, cache writes are skipped and pages are read from the archives instead.
+func HandleReadiness(c *fiber.Ctx) error {
+	free, low, err := utils.CacheFreeSpace()
+	if err != nil {
+		log.Debugf("Failed to read the free disk space of the cache: %v", err)
+	}
+	return c.JSON(readiness{Status: "ok", CacheFreeBytes: free, CacheLowSpace: low})
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"net/url"
 
 	"github.com/a-h/templ"
 	"github.com/alexander-bruun/magi/models"
@@ -17,8 +18,13 @@ const (
 )
 
 func HandleView(c *fiber.Ctx, content templ.Component) error {
+	return HandleViewWithStatus(c, content, fiber.StatusOK)
+}
+
+// HandleViewWithStatus renders a view like HandleView, but responds with the given status code
+func HandleViewWithStatus(c *fiber.Ctx, content templ.Component, status int) error {
 	if c.Get(htmxRequestHeader) != "" {
-		return renderComponent(c, content)
+		return renderComponent(c, content, status)
 	}
 
 	userRole, err := getUserRole(c)
@@ -28,22 +34,51 @@ func HandleView(c *fiber.Ctx, content templ.Component) error {
 		log.Errorf("Error getting user role: %v", err)
 	}
 
-	base := views.Layout(content, userRole)
-	return renderComponent(c, base)
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Error getting app config: %v", err)
+	}
+
+	base := views.Layout(content, userRole, config.EnablePWA)
+	return renderComponent(c, base, status)
 }
 
 func HandleHome(c *fiber.Ctx) error {
-	recentlyAdded, err := getRecentMangas("created_at")
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+	// A default library that has since been deleted falls back to the home page
+	if config.DefaultLibrary != "" {
+		if _, err := models.GetLibrary(config.DefaultLibrary); err == nil {
+			return c.Redirect("/mangas?library=" + url.QueryEscape(config.DefaultLibrary))
+		}
+	}
+
+	featured, err := getFeaturedMangas(c)
 	if err != nil {
 		return handleError(c, err)
 	}
 
-	recentlyUpdated, err := getRecentMangas("updated_at")
+	recentlyAdded, err := getRecentMangas(c, "created_at")
 	if err != nil {
 		return handleError(c, err)
 	}
 
-	return HandleView(c, views.Home(recentlyAdded, recentlyUpdated))
+	recentlyUpdated, err := getRecentlyUpdatedMangas(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return HandleView(c, views.Home(featured, getRecentlyViewedMangas(c), recentlyAdded, recentlyUpdated, getUpdatesSummary(c)))
+}
+
+// HandleDismissUpdates clears the updates summary of the current user until new content arrives
+func HandleDismissUpdates(c *fiber.Ctx) error {
+	if err := models.DismissUpdates(actorName(c)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	return c.SendString("")
 }
 
 func HandleNotFound(c *fiber.Ctx) error {
@@ -52,38 +87,133 @@ func HandleNotFound(c *fiber.Ctx) error {
 
 // Helper functions
 
-func renderComponent(c *fiber.Ctx, component templ.Component) error {
-	handler := adaptor.HTTPHandler(templ.Handler(component))
+func renderComponent(c *fiber.Ctx, component templ.Component, status int) error {
+	handler := adaptor.HTTPHandler(templ.Handler(component, templ.WithStatus(status)))
 	return handler(c)
 }
 
 func getUserRole(c *fiber.Ctx) (string, error) {
+	user, err := getCurrentUser(c)
+	if err != nil || user == nil {
+		return "", err
+	}
+	return user.Role, nil
+}
+
+// getUserName returns the username of the logged in user, or an empty string for anonymous requests
+func getUserName(c *fiber.Ctx) string {
+	user, err := getCurrentUser(c)
+	if err != nil || user == nil {
+		return ""
+	}
+	return user.Username
+}
+
+// getCurrentUser resolves the user from the access token cookie, returning nil for anonymous requests
+func getCurrentUser(c *fiber.Ctx) (*models.User, error) {
 	accessToken := c.Cookies(accessTokenCookie)
 	if accessToken == "" {
-		return "", nil
+		return nil, nil
 	}
 
 	claims, err := models.ValidateToken(accessToken)
 	if err != nil || claims == nil {
-		return "", fmt.Errorf("invalid access token")
+		return nil, fmt.Errorf("invalid access token")
 	}
 
 	userName, ok := claims["user_name"].(string)
 	if !ok {
-		return "", fmt.Errorf("user_name not found in token claims")
+		return nil, fmt.Errorf("user_name not found in token claims")
 	}
 
 	user, err := models.FindUserByUsername(userName)
 	if err != nil {
-		return "", fmt.Errorf("failed to find user: %s", userName)
+		return nil, fmt.Errorf("failed to find user: %s", userName)
 	}
 
-	return user.Role, nil
+	return user, nil
+}
+
+func getRecentMangas(c *fiber.Ctx, sortBy string) ([]models.EnrichedManga, error) {
+	mangas, _, err := models.SearchMangas("", 1, 10, sortBy, "desc", "", "", getContentRatingLimit(c), hideEmptyMangas(c))
+	if err != nil {
+		return nil, err
+	}
+	return models.EnrichMangas(mangas, getUserName(c))
 }
 
-func getRecentMangas(sortBy string) ([]models.Manga, error) {
-	mangas, _, err := models.SearchMangas("", 1, 10, sortBy, "desc", "", "")
-	return mangas, err
+// getFeaturedMangas lists the hand-curated featured mangas within their window
+func getFeaturedMangas(c *fiber.Ctx) ([]models.EnrichedManga, error) {
+	mangas, err := models.GetFeaturedMedia(getContentRatingLimit(c))
+	if err != nil {
+		return nil, err
+	}
+	return models.EnrichMangas(mangas, getUserName(c))
+}
+
+// getRecentlyUpdatedMangas lists the mangas with the most recently indexed chapters
+func getRecentlyUpdatedMangas(c *fiber.Ctx) ([]models.EnrichedManga, error) {
+	mangas, err := models.GetRecentlyUpdatedMangas(10, getContentRatingLimit(c))
+	if err != nil {
+		return nil, err
+	}
+	return models.EnrichMangas(mangas, getUserName(c))
+}
+
+// getRecentlyViewedMangas lists the series pages the current user visited last, anonymous users have none
+func getRecentlyViewedMangas(c *fiber.Ctx) []models.EnrichedManga {
+	userName := getUserName(c)
+	if userName == "" {
+		return nil
+	}
+
+	mangas, err := models.GetRecentlyViewed(userName, 10, getContentRatingLimit(c))
+	if err != nil {
+		log.Errorf("Failed to get recently viewed series of '%s': %v", userName, err)
+		return nil
+	}
+	enriched, err := models.EnrichMangas(mangas, userName)
+	if err != nil {
+		log.Errorf("Failed to enrich recently viewed series of '%s': %v", userName, err)
+		return nil
+	}
+	return enriched
+}
+
+// getUpdatesSummary records the visit of the current user and summarizes what was added since the previous one,
+// anonymous users get no summary
+func getUpdatesSummary(c *fiber.Ctx) *models.UpdatesSummary {
+	userName := getUserName(c)
+	if userName == "" {
+		return nil
+	}
+
+	if err := models.RecordVisit(userName, false); err != nil {
+		log.Errorf("Failed to record visit of '%s': %v", userName, err)
+	}
+	summary, err := models.GetUpdatesSince(userName, getContentRatingLimit(c))
+	if err != nil {
+		log.Errorf("Failed to get updates of '%s': %v", userName, err)
+		return nil
+	}
+	return &summary
+}
+
+// actorName returns the username set by the auth middleware
+func actorName(c *fiber.Ctx) string {
+	userName, _ := c.Locals("user_name").(string)
+	return userName
+}
+
+// logActivity records an activity log entry for an action of the current user
+func logActivity(c *fiber.Ctx, activityType, target string) {
+	logActivityAs(actorName(c), activityType, target)
+}
+
+func logActivityAs(actor, activityType, target string) {
+	if err := models.LogActivity(actor, activityType, target); err != nil {
+		log.Errorf("Failed to log activity '%s' on '%s': %v", activityType, target, err)
+	}
 }
 
 func handleError(c *fiber.Ctx, err error) error {
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 
+	"github.com/alexander-bruun/magi/indexer"
 	"github.com/alexander-bruun/magi/models"
 	"github.com/alexander-bruun/magi/views"
 	"github.com/gofiber/fiber/v2"
@@ -41,6 +44,7 @@ func HandleCreateLibrary(c *fiber.Ctx) error {
 	if err := models.CreateLibrary(library); err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 	}
+	logActivity(c, "library_create", library.Name)
 
 	libraries, err := models.GetLibraries()
 	if err != nil {
@@ -56,6 +60,33 @@ func HandleCreateLibrary(c *fiber.Ctx) error {
 	return c.SendString(tableContent)
 }
 
+// HandleLibraryPreview walks the folders of a library form the way the indexer would and lists the series it would
+// find, without indexing them. The metadata provider is only asked when the matches field is set, clients accepting
+// JSON get the preview as JSON.
+func HandleLibraryPreview(c *fiber.Ctx) error {
+	var library models.Library
+	if err := c.BodyParser(&library); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	library.Folders = slices.DeleteFunc(library.Folders, func(folder string) bool { return strings.TrimSpace(folder) == "" })
+
+	err := library.ValidateIndexSettings()
+	var preview indexer.ScanPreview
+	if err == nil {
+		preview, err = indexer.PreviewLibrary(library, c.FormValue("matches") == "true")
+	}
+	if c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return c.JSON(preview)
+	}
+	if err != nil {
+		return HandleView(c, views.LibraryScanPreview(preview, err.Error()))
+	}
+	return HandleView(c, views.LibraryScanPreview(preview, ""))
+}
+
 func HandleDeleteLibrary(c *fiber.Ctx) error {
 	slug := c.Params("slug")
 	if slug == "" {
@@ -65,6 +96,7 @@ func HandleDeleteLibrary(c *fiber.Ctx) error {
 	if err := models.DeleteLibrary(slug); err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 	}
+	logActivity(c, "library_delete", slug)
 
 	libraries, err := models.GetLibraries()
 	if err != nil {
@@ -91,6 +123,7 @@ func HandleUpdateLibrary(c *fiber.Ctx) error {
 	if err := models.UpdateLibrary(&library); err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 	}
+	logActivity(c, "library_update", library.Slug)
 
 	libraries, err := models.GetLibraries()
 	if err != nil {
@@ -106,6 +139,17 @@ func HandleUpdateLibrary(c *fiber.Ctx) error {
 	return c.SendString(tableContent)
 }
 
+// HandleRelocateLibrary moves a folder of a library to a new path, keeping the indexed series under it
+func HandleRelocateLibrary(c *fiber.Ctx) error {
+	slug := c.Params("slug")
+	relocated, err := models.RelocateLibrary(slug, c.FormValue("old_folder"), c.FormValue("new_folder"))
+	if err != nil {
+		return HandleView(c, views.RelocateLibraryResult(err.Error(), true))
+	}
+	logActivity(c, "library_relocate", slug)
+	return HandleView(c, views.RelocateLibraryResult(fmt.Sprintf("Relocated %d series", relocated), false))
+}
+
 func HandleEditLibrary(c *fiber.Ctx) error {
 	slug := c.Params("slug")
 	if slug == "" {
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/alexander-bruun/magi/utils"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// logStreamDefaultReplay is the number of recent lines sent on connect when the client doesn't ask for a number
+	logStreamDefaultReplay = 100
+	// logStreamWriteTimeout disconnects clients that stop reading, their lines are dropped in the meantime
+	logStreamWriteTimeout = 10 * time.Second
+	// logStreamPingInterval is how often the connection is checked, a client missing two pings is disconnected
+	logStreamPingInterval = 30 * time.Second
+)
+
+// logStreamDropped tells a client that lines were dropped because it fell behind
+type logStreamDropped struct {
+	Dropped int64 `json:"dropped"`
+}
+
+// HandleLogStreamUpgrade checks the filters of a log stream before the connection switches to a WebSocket. The
+// level query keeps the lines at or above a level, channel keeps the lines of a channel such as indexer_<library>
+// and replay is the number of recent lines sent first.
+func HandleLogStreamUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	level := c.Query("level")
+	if level != "" && !utils.IsLogLevel(level) {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid log level: "+level)
+	}
+	replay := logStreamDefaultReplay
+	if value := c.Query("replay"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid replay count: "+value)
+		}
+		replay = min(count, utils.LogReplaySize)
+	}
+
+	c.Locals("log_filter", utils.LogFilter{Level: level, Channel: c.Query("channel")})
+	c.Locals("log_replay", replay)
+	return c.Next()
+}
+
+// HandleLogStream sends the recent and then the new log lines matching the filters, one JSON message per line
+func HandleLogStream(conn *websocket.Conn) {
+	filter, _ := conn.Locals("log_filter").(utils.LogFilter)
+	replay, _ := conn.Locals("log_replay").(int)
+	recent, subscription := utils.SubscribeLogs(filter, replay)
+	defer utils.UnsubscribeLogs(subscription)
+
+	// Clients only send control frames, reading them answers the pings and notices when the client goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadDeadline(time.Now().Add(2 * logStreamPingInterval))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * logStreamPingInterval))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(message any) bool {
+		conn.SetWriteDeadline(time.Now().Add(logStreamWriteTimeout))
+		return conn.WriteJSON(message) == nil
+	}
+	for _, entry := range recent {
+		if !send(entry) {
+			return
+		}
+	}
+
+	ping := time.NewTicker(logStreamPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case entry, ok := <-subscription.Entries:
+			if !ok {
+				return
+			}
+			if dropped := subscription.Dropped(); dropped > 0 && !send(logStreamDropped{Dropped: dropped}) {
+				return
+			}
+			if !send(entry) {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(logStreamWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// mangaCovers returns the additional covers of a manga shown in its cover carousel, none when they can't be read
+func mangaCovers(slug string) []models.MangaCover {
+	covers, err := models.GetMangaCovers(slug)
+	if err != nil {
+		log.Errorf("Failed to get the covers of '%s': %s", slug, err)
+	}
+	return covers
+}
+
+// HandleAddMangaCover adds an image fetched from a URL to the cover carousel of a manga
+func HandleAddMangaCover(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+
+	coverURL, err := url.Parse(strings.TrimSpace(c.FormValue("url")))
+	if err != nil || (coverURL.Scheme != "http" && coverURL.Scheme != "https") || coverURL.Hostname() == "" {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), "Enter an http or https URL", true))
+	}
+	if !config.IsCoverURLHostAllowed(coverURL.Hostname()) {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), fmt.Sprintf("Covers can't be fetched from %s", coverURL.Hostname()), true))
+	}
+
+	// The cached file is named after the URL, so adding the same image twice keeps a single cover
+	hash := fnv.New64a()
+	hash.Write([]byte(coverURL.String()))
+	fileName := fmt.Sprintf("%s_cover-%x.jpg", manga.Slug, hash.Sum64())
+	maxBytes := int64(config.UploadBodyLimitMB) * 1024 * 1024
+	if err := utils.DownloadExternalImage(cachePath, fileName, coverURL.String(), maxBytes); err != nil {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), err.Error(), true))
+	}
+
+	// Lazy posters only keep the original, the carousel serves the cropped image straight from the cache
+	coverArtURL := fmt.Sprintf("http://localhost:3000/api/images/%s", fileName)
+	posterPath(coverArtURL)
+	if err := models.AddMangaCover(manga.Slug, coverArtURL, ""); err != nil {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), err.Error(), true))
+	}
+	logActivity(c, "manga_cover_update", manga.Slug)
+	return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), "Cover added", false))
+}
+
+// HandleRemoveMangaCover removes a cover from the cover carousel of a manga
+func HandleRemoveMangaCover(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := models.RemoveMangaCover(manga.Slug, c.Query("url")); err != nil {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), "Cover not found", true))
+	}
+	logActivity(c, "manga_cover_update", manga.Slug)
+	return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), "Cover removed", false))
+}
+
+// HandleMoveMangaCover moves a cover of the cover carousel of a manga to a position, counted from 1
+func HandleMoveMangaCover(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	covers := mangaCovers(manga.Slug)
+	order := make([]string, 0, len(covers))
+	for _, cover := range covers {
+		order = append(order, cover.URL)
+	}
+	from := slices.Index(order, c.FormValue("url"))
+	to, err := strconv.Atoi(c.FormValue("position"))
+	if from == -1 || err != nil || to < 1 || to > len(order) {
+		return HandleView(c, views.MangaCover(*manga, covers, true, coverBlurred(c, manga), "Invalid cover position", true))
+	}
+
+	moved := order[from]
+	order = slices.Insert(slices.Delete(order, from, from+1), to-1, moved)
+	if err := models.ReorderMangaCovers(manga.Slug, order); err != nil {
+		return HandleView(c, views.MangaCover(*manga, covers, true, coverBlurred(c, manga), err.Error(), true))
+	}
+	logActivity(c, "manga_cover_update", manga.Slug)
+	return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), "", false))
+}
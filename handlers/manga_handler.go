@@ -3,28 +3,123 @@ package handlers
 import (
 	"fmt"
 	"net/url"
+	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/alexander-bruun/magi/models"
 	"github.com/alexander-bruun/magi/utils"
 	"github.com/alexander-bruun/magi/views"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
 )
 
 const (
-	defaultPage     = 1
-	defaultPageSize = 16
-	searchPageSize  = 10
+	defaultPage    = 1
+	searchPageSize = 10
+
+	// maxChapterSearchResults caps the ?limit= of a chapter search
+	maxChapterSearchResults = 50
 )
 
 func HandleMangas(c *fiber.Ctx) error {
 	page := getPageNumber(c.Query("page"))
-	mangas, count, err := models.SearchMangas("", page, defaultPageSize, "name", "asc", "", "")
+	userName := getUserName(c)
+	preferences, overrides := getListingPreferences(c, userName)
+
+	mangas, count, err := models.SearchMangas("", page, preferences.PageSize, preferences.SortBy, preferences.SortOrder, "", listingLibrary(c), getContentRatingLimit(c), hideEmptyMangas(c))
 	if err != nil {
 		return handleError(c, err)
 	}
-	return HandleView(c, views.Mangas(mangas, int(count), page))
+	enriched, err := models.EnrichMangas(mangas, userName)
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.Mangas(enriched, int(count), page, preferences, overrides))
+}
+
+// getListingPreferences returns the listing preferences of the user, overridden by valid query parameters,
+// along with the overrides so they can be kept while paginating
+func getListingPreferences(c *fiber.Ctx, userName string) (models.UserPreferences, string) {
+	preferences, err := models.GetUserPreferences(userName)
+	if err != nil {
+		log.Errorf("Failed to get preferences for '%s': %s", userName, err)
+	}
+
+	overrides := url.Values{}
+	requested := preferences
+	if sortBy := c.Query("sort_by"); sortBy != "" {
+		requested.SortBy = sortBy
+		overrides.Set("sort_by", sortBy)
+	}
+	if sortOrder := c.Query("sort_order"); sortOrder != "" {
+		requested.SortOrder = sortOrder
+		overrides.Set("sort_order", sortOrder)
+	}
+	if pageSize := c.QueryInt("page_size"); pageSize != 0 {
+		requested.PageSize = pageSize
+		overrides.Set("page_size", strconv.Itoa(pageSize))
+	}
+	if view := c.Query("view"); view != "" {
+		requested.View = view
+		overrides.Set("view", view)
+	}
+	if library := listingLibrary(c); library != "" {
+		overrides.Set("library", library)
+	}
+
+	if err := requested.Validate(); err != nil {
+		return preferences, ""
+	}
+	return requested, overrides.Encode()
+}
+
+// chapterListOrder resolves the order of the chapter list of a manga, the ?chapter_order= override coming before the
+// preference of the user and the default of the library
+func chapterListOrder(c *fiber.Ctx, manga *models.Manga, preferences models.UserPreferences) string {
+	libraryOrder := ""
+	if library, err := models.GetLibrary(manga.LibrarySlug); err == nil {
+		libraryOrder = library.ChapterOrder
+	}
+	return models.EffectiveChapterOrder(c.Query("chapter_order"), preferences.ChapterOrder, libraryOrder)
+}
+
+// listingLibrary returns the library the listing is limited to, ignoring libraries that don't exist
+func listingLibrary(c *fiber.Ctx) string {
+	library := c.Query("library")
+	if library == "" {
+		return ""
+	}
+	if _, err := models.GetLibrary(library); err != nil {
+		return ""
+	}
+	return library
+}
+
+const similarMangasLimit = 5
+
+// recordMediaView counts a view of a manga page, the session is the user or else the client IP and user agent, so a
+// reload doesn't count again. The page is also added to the recently viewed series of the user. Bots matching the
+// configured user agents are neither counted nor recorded.
+func recordMediaView(c *fiber.Ctx, slug string) {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if models.IsBotUserAgent(userAgent, config.ViewBotUserAgents) {
+		return
+	}
+
+	session := getUserName(c)
+	if session == "" {
+		session = clientIP(c) + "|" + userAgent
+	} else if err := models.RecordMediaVisit(session, slug); err != nil {
+		log.Errorf("Failed to record visit of '%s' to '%s': %v", session, slug, err)
+	}
+	models.IncrementMediaView(slug, session)
 }
 
 func HandleManga(c *fiber.Ctx) error {
@@ -33,11 +128,66 @@ func HandleManga(c *fiber.Ctx) error {
 	if err != nil {
 		return handleError(c, err)
 	}
-	chapters, err := models.GetChapters(slug)
+	if err := checkMangaAccess(c, manga, false); err != nil {
+		return handleAccessError(c, err)
+	}
+	recordMediaView(c, manga.Slug)
+	user, _ := getCurrentUser(c)
+	preferences, listQuery := getListingPreferences(c, getUserName(c))
+	chapterOrder := chapterListOrder(c, manga, preferences)
+	chapters, err := models.GetChaptersInOrder(slug, chapterOrder)
+	if err != nil {
+		return handleError(c, err)
+	}
+	similar, err := models.GetSimilarMangas(slug, similarMangasLimit, getContentRatingLimit(c))
+	if err != nil {
+		log.Errorf("Failed to get similar mangas for '%s': %s", slug, err)
+	}
+	readChapters, err := models.GetReadChapterSlugs(getUserName(c), slug)
+	if err != nil {
+		log.Errorf("Failed to get read chapters of '%s': %s", slug, err)
+	}
+
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+	accentColor := ""
+	if config.TintMangaPages {
+		accentColor = manga.Accent()
+	}
+	return HandleView(c, views.Manga(*manga, chapters, similar, user != nil && canModerate(user), user != nil && user.Role == "admin", user != nil, listQuery, accentColor, readChapters, preferences.HideReadChapters, chapterOrder, mangaCovers(slug), coverBlurred(c, manga)))
+}
+
+// HandleCommunityPosition renders the chapter most readers of a manga are on, nothing when too few readers share one.
+// Clients accepting JSON get the position as JSON.
+func HandleCommunityPosition(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return handleError(c, err)
+	}
+	if err := checkMangaAccess(c, manga, false); err != nil {
+		return handleAccessError(c, err)
+	}
+
+	position, err := models.GetCommunityReadingPosition(manga.Slug)
+	if err != nil {
+		return handleError(c, err)
+	}
+	if c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+		return c.JSON(fiber.Map{"position": position})
+	}
+	return HandleView(c, views.CommunityPosition(manga.Slug, position))
+}
+
+// HandleMangaNeighbors renders links to the previous and next manga of the listing the user came from
+func HandleMangaNeighbors(c *fiber.Ctx) error {
+	preferences, listQuery := getListingPreferences(c, getUserName(c))
+	prev, next, err := models.GetAdjacentMangas(c.Params("manga"), listingLibrary(c), preferences.SortBy, preferences.SortOrder, getContentRatingLimit(c), hideEmptyMangas(c))
 	if err != nil {
 		return handleError(c, err)
 	}
-	return HandleView(c, views.Manga(*manga, chapters))
+	return HandleView(c, views.MangaNeighbors(prev, next, listQuery))
 }
 
 func HandleChapter(c *fiber.Ctx) error {
@@ -48,6 +198,9 @@ func HandleChapter(c *fiber.Ctx) error {
 	if err != nil {
 		return handleError(c, err)
 	}
+	if err := checkMangaAccess(c, manga, true); err != nil {
+		return handleAccessError(c, err)
+	}
 
 	chapter, err := models.GetChapter(mangaSlug, chapterSlug)
 	if err != nil {
@@ -64,7 +217,308 @@ func HandleChapter(c *fiber.Ctx) error {
 		return handleError(c, err)
 	}
 
-	return HandleView(c, views.Chapter(prevSlug, chapter.Slug, nextSlug, *manga, images, *chapter, chapters))
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %s", err)
+	}
+
+	// Other policies leave marking the chapter as read to the reader
+	markRead := ""
+	if userName := getUserName(c); userName != "" {
+		markRead = config.MarkReadPolicy
+		if markRead == models.MarkReadOnOpen {
+			if err := models.MarkChapterRead(userName, mangaSlug, chapter.Slug); err != nil {
+				log.Errorf("Failed to mark chapter '%s' as read for '%s': %s", chapter.Slug, userName, err)
+			}
+		}
+	}
+
+	readerPreferences, err := models.GetReaderPreferences(getUserName(c))
+	if err != nil {
+		log.Errorf("Failed to get reader preferences: %s", err)
+	}
+
+	// Pages found unreadable by a page check are flagged instead of requested
+	var badPages map[int]bool
+	if issue, err := models.GetChapterIssue(mangaSlug, chapter.Slug); err == nil {
+		badPages = issue.BadPages()
+	}
+
+	return HandleView(c, views.Chapter(prevSlug, chapter.Slug, nextSlug, *manga, images, *chapter, chapters, models.ResolveReadingMode(*manga), readerPreferences, badPages, markRead, config.MarkReadDwellSeconds))
+}
+
+// chapterPagesResponse lists the pages of a chapter along with the hints to lay them out
+type chapterPagesResponse struct {
+	Layout string `json:"layout"`
+	// Direction is the order of the pages within a group, rtl for mangas read right to left
+	Direction string `json:"direction"`
+	// Continuous stacks the pages without gaps fitted to the width, for vertically scrolling webtoons
+	Continuous bool     `json:"continuous"`
+	Pages      []string `json:"pages"`
+	Groups     [][]int  `json:"groups"`
+	// Reader holds the fit and spacing preferences of the user, the defaults for anonymous users
+	Reader models.ReaderPreferences `json:"reader"`
+	// Controls are the key and tap bindings of the user for the reading mode of the manga
+	Controls models.ReaderControls `json:"controls"`
+}
+
+// HandleChapterPages returns the page URLs of a chapter grouped for the ?layout= of the reader, single by default
+func HandleChapterPages(c *fiber.Ctx) error {
+	layout := c.Query("layout", models.PageLayoutSingle)
+	if !slices.Contains(models.PageLayouts, layout) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("invalid layout: %s", layout)})
+	}
+
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Manga not found"})
+	}
+	if err := checkMangaAccess(c, manga, true); err != nil {
+		return handleAccessErrorJSON(c, err)
+	}
+	chapter, err := models.GetChapter(manga.Slug, c.Params("chapter"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Chapter not found"})
+	}
+
+	pages, err := getChapterImages(manga, chapter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	readerPreferences, err := models.GetReaderPreferences(getUserName(c))
+	if err != nil {
+		log.Errorf("Failed to get reader preferences: %s", err)
+	}
+	readingMode := models.ResolveReadingMode(*manga)
+	direction := models.ReadingModeLTR
+	if readingMode == models.ReadingModeRTL {
+		direction = models.ReadingModeRTL
+	}
+	return c.JSON(chapterPagesResponse{
+		Layout:     layout,
+		Direction:  direction,
+		Continuous: layout == models.PageLayoutVertical,
+		Pages:      pages,
+		Groups:     models.PageGroups(len(pages), layout),
+		Reader:     readerPreferences,
+		Controls:   readerPreferences.Controls(readingMode),
+	})
+}
+
+// chapterManifestPage is a page of a chapter along with the size of its image
+type chapterManifestPage struct {
+	Page int    `json:"page"`
+	URL  string `json:"url"`
+	Size int64  `json:"size"`
+}
+
+// chapterManifestResponse lists every page of a chapter, so a client caching it for offline reading knows up front
+// what it is about to fetch
+type chapterManifestResponse struct {
+	PageCount int                   `json:"page_count"`
+	TotalSize int64                 `json:"total_size"`
+	Pages     []chapterManifestPage `json:"pages"`
+}
+
+// HandleChapterManifest lists the URL and size of every page of a chapter in a single response. Sizes are those of the
+// images stored in the chapter, a page sent with its orientation normalized can differ slightly.
+func HandleChapterManifest(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Manga not found"})
+	}
+	if err := checkMangaAccess(c, manga, true); err != nil {
+		return handleAccessErrorJSON(c, err)
+	}
+	chapter, err := models.GetChapter(manga.Slug, c.Params("chapter"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Chapter not found"})
+	}
+
+	filePath := filepath.Join(manga.Path, chapter.File)
+	var images []string
+	var sizes map[string]int64
+	if utils.ChapterFormatOf(filePath) == nil {
+		// Chapters made of a single image are their only page
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		images, sizes = []string{info.Name()}, map[string]int64{info.Name(): info.Size()}
+	} else {
+		if images, err = utils.CachedChapterImages(filePath); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if sizes, err = utils.ChapterImageSizes(filePath); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	manifest := chapterManifestResponse{PageCount: len(images), Pages: make([]chapterManifestPage, 0, len(images))}
+	for i, image := range images {
+		manifest.Pages = append(manifest.Pages, chapterManifestPage{
+			Page: i + 1,
+			URL:  fmt.Sprintf("/api/comic?manga=%s&chapter=%s&page=%d", manga.Slug, chapter.Slug, i+1),
+			Size: sizes[image],
+		})
+		manifest.TotalSize += sizes[image]
+	}
+	return c.JSON(manifest)
+}
+
+// chapterPageResponse points at a single page of a chapter
+type chapterPageResponse struct {
+	Page      int    `json:"page"`
+	PageCount int    `json:"page_count"`
+	URL       string `json:"url"`
+}
+
+// HandleChapterPage resolves a single page of a chapter so links and bookmarks can target it without listing the whole
+// chapter, answering with the page URL or redirecting to the image with ?redirect=true. Pages are served to anyone
+// passing the access checks of the manga, so the URL is all a client needs.
+func HandleChapterPage(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Manga not found"})
+	}
+	if err := checkMangaAccess(c, manga, true); err != nil {
+		return handleAccessErrorJSON(c, err)
+	}
+	chapter, err := models.GetChapter(manga.Slug, c.Params("chapter"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Chapter not found"})
+	}
+
+	pages, err := getChapterImages(manga, chapter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	page, err := strconv.Atoi(c.Params("page"))
+	if err != nil || page < 1 || page > len(pages) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("page must be between 1 and %d", len(pages))})
+	}
+
+	if c.QueryBool("redirect") {
+		return c.Redirect(pages[page-1])
+	}
+	return c.JSON(chapterPageResponse{Page: page, PageCount: len(pages), URL: pages[page-1]})
+}
+
+// chapterSearchResult is a chapter the reader can jump to
+type chapterSearchResult struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// HandleChapterSearch finds the chapters of a manga matching ?q=, a chapter number such as 10.5, a range such as
+// 120-121 or a fragment of the chapter names. Number queries return the closest chapters first.
+func HandleChapterSearch(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Manga not found"})
+	}
+	if err := checkMangaAccess(c, manga, false); err != nil {
+		return handleAccessErrorJSON(c, err)
+	}
+	limit := c.QueryInt("limit", searchPageSize)
+	if limit < 1 || limit > maxChapterSearchResults {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("limit must be between 1 and %d", maxChapterSearchResults)})
+	}
+
+	chapters, err := models.SearchChapters(manga.Slug, c.Query("q"), limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	results := make([]chapterSearchResult, 0, len(chapters))
+	for _, chapter := range chapters {
+		results = append(results, chapterSearchResult{
+			Slug: chapter.Slug,
+			Name: chapter.Name,
+			URL:  fmt.Sprintf("/mangas/%s/%s", manga.Slug, chapter.Slug),
+		})
+	}
+	return c.JSON(results)
+}
+
+// HandleMangaReadingMode overrides the reading mode of a manga, an empty mode restores the type default
+func HandleMangaReadingMode(c *fiber.Ctx) error {
+	slug := c.Params("manga")
+	if err := models.SetMediaReadingMode(slug, c.FormValue("reading_mode")); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	logActivity(c, "manga_update", slug)
+	return c.SendString("Saved")
+}
+
+// HandleMangaAliases replaces the alternative titles of a manga, one per line
+func HandleMangaAliases(c *fiber.Ctx) error {
+	slug := c.Params("manga")
+	if err := models.SetMangaAliases(slug, strings.Split(c.FormValue("aliases"), "\n")); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	logActivity(c, "manga_update", slug)
+	return c.SendString("Saved")
+}
+
+// HandleMangaPin pins a manga to the top of its library listing at the given position
+func HandleMangaPin(c *fiber.Ctx) error {
+	slug := c.Params("manga")
+	order, err := strconv.Atoi(c.FormValue("pin_order"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid pin order")
+	}
+	if err := models.SetMangaPin(slug, order); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	logActivity(c, "manga_update", slug)
+	return c.SendString("Pinned")
+}
+
+// HandleMangaUnpin returns a pinned manga to its place in the library listing
+func HandleMangaUnpin(c *fiber.Ctx) error {
+	slug := c.Params("manga")
+	if err := models.ClearMangaPin(slug); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	logActivity(c, "manga_update", slug)
+	return c.SendString("Unpinned")
+}
+
+// HandleMarkChapterRead marks a chapter as read once the reader reports it was finished or dwelled on
+func HandleMarkChapterRead(c *fiber.Ctx) error {
+	mangaSlug := c.Params("manga")
+	chapter, err := models.GetChapter(mangaSlug, c.Params("chapter"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+
+	if err := models.MarkChapterRead(actorName(c), mangaSlug, chapter.Slug); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// HandleMarkReadUpTo marks the chapter and all earlier chapters as read for the logged in user
+func HandleMarkReadUpTo(c *fiber.Ctx) error {
+	mangaSlug := c.Params("manga")
+	chapterSlug := c.Params("chapter")
+
+	if err := models.MarkReadUpTo(actorName(c), mangaSlug, chapterSlug); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	return c.SendString("Marked as read up to here")
+}
+
+// HandleMarkUnreadFrom marks the chapter and all later chapters as unread for the logged in user
+func HandleMarkUnreadFrom(c *fiber.Ctx) error {
+	mangaSlug := c.Params("manga")
+	chapterSlug := c.Params("chapter")
+
+	if err := models.MarkUnreadFrom(actorName(c), mangaSlug, chapterSlug); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	return c.SendString("Marked as unread from here")
 }
 
 func HandleUpdateMetadataManga(c *fiber.Ctx) error {
@@ -90,50 +544,82 @@ func HandleEditMetadataManga(c *fiber.Ctx) error {
 	if err != nil {
 		return handleError(c, err)
 	}
-
-	mangaDetail, err := models.GetMangadexManga(mangadexID)
-	if err != nil {
+	if err := applyMangadexMetadata(existingManga, mangadexID); err != nil {
 		return handleError(c, err)
 	}
+	logActivity(c, "manga_update", existingManga.Slug)
 
-	coverArtURL, err := extractCoverArtURL(mangaDetail, mangadexID)
+	redirectURL := fmt.Sprintf("/mangas/%s", existingManga.Slug)
+	c.Set("HX-Redirect", redirectURL)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// applyMangadexMetadata replaces the metadata of a manga with a MangaDex entry, which also settles a pending
+// metadata review
+func applyMangadexMetadata(existingManga *models.Manga, mangadexID string) error {
+	mangaDetail, err := models.GetMangadexManga(mangadexID)
 	if err != nil {
-		return handleError(c, err)
+		return err
 	}
 
-	cachedImageURL, err := cacheAndGetImageURL(existingManga.Slug, coverArtURL)
-	if err != nil {
-		return handleError(c, err)
+	// An uploaded cover is locked, so only the remaining metadata is replaced
+	cachedImageURL := existingManga.CoverArtURL
+	if !existingManga.CoverLocked {
+		coverArtURL, err := extractCoverArtURL(mangaDetail, mangadexID)
+		if err != nil {
+			return err
+		}
+
+		cachedImageURL, err = cacheAndGetImageURL(existingManga.Slug, coverArtURL)
+		if err != nil {
+			return err
+		}
+		existingManga.AccentColor = utils.CoverAccentColor(cachePath, cachedImageURL)
 	}
 
 	updateMangaDetails(existingManga, mangaDetail, cachedImageURL)
 
 	if err := models.UpdateManga(existingManga); err != nil {
-		return handleError(c, err)
+		return err
 	}
-
-	redirectURL := fmt.Sprintf("/mangas/%s", existingManga.Slug)
-	c.Set("HX-Redirect", redirectURL)
-	return c.SendStatus(fiber.StatusOK)
+	return models.DeleteMetadataReview(existingManga.Slug)
 }
 
 func HandleMangaSearch(c *fiber.Ctx) error {
 	searchParam := c.Query("search")
 
+	config, err := models.GetAppConfig()
+	if err != nil {
+		return handleError(c, err)
+	}
+	if config.DisableSearchForAnonymous && getUserName(c) == "" {
+		return HandleView(c, views.SearchRequiresLogin())
+	}
+
 	if searchParam == "" {
 		return HandleView(c, views.OneDoesNotSimplySearch())
 	}
 
-	mangas, _, err := models.SearchMangas(searchParam, defaultPage, searchPageSize, "name", "desc", "", "")
+	// Search results keep their relevance order
+	mangas, _, err := models.SearchMangas(searchParam, defaultPage, searchPageSize, "", "", "", "", getContentRatingLimit(c), hideEmptyMangas(c))
 	if err != nil {
 		return handleError(c, err)
 	}
 
+	// Highlights are opt-in so plain searches don't pay for them
+	var highlights map[string]models.SearchHighlight
+	if c.QueryBool("highlight") {
+		highlights = models.HighlightSearchResults(searchParam, mangas)
+	}
+	if c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+		return c.JSON(fiber.Map{"mangas": mangas, "highlights": highlights})
+	}
+
 	if len(mangas) == 0 {
 		return HandleView(c, views.NoResultsSearch())
 	}
 
-	return HandleView(c, views.SearchMangas(mangas))
+	return HandleView(c, views.SearchMangas(mangas, highlights))
 }
 
 // Helper functions
@@ -161,13 +647,17 @@ func getMangaAndChapters(mangaSlug string) (*models.Manga, []models.Chapter, err
 }
 
 func getChapterImages(manga *models.Manga, chapter *models.Chapter) ([]string, error) {
-	chapterFilePath := filepath.Join(manga.Path, chapter.File)
-	pageCount, err := utils.CountImageFiles(chapterFilePath)
-	if err != nil {
-		return nil, err
+	pageCount := chapter.PageCount
+	if pageCount <= 0 {
+		// Fall back to probing the archive for chapters indexed without a page count
+		var err error
+		pageCount, err = utils.CountImageFiles(filepath.Join(manga.Path, chapter.File))
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	images := make([]string, pageCount-1)
+	images := make([]string, pageCount)
 	for i := range images {
 		images[i] = fmt.Sprintf("/api/comic?manga=%s&chapter=%s&page=%d", manga.Slug, chapter.Slug, i+1)
 	}
@@ -197,7 +687,7 @@ func cacheAndGetImageURL(slug, coverArtURL string) (string, error) {
 	filename := filepath.Base(u.Path)
 	fileExt := filepath.Ext(filename)[1:] // remove leading dot
 
-	err = utils.DownloadImage("/home/alexa/magi/cache", slug, coverArtURL)
+	err = utils.DownloadImage(cachePath, slug, coverArtURL)
 	if err != nil {
 		return "", fmt.Errorf("error downloading image: %w", err)
 	}
@@ -211,6 +701,10 @@ func updateMangaDetails(manga *models.Manga, mangaDetail *models.MangaDetail, co
 	manga.Year = mangaDetail.Attributes.Year
 	manga.OriginalLanguage = mangaDetail.Attributes.OriginalLanguage
 	manga.Status = mangaDetail.Attributes.Status
-	manga.ContentRating = mangaDetail.Attributes.ContentRating
+	models.ApplyProviderContentRating(manga, models.MetadataProviderMangaDex, mangaDetail.Attributes.ContentRating)
+	manga.Tags = mangaDetail.TagNames()
+	manga.Aliases = mangaDetail.AliasNames(manga.Name)
+	manga.Type = mangaDetail.MangaType()
 	manga.CoverArtURL = coverArtURL
+	models.ApplyInferredContentRating(manga)
 }
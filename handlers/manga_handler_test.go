@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestChapterAPIsAnswerAccessErrorsAsJSON(t *testing.T) {
+	setupTestDB(t)
+	config := models.DefaultAppConfig()
+	config.AnonymousContentRatingLimit = "safe"
+	if err := models.UpdateAppConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateManga(models.Manga{Name: "Mature", ContentRating: "erotica"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateChapter(models.Chapter{Name: "Chapter 1", MangaSlug: "mature"}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Get("/api/chapters/:manga/:chapter/pages", HandleChapterPages)
+	app.Get("/api/chapters/:manga/:chapter/pages/:page", HandleChapterPage)
+	app.Get("/api/chapters/:manga/search", HandleChapterSearch)
+	app.Get("/api/chapters/:manga/:chapter/manifest", HandleChapterManifest)
+
+	for _, path := range []string{
+		"/api/chapters/mature/chapter-1/pages",
+		"/api/chapters/mature/chapter-1/pages/1",
+		"/api/chapters/mature/search?q=1",
+		"/api/chapters/mature/chapter-1/manifest",
+	} {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Errorf("%s: the body isn't JSON: %v", path, err)
+		}
+		if resp.StatusCode != fiber.StatusUnauthorized || body.Error != "you must be logged in to view this manga" {
+			t.Errorf("%s: got %d '%s', want %d with the access error", path, resp.StatusCode, body.Error, fiber.StatusUnauthorized)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"slices"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleMetadataReviews renders the mangas whose MangaDex match wasn't confident enough, with their best candidates
+func HandleMetadataReviews(c *fiber.Ctx) error {
+	reviews, err := models.GetMetadataReviews()
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.MetadataReviewsPage(reviews))
+}
+
+// HandleConfirmMetadataReview uses one of the reviewed candidates as the metadata of a manga
+func HandleConfirmMetadataReview(c *fiber.Ctx) error {
+	slug := c.Params("slug")
+	review, err := models.GetMetadataReview(slug)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+	candidateID := c.FormValue("id")
+	if !slices.ContainsFunc(review.Candidates, func(candidate models.MetadataCandidate) bool { return candidate.ID == candidateID }) {
+		return c.Status(fiber.StatusBadRequest).SendString("unknown candidate")
+	}
+
+	manga, err := models.GetManga(slug)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+	if err := applyMangadexMetadata(manga, candidateID); err != nil {
+		return c.Status(fiber.StatusBadGateway).SendString(err.Error())
+	}
+	logActivity(c, "metadata_review_confirm", slug)
+
+	return renderMetadataReviews(c)
+}
+
+// HandleDismissMetadataReview keeps the local metadata of a manga and removes it from the review queue
+func HandleDismissMetadataReview(c *fiber.Ctx) error {
+	slug := c.Params("slug")
+	if _, err := models.GetMetadataReview(slug); err != nil {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+	if err := models.DeleteMetadataReview(slug); err != nil {
+		return handleError(c, err)
+	}
+	logActivity(c, "metadata_review_dismiss", slug)
+
+	return renderMetadataReviews(c)
+}
+
+func renderMetadataReviews(c *fiber.Ctx) error {
+	reviews, err := models.GetMetadataReviews()
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.MetadataReviews(reviews))
+}
@@ -1,15 +1,24 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
 )
 
 const (
-	accessTokenDuration  = 15 * time.Minute
-	refreshTokenDuration = 7 * 24 * time.Hour
+	accessTokenDuration = 15 * time.Minute
 )
 
 var roleHierarchy = map[string]int{
@@ -18,6 +27,159 @@ var roleHierarchy = map[string]int{
 	"admin":     3,
 }
 
+// uploadRoutes accept file uploads, so they are held to the upload limit instead of the form limit
+var uploadRoutes = map[string]bool{
+	"/config/default-cover": true,
+	"/favorites/import":     true,
+}
+
+// isUploadRoute reports whether a path accepts file uploads, including the cover upload of every manga
+func isUploadRoute(path string) bool {
+	return uploadRoutes[path] || (strings.HasPrefix(path, "/mangas/") && strings.HasSuffix(path, "/cover"))
+}
+
+// BodyLimitMiddleware rejects request bodies larger than the configured limit of the route with a 413. The server
+// streams request bodies, so an announced size over the limit is rejected before anything is read, and other bodies
+// are read up to the limit before the handlers get them.
+func BodyLimitMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		length := c.Request().Header.ContentLength()
+		if length == 0 {
+			return c.Next()
+		}
+
+		config := models.GetRequestSettings().Config
+		limit, label := config.FormBodyLimitKB*1024, fmt.Sprintf("%d KB", config.FormBodyLimitKB)
+		if isUploadRoute(c.Path()) {
+			limit, label = config.UploadBodyLimitMB*1024*1024, fmt.Sprintf("%d MB", config.UploadBodyLimitMB)
+		}
+		tooLarge := func() error {
+			// The rest of the body is never read, so the connection can't serve another request
+			c.Context().SetConnectionClose()
+			return c.Status(fiber.StatusRequestEntityTooLarge).SendString(fmt.Sprintf("Request body too large, the limit for this page is %s", label))
+		}
+		if length > limit {
+			return tooLarge()
+		}
+
+		// Chunked bodies don't announce their size, they are cut off once they go over the limit
+		if stream := c.Request().BodyStream(); stream != nil {
+			body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Failed to read the request body")
+			}
+			if len(body) > limit {
+				return tooLarge()
+			}
+			c.Request().SetBody(body)
+		}
+		return c.Next()
+	}
+}
+
+// ClientIPMiddleware resolves the IP of the client, reading the configured header only when the peer is a trusted proxy
+func ClientIPMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		settings := models.GetRequestSettings()
+		header := settings.Config.ClientIPHeader
+		c.Locals("client_ip", resolveClientIP(c.Context().RemoteIP(), c.Get(header), header, settings.TrustedProxies))
+		return c.Next()
+	}
+}
+
+// clientIP returns the IP resolved by ClientIPMiddleware, falling back to the IP of the peer
+func clientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals("client_ip").(string); ok && ip != "" {
+		return ip
+	}
+	return c.Context().RemoteIP().String()
+}
+
+// resolveClientIP walks the forwarded addresses from the nearest hop, skipping trusted proxies, so a client
+// can't spoof its IP by sending the header itself
+func resolveClientIP(peer net.IP, headerValue, header string, trusted []*net.IPNet) string {
+	if headerValue == "" || !models.InNetworks(peer, trusted) {
+		return peer.String()
+	}
+
+	if header == models.ClientIPHeaderRealIP {
+		if ip := net.ParseIP(strings.TrimSpace(headerValue)); ip != nil {
+			return ip.String()
+		}
+		return peer.String()
+	}
+
+	hops := strings.Split(headerValue, ",")
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !models.InNetworks(ip, trusted) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// rateLimitWindow counts the requests of every client IP within the current minute
+type rateLimitWindow struct {
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int
+}
+
+var rateLimits = rateLimitWindow{counts: make(map[string]int)}
+
+// allow counts a request of a client and reports whether it is still within the limit of the current minute
+func (w *rateLimitWindow) allow(client string, limit int, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if now.Sub(w.start) >= time.Minute {
+		w.start = now
+		clear(w.counts)
+	}
+	w.counts[client]++
+	return w.counts[client] <= limit
+}
+
+// rateLimitExemptPaths are the prefixes of the static files and page images, a reader opening a chapter requests every
+// page and asset of it so these don't count towards the limit
+var rateLimitExemptPaths = []string{"/api/comic", "/api/images/", "/api/posters/", "/assets/"}
+
+// RateLimitMiddleware answers with a 429 once a client IP exceeds the configured requests per minute,
+// exempt paths, networks and keys are checked first so readers and internal clients are never throttled
+func RateLimitMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		settings := models.GetRequestSettings()
+		if settings.Config.RateLimitPerMinute == 0 || isRateLimitExempt(c, settings) {
+			return c.Next()
+		}
+
+		if !rateLimits.allow(clientIP(c), settings.Config.RateLimitPerMinute, time.Now()) {
+			c.Set(fiber.HeaderRetryAfter, "60")
+			return c.Status(fiber.StatusTooManyRequests).SendString("Too many requests, please try again later")
+		}
+		return c.Next()
+	}
+}
+
+// isRateLimitExempt reports whether the request is for an exempt path, carries an exempt key or comes from an exempt
+// network
+func isRateLimitExempt(c *fiber.Ctx, settings *models.RequestSettings) bool {
+	path := c.Path()
+	if slices.ContainsFunc(rateLimitExemptPaths, func(prefix string) bool { return strings.HasPrefix(path, prefix) }) {
+		return true
+	}
+	if settings.Config.IsRateLimitExemptKey(c.Get(models.RateLimitKeyHeader)) {
+		return true
+	}
+	return models.InNetworks(net.ParseIP(clientIP(c)), settings.RateLimitExemptions)
+}
+
 // AuthMiddleware handles token validation and refreshing
 func AuthMiddleware(requiredRole string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -55,17 +217,17 @@ func validateAccessToken(c *fiber.Ctx, accessToken, requiredRole string) error {
 }
 
 func refreshAndValidateTokens(c *fiber.Ctx, refreshToken, requiredRole string) error {
-	newAccessToken, userName, err := models.RefreshAccessToken(refreshToken)
+	newAccessToken, userName, session, err := models.RefreshAccessToken(refreshToken)
 	if err != nil || newAccessToken == "" {
 		return fiber.ErrUnauthorized
 	}
 
-	newRefreshToken, err := models.GenerateNewRefreshToken(userName)
+	newRefreshToken, err := models.GenerateNewRefreshToken(userName, session)
 	if err != nil {
 		return fiber.ErrInternalServerError
 	}
 
-	setAuthCookies(c, newAccessToken, newRefreshToken)
+	setAuthCookies(c, newAccessToken, newRefreshToken, session)
 
 	return validateUserRole(c, userName, requiredRole)
 }
@@ -102,7 +264,7 @@ func clearAuthCookies(c *fiber.Ctx) {
 	})
 }
 
-func setAuthCookies(c *fiber.Ctx, accessToken, refreshToken string) {
+func setAuthCookies(c *fiber.Ctx, accessToken, refreshToken string, session models.Session) {
 	c.Cookie(&fiber.Cookie{
 		Name:    "access_token",
 		Value:   accessToken,
@@ -111,6 +273,94 @@ func setAuthCookies(c *fiber.Ctx, accessToken, refreshToken string) {
 	c.Cookie(&fiber.Cookie{
 		Name:    "refresh_token",
 		Value:   refreshToken,
-		Expires: time.Now().Add(refreshTokenDuration),
+		Expires: models.RefreshTokenExpiry(session),
 	})
 }
+
+// getContentRatingLimit returns the content rating limit that applies to the current request
+func getContentRatingLimit(c *fiber.Ctx) string {
+	limit := ""
+	if getUserName(c) == "" {
+		config, err := models.GetAppConfig()
+		if err != nil {
+			log.Errorf("Failed to get app config: %v", err)
+		}
+		limit = config.AnonymousContentRatingLimit
+	}
+	return models.EffectiveContentRatingLimit(limit)
+}
+
+// hideEmptyMangas reports whether mangas without chapters should be left out of the listings, admins always see them
+func hideEmptyMangas(c *fiber.Ctx) bool {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+	return config.HideEmptyMangas && !isAdmin(c)
+}
+
+// checkMangaAccess enforces the safe mode, hidden manga, anonymous browsing and content gate restrictions for a manga,
+// reading includes chapter pages
+func checkMangaAccess(c *fiber.Ctx, manga *models.Manga, reading bool) error {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		return err
+	}
+
+	if !models.IsContentRatingAllowed(manga.ContentRating, config.SafeModeMaxRating) {
+		return fiber.NewError(fiber.StatusNotFound, "this manga is not available on this instance")
+	}
+	if manga.Hidden && !isAdmin(c) {
+		return fiber.NewError(fiber.StatusNotFound, "this manga is not available on this instance")
+	}
+
+	if getUserName(c) == "" {
+		if reading && config.RequireAuthToRead {
+			return fiber.NewError(fiber.StatusUnauthorized, "you must be logged in to read")
+		}
+		if !models.IsContentRatingAllowed(manga.ContentRating, config.AnonymousContentRatingLimit) {
+			return fiber.NewError(fiber.StatusUnauthorized, "you must be logged in to view this manga")
+		}
+	}
+
+	if config.IsContentGated(manga.ContentRating) && !contentGateConfirmed(c) {
+		return errContentGate
+	}
+	return nil
+}
+
+// handleAccessError responds with the status of an access error, sending HTMX requests to the login page on a 401
+// and showing the age confirmation when the content gate applies
+func handleAccessError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errContentGate) {
+		if c.Get(htmxRequestHeader) != "" {
+			c.Set("HX-Redirect", "/content-gate?redirect="+url.QueryEscape(c.OriginalURL()))
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+		config, configErr := models.GetAppConfig()
+		if configErr != nil {
+			return handleError(c, configErr)
+		}
+		return HandleViewWithStatus(c, views.ContentGate(config.ContentGateText, c.OriginalURL()), fiber.StatusForbidden)
+	}
+
+	status := accessErrorStatus(err)
+	if status == fiber.StatusUnauthorized && c.Get(htmxRequestHeader) != "" {
+		c.Set("HX-Redirect", "/login")
+	}
+	return HandleViewWithStatus(c, views.Error(err.Error()), status)
+}
+
+// handleAccessErrorJSON responds to an API request with the status of an access error and its message as JSON
+func handleAccessErrorJSON(c *fiber.Ctx, err error) error {
+	return c.Status(accessErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+}
+
+// accessErrorStatus returns the status of an access error, a 500 for errors that aren't about access
+func accessErrorStatus(err error) int {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
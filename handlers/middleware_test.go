@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := models.ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := net.ParseIP("10.0.0.2")
+	stranger := net.ParseIP("203.0.113.7")
+
+	for _, test := range []struct {
+		name        string
+		peer        net.IP
+		headerValue string
+		header      string
+		want        string
+	}{
+		{"no header", proxy, "", models.ClientIPHeaderForwardedFor, "10.0.0.2"},
+		{"forwarded by a trusted proxy", proxy, "198.51.100.4", models.ClientIPHeaderForwardedFor, "198.51.100.4"},
+		{"real ip from a trusted proxy", proxy, " 198.51.100.4 ", models.ClientIPHeaderRealIP, "198.51.100.4"},
+		{"invalid real ip", proxy, "localhost", models.ClientIPHeaderRealIP, "10.0.0.2"},
+		{"chain of trusted proxies", proxy, "198.51.100.4, 192.168.1.1, 10.0.0.3", models.ClientIPHeaderForwardedFor, "198.51.100.4"},
+
+		// Spoofing attempts
+		{"forwarded from an untrusted peer", stranger, "127.0.0.1", models.ClientIPHeaderForwardedFor, "203.0.113.7"},
+		{"real ip from an untrusted peer", stranger, "127.0.0.1", models.ClientIPHeaderRealIP, "203.0.113.7"},
+		{"spoofed hop before the client", proxy, "127.0.0.1, 198.51.100.4", models.ClientIPHeaderForwardedFor, "198.51.100.4"},
+		{"garbage hop before the client", proxy, "not-an-ip, 198.51.100.4", models.ClientIPHeaderForwardedFor, "198.51.100.4"},
+		{"garbage nearest hop", proxy, "198.51.100.4, not-an-ip", models.ClientIPHeaderForwardedFor, "10.0.0.2"},
+	} {
+		if got := resolveClientIP(test.peer, test.headerValue, test.header, trusted); got != test.want {
+			t.Errorf("%s: got '%s', want '%s'", test.name, got, test.want)
+		}
+	}
+}
+
+func TestResolveClientIPWithoutTrustedProxies(t *testing.T) {
+	peer := net.ParseIP("127.0.0.1")
+	if got := resolveClientIP(peer, "198.51.100.4", models.ClientIPHeaderForwardedFor, nil); got != "127.0.0.1" {
+		t.Errorf("got '%s', want the peer when no proxy is trusted", got)
+	}
+}
+
+func TestRateLimitWindow(t *testing.T) {
+	window := rateLimitWindow{counts: make(map[string]int)}
+	now := time.Now()
+	for i := range 3 {
+		if got, want := window.allow("client", 2, now), i < 2; got != want {
+			t.Errorf("request %d allowed = %v, want %v", i+1, got, want)
+		}
+	}
+	if !window.allow("other", 2, now) {
+		t.Error("another client was limited by the requests of the first one")
+	}
+	if !window.allow("client", 2, now.Add(time.Minute)) {
+		t.Error("the client was still limited in the next minute")
+	}
+}
+
+func TestRateLimitMiddlewareExemptions(t *testing.T) {
+	setupTestDB(t)
+	config := models.DefaultAppConfig()
+	config.RateLimitPerMinute = 2
+	config.RateLimitExemptKeys = "warmer-key\nmonitoring-key"
+	config.RateLimitExemptNetworks = "10.0.0.0/8"
+	// The peer of test requests is 0.0.0.0, trusting it lets the requests pick their client IP
+	config.TrustedProxies = "0.0.0.0"
+	config.ClientIPHeader = models.ClientIPHeaderForwardedFor
+	if err := models.UpdateAppConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	rateLimits.mu.Lock()
+	rateLimits.start = time.Now()
+	clear(rateLimits.counts)
+	rateLimits.mu.Unlock()
+
+	app := fiber.New()
+	app.Use(ClientIPMiddleware(), RateLimitMiddleware())
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	status := func(ip, key string) int {
+		t.Helper()
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, ip)
+		if key != "" {
+			req.Header.Set(models.RateLimitKeyHeader, key)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	for i := range 5 {
+		if got := status("198.51.100.1", "monitoring-key"); got != fiber.StatusOK {
+			t.Errorf("request %d with an exempt key got %d, want %d", i+1, got, fiber.StatusOK)
+		}
+		if got := status("10.1.2.3", ""); got != fiber.StatusOK {
+			t.Errorf("request %d from an exempt network got %d, want %d", i+1, got, fiber.StatusOK)
+		}
+	}
+
+	// Other clients are still constrained, the exempt requests didn't count towards their limit
+	for i, want := range []int{fiber.StatusOK, fiber.StatusOK, fiber.StatusTooManyRequests} {
+		if got := status("198.51.100.1", ""); got != want {
+			t.Errorf("request %d without a key got %d, want %d", i+1, got, want)
+		}
+	}
+	if got := status("198.51.100.1", "wrong-key"); got != fiber.StatusTooManyRequests {
+		t.Errorf("request with an unknown key got %d, want %d", got, fiber.StatusTooManyRequests)
+	}
+	if got := status("198.51.100.1", "warmer-key"); got != fiber.StatusOK {
+		t.Errorf("limited client with an exempt key got %d, want %d", got, fiber.StatusOK)
+	}
+}
+
+func TestRateLimitMiddlewareDoesNotThrottleReading(t *testing.T) {
+	setupTestDB(t)
+	config := models.DefaultAppConfig()
+	config.RateLimitPerMinute = 30
+	if err := models.UpdateAppConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	rateLimits.mu.Lock()
+	rateLimits.start = time.Now()
+	clear(rateLimits.counts)
+	rateLimits.mu.Unlock()
+
+	app := fiber.New()
+	app.Use(ClientIPMiddleware(), RateLimitMiddleware())
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	app.Get("/api/chapters/:manga/:chapter/pages", ok)
+	app.Get("/api/comic", ok)
+	app.Get("/api/posters/:slug", ok)
+	app.Static("/assets/", t.TempDir())
+	status := func(path string) int {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	// Opening a long chapter lists its pages once, then loads every page image along with the assets of the reader
+	if got := status("/api/chapters/series/chapter-1/pages"); got != fiber.StatusOK {
+		t.Fatalf("listing the pages got %d, want %d", got, fiber.StatusOK)
+	}
+	for page := range 200 {
+		if got := status(fmt.Sprintf("/api/comic?manga=series&chapter=chapter-1&page=%d", page+1)); got == fiber.StatusTooManyRequests {
+			t.Fatalf("page %d of the chapter was throttled", page+1)
+		}
+	}
+	for _, path := range []string{"/api/posters/series", "/assets/css/styles.css"} {
+		if got := status(path); got == fiber.StatusTooManyRequests {
+			t.Errorf("%s was throttled", path)
+		}
+	}
+
+	// The pages didn't use up the limit of the other requests, which still applies
+	for i := range 29 {
+		if got := status("/api/chapters/series/chapter-1/pages"); got != fiber.StatusOK {
+			t.Fatalf("request %d got %d, want %d", i+2, got, fiber.StatusOK)
+		}
+	}
+	if got := status("/api/chapters/series/chapter-1/pages"); got != fiber.StatusTooManyRequests {
+		t.Errorf("the request over the limit got %d, want %d", got, fiber.StatusTooManyRequests)
+	}
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	setupTestDB(t)
+	config := models.DefaultAppConfig()
+	config.FormBodyLimitKB = 1
+	config.UploadBodyLimitMB = 11
+	if err := models.UpdateAppConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server settings of main
+	app := fiber.New(fiber.Config{
+		BodyLimit:                    models.MaxFormBodyLimitKB * 1024,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	})
+	app.Use(BodyLimitMiddleware())
+	size := func(c *fiber.Ctx) error { return c.SendString(strconv.Itoa(len(c.Body()))) }
+	app.Post("/account/profile", size)
+	app.Post("/favorites/import", size)
+	send := func(path string, body io.Reader) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(fiber.MethodPost, path, body)
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		if req.ContentLength < 0 {
+			req.TransferEncoding = []string{"chunked"}
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		text, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(text)
+	}
+	// The reader hides its size, so the request is sent without a length
+	chunked := func(size int) io.Reader { return io.MultiReader(bytes.NewReader(make([]byte, size))) }
+
+	for _, test := range []struct {
+		name  string
+		path  string
+		body  io.Reader
+		limit string
+	}{
+		{"form", "/account/profile", bytes.NewReader(make([]byte, 2048)), "1 KB"},
+		{"chunked form", "/account/profile", chunked(2048), "1 KB"},
+		{"upload", "/favorites/import", bytes.NewReader(make([]byte, 11*1024*1024+1)), "11 MB"},
+	} {
+		status, text := send(test.path, test.body)
+		if status != fiber.StatusRequestEntityTooLarge {
+			t.Errorf("oversized %s got %d, want %d", test.name, status, fiber.StatusRequestEntityTooLarge)
+		}
+		if !strings.Contains(text, test.limit) {
+			t.Errorf("oversized %s answered '%s', want the limit of %s", test.name, text, test.limit)
+		}
+	}
+
+	// Bodies within their limit reach the handler whole, uploads even past the limit the server buffers by itself
+	for _, test := range []struct {
+		name string
+		path string
+		body io.Reader
+		size int
+	}{
+		{"form", "/account/profile", bytes.NewReader(make([]byte, 1024)), 1024},
+		{"chunked form", "/account/profile", chunked(1024), 1024},
+		{"upload", "/favorites/import", bytes.NewReader(make([]byte, 10*1024*1024+1)), 10*1024*1024 + 1},
+	} {
+		status, text := send(test.path, test.body)
+		if status != fiber.StatusOK || text != strconv.Itoa(test.size) {
+			t.Errorf("%s got %d '%s', want %d '%d'", test.name, status, text, fiber.StatusOK, test.size)
+		}
+	}
+}
+
+func TestBodyLimitMiddlewareRejectsBeforeReading(t *testing.T) {
+	setupTestDB(t)
+
+	app := fiber.New(fiber.Config{
+		BodyLimit:                    models.MaxFormBodyLimitKB * 1024,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+		DisableStartupMessage:        true,
+	})
+	app.Use(BodyLimitMiddleware())
+	app.Post("/account/profile", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	ln := fasthttputil.NewInmemoryListener()
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+
+	conn, err := ln.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// The server reads ahead the first few kilobytes, the answer can't wait for the rest of the gigabyte
+	if _, err := io.WriteString(conn, "POST /account/profile HTTP/1.1\r\nHost: magi\r\nContent-Type: application/json\r\nContent-Length: 1073741824\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(make([]byte, 16*1024)); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("no answer before the whole body was sent: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusRequestEntityTooLarge {
+		t.Errorf("got %d, want %d", resp.StatusCode, fiber.StatusRequestEntityTooLarge)
+	}
+}
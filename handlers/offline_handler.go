@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+const deviceCookie = "device_id"
+
+// HandleOfflineChapters lists the chapters the current device keeps for offline reading
+func HandleOfflineChapters(c *fiber.Ctx) error {
+	chapters, err := models.GetOfflineChapters(actorName(c), c.Cookies(deviceCookie))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"chapters": chapters})
+}
+
+// HandleMarkChapterOffline records that the current device cached a chapter, issuing a device ID on first use
+func HandleMarkChapterOffline(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Manga not found"})
+	}
+	if err := checkMangaAccess(c, manga, true); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	device, expires, err := deviceID(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := models.MarkChapterOffline(actorName(c), device, manga.Slug, c.Params("chapter"), expires); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// HandleUnmarkChapterOffline removes the offline marker of a chapter on the current device
+func HandleUnmarkChapterOffline(c *fiber.Ctx) error {
+	if err := models.UnmarkChapterOffline(actorName(c), c.Cookies(deviceCookie), c.Params("manga"), c.Params("chapter")); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// HandleClearOfflineChapters removes the offline markers of the current device, or of every device with ?all=true
+func HandleClearOfflineChapters(c *fiber.Ctx) error {
+	device := c.Cookies(deviceCookie)
+	if c.QueryBool("all") {
+		device = ""
+	} else if device == "" {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	if err := models.ClearOfflineChapters(actorName(c), device); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// deviceID returns the device ID of the request along with the expiry of the login session, both the cookie and
+// the offline markers expire with the session
+func deviceID(c *fiber.Ctx) (string, time.Time, error) {
+	session, err := models.SessionOfRefreshToken(c.Cookies("refresh_token"))
+	if err != nil {
+		if session, err = models.NewSession(false); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+
+	device := c.Cookies(deviceCookie)
+	if device == "" {
+		if device, err = models.NewDeviceID(); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     deviceCookie,
+		Value:    device,
+		Expires:  session.Expires,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return device, session.Expires, nil
+}
+
+// clearDeviceOfflineChapters drops the offline markers of the device logging out along with its device ID
+func clearDeviceOfflineChapters(c *fiber.Ctx, userName string) {
+	device := c.Cookies(deviceCookie)
+	if device == "" {
+		return
+	}
+	if err := models.ClearOfflineChapters(userName, device); err != nil {
+		log.Errorf("Failed to clear offline chapters of '%s': %v", userName, err)
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:    deviceCookie,
+		Value:   "",
+		Expires: time.Now().Add(-time.Hour),
+	})
+}
@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+const (
+	defaultCoverName   = "default-cover"
+	posterCacheControl = "public, max-age=86400"
+	// blurredCacheControl keeps browsers and proxies from storing covers that differ between viewers, a revealed cover
+	// would otherwise keep showing blurred
+	blurredCacheControl  = "private, no-store"
+	placeholderLineWidth = 14
+)
+
+var defaultCoverExtensions = []string{".jpg", ".jpeg", ".png", ".webp"}
+
+// cachedCoverExtensions are the extensions cover images are cached with, the cache directory holds other files too
+var cachedCoverExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+// posterMutex serializes generating posters on request, so concurrent requests don't write the same file
+var posterMutex sync.Mutex
+
+// coverImageTypes maps the sniffed content types accepted as manga covers to the extension they are stored with
+var coverImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// HandlePoster serves the cover of a manga, falling back to the default cover when it is missing
+func HandlePoster(c *fiber.Ctx) error {
+	slug := c.Params("slug")
+	name := slug
+
+	manga, err := models.GetManga(slug)
+	if err == nil {
+		name = manga.Name
+		if coverBlurApplies(manga) {
+			c.Set(fiber.HeaderCacheControl, blurredCacheControl)
+			if coverBlurred(c, manga) {
+				if coverPath := blurredPosterPath(manga.CoverArtURL); coverPath != "" {
+					return c.SendFile(coverPath)
+				}
+				return sendDefaultCover(c, name)
+			}
+			if coverPath := posterPath(manga.CoverArtURL); coverPath != "" {
+				return c.SendFile(coverPath)
+			}
+			return sendDefaultCover(c, name)
+		}
+		if coverPath := posterPath(manga.CoverArtURL); coverPath != "" {
+			c.Set(fiber.HeaderCacheControl, posterCacheControl)
+			return c.SendFile(coverPath)
+		}
+	}
+
+	c.Set(fiber.HeaderCacheControl, posterCacheControl)
+	return sendDefaultCover(c, name)
+}
+
+// HandleCoverImage serves a cached cover file of a manga: its poster, the original and blurred versions of it, or one
+// of its additional covers. Only the viewers who may see the cover unblurred get the files other than the blurred one.
+func HandleCoverImage(c *fiber.Ctx) error {
+	name := c.Params("file")
+	ext := strings.ToLower(filepath.Ext(name))
+	if name != filepath.Base(name) || !slices.Contains(cachedCoverExtensions, ext) {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	// Slugs never contain an underscore, it separates the variant of the cover
+	slug, variant, _ := strings.Cut(strings.TrimSuffix(name, filepath.Ext(name)), "_")
+	manga, err := models.GetManga(slug)
+	if err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	if err := checkMangaAccess(c, manga, false); err != nil {
+		return c.SendStatus(accessErrorStatus(err))
+	}
+
+	if coverBlurApplies(manga) {
+		c.Set(fiber.HeaderCacheControl, blurredCacheControl)
+		if variant != "blurred" && coverBlurred(c, manga) {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+	} else {
+		c.Set(fiber.HeaderCacheControl, posterCacheControl)
+	}
+
+	coverPath := filepath.Join(cachePath, name)
+	if _, err := os.Stat(coverPath); err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	return c.SendFile(coverPath)
+}
+
+// sendDefaultCover sends the uploaded default cover, or a placeholder with the name when there is none
+func sendDefaultCover(c *fiber.Ctx, name string) error {
+	if coverPath := defaultCoverPath(); coverPath != "" {
+		return c.SendFile(coverPath)
+	}
+
+	c.Set(fiber.HeaderContentType, "image/svg+xml")
+	return c.SendString(placeholderCover(name))
+}
+
+// HandleUploadDefaultCover stores the image used for mangas without a cover
+func HandleUploadDefaultCover(c *fiber.Ctx) error {
+	file, err := c.FormFile("cover")
+	if err != nil {
+		return HandleView(c, views.DefaultCoverForm(defaultCoverPath() != "", "No image was uploaded", true))
+	}
+
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if !isDefaultCoverExtension(ext) {
+		return HandleView(c, views.DefaultCoverForm(defaultCoverPath() != "", fmt.Sprintf("Unsupported image type: %s", ext), true))
+	}
+
+	removeDefaultCover()
+	if err := c.SaveFile(file, filepath.Join(cachePath, defaultCoverName+ext)); err != nil {
+		return HandleView(c, views.DefaultCoverForm(false, err.Error(), true))
+	}
+
+	logActivity(c, "default_cover_update", file.Filename)
+
+	return HandleView(c, views.DefaultCoverForm(true, "Default cover saved", false))
+}
+
+// HandleDeleteDefaultCover removes the uploaded default cover, restoring the generated placeholders
+func HandleDeleteDefaultCover(c *fiber.Ctx) error {
+	removeDefaultCover()
+	logActivity(c, "default_cover_update", "removed")
+	return HandleView(c, views.DefaultCoverForm(false, "Default cover removed", false))
+}
+
+// HandleUploadMangaCover replaces the cover of a manga with an uploaded image and locks it against metadata updates
+func HandleUploadMangaCover(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	file, err := c.FormFile("cover")
+	if err != nil {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), "No image was uploaded", true))
+	}
+
+	ext, err := coverImageExtension(file)
+	if err != nil {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), err.Error(), true))
+	}
+
+	originalPath := filepath.Join(cachePath, fmt.Sprintf("%s_original%s", manga.Slug, ext))
+	if err := c.SaveFile(file, originalPath); err != nil {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), err.Error(), true))
+	}
+
+	coverPath := filepath.Join(cachePath, manga.Slug+ext)
+	if err := utils.ProcessImage(originalPath, coverPath); err != nil {
+		os.Remove(originalPath)
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), err.Error(), true))
+	}
+
+	// Drop the previous cover when it was stored with another extension
+	if previous := localCoverPath(manga.CoverArtURL); previous != "" && previous != coverPath {
+		os.Remove(previous)
+	}
+
+	coverArtURL := fmt.Sprintf("http://localhost:3000/api/images/%s%s", manga.Slug, ext)
+	if err := models.SetMangaCover(manga.Slug, coverArtURL, utils.CoverAccentColor(cachePath, coverArtURL)); err != nil {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), err.Error(), true))
+	}
+	logActivity(c, "manga_cover_update", manga.Slug)
+
+	manga, err = models.GetManga(manga.Slug)
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), "Cover saved", false))
+}
+
+// HandleMangaCoverURL replaces the cover of a manga with an image fetched from a URL and locks it against metadata updates
+func HandleMangaCoverURL(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+
+	coverURL, err := url.Parse(strings.TrimSpace(c.FormValue("url")))
+	if err != nil || (coverURL.Scheme != "http" && coverURL.Scheme != "https") || coverURL.Hostname() == "" {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), "Enter an http or https URL", true))
+	}
+	if !config.IsCoverURLHostAllowed(coverURL.Hostname()) {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), fmt.Sprintf("Covers can't be fetched from %s", coverURL.Hostname()), true))
+	}
+
+	// Covers are always stored as JPEG, whatever the extension of the URL
+	fileName := manga.Slug + ".jpg"
+	maxBytes := int64(config.UploadBodyLimitMB) * 1024 * 1024
+	if err := utils.DownloadExternalImage(cachePath, fileName, coverURL.String(), maxBytes); err != nil {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), err.Error(), true))
+	}
+
+	coverPath := filepath.Join(cachePath, fileName)
+	if previous := localCoverPath(manga.CoverArtURL); previous != "" && previous != coverPath {
+		os.Remove(previous)
+	}
+
+	coverArtURL := fmt.Sprintf("http://localhost:3000/api/images/%s", fileName)
+	if err := models.SetMangaCover(manga.Slug, coverArtURL, utils.CoverAccentColor(cachePath, coverArtURL)); err != nil {
+		return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), err.Error(), true))
+	}
+	logActivity(c, "manga_cover_update", manga.Slug)
+
+	manga, err = models.GetManga(manga.Slug)
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), "Cover saved", false))
+}
+
+// HandleUnlockMangaCover allows metadata updates to replace an uploaded cover again
+func HandleUnlockMangaCover(c *fiber.Ctx) error {
+	slug := c.Params("manga")
+	if err := models.UnlockMangaCover(slug); err != nil {
+		return handleError(c, err)
+	}
+	logActivity(c, "manga_cover_update", slug)
+
+	manga, err := models.GetManga(slug)
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.MangaCover(*manga, mangaCovers(manga.Slug), true, coverBlurred(c, manga), "Cover unlocked", false))
+}
+
+// coverImageExtension sniffs the content of an uploaded cover, rejecting anything that isn't a supported image
+func coverImageExtension(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read the uploaded file: %w", err)
+	}
+
+	contentType := http.DetectContentType(header[:n])
+	ext, ok := coverImageTypes[contentType]
+	if !ok {
+		return "", fmt.Errorf("unsupported image type: %s", contentType)
+	}
+	return ext, nil
+}
+
+// localCoverPath resolves a cached cover URL to its file in the cache directory, if it exists
+func localCoverPath(coverArtURL string) string {
+	if coverArtURL == "" {
+		return ""
+	}
+	u, err := url.Parse(coverArtURL)
+	if err != nil || !strings.HasPrefix(u.Path, "/api/images/") {
+		return ""
+	}
+
+	coverPath := filepath.Join(cachePath, filepath.Base(u.Path))
+	if _, err := os.Stat(coverPath); err != nil {
+		return ""
+	}
+	return coverPath
+}
+
+// posterPath resolves the cropped poster of a cached cover, generating it from the original when it is missing
+func posterPath(coverArtURL string) string {
+	if coverPath := localCoverPath(coverArtURL); coverPath != "" {
+		return coverPath
+	}
+	u, err := url.Parse(coverArtURL)
+	if err != nil || !strings.HasPrefix(u.Path, "/api/images/") {
+		return ""
+	}
+
+	coverPath := filepath.Join(cachePath, filepath.Base(u.Path))
+	ext := filepath.Ext(coverPath)
+	originalPath := strings.TrimSuffix(coverPath, ext) + "_original" + ext
+	if _, err := os.Stat(originalPath); err != nil {
+		return ""
+	}
+
+	posterMutex.Lock()
+	defer posterMutex.Unlock()
+	// Another request may have generated it while waiting
+	if _, err := os.Stat(coverPath); err == nil {
+		return coverPath
+	}
+	if err := utils.ProcessImage(originalPath, coverPath); errors.Is(err, utils.ErrLowDiskSpace) {
+		return ""
+	} else if err != nil {
+		log.Errorf("Failed to generate poster %s: %v", coverPath, err)
+		os.Remove(coverPath)
+		return ""
+	}
+	return coverPath
+}
+
+// blurredPosterPath resolves the blurred version of a poster, generating it when it is missing or older than the poster
+func blurredPosterPath(coverArtURL string) string {
+	coverPath := posterPath(coverArtURL)
+	if coverPath == "" {
+		return ""
+	}
+	ext := filepath.Ext(coverPath)
+	blurredPath := strings.TrimSuffix(coverPath, ext) + "_blurred" + ext
+
+	posterMutex.Lock()
+	defer posterMutex.Unlock()
+	if isFresh(blurredPath, coverPath) {
+		return blurredPath
+	}
+	if err := utils.BlurImage(coverPath, blurredPath); errors.Is(err, utils.ErrLowDiskSpace) {
+		return ""
+	} else if err != nil {
+		log.Errorf("Failed to generate blurred poster %s: %v", blurredPath, err)
+		os.Remove(blurredPath)
+		return ""
+	}
+	return blurredPath
+}
+
+// isFresh reports whether a generated file exists and was written after its source
+func isFresh(path, sourcePath string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	source, err := os.Stat(sourcePath)
+	return err == nil && !info.ModTime().Before(source.ModTime())
+}
+
+// defaultCoverPath returns the path of the uploaded default cover, or an empty string if there is none
+func defaultCoverPath() string {
+	for _, ext := range defaultCoverExtensions {
+		coverPath := filepath.Join(cachePath, defaultCoverName+ext)
+		if _, err := os.Stat(coverPath); err == nil {
+			return coverPath
+		}
+	}
+	return ""
+}
+
+func removeDefaultCover() {
+	for _, ext := range defaultCoverExtensions {
+		os.Remove(filepath.Join(cachePath, defaultCoverName+ext))
+	}
+}
+
+func isDefaultCoverExtension(ext string) bool {
+	for _, allowed := range defaultCoverExtensions {
+		if ext == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholderCover renders an SVG cover with the name on a color derived from it, so each series looks distinct
+func placeholderCover(name string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	hue := hash.Sum32() % 360
+
+	var text strings.Builder
+	for i, line := range wrapWords(name, placeholderLineWidth) {
+		fmt.Fprintf(&text, `<tspan x="150" dy="%s">%s</tspan>`, lineOffset(i), html.EscapeString(line))
+	}
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="300" height="450" viewBox="0 0 300 450">`+
+		`<rect width="300" height="450" fill="hsl(%d, 45%%, 35%%)"/>`+
+		`<text x="150" y="200" fill="#ffffff" font-family="sans-serif" font-size="28" text-anchor="middle">%s</text>`+
+		`</svg>`, hue, text.String())
+}
+
+func lineOffset(line int) string {
+	if line == 0 {
+		return "0"
+	}
+	return "1.2em"
+}
+
+// wrapWords splits text into lines of roughly the given width, keeping at most four lines
+func wrapWords(text string, width int) []string {
+	var lines []string
+	var current string
+	for _, word := range strings.Fields(text) {
+		if current != "" && len(current)+1+len(word) > width {
+			lines = append(lines, current)
+			current = word
+			continue
+		}
+		if current != "" {
+			current += " "
+		}
+		current += word
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	if len(lines) > 4 {
+		lines = append(lines[:3], "...")
+	}
+	return lines
+}
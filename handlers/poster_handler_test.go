@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHandleCoverImageHoldsBackUnblurredCovers(t *testing.T) {
+	setupTestDB(t)
+	config := models.DefaultAppConfig()
+	config.CoverBlurRating = "erotica"
+	if err := models.UpdateAppConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+	for _, manga := range []models.Manga{{Name: "Mature", ContentRating: "erotica"}, {Name: "Tame", ContentRating: "safe"}} {
+		if err := models.CreateManga(manga); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previous := cachePath
+	cachePath = t.TempDir()
+	t.Cleanup(func() { cachePath = previous })
+	for _, name := range []string{"mature.jpg", "mature_original.jpg", "mature_blurred.jpg", "mature_cover-1.jpg", "tame.jpg", "magi.db"} {
+		if err := os.WriteFile(filepath.Join(cachePath, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := fiber.New()
+	app.Get("/api/images/:file", HandleCoverImage)
+	get := func(name, cookie string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(fiber.MethodGet, "/api/images/"+name, nil)
+		if cookie != "" {
+			req.Header.Set(fiber.HeaderCookie, cookie)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	// A viewer who didn't reveal the cover only gets the blurred one
+	for _, name := range []string{"mature.jpg", "mature_original.jpg", "mature_cover-1.jpg"} {
+		if status, body := get(name, ""); status != fiber.StatusForbidden || body == name {
+			t.Errorf("%s before the reveal got %d, want %d without the image", name, status, fiber.StatusForbidden)
+		}
+	}
+	for _, test := range []struct {
+		name   string
+		cookie string
+	}{
+		{"mature_blurred.jpg", ""},
+		{"mature.jpg", revealedCoversCookie + "=mature"},
+		{"mature_original.jpg", revealedCoversCookie + "=tame,mature"},
+		{"tame.jpg", ""},
+	} {
+		if status, body := get(test.name, test.cookie); status != fiber.StatusOK || body != test.name {
+			t.Errorf("%s with cookie '%s' got %d '%s', want %d with the image", test.name, test.cookie, status, body, fiber.StatusOK)
+		}
+	}
+
+	// Only the cover images of mangas are served from the cache directory
+	for _, name := range []string{"magi.db", "missing.jpg", "tame_original.jpg", "default-cover.jpg"} {
+		if status, _ := get(name, ""); status != fiber.StatusNotFound {
+			t.Errorf("%s got %d, want %d", name, status, fiber.StatusNotFound)
+		}
+	}
+}
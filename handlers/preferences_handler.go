@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxUserDataRequestsPerMinute limits how often a user can export or delete their data, both walk most buckets
+const maxUserDataRequestsPerMinute = 2
+
+// accountOverviewPageSize is the number of recent series of each list of the account overview by default
+const accountOverviewPageSize = 10
+
+// maxAccountOverviewItems bounds the recent series of each list a single account overview request can ask for
+const maxAccountOverviewItems = 50
+
+// userDataLimits counts the data exports and deletions of every user within the current minute
+var userDataLimits = rateLimitWindow{counts: make(map[string]int)}
+
+func HandlePreferences(c *fiber.Ctx) error {
+	preferences, err := models.GetUserPreferences(actorName(c))
+	if err != nil {
+		return handleError(c, err)
+	}
+	readerPreferences, err := models.GetReaderPreferences(actorName(c))
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.Preferences(preferences, readerPreferences))
+}
+
+func HandleUpdatePreferences(c *fiber.Ctx) error {
+	var preferences models.UserPreferences
+	if err := c.BodyParser(&preferences); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	if err := models.UpdateUserPreferences(actorName(c), &preferences); err != nil {
+		return HandleView(c, views.PreferencesForm(preferences, err.Error(), true))
+	}
+
+	return HandleView(c, views.PreferencesForm(preferences, "Preferences saved", false))
+}
+
+// readerPreferencesResponse carries the reader preferences along with the controls they resolve to per reading mode
+type readerPreferencesResponse struct {
+	models.ReaderPreferences
+	Controls map[string]models.ReaderControls `json:"controls"`
+}
+
+// HandleReaderPreferences returns the reader preferences of the current user, the defaults for anonymous users
+func HandleReaderPreferences(c *fiber.Ctx) error {
+	preferences, err := models.GetReaderPreferences(getUserName(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(newReaderPreferencesResponse(preferences))
+}
+
+// HandleSaveReaderPreferences stores the reader preferences of the current user sent as JSON or form values
+func HandleSaveReaderPreferences(c *fiber.Ctx) error {
+	var preferences models.ReaderPreferences
+	if err := c.BodyParser(&preferences); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := models.UpdateReaderPreferences(actorName(c), &preferences); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(newReaderPreferencesResponse(preferences))
+}
+
+func newReaderPreferencesResponse(preferences models.ReaderPreferences) readerPreferencesResponse {
+	controls := make(map[string]models.ReaderControls, len(models.ReadingModes))
+	for _, mode := range models.ReadingModes {
+		controls[mode] = preferences.Controls(mode)
+	}
+	return readerPreferencesResponse{ReaderPreferences: preferences, Controls: controls}
+}
+
+func HandleUpdateReaderPreferences(c *fiber.Ctx) error {
+	var preferences models.ReaderPreferences
+	if err := c.BodyParser(&preferences); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	if err := models.UpdateReaderPreferences(actorName(c), &preferences); err != nil {
+		return HandleView(c, views.ReaderPreferencesForm(preferences, err.Error(), true))
+	}
+
+	return HandleView(c, views.ReaderPreferencesForm(preferences, "Reader preferences saved", false))
+}
+
+// HandleExportUserData downloads everything stored about the current user as a JSON document
+func HandleExportUserData(c *fiber.Ctx) error {
+	username := actorName(c)
+	if !userDataLimits.allow(username, maxUserDataRequestsPerMinute, time.Now()) {
+		c.Set(fiber.HeaderRetryAfter, "60")
+		return c.Status(fiber.StatusTooManyRequests).SendString("Too many requests, please try again later")
+	}
+
+	export, err := models.ExportUserData(username)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	c.Attachment(fmt.Sprintf("magi-data-%s.json", username))
+	return c.JSON(export)
+}
+
+// HandleDeleteUserData deletes or anonymizes the data of the current user according to the configured policy, the
+// account itself is kept
+func HandleDeleteUserData(c *fiber.Ctx) error {
+	username := actorName(c)
+	if !userDataLimits.allow(username, maxUserDataRequestsPerMinute, time.Now()) {
+		return HandleView(c, views.UserDataForm("Too many requests, please try again later", true))
+	}
+
+	if err := models.DeleteUserData(username); err != nil {
+		return HandleView(c, views.UserDataForm(err.Error(), true))
+	}
+	logActivity(c, "user_data_delete", username)
+	return HandleView(c, views.UserDataForm("Your data was deleted", false))
+}
+
+// HandleAccountOverview returns the lists, counts and reading stats of the current user in a single response, the
+// limit and offset query values page the recent series of every list
+func HandleAccountOverview(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", accountOverviewPageSize)
+	if limit < 1 || limit > maxAccountOverviewItems {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("limit must be between 1 and %d", maxAccountOverviewItems)})
+	}
+	offset := c.QueryInt("offset")
+	if offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "offset can't be negative"})
+	}
+
+	overview, err := models.GetAccountOverview(actorName(c), models.AccountOverviewOptions{
+		Offset:             offset,
+		Limit:              limit,
+		ContentRatingLimit: getContentRatingLimit(c),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(overview)
+}
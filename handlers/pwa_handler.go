@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"github.com/alexander-bruun/magi/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+type manifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+type webManifest struct {
+	Name            string         `json:"name"`
+	ShortName       string         `json:"short_name"`
+	Description     string         `json:"description"`
+	StartURL        string         `json:"start_url"`
+	Scope           string         `json:"scope"`
+	Display         string         `json:"display"`
+	ThemeColor      string         `json:"theme_color"`
+	BackgroundColor string         `json:"background_color"`
+	Icons           []manifestIcon `json:"icons"`
+}
+
+// HandleManifest serves the web app manifest when installing Magi as an app is enabled
+func HandleManifest(c *fiber.Ctx) error {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	if !config.EnablePWA {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	if err := c.JSON(webManifest{
+		Name:            "Magi",
+		ShortName:       "Magi",
+		Description:     "Self-hosted manga reader",
+		StartURL:        "/",
+		Scope:           "/",
+		Display:         "standalone",
+		ThemeColor:      "#09090b",
+		BackgroundColor: "#09090b",
+		Icons: []manifestIcon{
+			{Src: "/assets/img/icon.png", Sizes: "350x350", Type: "image/png"},
+		},
+	}); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/manifest+json")
+	return nil
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// HandleCreateReport files a report, the reason is taken from the form or from the htmx prompt
+func HandleCreateReport(c *fiber.Ctx) error {
+	reason := c.FormValue("reason")
+	if reason == "" {
+		reason = c.Get("HX-Prompt")
+	}
+
+	report, err := models.CreateReport(actorName(c), c.FormValue("target_type"), c.FormValue("target_id"), reason)
+	if err != nil {
+		return HandleView(c, views.ReportResult(err.Error(), true))
+	}
+	logActivity(c, "report_create", fmt.Sprintf("%s %s", report.TargetType, report.TargetID))
+
+	return HandleView(c, views.ReportResult("Thanks, a moderator will review your report.", false))
+}
+
+// HandleReports renders the open reports for moderators to review
+func HandleReports(c *fiber.Ctx) error {
+	reports, err := models.GetOpenReports()
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.Reports(reports))
+}
+
+// HandleResolveReport marks a report as resolved or dismissed
+func HandleResolveReport(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid report")
+	}
+
+	status := c.FormValue("status")
+	if err := models.ResolveReport(id, actorName(c), status); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	logActivity(c, "report_"+status, strconv.FormatUint(id, 10))
+
+	reports, err := models.GetOpenReports()
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.ReportsTable(reports))
+}
+
+// HandleOpenReportsCount renders the number of open reports shown next to the reports link
+func HandleOpenReportsCount(c *fiber.Ctx) error {
+	reports, err := models.GetOpenReports()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	if len(reports) == 0 {
+		return c.SendString("")
+	}
+	return HandleView(c, views.OpenReportsCount(len(reports)))
+}
+
+// reportNotifier lets moderators know about new reports through the log
+type reportNotifier struct{}
+
+func (reportNotifier) Notify(notification models.Notification) {
+	report, ok := notification.Payload.(models.Report)
+	if !ok || notification.Type != "report_created" {
+		return
+	}
+	log.Infof("Report #%d filed by '%s' against %s '%s', awaiting moderator review", report.ID, report.Reporter, report.TargetType, report.TargetID)
+}
@@ -1,14 +1,21 @@
 package handlers
 
 import (
+	"github.com/alexander-bruun/magi/models"
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/healthcheck"
 )
 
+// cachePath is the directory holding the cached cover images
+var cachePath string
+
 func Initialize(app *fiber.App, cacheDirectory string) {
 	log.Info("Initializing GoFiber view routes")
+	cachePath = cacheDirectory
+	models.AddListener(reportNotifier{})
 
 	// CORS middleware configuration to allow all origins
 	app.Use(cors.New(cors.Config{
@@ -25,31 +32,66 @@ func Initialize(app *fiber.App, cacheDirectory string) {
 		return c.SendStatus(fiber.StatusOK)
 	})
 
+	// The readiness probe of the health check middleware, extended with the free disk space of the cache
+	app.Get(healthcheck.DefaultReadinessEndpoint, HandleReadiness)
 	app.Use(healthcheck.New())
+	app.Use(ClientIPMiddleware())
+	app.Use(RateLimitMiddleware())
+	app.Use(BodyLimitMiddleware())
 
 	// - .zip (implemented)
 	// - .cbz (implemented)
 	// - .rar (implemented)
 	// - .cbr (implemented)
+	// - .tar (implemented)
+	// - .cbt (implemented)
+	// - .tar.gz (implemented)
 	// - .pdf
 	// - .jpg (implemented)
 	// - .png (implemented)
 	// - .mobi
 	// - .epub
-	// Any other file type is blocked.
+	// Any other file type is blocked, see utils.ChapterFormats for the registered chapter formats.
 	app.Get("/api/comic", ComicHandler)
+	app.Get("/api/chapters/:manga/search", HandleChapterSearch)
+	app.Get("/api/chapters/:manga/:chapter/pages", HandleChapterPages)
+	app.Get("/api/chapters/:manga/:chapter/pages/:page", HandleChapterPage)
+	// Offline caches resolve every page of a chapter at once, only for logged in users
+	app.Get("/api/chapters/:manga/:chapter/manifest", AuthMiddleware("reader"), HandleChapterManifest)
+	app.Get("/api/featured", HandleFeaturedMedia)
+
+	// Reader preferences follow the user across devices, anonymous users get the defaults
+	app.Get("/api/preferences/reader", HandleReaderPreferences)
+	app.Put("/api/preferences/reader", AuthMiddleware("reader"), HandleSaveReaderPreferences)
+
+	// Lists, counts and reading stats of the current user gathered in one response
+	app.Get("/api/account/overview", AuthMiddleware("reader"), HandleAccountOverview)
+
+	// Chapters the current device keeps for offline reading, the pages themselves are cached by the client
+	offline := app.Group("/api/offline", AuthMiddleware("reader"))
+	offline.Get("", HandleOfflineChapters)
+	offline.Delete("", HandleClearOfflineChapters)
+	offline.Put("/:manga/:chapter", HandleMarkChapterOffline)
+	offline.Delete("/:manga/:chapter", HandleUnmarkChapterOffline)
 
 	// Static assets and images
-	app.Static("/api/images", cacheDirectory)
+	app.Get("/api/images/:file", HandleCoverImage)
+	app.Get("/api/posters/:slug", HandlePoster)
 	app.Static("/assets/", "./assets/")
 
+	// Progressive web app manifest
+	app.Get("/manifest.webmanifest", HandleManifest)
+
 	// Register views
 	app.Get("/", HandleHome)
+	app.Post("/updates/dismiss", AuthMiddleware("reader"), HandleDismissUpdates)
 	app.Get("/login", LoginHandler)
 	app.Get("/register", RegisterHandler)
 	app.Post("/register", CreateUserHandler)
 	app.Post("/login", LoginUserHandler)
 	app.Post("/logout", LogoutHandler)
+	app.Get("/content-gate", HandleContentGate)
+	app.Post("/content-gate", HandleConfirmContentGate)
 
 	// Libraries endpoint group
 	libraries := app.Group("/libraries", AuthMiddleware("admin"))
@@ -59,6 +101,8 @@ func Initialize(app *fiber.App, cacheDirectory string) {
 	libraries.Post("", HandleCreateLibrary)
 	libraries.Delete("/:slug", HandleDeleteLibrary)
 	libraries.Put("/:slug", HandleUpdateLibrary)
+	libraries.Post("/:slug/relocate", HandleRelocateLibrary)
+	libraries.Post("/preview", HandleLibraryPreview)
 
 	// Form endpoints
 	libraries.Get("/edit-library/:slug", HandleEditLibrary)
@@ -75,6 +119,96 @@ func Initialize(app *fiber.App, cacheDirectory string) {
 	users.Get("/unban/:username", HandleUserUnban)
 	users.Get("/promote/:username", HandleUserPromote)
 	users.Get("/demote/:username", HandleUserDemote)
+	users.Get("/table", HandleUsersTable)
+
+	// Admin only user management endpoints
+	users.Post("", AuthMiddleware("admin"), HandleCreateUser)
+	users.Post("/role/:username", AuthMiddleware("admin"), HandleUserRole)
+	users.Post("/password/:username", AuthMiddleware("admin"), HandleUserPassword)
+	users.Post("/logout/:username", AuthMiddleware("admin"), HandleUserLogout)
+	users.Post("/content-gate/:username", AuthMiddleware("admin"), HandleUserContentGateReset)
+	users.Delete("/:username", AuthMiddleware("admin"), HandleDeleteUser)
+
+	// Reports endpoint group
+	reports := app.Group("/reports", AuthMiddleware("reader"))
+	reports.Post("", HandleCreateReport)
+	reports.Get("", AuthMiddleware("moderator"), HandleReports)
+	reports.Get("/count", AuthMiddleware("moderator"), HandleOpenReportsCount)
+	reports.Post("/:id", AuthMiddleware("moderator"), HandleResolveReport)
+
+	// Tags endpoint group
+	tags := app.Group("/tags", AuthMiddleware("moderator"))
+	tags.Get("", HandleTags)
+	tags.Post("", HandleBulkTagEdit)
+
+	// Cleanup endpoint group
+	cleanup := app.Group("/cleanup", AuthMiddleware("admin"))
+	cleanup.Get("", HandleCleanup)
+	cleanup.Post("/preview", HandleCleanupPreview)
+	cleanup.Post("", HandleCleanupApply)
+
+	// Content ratings endpoint group
+	contentRatings := app.Group("/content-ratings", AuthMiddleware("admin"))
+	contentRatings.Get("", HandleContentRatings)
+	contentRatings.Get("/breakdown", HandleContentRatingBreakdown)
+
+	// Metadata review endpoint group
+	metadataReviews := app.Group("/metadata-reviews", AuthMiddleware("admin"))
+	metadataReviews.Get("", HandleMetadataReviews)
+	metadataReviews.Post("/:slug", HandleConfirmMetadataReview)
+	metadataReviews.Delete("/:slug", HandleDismissMetadataReview)
+
+	// Activity log endpoint group
+	activity := app.Group("/activity", AuthMiddleware("admin"))
+	activity.Get("", HandleActivityLog)
+	activity.Get("/table", HandleActivityLogTable)
+
+	// Live server logs over a WebSocket
+	logs := app.Group("/logs", AuthMiddleware("admin"))
+	logs.Get("/stream", HandleLogStreamUpgrade, websocket.New(HandleLogStream))
+
+	// Preferences endpoint group
+	preferences := app.Group("/preferences", AuthMiddleware("reader"))
+	preferences.Get("", HandlePreferences)
+	preferences.Post("", HandleUpdatePreferences)
+	preferences.Post("/reader", HandleUpdateReaderPreferences)
+	preferences.Get("/data", HandleExportUserData)
+	preferences.Delete("/data", HandleDeleteUserData)
+
+	// Favorites endpoint group
+	favorites := app.Group("/favorites", AuthMiddleware("reader"))
+	favorites.Get("", HandleFavorites)
+	favorites.Get("/export", HandleExportFavorites)
+	favorites.Post("/import", HandleImportFavorites)
+
+	// Reading lists of the current user
+	readingLists := app.Group("/reading-lists", AuthMiddleware("reader"))
+	readingLists.Get("", HandleReadingLists)
+
+	// Share links created by the current user, admins manage every link
+	shareLinks := app.Group("/share-links", AuthMiddleware("reader"))
+	shareLinks.Get("", HandleShareLinks)
+	shareLinks.Delete("/:token", HandleRevokeShareLink)
+
+	// Guest access through share links, limited to the shared manga or chapter
+	share := app.Group("/share")
+	share.Get("/:token", HandleSharedMedia)
+	share.Get("/:token/:chapter", HandleSharedChapter)
+	share.Get("/:token/:chapter/:page", HandleSharedPage)
+
+	// Config endpoint group
+	config := app.Group("/config", AuthMiddleware("admin"))
+	config.Get("", HandleConfig)
+	config.Post("", HandleUpdateConfig)
+	config.Post("/default-cover", HandleUploadDefaultCover)
+	config.Delete("/default-cover", HandleDeleteDefaultCover)
+	config.Post("/integrity-check", HandleIntegrityCheck)
+	config.Post("/compaction", HandleScheduleCompaction)
+	config.Post("/page-check", HandlePageCheck)
+	config.Get("/chapter-issues", HandleChapterIssues)
+	config.Get("/chapter-duplicates", HandleChapterDuplicates)
+	config.Post("/chapter-duplicates/:manga/:number", HandleResolveChapterDuplicate)
+	config.Get("/schema", HandleSchemaStatus)
 
 	// Manga endpoint group
 	mangas := app.Group("/mangas")
@@ -83,10 +217,42 @@ func Initialize(app *fiber.App, cacheDirectory string) {
 	mangas.Post("/overwrite-metadata", HandleEditMetadataManga)
 	mangas.Get("/search", HandleMangaSearch)
 	mangas.Get("/:manga", HandleManga)
+	mangas.Get("/:manga/neighbors", HandleMangaNeighbors)
+	mangas.Get("/:manga/community", HandleCommunityPosition)
+	mangas.Get("/:manga/favorite", AuthMiddleware("reader"), HandleFavoriteButton)
+	mangas.Post("/:manga/favorite", AuthMiddleware("reader"), HandleAddFavorite)
+	mangas.Delete("/:manga/favorite", AuthMiddleware("reader"), HandleRemoveFavorite)
+	mangas.Get("/:manga/share", AuthMiddleware("reader"), HandleShareForm)
+	mangas.Post("/:manga/share", AuthMiddleware("reader"), HandleCreateShareLink)
+	mangas.Get("/:manga/status", AuthMiddleware("reader"), HandleSeriesStatus)
+	mangas.Post("/:manga/status", AuthMiddleware("reader"), HandleSetSeriesStatus)
+	mangas.Post("/:manga/reading-mode", AuthMiddleware("moderator"), HandleMangaReadingMode)
+	mangas.Post("/:manga/aliases", AuthMiddleware("moderator"), HandleMangaAliases)
+	mangas.Post("/:manga/pin", AuthMiddleware("admin"), HandleMangaPin)
+	mangas.Delete("/:manga/pin", AuthMiddleware("admin"), HandleMangaUnpin)
+	mangas.Get("/:manga/featured", AuthMiddleware("admin"), HandleFeaturedForm)
+	mangas.Post("/:manga/featured", AuthMiddleware("admin"), HandleFeatureManga)
+	mangas.Delete("/:manga/featured", AuthMiddleware("admin"), HandleUnfeatureManga)
+	mangas.Post("/:manga/cover", AuthMiddleware("moderator"), HandleUploadMangaCover)
+	mangas.Post("/:manga/cover-url", AuthMiddleware("moderator"), HandleMangaCoverURL)
+	mangas.Delete("/:manga/cover-lock", AuthMiddleware("moderator"), HandleUnlockMangaCover)
+	mangas.Post("/:manga/covers", AuthMiddleware("moderator"), HandleAddMangaCover)
+	mangas.Delete("/:manga/covers", AuthMiddleware("moderator"), HandleRemoveMangaCover)
+	mangas.Post("/:manga/covers/order", AuthMiddleware("moderator"), HandleMoveMangaCover)
+	mangas.Post("/:manga/cover-reveal", HandleRevealCover)
 	mangas.Get("/:manga/:chapter", HandleChapter)
+	mangas.Post("/:manga/:chapter/read", AuthMiddleware("reader"), HandleMarkChapterRead)
+	mangas.Post("/:manga/:chapter/read-up-to", AuthMiddleware("reader"), HandleMarkReadUpTo)
+	mangas.Post("/:manga/:chapter/unread-from", AuthMiddleware("reader"), HandleMarkUnreadFrom)
+	mangas.Get("/:manga/:chapter/comments", HandleChapterComments)
+	mangas.Post("/:manga/:chapter/comments", AuthMiddleware("reader"), HandleCreateChapterComment)
+	mangas.Delete("/:manga/:chapter/comments/:id", AuthMiddleware("reader"), HandleDeleteChapterComment)
 
 	// Fallback
 	app.Get("/*", HandleNotFound)
 
+	// Popular covers and chapters are prepared in the background while the server starts serving
+	go WarmCaches()
+
 	log.Fatal(app.Listen(":3000"))
 }
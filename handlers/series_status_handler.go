@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleReadingLists lists the series of the current user with a status, reading by default
+func HandleReadingLists(c *fiber.Ctx) error {
+	status := c.Query("status", models.SeriesStatusReading)
+	if !slices.Contains(models.SeriesStatuses, status) {
+		return handleError(c, models.ErrInvalidSeriesStatus)
+	}
+
+	series, counts, err := models.GetSeriesByStatus(actorName(c), status, getContentRatingLimit(c))
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.ReadingLists(status, series, counts))
+}
+
+// HandleSeriesStatus renders the status picker of a manga for the current user
+func HandleSeriesStatus(c *fiber.Ctx) error {
+	status, explicit, err := models.GetSeriesStatus(actorName(c), c.Params("manga"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	return HandleView(c, views.SeriesStatusSelect(c.Params("manga"), status, explicit))
+}
+
+// HandleSetSeriesStatus sets the status of a manga for the current user, an empty status restores the implicit one
+func HandleSetSeriesStatus(c *fiber.Ctx) error {
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString("Manga not found")
+	}
+	if err := checkMangaAccess(c, manga, false); err != nil {
+		return err
+	}
+
+	if err := models.SetSeriesStatus(actorName(c), manga.Slug, c.FormValue("status")); err != nil {
+		if errors.Is(err, models.ErrInvalidSeriesStatus) {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	return HandleSeriesStatus(c)
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// HandleShareForm renders the form sharing a manga or one of its chapters, nothing while sharing is disabled
+func HandleShareForm(c *fiber.Ctx) error {
+	config, err := models.GetAppConfig()
+	if err != nil || !config.EnableShareLinks {
+		return c.SendString("")
+	}
+	manga, chapters, err := getMangaAndChapters(c.Params("manga"))
+	if err != nil {
+		return c.SendString("")
+	}
+	return HandleView(c, views.ShareForm(*manga, chapters, config.ShareLinkMaxDays))
+}
+
+// HandleCreateShareLink creates a link giving guests read-only access to a manga or a chapter of it
+func HandleCreateShareLink(c *fiber.Ctx) error {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		return HandleView(c, views.ShareLinkResult(nil, err.Error()))
+	}
+	if !config.EnableShareLinks {
+		return HandleView(c, views.ShareLinkResult(nil, "Sharing is disabled on this instance"))
+	}
+
+	manga, err := models.GetManga(c.Params("manga"))
+	if err != nil {
+		return HandleView(c, views.ShareLinkResult(nil, "Manga not found"))
+	}
+	if err := checkMangaAccess(c, manga, true); err != nil {
+		return HandleView(c, views.ShareLinkResult(nil, err.Error()))
+	}
+	if !guestMayRead(config, manga) {
+		return HandleView(c, views.ShareLinkResult(nil, "This manga is above the content rating guests may read"))
+	}
+
+	days, err := strconv.Atoi(c.FormValue("days"))
+	if err != nil || days < 1 || days > config.ShareLinkMaxDays {
+		return HandleView(c, views.ShareLinkResult(nil, fmt.Sprintf("A share link can last between 1 and %d days", config.ShareLinkMaxDays)))
+	}
+
+	target := models.ShareTarget{MangaSlug: manga.Slug, ChapterSlug: c.FormValue("chapter")}
+	link, err := models.CreateShareLink(actorName(c), target, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		return HandleView(c, views.ShareLinkResult(nil, err.Error()))
+	}
+	logActivity(c, "share_link_create", shareTargetName(target))
+	return HandleView(c, views.ShareLinkResult(&link, ""))
+}
+
+// HandleShareLinks lists the share links of the current user, admins see the links of every user
+func HandleShareLinks(c *fiber.Ctx) error {
+	links, err := visibleShareLinks(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.ShareLinksPage(links, time.Now()))
+}
+
+// HandleRevokeShareLink stops a share link from granting access
+func HandleRevokeShareLink(c *fiber.Ctx) error {
+	role, _ := getUserRole(c)
+	if err := models.RevokeShareLink(c.Params("token"), actorName(c), role == "admin"); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	logActivity(c, "share_link_revoke", c.Params("token"))
+
+	links, err := visibleShareLinks(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.ShareLinks(links, time.Now()))
+}
+
+// HandleSharedMedia opens a share link, listing the chapters of a shared manga or reading a shared chapter
+func HandleSharedMedia(c *fiber.Ctx) error {
+	link, manga, err := resolveShareLink(c)
+	if errors.Is(err, errContentGate) {
+		return handleAccessError(c, err)
+	}
+	if err != nil {
+		return HandleViewWithStatus(c, views.Error(err.Error()), fiber.StatusNotFound)
+	}
+	if err := models.RecordShareLinkView(link.Token); err != nil {
+		log.Errorf("Failed to record view of share link: %v", err)
+	}
+
+	if link.ChapterSlug != "" {
+		return renderSharedChapter(c, link, manga, link.ChapterSlug)
+	}
+	chapters, err := models.GetChapters(manga.Slug)
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.SharedManga(link, *manga, chapters))
+}
+
+// HandleSharedChapter reads a chapter of a shared manga
+func HandleSharedChapter(c *fiber.Ctx) error {
+	link, manga, err := resolveShareLink(c)
+	if errors.Is(err, errContentGate) {
+		return handleAccessError(c, err)
+	}
+	if err != nil {
+		return HandleViewWithStatus(c, views.Error(err.Error()), fiber.StatusNotFound)
+	}
+	if !link.Allows(manga.Slug, c.Params("chapter")) {
+		return HandleViewWithStatus(c, views.Error(models.ErrShareLinkInvalid.Error()), fiber.StatusNotFound)
+	}
+	return renderSharedChapter(c, link, manga, c.Params("chapter"))
+}
+
+// HandleSharedPage serves a page of a shared chapter, the link only grants the pages of its own target
+func HandleSharedPage(c *fiber.Ctx) error {
+	link, manga, err := resolveShareLink(c)
+	if errors.Is(err, errContentGate) {
+		return err
+	}
+	if err != nil || !link.Allows(manga.Slug, c.Params("chapter")) {
+		return c.Status(fiber.StatusNotFound).SendString(models.ErrShareLinkInvalid.Error())
+	}
+	chapter, err := models.GetChapter(manga.Slug, c.Params("chapter"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString("Chapter not found")
+	}
+	return sendChapterPage(c, manga, chapter, c.Params("page"))
+}
+
+// visibleShareLinks returns the share links of the current user, or of every user for admins
+func visibleShareLinks(c *fiber.Ctx) ([]models.ShareLink, error) {
+	username := actorName(c)
+	if role, _ := getUserRole(c); role == "admin" {
+		username = ""
+	}
+	return models.GetShareLinks(username)
+}
+
+// resolveShareLink returns the active share link of the request with its manga, checking that sharing is enabled
+// and that guests may read the manga. A gated manga requires the age confirmation like the regular reader does.
+func resolveShareLink(c *fiber.Ctx) (models.ShareLink, *models.Manga, error) {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		return models.ShareLink{}, nil, err
+	}
+	if !config.EnableShareLinks {
+		return models.ShareLink{}, nil, models.ErrShareLinkInvalid
+	}
+
+	link, err := models.GetShareLink(c.Params("token"))
+	if err != nil {
+		return models.ShareLink{}, nil, err
+	}
+	manga, err := models.GetManga(link.MangaSlug)
+	if err != nil || !guestMayRead(config, manga) {
+		return models.ShareLink{}, nil, models.ErrShareLinkInvalid
+	}
+	if config.IsContentGated(manga.ContentRating) && !contentGateConfirmed(c) {
+		return models.ShareLink{}, nil, errContentGate
+	}
+	return link, manga, nil
+}
+
+func renderSharedChapter(c *fiber.Ctx, link models.ShareLink, manga *models.Manga, chapterSlug string) error {
+	chapter, err := models.GetChapter(manga.Slug, chapterSlug)
+	if err != nil {
+		return handleError(c, err)
+	}
+	images, err := getChapterImages(manga, chapter)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	pages := make([]string, len(images))
+	for i := range pages {
+		pages[i] = fmt.Sprintf("/share/%s/%s/%d", link.Token, chapter.Slug, i+1)
+	}
+	return HandleView(c, views.SharedChapter(link, *manga, *chapter, pages))
+}
+
+// guestMayRead reports whether a manga is visible and within the content rating anonymous users may see
+func guestMayRead(config models.AppConfig, manga *models.Manga) bool {
+	return !manga.Hidden &&
+		models.IsContentRatingAllowed(manga.ContentRating, config.SafeModeMaxRating) &&
+		models.IsContentRatingAllowed(manga.ContentRating, config.AnonymousContentRatingLimit)
+}
+
+func shareTargetName(target models.ShareTarget) string {
+	if target.ChapterSlug == "" {
+		return target.MangaSlug
+	}
+	return target.MangaSlug + "/" + target.ChapterSlug
+}
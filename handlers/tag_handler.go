@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleTags renders the bulk tag editing page
+func HandleTags(c *fiber.Ctx) error {
+	libraries, err := models.GetLibraries()
+	if err != nil {
+		return handleError(c, err)
+	}
+	tags, err := models.GetAllTags()
+	if err != nil {
+		return handleError(c, err)
+	}
+	return HandleView(c, views.Tags(libraries, tags))
+}
+
+// HandleBulkTagEdit adds or removes a tag on every manga matching the library and tag filters
+func HandleBulkTagEdit(c *fiber.Ctx) error {
+	slugs, err := models.FindMangaSlugs(c.FormValue("library"), c.FormValue("filter_tag"))
+	if err != nil {
+		return HandleView(c, views.BulkTagResult(err.Error(), true))
+	}
+	if len(slugs) == 0 {
+		return HandleView(c, views.BulkTagResult("No mangas match the filter", true))
+	}
+
+	tag := c.FormValue("tag")
+	var updated int
+	switch action := c.FormValue("action"); action {
+	case "add":
+		updated, err = models.AddTagToMedia(slugs, tag)
+	case "remove":
+		updated, err = models.RemoveTagFromMedia(slugs, tag)
+	default:
+		err = fmt.Errorf("invalid action: %s", action)
+	}
+	if err != nil {
+		return HandleView(c, views.BulkTagResult(err.Error(), true))
+	}
+	logActivity(c, "tag_bulk_edit", fmt.Sprintf("%s %s (%d mangas)", c.FormValue("action"), tag, updated))
+
+	return HandleView(c, views.BulkTagResult(fmt.Sprintf("%d of %d matching mangas updated", updated, len(slugs)), false))
+}
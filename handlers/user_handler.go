@@ -1,17 +1,27 @@
 package handlers
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/alexander-bruun/magi/models"
 	"github.com/alexander-bruun/magi/views"
 	"github.com/gofiber/fiber/v2"
 )
 
+const usersPageSize = 20
+
 func HandleUsers(c *fiber.Ctx) error {
-	users, err := models.GetUsers()
+	users, total, page, err := searchUsers(c)
 	if err != nil {
 		return handleError(c, err)
 	}
-	return HandleView(c, views.Users(users))
+	return HandleView(c, views.Users(users, total, page, c.Query("search"), isAdmin(c)))
+}
+
+// HandleUsersTable renders only the users table, used for searching and paging
+func HandleUsersTable(c *fiber.Ctx) error {
+	return renderUsersTable(c, "", false)
 }
 
 func HandleUserBan(c *fiber.Ctx) error {
@@ -19,50 +29,141 @@ func HandleUserBan(c *fiber.Ctx) error {
 
 	models.UpdateUserRole(username, "reader")
 	models.BanUser(username)
+	logActivity(c, "user_ban", username)
 
-	users, err := models.GetUsers()
-	if err != nil {
-		return handleError(c, err)
-	}
-
-	return HandleView(c, views.UsersTable(users))
+	return renderUsersTable(c, "", false)
 }
 
 func HandleUserUnban(c *fiber.Ctx) error {
 	username := c.Params("username")
 
 	models.UnbanUser(username)
+	logActivity(c, "user_unban", username)
 
-	users, err := models.GetUsers()
-	if err != nil {
-		return handleError(c, err)
-	}
-
-	return HandleView(c, views.UsersTable(users))
+	return renderUsersTable(c, "", false)
 }
 
 func HandleUserPromote(c *fiber.Ctx) error {
 	username := c.Params("username")
 
 	models.PromoteUser(username)
+	logActivity(c, "user_promote", username)
 
-	users, err := models.GetUsers()
-	if err != nil {
-		return handleError(c, err)
-	}
-
-	return HandleView(c, views.UsersTable(users))
+	return renderUsersTable(c, "", false)
 }
 
 func HandleUserDemote(c *fiber.Ctx) error {
 	username := c.Params("username")
 
 	models.DemoteUser(username)
+	logActivity(c, "user_demote", username)
+
+	return renderUsersTable(c, "", false)
+}
+
+// HandleCreateUser creates a user with the requested role
+func HandleCreateUser(c *fiber.Ctx) error {
+	username := c.FormValue("username")
+	password := c.FormValue("password")
+	role := c.FormValue("role", "reader")
+
+	if err := models.CreateUserWithRole(username, password, role); err != nil {
+		return renderUsersTable(c, err.Error(), true)
+	}
+	logActivity(c, "user_create", username)
+
+	return renderUsersTable(c, fmt.Sprintf("User '%s' has been created.", username), false)
+}
+
+// HandleUserRole sets the role of a user
+func HandleUserRole(c *fiber.Ctx) error {
+	username := c.Params("username")
+	if username == actorName(c) {
+		return renderUsersTable(c, "You cannot change your own role.", true)
+	}
+
+	if err := models.UpdateUserRole(username, c.FormValue("role")); err != nil {
+		return renderUsersTable(c, err.Error(), true)
+	}
+	logActivity(c, "user_role", username)
+
+	return renderUsersTable(c, "", false)
+}
+
+// HandleUserPassword resets the password of a user
+func HandleUserPassword(c *fiber.Ctx) error {
+	username := c.Params("username")
+
+	if err := models.UpdateUserPassword(username, c.FormValue("password")); err != nil {
+		return renderUsersTable(c, err.Error(), true)
+	}
+	logActivity(c, "user_password_reset", username)
+
+	return renderUsersTable(c, fmt.Sprintf("Password of '%s' has been reset.", username), false)
+}
+
+// HandleUserLogout ends every session of a user by invalidating their refresh tokens
+func HandleUserLogout(c *fiber.Ctx) error {
+	username := c.Params("username")
+
+	if err := models.IncrementRefreshTokenVersion(username); err != nil {
+		return renderUsersTable(c, err.Error(), true)
+	}
+	logActivity(c, "user_logout", username)
+
+	return renderUsersTable(c, fmt.Sprintf("User '%s' has been logged out.", username), false)
+}
+
+// HandleUserContentGateReset forgets the age confirmation of a user, who has to confirm again to view gated content
+func HandleUserContentGateReset(c *fiber.Ctx) error {
+	username := c.Params("username")
+
+	if err := models.ResetContentGate(username); err != nil {
+		return renderUsersTable(c, err.Error(), true)
+	}
+	logActivity(c, "user_content_gate_reset", username)
 
-	users, err := models.GetUsers()
+	return renderUsersTable(c, fmt.Sprintf("The age confirmation of '%s' has been reset.", username), false)
+}
+
+// HandleDeleteUser deletes a user and their data according to the configured policy
+func HandleDeleteUser(c *fiber.Ctx) error {
+	username := c.Params("username")
+	if username == actorName(c) {
+		return renderUsersTable(c, "You cannot delete your own account.", true)
+	}
+
+	if err := models.DeleteUser(username); err != nil {
+		return renderUsersTable(c, err.Error(), true)
+	}
+	logActivity(c, "user_delete", username)
+
+	return renderUsersTable(c, fmt.Sprintf("User '%s' has been deleted.", username), false)
+}
+
+// renderUsersTable renders the users table, keeping the current page and search term
+func renderUsersTable(c *fiber.Ctx, message string, failed bool) error {
+	users, total, page, err := searchUsers(c)
 	if err != nil {
 		return handleError(c, err)
 	}
+	return HandleView(c, views.UsersTable(users, total, page, c.FormValue("search"), isAdmin(c), message, failed))
+}
+
+func searchUsers(c *fiber.Ctx) ([]models.User, int, int, error) {
+	page, err := strconv.Atoi(c.FormValue("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	users, total, err := models.SearchUsers(c.FormValue("search"), page, usersPageSize)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return users, int(total), page, nil
+}
 
-	return HandleView(c, views.UsersTable(users))
+func isAdmin(c *fiber.Ctx) bool {
+	role, err := getUserRole(c)
+	return err == nil && role == "admin"
 }
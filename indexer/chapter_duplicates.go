@@ -0,0 +1,191 @@
+package indexer
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+)
+
+// chapterMarkerPattern matches the number following a chapter marker, such as "c10", "Ch. 10.5" or "#10"
+var chapterMarkerPattern = regexp.MustCompile(`(?i)(?:\b(?:c|ch\.?|chapter)|#)\s*(\d+(?:\.\d+)?)`)
+
+// chapterNumberOf returns the chapter number of a cleaned chapter name, the number after a chapter marker or else its
+// first number, so the volume of "Vol. 01 Ch. 003" doesn't count as its chapter
+func chapterNumberOf(name string) (string, bool) {
+	var number float64
+	var err error
+	if match := chapterMarkerPattern.FindStringSubmatch(name); match != nil {
+		number, err = strconv.ParseFloat(match[1], 64)
+	} else {
+		number, err = utils.ExtractDecimalNumber(name)
+	}
+	if err != nil {
+		return "", false
+	}
+	return strconv.FormatFloat(number, 'f', -1, 64), true
+}
+
+// resolveDuplicateChapters records the files of a series folder sharing a chapter number and returns the files to
+// index. A duplicate resolved by an admin keeps the file they picked. The file the duplicate chapter policy picks is
+// only suggested to an admin, unless the policy is applied automatically. The other files of a kept duplicate aren't
+// indexed, the chapters indexed from them are merged into the kept chapter. Duplicates left to an admin are indexed
+// as before.
+func resolveDuplicateChapters(slug, path string, files []chapterFile, library models.Library, config models.AppConfig) ([]chapterFile, error) {
+	groups := make(map[string][]chapterFile)
+	var numbers []string
+	for _, file := range files {
+		number, ok := chapterNumberOf(file.name)
+		if !ok {
+			continue
+		}
+		if _, seen := groups[number]; !seen {
+			numbers = append(numbers, number)
+		}
+		groups[number] = append(groups[number], file)
+	}
+
+	previous, err := models.GetChapterDuplicatesByMangaSlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	var duplicates []models.ChapterDuplicate
+	dropped := make(map[string]bool)
+	for _, number := range numbers {
+		group := groups[number]
+		if len(group) < 2 {
+			continue
+		}
+
+		duplicate := models.ChapterDuplicate{MangaSlug: slug, Number: number, DetectedAt: time.Now()}
+		for _, file := range group {
+			size, modTime, err := utils.ChapterFileInfo(filepath.Join(path, file.entry.Name()))
+			if err != nil {
+				log.Debugf("Failed to stat chapter for: '%s' - '%s' (%s)", slug, file.entry.Name(), err)
+			}
+			duplicate.Files = append(duplicate.Files, models.ChapterDuplicateFile{
+				File:    file.entry.Name(),
+				Name:    file.name,
+				Slug:    file.slug,
+				Size:    size,
+				ModTime: modTime,
+			})
+		}
+
+		known, ok := previous[number]
+		if ok {
+			duplicate.DetectedAt = known.DetectedAt
+			if _, kept := duplicate.File(known.Kept); known.Resolved && kept {
+				duplicate.Kept, duplicate.Resolved = known.Kept, true
+			}
+		} else {
+			log.Warnw(fmt.Sprintf("Found %d files for chapter %s of '%s'", len(group), number, slug), utils.LogChannelKey, logChannel(library.Slug))
+		}
+		if !duplicate.Resolved {
+			// Merging moves the reading progress, comments and share links of the other chapters for good, so the
+			// policy only merges on its own when an admin opted in
+			choice := models.ChooseDuplicateChapter(duplicate.Files, config.DuplicateChapterPolicy, config.DuplicateChapterKeyword)
+			if config.DuplicateChapterAutoMerge {
+				duplicate.Kept = choice
+			} else {
+				duplicate.Suggested = choice
+			}
+		}
+
+		if duplicate.Kept != "" {
+			if err := keepDuplicateChapter(slug, library.Slug, path, duplicate); err != nil {
+				return nil, fmt.Errorf("failed to keep '%s' as chapter %s: %w", duplicate.Kept, number, err)
+			}
+			for _, file := range duplicate.Files {
+				dropped[file.File] = file.File != duplicate.Kept
+			}
+		}
+		duplicates = append(duplicates, duplicate)
+	}
+
+	if err := models.SetChapterDuplicates(slug, duplicates); err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(files, func(file chapterFile) bool { return dropped[file.entry.Name()] }), nil
+}
+
+// ResolveChapterDuplicate keeps the file an admin picked out of duplicate chapter files. The chapters indexed from the
+// other files are merged into the chapter of the kept file, which keeps the reading progress of its readers.
+func ResolveChapterDuplicate(mangaSlug, number, file string) error {
+	unlock := lockSlug(mangaSlug)
+	defer unlock()
+
+	manga, err := models.GetManga(mangaSlug)
+	if err != nil {
+		return err
+	}
+	duplicate, err := models.ResolveChapterDuplicate(mangaSlug, number, file)
+	if err != nil {
+		return err
+	}
+	return keepDuplicateChapter(mangaSlug, manga.LibrarySlug, manga.Path, duplicate)
+}
+
+// keepDuplicateChapter makes the kept file of a duplicate the only indexed chapter of its number. An indexed chapter
+// of another file is renamed to the kept chapter when it isn't indexed yet, the others are merged into it.
+func keepDuplicateChapter(mangaSlug, librarySlug, path string, duplicate models.ChapterDuplicate) error {
+	kept, ok := duplicate.File(duplicate.Kept)
+	if !ok {
+		return fmt.Errorf("'%s' is not one of the files of chapter %s", duplicate.Kept, duplicate.Number)
+	}
+	chapters, err := models.GetChapters(mangaSlug)
+	if err != nil {
+		return err
+	}
+
+	var keptChapter *models.Chapter
+	var others []models.Chapter
+	for _, chapter := range chapters {
+		if _, ok := duplicate.File(chapter.File); !ok && chapter.Slug != kept.Slug {
+			continue
+		}
+		if chapter.Slug == kept.Slug {
+			keptChapter = &chapter
+		} else {
+			others = append(others, chapter)
+		}
+	}
+
+	keptPath := filepath.Join(path, kept.File)
+	pageCount, err := utils.CountImageFiles(keptPath)
+	if err != nil {
+		log.Debugf("Failed to count pages for: '%s' - '%s' (%s)", mangaSlug, kept.File, err)
+	}
+	if keptChapter == nil {
+		if len(others) == 0 {
+			return nil
+		}
+		renamed := others[0]
+		others = others[1:]
+		oldSlug := renamed.Slug
+		renamed.Name, renamed.Slug, renamed.File = kept.Name, kept.Slug, kept.File
+		renamed.PageCount, renamed.FileSize, renamed.FileModTime = pageCount, kept.Size, kept.ModTime
+		if err := models.RenameChapter(mangaSlug, oldSlug, renamed); err != nil {
+			return err
+		}
+		keptChapter = &renamed
+	} else if err := refreshChapter(keptChapter, librarySlug, kept.File, pageCount, kept.Size, kept.ModTime); err != nil {
+		return err
+	}
+
+	for _, other := range others {
+		if err := models.MergeChapter(mangaSlug, other.Slug, keptChapter.Slug); err != nil {
+			return err
+		}
+		log.Infof("Merged duplicate chapter: '%s' - '%s' into '%s'", mangaSlug, other.Slug, keptChapter.Slug)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexander-bruun/magi/models"
+)
+
+func TestChapterNumberOf(t *testing.T) {
+	for name, want := range map[string]string{
+		"Vol. 01 Ch. 003": "3",
+		"#10":             "10",
+		"c10":             "10",
+		"Chapter 10.5":    "10.5",
+		"Volume 2":        "2",
+	} {
+		if got, ok := chapterNumberOf(name); !ok || got != want {
+			t.Errorf("chapterNumberOf(%q) = %q, %v, want %q", name, got, ok, want)
+		}
+	}
+	if got, ok := chapterNumberOf("Extra"); ok {
+		t.Errorf("chapterNumberOf(\"Extra\") = %q, want no number", got)
+	}
+}
+
+// writeChapter creates a chapter folder with the given number of pages
+func writeChapter(t *testing.T, root, name string, pages int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(root, name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for page := 1; page <= pages; page++ {
+		if err := os.WriteFile(filepath.Join(root, name, fmt.Sprintf("%03d.jpg", page)), make([]byte, 1000), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// indexDuplicateChapter indexes a series whose chapter 10 is read by a reader, then indexes it again once a larger
+// file of chapter 10 appeared. It returns the slugs of the series and of the chapter that was read.
+func indexDuplicateChapter(t *testing.T, autoMerge bool) (string, string) {
+	t.Helper()
+	setupTestIndexer(t)
+	config := models.DefaultAppConfig()
+	config.DuplicateChapterPolicy = models.DuplicateChapterPolicyLargest
+	config.DuplicateChapterAutoMerge = autoMerge
+	if err := models.UpdateAppConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(t.TempDir(), "Duplicates")
+	writeChapter(t, root, "Chapter 10", 1)
+	library := models.Library{Slug: "library", MetadataDisabled: true}
+	mediaRoot := MediaRoot{Path: root, Name: "Duplicates"}
+	slug, err := IndexManga(mediaRoot, library, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chapters, err := models.GetChapters(slug)
+	if err != nil || len(chapters) != 1 {
+		t.Fatalf("got %d chapters (%v) after the first index, want 1", len(chapters), err)
+	}
+	if err := models.MarkChapterRead("reader", slug, chapters[0].Slug); err != nil {
+		t.Fatal(err)
+	}
+
+	writeChapter(t, root, "Ch. 10", 3)
+	if _, err := IndexManga(mediaRoot, library, nil); err != nil {
+		t.Fatal(err)
+	}
+	return slug, chapters[0].Slug
+}
+
+func TestDuplicateChapterPolicyOnlySuggests(t *testing.T) {
+	slug, read := indexDuplicateChapter(t, false)
+
+	chapters, err := models.GetChapters(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chapters) != 2 {
+		t.Errorf("got %d chapters, want both files indexed until an admin picks one", len(chapters))
+	}
+	readSlugs, err := models.GetReadChapterSlugs("reader", slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !readSlugs[read] {
+		t.Errorf("the reading state of '%s' moved without an admin, got %v", read, readSlugs)
+	}
+	duplicate, err := models.GetChapterDuplicate(slug, "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duplicate.Kept != "" || duplicate.Suggested != "Ch. 10" {
+		t.Errorf("got kept '%s' and suggested '%s', want 'Chapter 10 v2' only suggested", duplicate.Kept, duplicate.Suggested)
+	}
+
+	// The admin confirming the suggestion merges the chapters
+	if err := ResolveChapterDuplicate(slug, "10", duplicate.Suggested); err != nil {
+		t.Fatal(err)
+	}
+	assertMergedInto(t, slug, "Ch. 10")
+}
+
+func TestDuplicateChapterPolicyAutoMerge(t *testing.T) {
+	slug, _ := indexDuplicateChapter(t, true)
+	assertMergedInto(t, slug, "Ch. 10")
+}
+
+// assertMergedInto checks that the only chapter left is the one of the kept file and that it holds the reading state
+func assertMergedInto(t *testing.T, slug, file string) {
+	t.Helper()
+	chapters, err := models.GetChapters(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chapters) != 1 || chapters[0].File != file {
+		t.Fatalf("got chapters %+v, want only the chapter of '%s'", chapters, file)
+	}
+	readSlugs, err := models.GetReadChapterSlugs("reader", slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !readSlugs[chapters[0].Slug] {
+		t.Errorf("the reading state didn't move to '%s', got %v", chapters[0].Slug, readSlugs)
+	}
+}
@@ -0,0 +1,176 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/robfig/cron/v3"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+)
+
+var (
+	coverRepairMutex    sync.Mutex
+	coverRepairCron     *cron.Cron
+	coverRepairSchedule string
+
+	// coverRepairRunning skips a run while the previous one is still going
+	coverRepairRunning atomic.Bool
+)
+
+// ScheduleCoverRepair runs the cover repair job on a cron schedule, an empty schedule stops it
+func ScheduleCoverRepair(schedule string) {
+	coverRepairMutex.Lock()
+	defer coverRepairMutex.Unlock()
+
+	if coverRepairCron != nil && schedule == coverRepairSchedule {
+		return
+	}
+	if coverRepairCron != nil {
+		coverRepairCron.Stop()
+		coverRepairCron = nil
+	}
+	coverRepairSchedule = schedule
+	if schedule == "" {
+		log.Info("Cover repair is disabled")
+		return
+	}
+
+	c := cron.New()
+	if _, err := c.AddFunc(schedule, RepairCovers); err != nil {
+		log.Errorf("Error adding cover repair job: %s", err)
+		return
+	}
+	c.Start()
+	coverRepairCron = c
+	log.Infof("Cover repair registered with cron schedule '%s'", schedule)
+}
+
+// RepairCovers retries the covers that are missing or were never downloaded, each manga backing off after a failed
+// attempt and giving up after the configured number of attempts
+func RepairCovers() {
+	if !coverRepairRunning.CompareAndSwap(false, true) {
+		log.Info("Cover repair already running, skipping")
+		return
+	}
+	defer coverRepairRunning.Store(false)
+
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+		return
+	}
+	mangas, err := models.GetMangasWithBrokenCovers(cacheDataDirectory)
+	if err != nil {
+		log.Errorf("Failed to find broken covers: %v", err)
+		return
+	}
+	repairs, err := models.GetCoverRepairs()
+	if err != nil {
+		log.Errorf("Failed to get cover repair attempts: %v", err)
+		return
+	}
+
+	now := time.Now()
+	repaired, failed := 0, 0
+	for _, manga := range mangas {
+		repair, attempted := repairs[manga.Slug]
+		delete(repairs, manga.Slug)
+		if attempted && !repair.Due(now, config.CoverRepairMaxAttempts) {
+			continue
+		}
+
+		if err := repairCover(manga); err != nil {
+			failed++
+			repair, recordErr := models.RecordCoverRepairFailure(manga.Slug, err)
+			if recordErr != nil {
+				log.Errorf("Failed to record cover repair attempt of '%s': %v", manga.Slug, recordErr)
+				continue
+			}
+			if repair.Attempts >= config.CoverRepairMaxAttempts {
+				log.Warnf("Giving up on the cover of '%s' after %d attempts: %v", manga.Slug, repair.Attempts, err)
+			} else {
+				log.Debugf("Failed to repair the cover of '%s', retrying after %s: %v", manga.Slug, repair.NextAttempt.Format(time.RFC3339), err)
+			}
+			continue
+		}
+		repaired++
+		logActivity("cover_repair", manga.Slug)
+	}
+
+	// Records left over belong to mangas that were deleted or got a working cover some other way
+	for slug := range repairs {
+		if err := models.DeleteCoverRepair(slug); err != nil {
+			log.Errorf("Failed to delete cover repair attempts of '%s': %v", slug, err)
+		}
+	}
+
+	if repaired > 0 || failed > 0 {
+		log.Infof("Cover repair completed, %d repaired and %d failed", repaired, failed)
+	}
+}
+
+// repairCover downloads the cover a manga already points at, or looks for a local poster and then a MangaDex cover
+// unless its library has metadata disabled
+func repairCover(manga models.Manga) error {
+	unlock := lockSlug(manga.Slug)
+	defer unlock()
+
+	coverURL, err := findCover(manga)
+	if err != nil {
+		return err
+	}
+	return models.SetRepairedCover(manga.Slug, coverURL, utils.CoverAccentColor(cacheDataDirectory, coverURL))
+}
+
+func findCover(manga models.Manga) (string, error) {
+	if u, err := url.Parse(manga.CoverArtURL); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "localhost:3000" {
+		return downloadCover(manga.Slug, manga.CoverArtURL)
+	}
+
+	if manga.Path != "" {
+		localURL, err := handleLocalImages(manga.Slug, manga.Path)
+		if err != nil {
+			return "", err
+		}
+		if localURL != "" {
+			return localURL, nil
+		}
+	}
+
+	if library, err := models.GetLibrary(manga.LibrarySlug); err == nil && library.MetadataProvider() == "" {
+		return "", errors.New("no local cover found")
+	}
+	match, err := models.GetBestMatchMangadexManga(manga.Name)
+	if err != nil {
+		return "", err
+	}
+	coverArtURL := getCoverArtURL(match)
+	if coverArtURL == "" {
+		return "", errors.New("no cover found")
+	}
+	return downloadCover(manga.Slug, coverArtURL)
+}
+
+// downloadCover caches a remote cover, unlike downloadAndCacheImage a failed download is reported as an error
+func downloadCover(slug, coverArtURL string) (string, error) {
+	u, err := url.Parse(coverArtURL)
+	if err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(u.Path)
+	if ext == "" {
+		return "", fmt.Errorf("cover URL without a file extension: %s", coverArtURL)
+	}
+	if err := utils.DownloadImage(cacheDataDirectory, slug, coverArtURL); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s%s", localServerBaseURL, slug, ext), nil
+}
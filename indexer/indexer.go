@@ -1,11 +1,13 @@
 package indexer
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -19,68 +21,180 @@ const (
 	localServerBaseURL = "http://localhost:3000/api/images"
 )
 
-func IndexManga(absolutePath, librarySlug string) (string, error) {
-	defer utils.LogDuration("IndexManga", time.Now(), absolutePath)
+// slugLocks holds a mutex per manga slug, so the same series is never indexed concurrently. A mutex only lives while
+// it is held or waited for, so the slugs of deleted or renamed series don't pile up.
+var slugLocks = struct {
+	sync.Mutex
+	locks map[string]*slugLock
+}{locks: make(map[string]*slugLock)}
+
+// slugLock is the mutex of a slug and the number of goroutines holding or waiting for it
+type slugLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockSlug acquires the lock for a slug and returns the function releasing it
+func lockSlug(slug string) func() {
+	slugLocks.Lock()
+	lock, ok := slugLocks.locks[slug]
+	if !ok {
+		lock = &slugLock{}
+		slugLocks.locks[slug] = lock
+	}
+	lock.refs++
+	slugLocks.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		slugLocks.Lock()
+		defer slugLocks.Unlock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(slugLocks.locks, slug)
+		}
+	}
+}
+
+// IndexManga indexes a series found in a folder of a library, skipping the chapters matched by the ignore rules of the library folder
+func IndexManga(root MediaRoot, library models.Library, ignore utils.IgnoreRules) (string, error) {
+	defer utils.LogDuration("IndexManga", time.Now(), root.String())
 
-	cleanedName := utils.RemovePatterns(filepath.Base(absolutePath))
+	cleanedName := utils.RemovePatterns(root.Name)
 	if cleanedName == "" {
 		return "", nil
 	}
 
 	slug := utils.Sluggify(cleanedName)
+
+	// The same title can live in several folders, serialize indexing of the same slug
+	unlock := lockSlug(slug)
+	defer unlock()
+
 	if exists, _ := models.MangaExists(slug); exists {
-		log.Debugf("Skipping: '%s', it has already been indexed", cleanedName)
-		return "", nil
+		chapterCount, err := IndexChapters(slug, root, library, ignore)
+		if err != nil {
+			log.Errorw(fmt.Sprintf("Failed to re-index chapters: %s (%s)", slug, err.Error()), utils.LogChannelKey, logChannel(library.Slug))
+			return "", err
+		}
+		indexMangaCovers(slug, root, library)
+		if tags := folderTags(root, library); len(tags) > 0 {
+			if _, err := models.MergeMangaTags(slug, tags); err != nil {
+				log.Errorw(fmt.Sprintf("Failed to add the folder tags of '%s': %s", slug, err), utils.LogChannelKey, logChannel(library.Slug))
+			}
+		}
+		log.Debugf("Re-indexed chapters for: '%s', it has already been indexed (%d new chapters)", cleanedName, chapterCount)
+		return slug, nil
 	}
 
-	bestMatch, err := models.GetBestMatchMangadexManga(cleanedName)
-	if err != nil {
-		log.Warnf("No search result found for: '%s', falling back to local metadata", slug)
+	// Rather than guessing, a match that isn't confident enough is left for an admin to confirm, while a provider that
+	// is down is asked again later
+	var lowConfidence *models.LowConfidenceMatchError
+	var unavailable error
+	var title string
+	var bestMatch *models.MangaDetail
+	var err error
+	if library.MetadataProvider() != "" {
+		title = metadataTitle(cleanedName, root, library, ignore)
+		bestMatch, err = models.GetBestMatchMangadexManga(title)
+	} else {
+		log.Debugf("Metadata is disabled for library '%s', indexing '%s' with local metadata", library.Slug, slug)
+	}
+	if errors.As(err, &lowConfidence) {
+		log.Warnw(fmt.Sprintf("No confident match found for: '%s' (%s), falling back to local metadata and queueing it for review", slug, err), utils.LogChannelKey, logChannel(library.Slug))
+	} else if models.IsProviderUnavailable(err) {
+		unavailable = err
+		log.Warnw(fmt.Sprintf("MangaDex is unavailable for: '%s' (%s), falling back to local metadata until a retry reaches it", slug, err), utils.LogChannelKey, logChannel(library.Slug))
+	} else if err != nil {
+		log.Warnw(fmt.Sprintf("No search result found for: '%s', falling back to local metadata", slug), utils.LogChannelKey, logChannel(library.Slug))
 	}
 
-	cachedImageURL, err := handleCoverArt(bestMatch, slug, absolutePath)
+	cachedImageURL, err := handleCoverArt(bestMatch, slug, root)
 	if err != nil {
-		log.Errorf("Failed to handle cover image for: '%s'", slug)
+		log.Errorw(fmt.Sprintf("Failed to handle cover image for: '%s'", slug), utils.LogChannelKey, logChannel(library.Slug))
 		return "", err
 	}
 
-	newManga := createMangaFromMatch(bestMatch, cleanedName, slug, librarySlug, absolutePath, cachedImageURL)
+	newManga := createMangaFromMatch(bestMatch, cleanedName, slug, library.Slug, root.Path, cachedImageURL)
+	newManga.AccentColor = utils.CoverAccentColor(cacheDataDirectory, cachedImageURL)
+	if tags, err := models.MergeTags(newManga.Tags, folderTags(root, library)); err != nil {
+		log.Errorw(fmt.Sprintf("Failed to add the folder tags of '%s': %s", slug, err), utils.LogChannelKey, logChannel(library.Slug))
+	} else {
+		newManga.Tags = tags
+	}
+	models.ApplyInferredContentRating(&newManga)
 
 	if err := models.CreateManga(newManga); err != nil {
-		log.Errorf("Failed to create manga: %s (%s)", slug, err.Error())
+		log.Errorw(fmt.Sprintf("Failed to create manga: %s (%s)", slug, err.Error()), utils.LogChannelKey, logChannel(library.Slug))
 		return "", err
 	}
 
-	chapterCount, err := IndexChapters(slug, absolutePath)
+	if lowConfidence != nil {
+		if err := models.QueueMetadataReview(slug, title, lowConfidence.Candidates); err != nil {
+			log.Errorf("Failed to queue '%s' for metadata review: %s", slug, err)
+		}
+	}
+	if unavailable != nil {
+		if err := models.QueueMetadataRetry(slug, title, unavailable); err != nil {
+			log.Errorf("Failed to queue '%s' for a metadata retry: %s", slug, err)
+		}
+	}
+
+	chapterCount, err := IndexChapters(slug, root, library, ignore)
 	if err != nil {
-		log.Errorf("Failed to index chapters: %s (%s)", slug, err.Error())
+		log.Errorw(fmt.Sprintf("Failed to index chapters: %s (%s)", slug, err.Error()), utils.LogChannelKey, logChannel(library.Slug))
 		return "", err
 	}
+	indexMangaCovers(slug, root, library)
 
-	log.Infof("Indexed manga: '%s' (%d chapters)", cleanedName, chapterCount)
+	log.Infow(fmt.Sprintf("Indexed manga: '%s' (%d chapters)", cleanedName, chapterCount), utils.LogChannelKey, logChannel(library.Slug))
+	logActivity("manga_create", slug)
 	return slug, nil
 }
 
+// folderTags returns the tags the tag patterns of a library find in the name of a series, they are added to the
+// provider tags
+func folderTags(root MediaRoot, library models.Library) []string {
+	patterns, err := utils.ParseTagPatterns(library.TagPatterns)
+	if err != nil {
+		log.Errorw(fmt.Sprintf("Invalid tag patterns: %s", err), utils.LogChannelKey, logChannel(library.Slug))
+		return nil
+	}
+	return utils.ExtractTags(root.Name, patterns)
+}
+
 func createMangaFromMatch(match *models.MangaDetail, name, slug, librarySlug, path, coverURL string) models.Manga {
-	return models.Manga{
+	manga := models.Manga{
 		Name:             name,
 		Slug:             slug,
 		Description:      getStringAttribute(match, func(m *models.MangaDetail) string { return m.Attributes.Description["en"] }),
 		Year:             getIntAttribute(match, func(m *models.MangaDetail) int { return m.Attributes.Year }),
 		OriginalLanguage: getStringAttribute(match, func(m *models.MangaDetail) string { return m.Attributes.OriginalLanguage }),
 		Status:           getStringAttribute(match, func(m *models.MangaDetail) string { return m.Attributes.Status }),
-		ContentRating:    getStringAttribute(match, func(m *models.MangaDetail) string { return m.Attributes.ContentRating }),
 		CoverArtURL:      coverURL,
 		LibrarySlug:      librarySlug,
 		Path:             path,
 		Author:           getAuthor(match),
+		Tags:             match.TagNames(),
+		Aliases:          match.AliasNames(name),
+		Type:             match.MangaType(),
 	}
+	if match != nil {
+		models.ApplyProviderContentRating(&manga, models.MetadataProviderMangaDex, match.Attributes.ContentRating)
+	}
+	return manga
 }
 
-func handleCoverArt(bestMatch *models.MangaDetail, slug, absolutePath string) (string, error) {
+func handleCoverArt(bestMatch *models.MangaDetail, slug string, root MediaRoot) (string, error) {
 	coverArtURL := getCoverArtURL(bestMatch)
+	// The images of a folder shared by several series belong to none of them
+	if coverArtURL == "" && root.shared() {
+		return "", nil
+	}
 	if coverArtURL == "" {
-		return handleLocalImages(slug, absolutePath)
+		return handleLocalImages(slug, root.Path)
 	}
 	return downloadAndCacheImage(slug, coverArtURL)
 }
@@ -120,12 +234,19 @@ func processLocalImage(slug, imagePath string) (string, error) {
 	originalFile := filepath.Join(cacheDataDirectory, fmt.Sprintf("%s_original.%s", slug, fileExt))
 	croppedFile := filepath.Join(cacheDataDirectory, fmt.Sprintf("%s.%s", slug, fileExt))
 
+	// Without room in the cache the series is indexed without a cover, the cover repair picks it up later
+	if err := utils.EnsureCacheSpace(); err != nil {
+		log.Warnf("Skipped caching the cover of '%s': %s", slug, err)
+		return "", nil
+	}
 	if err := utils.CopyFile(imagePath, originalFile); err != nil {
 		return "", fmt.Errorf("failed to copy file: %w", err)
 	}
 
-	if err := utils.ProcessImage(originalFile, croppedFile); err != nil {
-		return "", fmt.Errorf("failed to crop image: %w", err)
+	if !utils.LazyPosters() {
+		if err := utils.ProcessImage(originalFile, croppedFile); err != nil {
+			return "", fmt.Errorf("failed to crop image: %w", err)
+		}
 	}
 
 	return fmt.Sprintf("%s/%s.%s", localServerBaseURL, slug, fileExt), nil
@@ -180,39 +301,228 @@ func getAuthor(match *models.MangaDetail) string {
 	return ""
 }
 
-func IndexChapters(slug, path string) (int, error) {
-	entries, err := os.ReadDir(path)
+// IndexChapters indexes the chapters of a series, skipping the extensions excluded from the library. The ignore
+// rules are relative to its library folder.
+func IndexChapters(slug string, root MediaRoot, library models.Library, ignore utils.IgnoreRules) (int, error) {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		return 0, err
+	}
+	path := root.Path
+	files, err := findChapterFiles(slug, root, library, ignore, config)
 	if err != nil {
 		return 0, err
 	}
+	if files, err = resolveDuplicateChapters(slug, path, files, library, config); err != nil {
+		return 0, err
+	}
+
+	var renames map[string]models.Chapter
+	if config.DetectChapterRenames {
+		if renames, err = detectChapterRenames(slug, path, files); err != nil {
+			return 0, err
+		}
+	}
 
 	var chapterCount int
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	for _, file := range files {
+		entry, cleanedName, chapterSlug := file.entry, file.name, file.slug
+
+		pageCount, err := utils.CountImageFiles(filepath.Join(path, entry.Name()))
+		if err != nil {
+			log.Debugf("Failed to count pages for: '%s' - '%s' (%s)", slug, entry.Name(), err)
 		}
 
-		cleanedName := utils.RemovePatterns(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
-		if !containsNumber(cleanedName) {
-			log.Debugf("Chapter index was skipped for: '%s' - '%s' (no numeric value)", slug, cleanedName)
+		fileSize, fileModTime, err := utils.ChapterFileInfo(filepath.Join(path, entry.Name()))
+		if err != nil {
+			log.Debugf("Failed to stat chapter for: '%s' - '%s' (%s)", slug, entry.Name(), err)
+		}
+
+		existing, err := models.GetChapter(slug, chapterSlug)
+		if err == nil {
+			changed := existing.File != entry.Name() || existing.FileChanged(fileSize, fileModTime)
+			if err := refreshChapter(existing, library.Slug, entry.Name(), pageCount, fileSize, fileModTime); err != nil {
+				return 0, fmt.Errorf("failed to refresh chapter '%s' for manga '%s': %w", cleanedName, slug, err)
+			}
+			if changed && config.CheckChapterPages {
+				checkChapterPages(slug, chapterSlug, filepath.Join(path, entry.Name()))
+			}
 			continue
 		}
 
 		chapter := models.Chapter{
-			Name:      cleanedName,
-			Slug:      utils.Sluggify(cleanedName),
-			File:      entry.Name(),
-			MangaSlug: slug,
+			Name:        cleanedName,
+			Slug:        chapterSlug,
+			File:        entry.Name(),
+			MangaSlug:   slug,
+			PageCount:   pageCount,
+			FileSize:    fileSize,
+			FileModTime: fileModTime,
+		}
+		if renamed, ok := renames[chapterSlug]; ok {
+			chapter.CreatedAt = renamed.CreatedAt
+			chapter.UpdatedAt = time.Now()
+			if err := models.RenameChapter(slug, renamed.Slug, chapter); err != nil {
+				return 0, fmt.Errorf("failed to rename chapter '%s' to '%s' for manga '%s': %w", renamed.Name, cleanedName, slug, err)
+			}
+			log.Infow(fmt.Sprintf("Renamed chapter: '%s' - '%s' to '%s'", slug, renamed.File, entry.Name()), utils.LogChannelKey, logChannel(library.Slug))
+			logActivity("chapter_rename", slug+"/"+chapterSlug)
+			continue
 		}
 		if err := models.CreateChapter(chapter); err != nil {
 			return 0, fmt.Errorf("failed to index chapter '%s' for manga '%s': %w", cleanedName, slug, err)
 		}
+		if config.CheckChapterPages {
+			checkChapterPages(slug, chapterSlug, filepath.Join(path, entry.Name()))
+		}
 		chapterCount++
 	}
 
 	return chapterCount, nil
 }
 
+// findChapterFiles lists the entries of a series that are indexed as its chapters, with their cleaned names and slugs
+func findChapterFiles(slug string, root MediaRoot, library models.Library, ignore utils.IgnoreRules, config models.AppConfig) ([]chapterFile, error) {
+	path := root.Path
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []chapterFile
+	for _, entry := range entries {
+		if !root.includes(entry.Name()) {
+			continue
+		}
+		if ignore.Ignored(filepath.Join(root.Rel, entry.Name()), entry.IsDir()) {
+			log.Debugf("Chapter index was skipped for: '%s' - '%s' (ignored)", slug, entry.Name())
+			continue
+		}
+		if !config.IsChapterFormatEnabled(filepath.Join(path, entry.Name())) {
+			log.Debugf("Chapter index was skipped for: '%s' - '%s' (format not enabled)", slug, entry.Name())
+			continue
+		}
+		if library.ExcludesFile(entry.Name()) {
+			log.Debugf("Chapter index was skipped for: '%s' - '%s' (extension excluded from the library)", slug, entry.Name())
+			continue
+		}
+
+		chapterName := entry.Name()
+		if !entry.IsDir() {
+			chapterName = trimChapterExtension(chapterName)
+		}
+		cleanedName := utils.RemovePatterns(chapterName)
+		// Files of a shared folder are named after their series, which the cleanup can cut before the number
+		if root.shared() {
+			cleanedName = cleanFileName(entry.Name())
+		}
+		// The file of a single file series is its only chapter, numbered or not
+		if !containsNumber(cleanedName) && !root.SingleFile {
+			log.Debugf("Chapter index was skipped for: '%s' - '%s' (no numeric value)", slug, cleanedName)
+			continue
+		}
+		files = append(files, chapterFile{entry: entry, name: cleanedName, slug: utils.Sluggify(cleanedName)})
+	}
+	return files, nil
+}
+
+// chapterFile is a chapter file or folder found in a series folder
+type chapterFile struct {
+	entry os.DirEntry
+	name  string
+	slug  string
+}
+
+// detectChapterRenames pairs the new chapters of a series folder with the indexed chapters they replace, by slug.
+// A chapter counts as renamed when its file is gone and it is the only missing chapter with its number, while the new
+// file is the only new one with that number. Anything ambiguous, such as a chapter split into several files, is
+// indexed as new chapters.
+func detectChapterRenames(slug, path string, files []chapterFile) (map[string]models.Chapter, error) {
+	indexed, err := models.GetChapters(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]bool, len(files))
+	found := make(map[string]bool, len(files))
+	for _, file := range files {
+		present[file.entry.Name()] = true
+		found[file.slug] = true
+	}
+
+	known := make(map[string]bool, len(indexed))
+	missing := make(map[float64][]models.Chapter)
+	for _, chapter := range indexed {
+		known[chapter.Slug] = true
+		if present[chapter.File] || found[chapter.Slug] {
+			continue
+		}
+		// Files that are only ignored or excluded now are still there
+		if _, err := os.Stat(filepath.Join(path, chapter.File)); err == nil {
+			continue
+		}
+		if number, err := utils.ExtractDecimalNumber(chapter.Name); err == nil {
+			missing[number] = append(missing[number], chapter)
+		}
+	}
+
+	added := make(map[float64][]chapterFile)
+	for _, file := range files {
+		if known[file.slug] {
+			continue
+		}
+		if number, err := utils.ExtractDecimalNumber(file.name); err == nil {
+			added[number] = append(added[number], file)
+		}
+	}
+
+	renames := make(map[string]models.Chapter)
+	for number, files := range added {
+		if len(files) == 1 && len(missing[number]) == 1 {
+			renames[files[0].slug] = missing[number][0]
+		}
+	}
+	return renames, nil
+}
+
+// refreshChapter updates an already indexed chapter if its file or page count went stale,
+// a chapter whose source file was replaced in place is reported as re-released on the log channel of its library
+func refreshChapter(chapter *models.Chapter, librarySlug, file string, pageCount int, fileSize int64, fileModTime time.Time) error {
+	replaced := chapter.File == file && chapter.FileChanged(fileSize, fileModTime)
+	untracked := chapter.FileSize == 0 && chapter.FileModTime.IsZero()
+	if chapter.File == file && chapter.PageCount == pageCount && !replaced && !untracked {
+		return nil
+	}
+
+	log.Debugf("Updating chapter: '%s' - '%s' (%d pages)", chapter.MangaSlug, chapter.Slug, pageCount)
+	chapter.File = file
+	chapter.PageCount = pageCount
+	chapter.FileSize = fileSize
+	chapter.FileModTime = fileModTime
+	if replaced {
+		chapter.UpdatedAt = time.Now()
+	}
+	if err := models.UpdateChapter(chapter); err != nil {
+		return err
+	}
+
+	if replaced {
+		log.Infow(fmt.Sprintf("Chapter was re-released: '%s' - '%s'", chapter.MangaSlug, chapter.Slug), utils.LogChannelKey, logChannel(librarySlug))
+		logActivity("chapter_update", chapter.MangaSlug+"/"+chapter.Slug)
+		models.NotifyListeners(models.Notification{Type: "chapter_updated", Payload: *chapter})
+	}
+	return nil
+}
+
+// trimChapterExtension removes the file extension, including double extensions like .tar.gz
+func trimChapterExtension(fileName string) string {
+	name := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	if strings.HasSuffix(strings.ToLower(name), ".tar") {
+		name = name[:len(name)-len(".tar")]
+	}
+	return name
+}
+
 func containsNumber(s string) bool {
 	for _, r := range s {
 		if unicode.IsDigit(r) {
@@ -221,3 +531,10 @@ func containsNumber(s string) bool {
 	}
 	return false
 }
+
+// logActivity records an activity log entry on behalf of the indexer
+func logActivity(activityType, target string) {
+	if err := models.LogActivity("indexer", activityType, target); err != nil {
+		log.Errorf("Failed to log activity '%s' on '%s': %v", activityType, target, err)
+	}
+}
@@ -0,0 +1,300 @@
+package indexer
+
+import (
+	"archive/zip"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexander-bruun/magi/models"
+)
+
+// setupTestIndexer opens a fresh database and cache directory for the duration of a test
+func setupTestIndexer(t *testing.T) {
+	t.Helper()
+	if err := models.Initialize(t.TempDir()); err != nil {
+		t.Fatalf("failed to initialize the database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := models.Close(); err != nil {
+			t.Errorf("failed to close the database: %v", err)
+		}
+	})
+	cacheDataDirectory = t.TempDir()
+}
+
+func TestLockSlugSerializesTheSameSlug(t *testing.T) {
+	var holders, maxHolders atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := lockSlug("same")
+			defer unlock()
+
+			current := holders.Add(1)
+			for {
+				seen := maxHolders.Load()
+				if current <= seen || maxHolders.CompareAndSwap(seen, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			holders.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if got := maxHolders.Load(); got != 1 {
+		t.Errorf("%d goroutines held the lock of the same slug at once, want 1", got)
+	}
+	if len(slugLocks.locks) != 0 {
+		t.Errorf("%d slug locks left after every lock was released, want none", len(slugLocks.locks))
+	}
+}
+
+func TestLockSlugKeepsOtherSlugsParallel(t *testing.T) {
+	unlock := lockSlug("first")
+	defer unlock()
+
+	done := make(chan struct{})
+	go func() {
+		lockSlug("second")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("locking another slug waited for the lock of the first one")
+	}
+}
+
+func TestIndexMangaConcurrentlyCreatesTheSeriesOnce(t *testing.T) {
+	setupTestIndexer(t)
+
+	root := filepath.Join(t.TempDir(), "Concurrent")
+	for _, chapter := range []string{"Chapter 1", "Chapter 2"} {
+		if err := os.MkdirAll(filepath.Join(root, chapter), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, chapter, "001.jpg"), []byte("page"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Processing the poster between the existing-vs-new decision and the create widens the window of a race
+	poster, err := os.Create(filepath.Join(root, "poster.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(poster, image.NewRGBA(image.Rect(0, 0, 400, 600))); err != nil {
+		t.Fatal(err)
+	}
+	poster.Close()
+	library := models.Library{Slug: "library", MetadataDisabled: true}
+	mediaRoot := MediaRoot{Path: root, Name: "Concurrent"}
+
+	// The goroutines wait for each other so they all hit the existing-vs-new decision together
+	const workers = 16
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, workers)
+	slugs := make(chan string, workers)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			slug, err := IndexManga(mediaRoot, library, nil)
+			errs <- err
+			slugs <- slug
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	close(slugs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent index failed: %v", err)
+		}
+	}
+	var slug string
+	for indexed := range slugs {
+		if slug != "" && indexed != slug {
+			t.Errorf("got slugs '%s' and '%s', want the same series", slug, indexed)
+		}
+		slug = indexed
+	}
+	mangas, err := models.GetAllMangas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mangas) != 1 {
+		t.Errorf("got %d series, want 1", len(mangas))
+	}
+	chapters, err := models.GetChapters(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chapters) != 2 {
+		t.Errorf("got %d chapters, want 2", len(chapters))
+	}
+}
+
+func TestIndexChaptersSkipsDisabledFormats(t *testing.T) {
+	setupTestIndexer(t)
+	config := models.DefaultAppConfig()
+	config.ChapterFormats = slices.DeleteFunc(config.ChapterFormats, func(name string) bool { return name == "folder" })
+	if err := models.UpdateAppConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(t.TempDir(), "Formats")
+	writeChapter(t, root, "Chapter 1", 1)
+	archive, err := os.Create(filepath.Join(root, "Chapter 2.cbz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := zip.NewWriter(archive)
+	page, err := writer.Create("001.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.Write([]byte("page"))
+	writer.Close()
+	archive.Close()
+
+	slug, err := IndexManga(MediaRoot{Path: root, Name: "Formats"}, models.Library{Slug: "library", MetadataDisabled: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chapters, err := models.GetChapters(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chapters) != 1 || chapters[0].File != "Chapter 2.cbz" {
+		t.Errorf("got chapters %+v, want only the cbz chapter with image folders disabled", chapters)
+	}
+}
+
+func TestIndexChaptersSkipsExtensionsExcludedFromTheLibrary(t *testing.T) {
+	setupTestIndexer(t)
+	root := filepath.Join(t.TempDir(), "Extras")
+	writeChapter(t, root, "Chapter 1", 1)
+	for _, name := range []string{"Chapter 2.cbz", "Chapter 3.zip"} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The same files indexed by a library excluding zip archives and by one that doesn't
+	for _, test := range []struct {
+		library models.Library
+		want    int
+	}{
+		{models.Library{Slug: "excluding", MetadataDisabled: true, ExcludedExtensions: []string{".zip"}}, 2},
+		{models.Library{Slug: "including", MetadataDisabled: true}, 3},
+	} {
+		slug, err := IndexManga(MediaRoot{Path: root, Name: "Extras"}, test.library, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chapters, err := models.GetChapters(slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chapters) != test.want {
+			t.Errorf("library '%s' indexed %d chapters, want %d", test.library.Slug, len(chapters), test.want)
+		}
+		if err := models.DeleteManga(slug); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIndexMangaMergesFolderTags(t *testing.T) {
+	setupTestIndexer(t)
+	root := filepath.Join(t.TempDir(), "[Action][Completed] Tagged")
+	writeChapter(t, root, "Chapter 1", 1)
+	library := models.Library{Slug: "library", MetadataDisabled: true, TagPatterns: `\[([^\]]+)\]`}
+	mediaRoot := MediaRoot{Path: root, Name: filepath.Base(root)}
+
+	slug, err := IndexManga(mediaRoot, library, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manga, err := models.GetManga(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Action", "Completed"}; !slices.Equal(manga.Tags, want) {
+		t.Errorf("got tags %v, want %v", manga.Tags, want)
+	}
+
+	// Tags reset by a metadata refresh are merged back on the next index, the provider tags are kept
+	manga.Tags = []string{"Drama"}
+	if err := models.UpdateManga(manga); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IndexManga(mediaRoot, library, nil); err != nil {
+		t.Fatal(err)
+	}
+	if manga, err = models.GetManga(slug); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Drama", "Action", "Completed"}; !slices.Equal(manga.Tags, want) {
+		t.Errorf("got tags %v after indexing again, want %v", manga.Tags, want)
+	}
+}
+
+// countingTransport fails every request it is asked to send, counting them
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return nil, errors.New("no external requests in tests")
+}
+
+func TestIndexMangaSkipsTheProviderOfLibrariesWithMetadataDisabled(t *testing.T) {
+	setupTestIndexer(t)
+	transport := &countingTransport{}
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = transport
+	t.Cleanup(func() { http.DefaultTransport = defaultTransport })
+
+	for _, test := range []struct {
+		name    string
+		library models.Library
+		lookups bool
+	}{
+		{"Enabled", models.Library{Slug: "provider"}, true},
+		{"Disabled", models.Library{Slug: "local", MetadataDisabled: true}, false},
+	} {
+		root := filepath.Join(t.TempDir(), test.name)
+		writeChapter(t, root, "Chapter 1", 1)
+		transport.requests.Store(0)
+
+		slug, err := IndexManga(MediaRoot{Path: root, Name: test.name}, test.library, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if requests := transport.requests.Load(); (requests > 0) != test.lookups {
+			t.Errorf("library '%s' sent %d external requests, want lookups %v", test.library.Slug, requests, test.lookups)
+		}
+		if _, err := models.GetManga(slug); err != nil {
+			t.Errorf("library '%s' didn't index the series from local metadata: %v", test.library.Slug, err)
+		}
+	}
+}
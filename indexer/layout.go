@@ -0,0 +1,217 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2/log"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+)
+
+// layoutSampleSize is the number of folders the auto layout looks into before guessing the layout of a library folder
+const layoutSampleSize = 20
+
+// MediaRoot is a series found in a library folder, held by a folder of its own or by some files of a shared folder
+type MediaRoot struct {
+	// Path is the folder holding the chapters of the series
+	Path string
+	// Rel is the path of the folder relative to its library folder, which the ignore rules are matched against
+	Rel string
+	// Name is the name the title of the series is cleaned from
+	Name string
+	// Files limits the chapters to these files of the folder, nil indexes every entry of the folder
+	Files []string
+	// SingleFile marks a series held by a single file, which is its only chapter whatever its name
+	SingleFile bool
+}
+
+// includes reports whether an entry of the folder of the series belongs to it
+func (r MediaRoot) includes(name string) bool {
+	return r.Files == nil || slices.Contains(r.Files, name)
+}
+
+// shared reports whether the folder of the series holds other series as well, its images then belong to none of them
+func (r MediaRoot) shared() bool {
+	return r.Files != nil
+}
+
+// String describes a media root in log lines
+func (r MediaRoot) String() string {
+	if r.shared() {
+		return fmt.Sprintf("'%s' in '%s'", r.Name, r.Path)
+	}
+	return fmt.Sprintf("'%s'", r.Path)
+}
+
+// folderRoot is the media root of a series held by a folder of its own
+func folderRoot(path, rel string) MediaRoot {
+	return MediaRoot{Path: path, Rel: rel, Name: filepath.Base(path)}
+}
+
+// bracketedPattern matches the bracketed parts of a file name, such as scanlation groups and years
+var bracketedPattern = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)|\{[^}]*\}`)
+
+// volumeMarkerPattern matches the volume or chapter part of a file name, such as " v01", " - Chapter 12" or " #3",
+// and everything after it
+var volumeMarkerPattern = regexp.MustCompile(`(?i)[\s._-]+(v|vol\.?|volume|c|ch\.?|chapter|#)\s*\d+(\.\d+)?\b.*$`)
+
+// trailingNumberPattern matches a number closing a file name, for names numbered without a marker such as "Akira 03"
+var trailingNumberPattern = regexp.MustCompile(`[\s._-]+\d+(\.\d+)?$`)
+
+// cleanFileName returns the name of a chapter file without its extension and bracketed parts
+func cleanFileName(fileName string) string {
+	name := strings.ReplaceAll(bracketedPattern.ReplaceAllString(trimChapterExtension(fileName), " "), "_", " ")
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// seriesNameOf returns the name of the series a chapter file belongs to, the file name without its bracketed parts
+// and its volume or chapter number
+func seriesNameOf(fileName string) string {
+	name := cleanFileName(fileName)
+	if loc := volumeMarkerPattern.FindStringIndex(name); loc != nil && loc[0] > 0 {
+		name = name[:loc[0]]
+	} else if loc := trailingNumberPattern.FindStringIndex(name); loc != nil && loc[0] > 0 {
+		name = name[:loc[0]]
+	}
+	return strings.Trim(name, " ._-")
+}
+
+// enumerateMediaRoots lists the series of a library folder laid out in the given layout
+func enumerateMediaRoots(folder, layout string, ignore utils.IgnoreRules) ([]MediaRoot, error) {
+	dirs, files, err := visibleEntries(folder, "", ignore)
+	if err != nil {
+		return nil, err
+	}
+	if layout == models.LibraryLayoutAuto {
+		layout = detectLayout(folder, dirs, files, ignore)
+		log.Debugf("Detected the '%s' layout in '%s'", layout, folder)
+	}
+
+	var roots []MediaRoot
+	switch layout {
+	case models.LibraryLayoutPublisherSeries:
+		for _, publisher := range dirs {
+			series, _, err := visibleEntries(filepath.Join(folder, publisher), publisher, ignore)
+			if err != nil {
+				log.Errorf("Failed to read the publisher folder '%s' in '%s': %s", publisher, folder, err)
+				continue
+			}
+			for _, name := range series {
+				roots = append(roots, folderRoot(filepath.Join(folder, publisher, name), filepath.Join(publisher, name)))
+			}
+		}
+	case models.LibraryLayoutFlat:
+		groups := make(map[string]int)
+		for _, file := range files {
+			name := seriesNameOf(file)
+			if name == "" {
+				continue
+			}
+			if i, ok := groups[strings.ToLower(name)]; ok {
+				roots[i].Files = append(roots[i].Files, file)
+				continue
+			}
+			groups[strings.ToLower(name)] = len(roots)
+			roots = append(roots, MediaRoot{Path: folder, Name: name, Files: []string{file}})
+		}
+	case models.LibraryLayoutFilePerSeries:
+		for _, file := range files {
+			roots = append(roots, MediaRoot{Path: folder, Name: trimChapterExtension(file), Files: []string{file}, SingleFile: true})
+		}
+	default:
+		for _, name := range dirs {
+			roots = append(roots, folderRoot(filepath.Join(folder, name), name))
+		}
+	}
+	return roots, nil
+}
+
+// visibleEntries returns the folders and chapter files of a folder that aren't ignored, rel is the path of the folder
+// relative to its library folder
+func visibleEntries(folder, rel string, ignore utils.IgnoreRules) (dirs, files []string, err error) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		if ignore.Ignored(filepath.Join(rel, entry.Name()), entry.IsDir()) {
+			log.Debugf("Skipping '%s' in '%s' (ignored)", entry.Name(), folder)
+			continue
+		}
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		} else if utils.GetChapterFormat(entry.Name()) != nil {
+			files = append(files, entry.Name())
+		}
+	}
+	return dirs, files, nil
+}
+
+// detectLayout guesses the layout of a library folder from its entries. Folders mostly holding chapter files lay out
+// their series flat, as a file per series when no two files belong to the same series. Otherwise a sample of the
+// subfolders decides between a folder per series and a folder per publisher: series folders hold chapter files or
+// folders of images, publisher folders hold folders that do.
+func detectLayout(folder string, dirs, files []string, ignore utils.IgnoreRules) string {
+	if len(files) > len(dirs) {
+		seen := make(map[string]bool)
+		for _, file := range files {
+			name := strings.ToLower(seriesNameOf(file))
+			if seen[name] {
+				return models.LibraryLayoutFlat
+			}
+			seen[name] = true
+		}
+		return models.LibraryLayoutFilePerSeries
+	}
+
+	var seriesVotes, publisherVotes int
+	for _, dir := range dirs[:min(len(dirs), layoutSampleSize)] {
+		switch {
+		case holdsChapters(filepath.Join(folder, dir), dir, ignore):
+			seriesVotes++
+		case holdsSeries(filepath.Join(folder, dir), dir, ignore):
+			publisherVotes++
+		}
+	}
+	if publisherVotes > seriesVotes {
+		return models.LibraryLayoutPublisherSeries
+	}
+	return models.LibraryLayoutSeriesFolders
+}
+
+// holdsChapters reports whether a folder directly holds chapter files or folders of images
+func holdsChapters(folder, rel string, ignore utils.IgnoreRules) bool {
+	dirs, files, err := visibleEntries(folder, rel, ignore)
+	if err != nil {
+		return false
+	}
+	if len(files) > 0 {
+		return true
+	}
+	for _, dir := range dirs {
+		if count, _ := utils.CountImageFiles(filepath.Join(folder, dir)); count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// holdsSeries reports whether one of the subfolders of a folder holds chapters
+func holdsSeries(folder, rel string, ignore utils.IgnoreRules) bool {
+	dirs, _, err := visibleEntries(folder, rel, ignore)
+	if err != nil {
+		return false
+	}
+	for _, dir := range dirs {
+		if holdsChapters(filepath.Join(folder, dir), filepath.Join(rel, dir), ignore) {
+			return true
+		}
+	}
+	return false
+}
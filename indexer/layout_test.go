@@ -0,0 +1,121 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+)
+
+// writeFixture creates empty files at the given paths of a folder, along with their parent folders
+func writeFixture(t *testing.T, folder string, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		path = filepath.Join(folder, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("page"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEnumerateMediaRoots(t *testing.T) {
+	for _, test := range []struct {
+		layout  string
+		fixture []string
+		want    func(folder string) []MediaRoot
+	}{
+		{
+			layout:  models.LibraryLayoutSeriesFolders,
+			fixture: []string{"Alpha/Chapter 1/001.jpg", "Alpha/Chapter 2/001.jpg", "Bravo/Chapter 1.cbz"},
+			want: func(folder string) []MediaRoot {
+				return []MediaRoot{
+					{Path: filepath.Join(folder, "Alpha"), Rel: "Alpha", Name: "Alpha"},
+					{Path: filepath.Join(folder, "Bravo"), Rel: "Bravo", Name: "Bravo"},
+				}
+			},
+		},
+		{
+			layout:  models.LibraryLayoutPublisherSeries,
+			fixture: []string{"Kodansha/Akira/Chapter 1.cbz", "Kodansha/Ghost/Chapter 1.cbz", "Shueisha/Naruto/Chapter 1/001.jpg"},
+			want: func(folder string) []MediaRoot {
+				return []MediaRoot{
+					{Path: filepath.Join(folder, "Kodansha", "Akira"), Rel: filepath.Join("Kodansha", "Akira"), Name: "Akira"},
+					{Path: filepath.Join(folder, "Kodansha", "Ghost"), Rel: filepath.Join("Kodansha", "Ghost"), Name: "Ghost"},
+					{Path: filepath.Join(folder, "Shueisha", "Naruto"), Rel: filepath.Join("Shueisha", "Naruto"), Name: "Naruto"},
+				}
+			},
+		},
+		{
+			layout:  models.LibraryLayoutFlat,
+			fixture: []string{"Akira v01.cbz", "Akira v02.cbz", "Naruto - Chapter 13.cbz", "[Group] Naruto - Chapter 12 (2002).cbz", "notes.txt"},
+			want: func(folder string) []MediaRoot {
+				return []MediaRoot{
+					{Path: folder, Name: "Akira", Files: []string{"Akira v01.cbz", "Akira v02.cbz"}},
+					{Path: folder, Name: "Naruto", Files: []string{"Naruto - Chapter 13.cbz", "[Group] Naruto - Chapter 12 (2002).cbz"}},
+				}
+			},
+		},
+		{
+			layout:  models.LibraryLayoutFilePerSeries,
+			fixture: []string{"Akira.cbz", "Ghost in the Shell.cbz"},
+			want: func(folder string) []MediaRoot {
+				return []MediaRoot{
+					{Path: folder, Name: "Akira", Files: []string{"Akira.cbz"}, SingleFile: true},
+					{Path: folder, Name: "Ghost in the Shell", Files: []string{"Ghost in the Shell.cbz"}, SingleFile: true},
+				}
+			},
+		},
+	} {
+		folder := t.TempDir()
+		writeFixture(t, folder, test.fixture...)
+		want := test.want(folder)
+
+		for _, layout := range []string{test.layout, models.LibraryLayoutAuto} {
+			roots, err := enumerateMediaRoots(folder, layout, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(roots, want) {
+				t.Errorf("the '%s' layout of a %s fixture got %+v, want %+v", layout, test.layout, roots, want)
+			}
+		}
+	}
+}
+
+func TestEnumerateMediaRootsSkipsIgnoredSeries(t *testing.T) {
+	folder := t.TempDir()
+	writeFixture(t, folder, "Kodansha/Akira/Chapter 1.cbz", "Kodansha/Ghost/Chapter 1.cbz")
+	ignore, err := utils.ParseIgnorePatterns("Kodansha/Ghost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots, err := enumerateMediaRoots(folder, models.LibraryLayoutPublisherSeries, ignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || roots[0].Name != "Akira" {
+		t.Errorf("got %+v, want only the series that isn't ignored", roots)
+	}
+}
+
+func TestSeriesNameOf(t *testing.T) {
+	for fileName, want := range map[string]string{
+		"Akira v01.cbz":                          "Akira",
+		"[Group] Naruto - Chapter 12 (2002).cbz": "Naruto",
+		"One_Piece_c1001.cbz":                    "One Piece",
+		"Berserk #3.cbz":                         "Berserk",
+		"Akira 03.cbz":                           "Akira",
+		"Monster.cbz":                            "Monster",
+	} {
+		if got := seriesNameOf(fileName); got != want {
+			t.Errorf("seriesNameOf(%q) = '%s', want '%s'", fileName, got, want)
+		}
+	}
+}
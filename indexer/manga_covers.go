@@ -0,0 +1,67 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2/log"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+)
+
+// additionalCoverPattern matches the images of a series folder holding additional covers, such as cover2.jpg or
+// volume 03.png. The primary cover is read from poster and thumbnail images instead.
+var additionalCoverPattern = regexp.MustCompile(`(?i)^(cover|vol(ume)?)([^a-z].*)?\.(jpe?g|png)$`)
+
+// indexMangaCovers adds the additional covers found in a series folder to the carousel of a manga. Each cover is
+// cropped into the image cache once and again when its file changes, covers removed by a moderator stay removed.
+// Folders shared by several series have no covers of their own.
+func indexMangaCovers(slug string, root MediaRoot, library models.Library) {
+	if root.shared() {
+		return
+	}
+	path := root.Path
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		log.Debugf("Failed to read the covers of '%s': %s", slug, err)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !additionalCoverPattern.MatchString(entry.Name()) {
+			continue
+		}
+		coverURL, err := cacheAdditionalCover(slug, filepath.Join(path, entry.Name()))
+		if err != nil {
+			log.Warnw(fmt.Sprintf("Failed to cache the cover '%s' of '%s': %s", entry.Name(), slug, err), utils.LogChannelKey, logChannel(library.Slug))
+			continue
+		}
+		if err := models.AddMangaCover(slug, coverURL, entry.Name()); err != nil {
+			log.Errorw(fmt.Sprintf("Failed to add the cover '%s' of '%s': %s", entry.Name(), slug, err), utils.LogChannelKey, logChannel(library.Slug))
+		}
+	}
+}
+
+// cacheAdditionalCover crops an additional cover into the image cache, skipping covers cached since their file last
+// changed, and returns the URL of the cached image
+func cacheAdditionalCover(slug, imagePath string) (string, error) {
+	name := filepath.Base(imagePath)
+	ext := strings.ToLower(filepath.Ext(name))
+	fileName := fmt.Sprintf("%s_cover-%s%s", slug, utils.Sluggify(strings.TrimSuffix(name, filepath.Ext(name))), ext)
+	cachedFile := filepath.Join(cacheDataDirectory, fileName)
+
+	source, err := os.Stat(imagePath)
+	if err != nil {
+		return "", err
+	}
+	if cached, err := os.Stat(cachedFile); err != nil || cached.ModTime().Before(source.ModTime()) {
+		if err := utils.ProcessImage(imagePath, cachedFile); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s/%s", localServerBaseURL, fileName), nil
+}
@@ -0,0 +1,184 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/robfig/cron/v3"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+)
+
+var (
+	metadataRetryMutex    sync.Mutex
+	metadataRetryCron     *cron.Cron
+	metadataRetrySchedule string
+
+	// metadataRetryRunning skips a run while the previous one is still going
+	metadataRetryRunning atomic.Bool
+)
+
+// ScheduleMetadataRetry runs the metadata retry job on a cron schedule, an empty schedule stops it
+func ScheduleMetadataRetry(schedule string) {
+	metadataRetryMutex.Lock()
+	defer metadataRetryMutex.Unlock()
+
+	if metadataRetryCron != nil && schedule == metadataRetrySchedule {
+		return
+	}
+	if metadataRetryCron != nil {
+		metadataRetryCron.Stop()
+		metadataRetryCron = nil
+	}
+	metadataRetrySchedule = schedule
+	if schedule == "" {
+		log.Info("Metadata retry is disabled")
+		return
+	}
+
+	c := cron.New()
+	if _, err := c.AddFunc(schedule, RetryMetadata); err != nil {
+		log.Errorf("Error adding metadata retry job: %s", err)
+		return
+	}
+	c.Start()
+	metadataRetryCron = c
+	log.Infof("Metadata retry registered with cron schedule '%s'", schedule)
+}
+
+// RetryMetadata searches the metadata of the mangas indexed while the provider was down again. A manga stays pending
+// while the provider is still down, backing off after each attempt and giving up after the configured number of
+// attempts. A search that reaches the provider settles it: a match is applied, a match that isn't confident enough is
+// queued for review and a title without a match keeps its local metadata.
+func RetryMetadata() {
+	if !metadataRetryRunning.CompareAndSwap(false, true) {
+		log.Info("Metadata retry already running, skipping")
+		return
+	}
+	defer metadataRetryRunning.Store(false)
+
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+		return
+	}
+	retries, err := models.GetMetadataRetries()
+	if err != nil {
+		log.Errorf("Failed to get pending metadata: %v", err)
+		return
+	}
+
+	now := time.Now()
+	settled, failed := 0, 0
+	for _, retry := range retries {
+		if !retry.Due(now, config.MetadataRetryMaxAttempts) {
+			continue
+		}
+
+		err := retryMangaMetadata(retry)
+		if models.IsProviderUnavailable(err) {
+			failed++
+			retry, recordErr := models.RecordMetadataRetryFailure(retry.MangaSlug, err)
+			if recordErr != nil {
+				log.Errorf("Failed to record metadata retry of '%s': %v", retry.MangaSlug, recordErr)
+				continue
+			}
+			if retry.Attempts >= config.MetadataRetryMaxAttempts {
+				log.Warnf("Giving up on the metadata of '%s' after %d attempts: %v", retry.MangaSlug, retry.Attempts, err)
+			} else {
+				log.Debugf("MangaDex is still unavailable for '%s', retrying after %s: %v", retry.MangaSlug, retry.NextAttempt.Format(time.RFC3339), err)
+			}
+			continue
+		}
+		if err != nil {
+			log.Errorf("Failed to retry the metadata of '%s': %v", retry.MangaSlug, err)
+			continue
+		}
+		settled++
+	}
+
+	if settled > 0 || failed > 0 {
+		log.Infof("Metadata retry completed, %d settled and %d still pending", settled, failed)
+	}
+}
+
+// retryMangaMetadata searches the metadata of a pending manga again, the manga stops being pending unless the
+// provider is still down
+func retryMangaMetadata(retry models.MetadataRetry) error {
+	unlock := lockSlug(retry.MangaSlug)
+	defer unlock()
+
+	manga, err := models.GetManga(retry.MangaSlug)
+	if err != nil {
+		return models.DeleteMetadataRetry(retry.MangaSlug)
+	}
+	// Metadata picked by hand in the meantime wins, series of a library whose metadata got disabled keep the local one
+	if manga.MetadataProvider != "" {
+		return models.DeleteMetadataRetry(retry.MangaSlug)
+	}
+	if library, err := models.GetLibrary(manga.LibrarySlug); err == nil && library.MetadataProvider() == "" {
+		return models.DeleteMetadataRetry(retry.MangaSlug)
+	}
+
+	match, err := models.GetBestMatchMangadexManga(retry.Title)
+	if models.IsProviderUnavailable(err) {
+		return err
+	}
+	var lowConfidence *models.LowConfidenceMatchError
+	switch {
+	case errors.As(err, &lowConfidence):
+		log.Warnf("No confident match found for: '%s' (%s), queueing it for review", manga.Slug, err)
+		if err := models.QueueMetadataReview(manga.Slug, retry.Title, lowConfidence.Candidates); err != nil {
+			return err
+		}
+	case err != nil:
+		log.Infof("No search result found for: '%s', keeping its local metadata", manga.Slug)
+	default:
+		if err := applyRetriedMetadata(manga, match); err != nil {
+			return err
+		}
+		log.Infof("Retrieved the metadata of '%s'", manga.Slug)
+		logActivity("manga_update", manga.Slug)
+	}
+	return models.DeleteMetadataRetry(manga.Slug)
+}
+
+// applyRetriedMetadata fills in the metadata of a manga indexed with local metadata from its match, keeping its name,
+// the tags found in its folder and a cover set by hand
+func applyRetriedMetadata(manga *models.Manga, match *models.MangaDetail) error {
+	manga.Description = match.Attributes.Description["en"]
+	manga.Year = match.Attributes.Year
+	manga.OriginalLanguage = match.Attributes.OriginalLanguage
+	manga.Status = match.Attributes.Status
+	manga.Author = getAuthor(match)
+	manga.Aliases = match.AliasNames(manga.Name)
+	if manga.Type == "" {
+		manga.Type = match.MangaType()
+	}
+	tags, err := models.MergeTags(match.TagNames(), manga.Tags)
+	if err != nil {
+		return err
+	}
+	manga.Tags = tags
+	models.ApplyProviderContentRating(manga, models.MetadataProviderMangaDex, match.Attributes.ContentRating)
+	models.ApplyInferredContentRating(manga)
+
+	if coverArtURL := getCoverArtURL(match); coverArtURL != "" && !manga.CoverLocked {
+		if cachedURL, err := downloadCover(manga.Slug, coverArtURL); err != nil {
+			log.Warnf("Failed to download the cover of '%s', keeping its local cover: %s", manga.Slug, err)
+		} else {
+			manga.CoverArtURL = cachedURL
+			manga.AccentColor = utils.CoverAccentColor(cacheDataDirectory, cachedURL)
+		}
+	}
+
+	if err := models.UpdateManga(manga); err != nil {
+		return fmt.Errorf("failed to update '%s': %w", manga.Slug, err)
+	}
+	return nil
+}
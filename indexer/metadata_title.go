@@ -0,0 +1,82 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// embeddedTitleSamples is the number of chapters whose embedded series title has to agree before it is trusted
+const embeddedTitleSamples = 3
+
+// metadataTitle returns the title the metadata of a new series is searched by. With the embedded title source, the
+// series title embedded in its first chapters is used when they agree, falling back to the cleaned folder name.
+func metadataTitle(cleanedName string, root MediaRoot, library models.Library, ignore utils.IgnoreRules) string {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+		return cleanedName
+	}
+	if config.MetadataTitleSource != models.MetadataTitleSourceEmbedded {
+		return cleanedName
+	}
+
+	if title := embeddedSeriesTitle(root, config, library, ignore); title != "" {
+		log.Infow(fmt.Sprintf("Searching metadata for: '%s' by its embedded series title '%s'", cleanedName, title), utils.LogChannelKey, logChannel(library.Slug))
+		return title
+	}
+	log.Infow(fmt.Sprintf("Searching metadata for: '%s' by its folder name, no embedded series title found", cleanedName), utils.LogChannelKey, logChannel(library.Slug))
+	return cleanedName
+}
+
+// embeddedSeriesTitle reads the series title from the ComicInfo.xml of the first chapters of a series folder. The
+// title is only returned when every sampled chapter carrying one agrees, a mix of titles means the metadata can't be
+// trusted.
+func embeddedSeriesTitle(root MediaRoot, config models.AppConfig, library models.Library, ignore utils.IgnoreRules) string {
+	path := root.Path
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return ""
+	}
+	var names []string
+	for _, entry := range entries {
+		if !root.includes(entry.Name()) {
+			continue
+		}
+		if ignore.Ignored(filepath.Join(root.Rel, entry.Name()), entry.IsDir()) || library.ExcludesFile(entry.Name()) {
+			continue
+		}
+		if config.IsChapterFormatEnabled(filepath.Join(path, entry.Name())) {
+			names = append(names, entry.Name())
+		}
+	}
+	utils.NaturalSort(names)
+
+	title, samples := "", 0
+	for _, name := range names {
+		if samples == embeddedTitleSamples {
+			break
+		}
+		info, err := utils.ReadComicInfo(filepath.Join(path, name))
+		if err != nil {
+			log.Debugf("Failed to read the embedded metadata of: '%s' (%s)", name, err)
+			continue
+		}
+		if info == nil || info.Series == "" {
+			continue
+		}
+		samples++
+		if title == "" {
+			title = info.Series
+		} else if !strings.EqualFold(title, info.Series) {
+			log.Debugf("Embedded series titles disagree in: '%s' ('%s' and '%s')", path, title, info.Series)
+			return ""
+		}
+	}
+	return title
+}
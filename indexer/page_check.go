@@ -0,0 +1,80 @@
+package indexer
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+)
+
+// ErrPageCheckRunning is returned when a page check is requested while one is still going
+var ErrPageCheckRunning = errors.New("a page check is already running")
+
+// pageCheckRunning keeps a single page check of the whole library running at a time
+var pageCheckRunning atomic.Bool
+
+// StartPageCheck checks the pages of every chapter in the background, replacing the recorded chapter issues
+func StartPageCheck() error {
+	if !pageCheckRunning.CompareAndSwap(false, true) {
+		return ErrPageCheckRunning
+	}
+	go func() {
+		defer pageCheckRunning.Store(false)
+		checkAllChapterPages()
+	}()
+	return nil
+}
+
+func checkAllChapterPages() {
+	done := models.StartIndexing()
+	defer done()
+
+	start := time.Now()
+	mangas, err := models.GetAllMangas()
+	if err != nil {
+		log.Errorf("Failed to list mangas for the page check: %s", err)
+		return
+	}
+
+	var checked, broken int
+	for _, manga := range mangas {
+		chapters, err := models.GetChapters(manga.Slug)
+		if err != nil {
+			log.Errorf("Failed to list chapters of '%s' for the page check: %s", manga.Slug, err)
+			continue
+		}
+		for _, chapter := range chapters {
+			if checkChapterPages(manga.Slug, chapter.Slug, filepath.Join(manga.Path, chapter.File)) {
+				broken++
+			}
+			checked++
+		}
+	}
+
+	log.Infof("Checked the pages of %d chapters in %s, %d with unreadable pages", checked, time.Since(start), broken)
+}
+
+// checkChapterPages decodes the pages of a chapter and records the unreadable ones, reporting whether any were found.
+// Chapters made of a single image are served as is and not checked.
+func checkChapterPages(mangaSlug, chapterSlug, chapterPath string) bool {
+	if utils.ChapterFormatOf(chapterPath) == nil {
+		return false
+	}
+
+	issues, err := utils.CheckChapterPages(chapterPath)
+	if err != nil {
+		issues = []utils.PageIssue{{Error: err.Error()}}
+	}
+	if err := models.SetChapterIssues(mangaSlug, chapterSlug, issues); err != nil {
+		log.Errorf("Failed to record page issues of '%s' - '%s': %s", mangaSlug, chapterSlug, err)
+	}
+	if len(issues) > 0 {
+		log.Warnf("Chapter '%s' - '%s' has %d unreadable pages", mangaSlug, chapterSlug, len(issues))
+	}
+	return len(issues) > 0
+}
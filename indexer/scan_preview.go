@@ -0,0 +1,135 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+)
+
+// maxScanPreviewMedia bounds the series a scan preview looks at, measuring pages and matching metadata take a while
+const maxScanPreviewMedia = 200
+
+// MediaPreview is how a series found in a library folder would be indexed
+type MediaPreview struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	// Type is the media type detected from the shape of the pages or the metadata match, empty until a match decides
+	Type         string `json:"type"`
+	ChapterCount int    `json:"chapter_count"`
+	// MetadataQuery is the title the metadata would be searched by
+	MetadataQuery string `json:"metadata_query"`
+	// Tags are the tags the tag patterns of the library find in the name of the series
+	Tags []string `json:"tags,omitempty"`
+	// Indexed is set when a series with the same slug is already indexed, its chapters would be added to it
+	Indexed bool                  `json:"indexed"`
+	Match   *MetadataMatchPreview `json:"match,omitempty"`
+}
+
+// MetadataMatchPreview is the metadata match a series would get
+type MetadataMatchPreview struct {
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url,omitempty"`
+	// Review is set when the best match isn't confident enough and the series would be queued for review
+	Review bool   `json:"review,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ScanPreview is the result of a dry run over the folders of a library
+type ScanPreview struct {
+	Media []MediaPreview `json:"media"`
+	// Truncated is set when the folders hold more series than a preview looks at
+	Truncated bool `json:"truncated"`
+}
+
+// PreviewLibrary walks the folders of a library the way the indexer would and returns the series it would index,
+// without writing anything. The metadata provider is only asked for matches when matches is set.
+func PreviewLibrary(library models.Library, matches bool) (ScanPreview, error) {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		return ScanPreview{}, err
+	}
+	if len(library.Folders) == 0 {
+		return ScanPreview{}, errors.New("at least one folder is required")
+	}
+
+	var preview ScanPreview
+	for _, folder := range library.Folders {
+		ignore := ignoreRules(folder)
+		roots, err := enumerateMediaRoots(folder, library.EffectiveLayout(), ignore)
+		if err != nil {
+			return ScanPreview{}, fmt.Errorf("failed to read '%s': %w", folder, err)
+		}
+		for _, root := range roots {
+			if len(preview.Media) == maxScanPreviewMedia {
+				preview.Truncated = true
+				return preview, nil
+			}
+			if media, ok := previewMedia(root, library, ignore, config, matches); ok {
+				preview.Media = append(preview.Media, media)
+			}
+		}
+	}
+	return preview, nil
+}
+
+// previewMedia describes how a series would be indexed, series whose name cleans up to nothing are skipped
+func previewMedia(root MediaRoot, library models.Library, ignore utils.IgnoreRules, config models.AppConfig, matches bool) (MediaPreview, bool) {
+	cleanedName := utils.RemovePatterns(root.Name)
+	if cleanedName == "" {
+		return MediaPreview{}, false
+	}
+	media := MediaPreview{
+		Path:          root.Path,
+		Name:          cleanedName,
+		Slug:          utils.Sluggify(cleanedName),
+		MetadataQuery: cleanedName,
+		Tags:          folderTags(root, library),
+	}
+	media.Indexed, _ = models.MangaExists(media.Slug)
+
+	files, err := findChapterFiles(media.Slug, root, library, ignore, config)
+	if err == nil {
+		media.ChapterCount = len(files)
+	}
+	chapterPaths := make([]string, 0, len(files))
+	for _, file := range files {
+		chapterPaths = append(chapterPaths, filepath.Join(root.Path, file.entry.Name()))
+	}
+	utils.NaturalSort(chapterPaths)
+	if isWebtoonShape(measureChapterPages(chapterPaths)) {
+		media.Type = models.MangaTypeWebtoon
+	}
+
+	if config.MetadataTitleSource == models.MetadataTitleSourceEmbedded {
+		if title := embeddedSeriesTitle(root, config, library, ignore); title != "" {
+			media.MetadataQuery = title
+		}
+	}
+
+	if matches && library.MetadataProvider() != "" {
+		var match *models.MangaDetail
+		media.Match, match = previewMatch(media.MetadataQuery)
+		if media.Type == "" {
+			media.Type = match.MangaType()
+		}
+	}
+	return media, true
+}
+
+// previewMatch asks the metadata provider for the match of a title, the match is nil unless it is confident enough
+func previewMatch(title string) (*MetadataMatchPreview, *models.MangaDetail) {
+	match, err := models.GetBestMatchMangadexManga(title)
+	var lowConfidence *models.LowConfidenceMatchError
+	if errors.As(err, &lowConfidence) {
+		best := lowConfidence.Candidates[0]
+		return &MetadataMatchPreview{Title: best.Title, URL: best.URL(), Review: true}, nil
+	}
+	if err != nil {
+		return &MetadataMatchPreview{Error: err.Error()}, nil
+	}
+	return &MetadataMatchPreview{Title: match.MatchTitle(), URL: fmt.Sprintf("https://mangadex.org/title/%s", match.ID)}, match
+}
@@ -1,14 +1,16 @@
 package indexer
 
 import (
+	"fmt"
 	"os"
-	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/robfig/cron/v3"
 
 	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
 )
 
 var (
@@ -24,6 +26,7 @@ type Indexer struct {
 	CronRunning bool
 	JobRunning  bool
 	stop        chan struct{}
+	stopOnce    sync.Once
 }
 
 // Initialize sets up indexers and notifications
@@ -36,6 +39,14 @@ func Initialize(cacheDirectory string, libraries []models.Library) {
 		go indexer.Start()
 	}
 
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+	ScheduleCoverRepair(config.CoverRepairSchedule)
+	ScheduleMetadataRetry(config.MetadataRetrySchedule)
+	ScheduleTypeReclassification(config.TypeReclassifySchedule)
+
 	// Register NotificationListener
 	models.AddListener(&NotificationListener{
 		notifications: make(chan models.Notification),
@@ -72,82 +83,119 @@ func (idx *Indexer) Start() {
 	idx.Stop()
 }
 
-// Stop stops the indexer and cleans up
+// Stop stops the indexer and cleans up, only the first call has an effect as Start calls it again once stopped
 func (idx *Indexer) Stop() {
-	if idx.CronRunning {
-		idx.Cron.Stop()
-		idx.CronRunning = false
-		log.Infof("Stopped indexer for library: '%s'", idx.Library.Name)
-	}
+	idx.stopOnce.Do(func() {
+		if idx.CronRunning {
+			idx.Cron.Stop()
+			idx.CronRunning = false
+			log.Infof("Stopped indexer for library: '%s'", idx.Library.Name)
+		}
 
-	close(idx.stop)
-	delete(activeIndexers, idx.Library.Slug)
+		close(idx.stop)
+		delete(activeIndexers, idx.Library.Slug)
+	})
 }
 
 // runIndexingJob performs the indexing job
 func (idx *Indexer) runIndexingJob() {
 	if idx.JobRunning {
-		log.Infof("Indexing job for library '%s' already running, skipping", idx.Library.Name)
+		log.Infow(fmt.Sprintf("Indexing job for library '%s' already running, skipping", idx.Library.Name), utils.LogChannelKey, logChannel(idx.Library.Slug))
 		return
 	}
 	defer func() {
 		idx.JobRunning = false
-		log.Infof("Indexing job for library '%s' completed", idx.Library.Name)
+		log.Infow(fmt.Sprintf("Indexing job for library '%s' completed", idx.Library.Name), utils.LogChannelKey, logChannel(idx.Library.Slug))
 	}()
 
 	idx.JobRunning = true
-	log.Infof("Starting indexing for library '%s'", idx.Library.Name)
+
+	// Hold off database maintenance while indexing
+	defer models.StartIndexing()()
+
+	log.Infow(fmt.Sprintf("Starting indexing for library '%s'", idx.Library.Name), utils.LogChannelKey, logChannel(idx.Library.Slug))
 	start := time.Now()
 
 	for _, folder := range idx.Library.Folders {
+		if !folderAvailable(folder) {
+			log.Errorw(fmt.Sprintf("Folder '%s' of library '%s' is missing or empty, skipping it and keeping its series. Relocate the library if the folder moved.", folder, idx.Library.Name), utils.LogChannelKey, logChannel(idx.Library.Slug))
+			continue
+		}
 		if err := idx.processFolder(folder); err != nil {
-			log.Errorf("Error processing folder '%s': %s", folder, err)
+			log.Errorw(fmt.Sprintf("Error processing folder '%s': %s", folder, err), utils.LogChannelKey, logChannel(idx.Library.Slug))
 		}
 
 		select {
 		case <-idx.stop:
-			log.Infof("Indexing for library '%s' interrupted", idx.Library.Name)
+			log.Infow(fmt.Sprintf("Indexing for library '%s' interrupted", idx.Library.Name), utils.LogChannelKey, logChannel(idx.Library.Slug))
 			return
 		default:
 		}
 	}
 
 	duration := time.Since(start)
-	log.Infof("Indexing for library '%s' completed in %s", idx.Library.Name, duration)
+	log.Infow(fmt.Sprintf("Indexing for library '%s' completed in %s", idx.Library.Name, duration), utils.LogChannelKey, logChannel(idx.Library.Slug))
+	logActivity("indexer_run", idx.Library.Slug)
 }
 
-// processFolder processes files and directories in a given folder
-func (idx *Indexer) processFolder(folder string) error {
+// folderAvailable reports whether a library folder exists and has entries, an unmounted share usually leaves an
+// empty mount point behind
+func folderAvailable(folder string) bool {
 	dir, err := os.Open(folder)
 	if err != nil {
-		return err
+		return false
 	}
 	defer dir.Close()
+	names, err := dir.Readdirnames(1)
+	return err == nil && len(names) > 0
+}
 
-	entries, err := dir.Readdir(-1)
+// logChannel is the log stream channel of the indexing of a library, admins can follow it live
+func logChannel(librarySlug string) string {
+	return "indexer_" + librarySlug
+}
+
+// processFolder indexes the series of a library folder, found according to the layout of the library
+func (idx *Indexer) processFolder(folder string) error {
+	ignore := ignoreRules(folder)
+	roots, err := enumerateMediaRoots(folder, idx.Library.EffectiveLayout(), ignore)
 	if err != nil {
 		return err
 	}
 
-	for _, entry := range entries {
+	for _, root := range roots {
 		select {
 		case <-idx.stop:
 			return nil
 		default:
 		}
 
-		path := filepath.Join(folder, entry.Name())
-		if entry.IsDir() {
-			if _, err := IndexManga(path, idx.Library.Slug); err != nil {
-				log.Errorf("Error indexing manga at '%s': %s", path, err)
-			}
-		} else {
-			log.Debugf("File: %s", entry.Name())
+		if _, err := IndexManga(root, idx.Library, ignore); err != nil {
+			log.Errorw(fmt.Sprintf("Error indexing manga at %s: %s", root, err), utils.LogChannelKey, logChannel(idx.Library.Slug))
 		}
 	}
 	return nil
 }
 
+// ignoreRules combines the configured ignore patterns with the ignore file of a library folder, which is read
+// on every run so edits apply to the next one
+func ignoreRules(folder string) utils.IgnoreRules {
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+	rules, err := utils.ParseIgnorePatterns(config.IndexIgnorePatterns)
+	if err != nil {
+		log.Errorf("Failed to parse ignore patterns: %s", err)
+	}
+
+	folderRules, err := utils.LoadIgnoreFile(folder)
+	if err != nil {
+		log.Errorf("Failed to read '%s' in '%s': %s", utils.IgnoreFileName, folder, err)
+	}
+	return append(rules, folderRules...)
+}
+
 // NotificationListener listens for notifications and handles them
 type NotificationListener struct {
 	notifications chan models.Notification
@@ -155,15 +203,28 @@ type NotificationListener struct {
 
 // Notify processes incoming notifications
 func (nl *NotificationListener) Notify(notification models.Notification) {
-	log.Debugf("Received notification of type '%s' for library '%s'", notification.Type, notification.Payload.(models.Library).Name)
+	// Configuration changes can reschedule the cover repair, metadata retry and type reclassification jobs
+	if config, ok := notification.Payload.(models.AppConfig); ok {
+		ScheduleCoverRepair(config.CoverRepairSchedule)
+		ScheduleMetadataRetry(config.MetadataRetrySchedule)
+		ScheduleTypeReclassification(config.TypeReclassifySchedule)
+		return
+	}
+
+	// Otherwise only library notifications concern the indexer
+	library, ok := notification.Payload.(models.Library)
+	if !ok {
+		return
+	}
+	log.Debugf("Received notification of type '%s' for library '%s'", notification.Type, library.Name)
 
 	switch notification.Type {
 	case "library_created":
-		nl.handleLibraryCreated(notification.Payload.(models.Library))
+		nl.handleLibraryCreated(library)
 	case "library_updated":
-		nl.handleLibraryUpdated(notification.Payload.(models.Library))
+		nl.handleLibraryUpdated(library)
 	case "library_deleted":
-		nl.handleLibraryDeleted(notification.Payload.(models.Library))
+		nl.handleLibraryDeleted(library)
 	default:
 		log.Warnf("Unknown notification type: %s", notification.Type)
 	}
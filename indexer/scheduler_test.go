@@ -0,0 +1,63 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+)
+
+func TestProcessFolderAppliesTheIgnoreFile(t *testing.T) {
+	setupTestIndexer(t)
+	folder := t.TempDir()
+	writeChapter(t, filepath.Join(folder, "Alpha"), "Chapter 1", 1)
+	writeChapter(t, filepath.Join(folder, "Alpha"), "Chapter 2", 1)
+	writeChapter(t, filepath.Join(folder, "Alpha"), "Chapter 3", 1)
+	writeChapter(t, filepath.Join(folder, "RAW"), "Chapter 1", 1)
+	ignoreFile := filepath.Join(folder, utils.IgnoreFileName)
+	fixture := "# raws are indexed by another library\nRAW/\nAlpha/Chapter *\n!Alpha/Chapter 1\n"
+	if err := os.WriteFile(ignoreFile, []byte(fixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := NewIndexer(models.Library{Slug: "library", MetadataDisabled: true})
+	if err := idx.processFolder(folder); err != nil {
+		t.Fatal(err)
+	}
+	mangas, err := models.GetAllMangas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mangas) != 1 || mangas[0].Name != "Alpha" {
+		t.Fatalf("got %+v, want only the series outside of RAW", mangas)
+	}
+	chapters, err := models.GetChapters(mangas[0].Slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chapters) != 1 || chapters[0].File != "Chapter 1" {
+		t.Errorf("got chapters %+v, want only the re-included chapter", chapters)
+	}
+
+	// The file is read again on the next run
+	if err := os.WriteFile(ignoreFile, []byte("Alpha/Chapter 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.processFolder(folder); err != nil {
+		t.Fatal(err)
+	}
+	if mangas, err = models.GetAllMangas(); err != nil {
+		t.Fatal(err)
+	}
+	if len(mangas) != 2 {
+		t.Errorf("got %d series, want RAW indexed once no longer ignored", len(mangas))
+	}
+	if chapters, err = models.GetChapters(chapters[0].MangaSlug); err != nil {
+		t.Fatal(err)
+	}
+	if len(chapters) != 2 {
+		t.Errorf("got %d chapters, want the chapters that are no longer ignored", len(chapters))
+	}
+}
@@ -0,0 +1,166 @@
+package indexer
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/robfig/cron/v3"
+
+	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
+)
+
+// Bounds of the page shape detection, a manga becomes a webtoon when most of the measured pages are long strips
+const (
+	reclassifyChapters        = 3
+	reclassifyPagesPerChapter = 10
+	reclassifyMinPages        = 5
+	webtoonPageRatio          = 2.5
+	webtoonTallShare          = 0.8
+)
+
+// ErrReclassificationRunning is returned when a reclassification is requested while one is still going
+var ErrReclassificationRunning = errors.New("a type reclassification is already running")
+
+var (
+	reclassifyMutex    sync.Mutex
+	reclassifyCron     *cron.Cron
+	reclassifySchedule string
+
+	// reclassifyRunning keeps a single reclassification running at a time
+	reclassifyRunning atomic.Bool
+)
+
+// TypeReclassification is a type change detected for a manga
+type TypeReclassification struct {
+	Slug     string
+	Name     string
+	From     string
+	To       string
+	Tall     int
+	Measured int
+}
+
+// ScheduleTypeReclassification runs the type reclassification on a cron schedule, an empty schedule stops it
+func ScheduleTypeReclassification(schedule string) {
+	reclassifyMutex.Lock()
+	defer reclassifyMutex.Unlock()
+
+	if reclassifyCron != nil && schedule == reclassifySchedule {
+		return
+	}
+	if reclassifyCron != nil {
+		reclassifyCron.Stop()
+		reclassifyCron = nil
+	}
+	reclassifySchedule = schedule
+	if schedule == "" {
+		return
+	}
+
+	c := cron.New()
+	_, err := c.AddFunc(schedule, func() {
+		if _, err := ReclassifyTypes(false); err != nil && !errors.Is(err, ErrReclassificationRunning) {
+			log.Errorf("Type reclassification failed: %v", err)
+		}
+	})
+	if err != nil {
+		log.Errorf("Error adding type reclassification job: %s", err)
+		return
+	}
+	c.Start()
+	reclassifyCron = c
+	log.Infof("Type reclassification registered with cron schedule '%s'", schedule)
+}
+
+// ReclassifyTypes measures the pages of every manga that isn't a webtoon and turns those made of long strips into
+// webtoons, so they default to vertical reading. Mangas with a reading mode picked by hand are left alone. A dry run
+// only returns the changes it would make.
+func ReclassifyTypes(dryRun bool) ([]TypeReclassification, error) {
+	if !reclassifyRunning.CompareAndSwap(false, true) {
+		return nil, ErrReclassificationRunning
+	}
+	defer reclassifyRunning.Store(false)
+
+	mangas, err := models.GetAllMangas()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []TypeReclassification
+	for _, manga := range mangas {
+		if manga.ReadingMode != "" || manga.MediaType() == models.MangaTypeWebtoon {
+			continue
+		}
+		tall, measured, err := measureMangaPages(manga)
+		if err != nil {
+			log.Warnf("Failed to measure the pages of '%s': %v", manga.Slug, err)
+			continue
+		}
+		if !isWebtoonShape(tall, measured) {
+			continue
+		}
+
+		change := TypeReclassification{
+			Slug:     manga.Slug,
+			Name:     manga.Name,
+			From:     manga.MediaType(),
+			To:       models.MangaTypeWebtoon,
+			Tall:     tall,
+			Measured: measured,
+		}
+		changes = append(changes, change)
+		if dryRun {
+			continue
+		}
+		if err := models.SetMangaType(manga.Slug, change.To); err != nil {
+			log.Errorf("Failed to reclassify '%s': %v", manga.Slug, err)
+			continue
+		}
+		log.Infof("Reclassified '%s' from %s to %s, %d of %d pages are long strips", manga.Slug, change.From, change.To, tall, measured)
+		logActivity("type_reclassify", manga.Slug)
+	}
+	return changes, nil
+}
+
+// measureMangaPages counts the long strip pages among the first pages of the first chapters of a manga
+func measureMangaPages(manga models.Manga) (tall, measured int, err error) {
+	chapters, err := models.GetChapters(manga.Slug)
+	if err != nil {
+		return 0, 0, err
+	}
+	chapterPaths := make([]string, 0, len(chapters))
+	for _, chapter := range chapters {
+		chapterPaths = append(chapterPaths, filepath.Join(manga.Path, chapter.File))
+	}
+	tall, measured = measureChapterPages(chapterPaths)
+	return tall, measured, nil
+}
+
+// measureChapterPages counts the long strip pages among the first pages of the first of the given chapters
+func measureChapterPages(chapterPaths []string) (tall, measured int) {
+	for i, chapterPath := range chapterPaths {
+		if i == reclassifyChapters {
+			break
+		}
+		if utils.ChapterFormatOf(chapterPath) == nil {
+			continue
+		}
+		chapterTall, chapterMeasured, err := utils.CountTallPages(chapterPath, reclassifyPagesPerChapter, webtoonPageRatio)
+		if err != nil {
+			log.Debugf("Failed to measure the pages of '%s': %v", chapterPath, err)
+			continue
+		}
+		tall += chapterTall
+		measured += chapterMeasured
+	}
+	return tall, measured
+}
+
+// isWebtoonShape reports whether enough pages were measured and most of them are long strips
+func isWebtoonShape(tall, measured int) bool {
+	return measured >= reclassifyMinPages && float64(tall) >= webtoonTallShare*float64(measured)
+}
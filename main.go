@@ -3,17 +3,21 @@ package main
 import (
 	// _ "net/http/pprof" // Import for side-effect of registering pprof handlers
 
+	"context"
 	"embed"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"syscall"
 
 	"github.com/alexander-bruun/magi/handlers"
 	"github.com/alexander-bruun/magi/indexer"
 	"github.com/alexander-bruun/magi/models"
+	"github.com/alexander-bruun/magi/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
@@ -44,7 +48,7 @@ func init() {
 	// }
 	// log.SetOutput(f)
 
-	log.SetLevel(log.LevelInfo)
+	utils.SetLogLevel(log.LevelInfo)
 
 	var defaultDataDirectory string
 
@@ -78,9 +82,34 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %s", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfig(os.Args[2:]); err != nil {
+			log.Fatalf("Configuration check failed: %s", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "maintenance" {
+		if err := runMaintenance(os.Args[2:]); err != nil {
+			log.Fatalf("Maintenance failed: %s", err)
+		}
+		return
+	}
+
 	log.Info("Starting Magi!")
 
 	flag.Parse()
+	seedConfig, err := resolveOptions(flag.CommandLine)
+	if err != nil {
+		log.Fatalf("Failed to load the configuration file: %s", err)
+	}
 
 	// Cache directory under the data directory
 	joinedCacheDataDirectory := filepath.Join(dataDirectory, "cache")
@@ -95,7 +124,7 @@ func main() {
 	log.Debugf("Using '%s' as the image caching location", joinedCacheDataDirectory)
 
 	// Initialize key-value connection
-	err := models.Initialize(dataDirectory)
+	err = models.Initialize(dataDirectory)
 	if err != nil {
 		log.Errorf("Failed to connect to key-value store: %v", err)
 	}
@@ -105,6 +134,49 @@ func main() {
 		}
 	}()
 
+	// Apply pending data migrations
+	if err := models.Migrate(); err != nil {
+		log.Fatalf("Failed to migrate key-value store: %v", err)
+	}
+
+	// Compaction reopens the key-value store, so a scheduled one runs before anything else uses it
+	if compacted, before, after, err := models.CompactScheduledDatabase(dataDirectory); err != nil {
+		log.Errorf("Failed to compact key-value store: %v", err)
+	} else if compacted {
+		log.Infof("Compacted database from %d to %d bytes", before, after)
+	}
+
+	// The configuration file only seeds the app configuration of a new instance
+	if seedConfig != nil {
+		seeded, err := models.SeedAppConfig(seedConfig)
+		if err != nil {
+			log.Fatalf("Failed to seed the app configuration: %v", err)
+		}
+		if seeded {
+			log.Info("App configuration seeded from the configuration file")
+		}
+	}
+
+	// Pages extracted from chapter archives, kept outside of the statically served cache directory
+	if err := utils.InitializeArchiveCache(filepath.Join(dataDirectory, "pages")); err != nil {
+		log.Errorf("Failed to prepare the page cache directory: %v", err)
+	}
+
+	// Cache writes are skipped while the disk of the data directory is low on space
+	utils.InitializeCacheSpaceGuard(dataDirectory)
+
+	config, err := models.GetAppConfig()
+	if err != nil {
+		log.Warnf("Failed to get app config: %v", err)
+	}
+	config.ApplyImageSettings()
+
+	// Rotating log file under the data directory, written when enabled in the configuration
+	if err := utils.InitializeLogDirectory(filepath.Join(dataDirectory, "logs")); err != nil {
+		log.Errorf("Failed to prepare the log directory: %v", err)
+	}
+	config.ApplyLogSettings()
+
 	// Retrieve or generate JWT key
 	_, err = models.GetKey()
 	if err != nil {
@@ -133,6 +205,16 @@ func main() {
 		AppName:       fmt.Sprintf("Magi %s", Version),
 		Views:         engine,
 		ViewsLayout:   "base",
+		// Larger bodies are streamed, BodyLimitMiddleware reads them up to the limit of their route
+		BodyLimit:                    models.MaxFormBodyLimitKB * 1024,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	})
+
+	// The service worker lives in the assets, but has to control every page of the reader
+	app.Use("/assets/js/service-worker.js", func(c *fiber.Ctx) error {
+		c.Set("Service-Worker-Allowed", "/")
+		return c.Next()
 	})
 
 	app.Use("/assets", filesystem.New(filesystem.Config{
@@ -151,6 +233,122 @@ func main() {
 	}
 	go indexer.Initialize(joinedCacheDataDirectory, libraries)
 
-	// Block main thread to keep goroutines running
-	select {}
+	// Block main thread until asked to stop, then cancel cover downloads before closing the key-value store
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Info("Shutting down Magi")
+	utils.StopImageDownloads()
+}
+
+// runMaintenance runs a database maintenance task, the server must not be running as it holds the database lock
+func runMaintenance(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: magi maintenance <integrity-check|compact|vacuum|infer-content-ratings|remap-content-ratings|backfill-accent-colors|reclassify-types> [-data-directory path] [-config file] [-dry-run] [-provider name]")
+	}
+	dryRun := flag.CommandLine.Bool("dry-run", false, "Only report the changes of reclassify-types")
+	provider := flag.CommandLine.String("provider", models.MetadataProviderMangaDex, "Metadata provider whose content ratings remap-content-ratings maps again")
+	if err := flag.CommandLine.Parse(args[1:]); err != nil {
+		return err
+	}
+	if _, err := resolveOptions(flag.CommandLine); err != nil {
+		return err
+	}
+
+	if err := models.Initialize(dataDirectory); err != nil {
+		return fmt.Errorf("failed to open key-value store, make sure Magi is not running: %w", err)
+	}
+	defer models.Close()
+
+	switch args[0] {
+	case "integrity-check":
+		problems, err := models.CheckIntegrity()
+		if err != nil {
+			return err
+		}
+		for _, problem := range problems {
+			log.Warn(problem)
+		}
+		log.Infof("Integrity check completed, %d problems found", len(problems))
+	// compact is the bbolt equivalent of a SQLite vacuum, rewriting the database without its free pages
+	case "compact", "vacuum":
+		before, after, err := models.CompactDatabase(dataDirectory)
+		if err != nil {
+			return err
+		}
+		log.Infof("Compacted database from %d to %d bytes", before, after)
+	case "infer-content-ratings":
+		updated, err := models.ReinferContentRatings()
+		if err != nil {
+			return err
+		}
+		log.Infof("Inferred content ratings from tags for %d mangas", updated)
+	case "remap-content-ratings":
+		updated, err := models.RemapContentRatings(*provider)
+		if err != nil {
+			return err
+		}
+		log.Infof("Remapped content ratings of %d %s mangas", updated, *provider)
+	case "backfill-accent-colors":
+		updated, err := models.BackfillAccentColors(filepath.Join(dataDirectory, "cache"))
+		if err != nil {
+			return err
+		}
+		log.Infof("Extracted accent colors for %d mangas", updated)
+	case "reclassify-types":
+		changes, err := indexer.ReclassifyTypes(*dryRun)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			log.Infof("%s: %s -> %s, %d of %d pages are long strips", change.Slug, change.From, change.To, change.Tall, change.Measured)
+		}
+		if *dryRun {
+			log.Infof("%d mangas would be reclassified", len(changes))
+		} else {
+			log.Infof("Reclassified %d mangas", len(changes))
+		}
+	default:
+		return fmt.Errorf("unknown maintenance task: %s", args[0])
+	}
+	return nil
+}
+
+// runMigrate applies the pending migrations, or only lists them with "status" or -dry-run
+func runMigrate(args []string) error {
+	statusOnly := len(args) > 0 && args[0] == "status"
+	if statusOnly {
+		args = args[1:]
+	}
+
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.StringVar(&dataDirectory, "data-directory", dataDirectory, "Path to the data directory")
+	flags.StringVar(&configPath, "config", configPath, "Path to a YAML or JSON configuration file, also read from "+configEnv)
+	dryRun := flags.Bool("dry-run", false, "List the pending migrations without applying them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if _, err := resolveOptions(flags); err != nil {
+		return err
+	}
+
+	if err := models.Initialize(dataDirectory); err != nil {
+		return fmt.Errorf("failed to open key-value store, make sure Magi is not running or use GET /config/schema: %w", err)
+	}
+	defer models.Close()
+
+	current, pending, err := models.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	log.Infof("Schema version %d of %d, %d pending migrations", current, models.LatestSchemaVersion(), len(pending))
+	for _, m := range pending {
+		log.Infof("Pending migration %d: %s", m.Version, m.Description)
+	}
+
+	if statusOnly || *dryRun || len(pending) == 0 {
+		return nil
+	}
+	return models.Migrate()
 }
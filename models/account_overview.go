@@ -0,0 +1,169 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// AccountOverviewOptions selects the recent items of an account overview
+type AccountOverviewOptions struct {
+	// Offset skips the first recent items of each list, Limit bounds them
+	Offset int
+	Limit  int
+	// ContentRatingLimit leaves out the series above it, the counts included
+	ContentRatingLimit string
+}
+
+// AccountOverview gathers what a user has done on the server, the counts of each list and a page of its most recent
+// series. Hidden series and series above the content rating limit are left out of both.
+type AccountOverview struct {
+	Username  string              `json:"username"`
+	Favorites AccountOverviewList `json:"favorites"`
+	// Reading lists the series the user read a chapter of, by the last chapter read
+	Reading AccountOverviewList `json:"reading"`
+	// RecentlyViewed lists the series the user last visited, it is bounded by the recently viewed trail
+	RecentlyViewed AccountOverviewList `json:"recently_viewed"`
+	// Statuses counts the series of each reading list status, explicit or implicit
+	Statuses map[string]int `json:"statuses"`
+	Stats    ReadingStats   `json:"stats"`
+}
+
+// AccountOverviewList is the number of series of a list and a page of the most recent ones, latest first
+type AccountOverviewList struct {
+	Total  int                   `json:"total"`
+	Recent []AccountOverviewItem `json:"recent"`
+}
+
+// AccountOverviewItem is a series of a list of an account overview
+type AccountOverviewItem struct {
+	Slug      string `json:"slug"`
+	Name      string `json:"name"`
+	PosterURL string `json:"poster_url"`
+	// At is when the series was added to the list, favorited, read or visited
+	At time.Time `json:"at"`
+	// ChapterSlug is the last chapter read, only set on the reading list
+	ChapterSlug string `json:"chapter_slug,omitempty"`
+}
+
+// ReadingStats sums up the reading of a user
+type ReadingStats struct {
+	ChaptersRead int        `json:"chapters_read"`
+	SeriesRead   int        `json:"series_read"`
+	LastReadAt   *time.Time `json:"last_read_at,omitempty"`
+}
+
+// GetAccountOverview returns the account overview of a user, reading every list of the user in a single transaction
+func GetAccountOverview(username string, opts AccountOverviewOptions) (AccountOverview, error) {
+	mangas, err := listableMangas("", opts.ContentRatingLimit, false)
+	if err != nil {
+		return AccountOverview{}, err
+	}
+	visible := make(map[string]Manga, len(mangas))
+	for _, manga := range mangas {
+		visible[manga.Slug] = manga
+	}
+
+	overview := AccountOverview{Username: username, Statuses: make(map[string]int, len(SeriesStatuses))}
+	var favorites, reading, viewed []AccountOverviewItem
+	err = db.View(func(tx *bbolt.Tx) error {
+		prefix := username + ":"
+
+		bucket := tx.Bucket([]byte("favorites"))
+		for _, key := range keysWithPrefix(bucket, prefix) {
+			var favorite Favorite
+			if err := json.Unmarshal(bucket.Get(key), &favorite); err != nil {
+				return err
+			}
+			if manga, ok := visible[favorite.MangaSlug]; ok {
+				favorites = append(favorites, newAccountOverviewItem(manga, favorite.AddedAt))
+			}
+		}
+
+		latest := make(map[string]ReadingState)
+		bucket = tx.Bucket([]byte("reading_states"))
+		for _, key := range keysWithPrefix(bucket, prefix) {
+			var state ReadingState
+			if err := json.Unmarshal(bucket.Get(key), &state); err != nil {
+				return err
+			}
+			if _, ok := visible[state.MangaSlug]; !ok {
+				continue
+			}
+			overview.Stats.ChaptersRead++
+			if last, ok := latest[state.MangaSlug]; !ok || state.ReadAt.After(last.ReadAt) {
+				latest[state.MangaSlug] = state
+			}
+		}
+		statuses := make(map[string]string, len(latest))
+		for mangaSlug, state := range latest {
+			item := newAccountOverviewItem(visible[mangaSlug], state.ReadAt)
+			item.ChapterSlug = state.ChapterSlug
+			reading = append(reading, item)
+			statuses[mangaSlug] = SeriesStatusReading
+			if overview.Stats.LastReadAt == nil || state.ReadAt.After(*overview.Stats.LastReadAt) {
+				readAt := state.ReadAt
+				overview.Stats.LastReadAt = &readAt
+			}
+		}
+		overview.Stats.SeriesRead = len(latest)
+
+		bucket = tx.Bucket([]byte("user_series_status"))
+		for _, key := range keysWithPrefix(bucket, prefix) {
+			var status SeriesStatus
+			if err := json.Unmarshal(bucket.Get(key), &status); err != nil {
+				return err
+			}
+			if _, ok := visible[status.MangaSlug]; ok {
+				statuses[status.MangaSlug] = status.Status
+			}
+		}
+		for _, status := range statuses {
+			overview.Statuses[status]++
+		}
+
+		visits, err := recentVisits(tx.Bucket([]byte("recently_viewed")), username)
+		if err != nil {
+			return err
+		}
+		for _, visit := range visits {
+			if manga, ok := visible[visit.MangaSlug]; ok {
+				viewed = append(viewed, newAccountOverviewItem(manga, visit.VisitedAt))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return AccountOverview{}, err
+	}
+
+	overview.Favorites = newAccountOverviewList(favorites, opts)
+	overview.Reading = newAccountOverviewList(reading, opts)
+	overview.RecentlyViewed = newAccountOverviewList(viewed, opts)
+	return overview, nil
+}
+
+func newAccountOverviewItem(manga Manga, at time.Time) AccountOverviewItem {
+	return AccountOverviewItem{Slug: manga.Slug, Name: manga.Name, PosterURL: manga.PosterURL(), At: at}
+}
+
+// newAccountOverviewList sorts the series of a list latest first, by name when added at the same time, and keeps the
+// page the options select
+func newAccountOverviewList(items []AccountOverviewItem, opts AccountOverviewOptions) AccountOverviewList {
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].At.Equal(items[j].At) {
+			return items[i].At.After(items[j].At)
+		}
+		return strings.ToLower(items[i].Name) < strings.ToLower(items[j].Name)
+	})
+	start := min(max(opts.Offset, 0), len(items))
+	end := len(items)
+	if opts.Limit > 0 {
+		end = min(start+opts.Limit, len(items))
+	}
+	recent := make([]AccountOverviewItem, 0, end-start)
+	return AccountOverviewList{Total: len(items), Recent: append(recent, items[start:end]...)}
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+type ActivityLogEntry struct {
+	ID        uint64    `json:"id"`
+	Actor     string    `json:"actor"`
+	Type      string    `json:"type"`
+	Target    string    `json:"target"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LogActivity records an audit entry for an action performed by an actor against a target
+func LogActivity(actor, activityType, target string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("activity_log"))
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		entry := ActivityLogEntry{
+			ID:        id,
+			Actor:     actor,
+			Type:      activityType,
+			Target:    target,
+			CreatedAt: time.Now(),
+		}
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return b.Put(activityLogKey(id), encoded)
+	})
+}
+
+// ActivityLogFilter narrows down the activity log, empty fields match everything
+type ActivityLogFilter struct {
+	Type  string
+	Actor string
+	From  time.Time
+	To    time.Time
+}
+
+// matches reports whether an entry passes the filter, the To date is inclusive of the whole day
+func (f ActivityLogFilter) matches(entry ActivityLogEntry) bool {
+	if f.Type != "" && entry.Type != f.Type {
+		return false
+	}
+	if f.Actor != "" && !strings.EqualFold(entry.Actor, f.Actor) {
+		return false
+	}
+	if !f.From.IsZero() && entry.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !entry.CreatedAt.Before(f.To.AddDate(0, 0, 1)) {
+		return false
+	}
+	return true
+}
+
+// GetActivityLog returns a page of the entries matching the filter, newest first, and the total number of matches
+func GetActivityLog(filter ActivityLogFilter, page, pageSize int) ([]ActivityLogEntry, int, error) {
+	var entries []ActivityLogEntry
+	total := 0
+	start := (page - 1) * pageSize
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket([]byte("activity_log")).Cursor()
+		for k, v := cursor.Last(); k != nil; k, v = cursor.Prev() {
+			var entry ActivityLogEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if !filter.matches(entry) {
+				continue
+			}
+			if total >= start && len(entries) < pageSize {
+				entries = append(entries, entry)
+			}
+			total++
+		}
+		return nil
+	})
+	return entries, total, err
+}
+
+// forgetActivityActor removes a deleted user from the activity log, their entries are deleted or moved to the
+// placeholder user when keep is set
+func forgetActivityActor(tx *bbolt.Tx, username, placeholder string, keep bool) error {
+	bucket := tx.Bucket([]byte("activity_log"))
+
+	var updated []ActivityLogEntry
+	var deleted [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var entry ActivityLogEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return err
+		}
+		if entry.Actor != username {
+			return nil
+		}
+		if keep {
+			entry.Actor = placeholder
+			updated = append(updated, entry)
+		} else {
+			deleted = append(deleted, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range deleted {
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	for _, entry := range updated {
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(activityLogKey(entry.ID), encoded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activityLogKey encodes the id big-endian so entries are stored in insertion order
+func activityLogKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alexander-bruun/magi/utils"
+)
+
+// maxAliases bounds the alternative titles kept per manga, providers can list dozens of translations
+const maxAliases = 50
+
+// Titles returns the name of a manga followed by its aliases
+func (m Manga) Titles() []string {
+	return append([]string{m.Name}, m.Aliases...)
+}
+
+// NormalizeAliases trims the aliases and drops the empty ones, duplicates and those equal to the name, comparing
+// titles without case and diacritics
+func NormalizeAliases(name string, aliases []string) []string {
+	seen := map[string]bool{utils.FoldTitle(name): true}
+	var normalized []string
+	for _, alias := range aliases {
+		alias = strings.TrimSpace(alias)
+		folded := utils.FoldTitle(alias)
+		if folded == "" || seen[folded] {
+			continue
+		}
+		seen[folded] = true
+		normalized = append(normalized, alias)
+	}
+	return normalized
+}
+
+// SetMangaAliases replaces the alternative titles of a manga
+func SetMangaAliases(slug string, aliases []string) error {
+	manga, err := GetManga(slug)
+	if err != nil {
+		return err
+	}
+	aliases = NormalizeAliases(manga.Name, aliases)
+	if len(aliases) > maxAliases {
+		return fmt.Errorf("a manga can have at most %d aliases", maxAliases)
+	}
+	manga.Aliases = aliases
+	return UpdateManga(manga)
+}
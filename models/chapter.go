@@ -1,23 +1,57 @@
 package models
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/alexander-bruun/magi/utils"
 	"go.etcd.io/bbolt"
 )
 
+// Orders a chapter list can be displayed in
+const (
+	ChapterOrderAsc  = "asc"
+	ChapterOrderDesc = "desc"
+)
+
+// ChapterOrders lists the supported chapter list orders
+var ChapterOrders = []string{ChapterOrderAsc, ChapterOrderDesc}
+
+// EffectiveChapterOrder picks the first valid order, a user's preference before the library default, oldest first otherwise
+func EffectiveChapterOrder(orders ...string) string {
+	for _, order := range orders {
+		if slices.Contains(ChapterOrders, order) {
+			return order
+		}
+	}
+	return ChapterOrderAsc
+}
+
 type Chapter struct {
-	Slug            string `json:"slug"`
-	Name            string `json:"name"`
-	Type            string `json:"type"`
-	File            string `json:"file"`
-	ChapterCoverURL string `json:"chapter_cover_url"`
-	MangaSlug       string `json:"manga_slug"`
+	Slug            string    `json:"slug"`
+	Name            string    `json:"name"`
+	Type            string    `json:"type"`
+	File            string    `json:"file"`
+	ChapterCoverURL string    `json:"chapter_cover_url"`
+	MangaSlug       string    `json:"manga_slug"`
+	PageCount       int       `json:"page_count"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at,omitempty"`
+	FileSize        int64     `json:"file_size,omitempty"`
+	FileModTime     time.Time `json:"file_mod_time,omitempty"`
+}
+
+// FileChanged reports whether the chapter source no longer matches the recorded size and modification time,
+// chapters indexed before these were tracked never count as changed
+func (c Chapter) FileChanged(size int64, modTime time.Time) bool {
+	if c.FileSize == 0 && c.FileModTime.IsZero() {
+		return false
+	}
+	return c.FileSize != size || !c.FileModTime.Equal(modTime)
 }
 
 // CreateChapter adds a new chapter if it does not already exist
@@ -28,33 +62,78 @@ func CreateChapter(chapter Chapter) error {
 	} else if exists {
 		return errors.New("chapter already exists")
 	}
+	chapter.CreatedAt = time.Now()
 
-	return create("chapters", chapterKey(chapter.MangaSlug, chapter.Slug), chapter)
+	if err := create("chapters", chapterKey(chapter.MangaSlug, chapter.Slug), chapter); err != nil {
+		return err
+	}
+	NotifyListeners(Notification{Type: "chapter_created", Payload: chapter})
+	return nil
 }
 
-// GetChapters retrieves all chapters for a specific manga, sorted by name
+// GetChapters retrieves all chapters for a specific manga, sorted by chapter number
 func GetChapters(mangaSlug string) ([]Chapter, error) {
+	return GetChaptersInOrder(mangaSlug, ChapterOrderAsc)
+}
+
+// GetChaptersInOrder retrieves all chapters for a specific manga sorted by chapter number, newest first for ChapterOrderDesc
+func GetChaptersInOrder(mangaSlug, order string) ([]Chapter, error) {
 	var chapters []Chapter
 	err := db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("chapters"))
-		cursor := bucket.Cursor()
-		prefix := []byte(mangaSlug + ":")
+		var err error
+		chapters, err = chaptersInBucket(tx.Bucket([]byte("chapters")), mangaSlug)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
-			var chapter Chapter
-			if err := json.Unmarshal(v, &chapter); err != nil {
+	sortChaptersByNumber(chapters)
+	if order == ChapterOrderDesc {
+		slices.Reverse(chapters)
+	}
+	return chapters, nil
+}
+
+// GetLatestChapters returns the numerically latest chapter of each of the given mangas in a single transaction
+func GetLatestChapters(mangaSlugs []string) (map[string]Chapter, error) {
+	latest := make(map[string]Chapter)
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("chapters"))
+		for _, mangaSlug := range mangaSlugs {
+			chapters, err := chaptersInBucket(bucket, mangaSlug)
+			if err != nil {
 				return err
 			}
-			chapters = append(chapters, chapter)
+			for i, chapter := range chapters {
+				if i == 0 || chapterIsLater(chapter, latest[mangaSlug]) {
+					latest[mangaSlug] = chapter
+				}
+			}
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	return latest, nil
+}
 
-	sortChaptersByNumber(chapters)
-	return chapters, nil
+// mangaSlugsWithChapters returns the slugs of the mangas having at least one chapter
+func mangaSlugsWithChapters() (map[string]bool, error) {
+	slugs := make(map[string]bool)
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("chapters")).ForEach(func(k, _ []byte) error {
+			if mangaSlug, _, ok := strings.Cut(string(k), ":"); ok {
+				slugs[mangaSlug] = true
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slugs, nil
 }
 
 // GetChapter retrieves a specific chapter by its slug
@@ -131,6 +210,19 @@ func sortChaptersByNumber(chapters []Chapter) {
 	})
 }
 
+// chapterIsLater orders chapters like sortChaptersByNumber, using the creation time when the numbers are equal
+func chapterIsLater(a, b Chapter) bool {
+	numA, errA := utils.ExtractNumber(a.Name)
+	numB, errB := utils.ExtractNumber(b.Name)
+	if errA != nil || errB != nil {
+		return a.Name > b.Name
+	}
+	if numA != numB {
+		return numA > numB
+	}
+	return a.CreatedAt.After(b.CreatedAt)
+}
+
 func indexOfChapter(chapters []Chapter, chapterSlug string) int {
 	for i, chapter := range chapters {
 		if chapter.Slug == chapterSlug {
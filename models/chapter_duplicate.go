@@ -0,0 +1,178 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Policies deciding which of the files of a series with the same chapter number is indexed as the chapter
+const (
+	DuplicateChapterPolicyManual  = "manual"
+	DuplicateChapterPolicyLargest = "largest"
+	DuplicateChapterPolicyNewest  = "newest"
+	DuplicateChapterPolicyKeyword = "keyword"
+)
+
+// ChapterDuplicateFile is one of the files of a series found with the same chapter number
+type ChapterDuplicateFile struct {
+	File    string    `json:"file"`
+	Name    string    `json:"name"`
+	Slug    string    `json:"slug"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ChapterDuplicate records the files of a series folder that parse to the same chapter number
+type ChapterDuplicate struct {
+	MangaSlug string                 `json:"manga_slug"`
+	Number    string                 `json:"number"`
+	Files     []ChapterDuplicateFile `json:"files"`
+	// Kept is the file indexed as the chapter, empty while the duplicate waits for an admin to pick one
+	Kept string `json:"kept,omitempty"`
+	// Suggested is the file the keep policy picks while it isn't applied automatically, for an admin to confirm
+	Suggested string `json:"suggested,omitempty"`
+	// Resolved is set when an admin picked the kept file, which then wins over the keep policy
+	Resolved   bool      `json:"resolved,omitempty"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// File returns the duplicate file with the given name
+func (d ChapterDuplicate) File(name string) (ChapterDuplicateFile, bool) {
+	for _, file := range d.Files {
+		if file.File == name {
+			return file, true
+		}
+	}
+	return ChapterDuplicateFile{}, false
+}
+
+// ChooseDuplicateChapter returns the file a keep policy indexes out of duplicate files, empty for the manual policy.
+// The keyword policy prefers the files whose name contains the keyword, ties are broken by size, then by date and
+// name so every index keeps the same file.
+func ChooseDuplicateChapter(files []ChapterDuplicateFile, policy, keyword string) string {
+	if policy == DuplicateChapterPolicyManual || len(files) == 0 {
+		return ""
+	}
+	candidates := slices.Clone(files)
+	if policy == DuplicateChapterPolicyKeyword {
+		keyword = strings.ToLower(keyword)
+		matching := slices.DeleteFunc(slices.Clone(files), func(file ChapterDuplicateFile) bool {
+			return !strings.Contains(strings.ToLower(file.File), keyword)
+		})
+		if len(matching) > 0 {
+			candidates = matching
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if policy == DuplicateChapterPolicyNewest && !a.ModTime.Equal(b.ModTime) {
+			return a.ModTime.After(b.ModTime)
+		}
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		if !a.ModTime.Equal(b.ModTime) {
+			return a.ModTime.After(b.ModTime)
+		}
+		return a.File < b.File
+	})
+	return candidates[0].File
+}
+
+// SetChapterDuplicates replaces the duplicates recorded for a manga with the ones found by its last index
+func SetChapterDuplicates(mangaSlug string, duplicates []ChapterDuplicate) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("chapter_duplicates"))
+		for _, key := range keysWithPrefix(bucket, mangaSlug+":") {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		for _, duplicate := range duplicates {
+			if err := putJSON(bucket, chapterDuplicateKey(mangaSlug, duplicate.Number), duplicate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetChapterDuplicate returns the duplicate recorded for a chapter number of a manga
+func GetChapterDuplicate(mangaSlug, number string) (ChapterDuplicate, error) {
+	var duplicate ChapterDuplicate
+	err := get("chapter_duplicates", chapterDuplicateKey(mangaSlug, number), &duplicate)
+	return duplicate, err
+}
+
+// GetChapterDuplicatesByMangaSlug returns the duplicates recorded for a manga, by chapter number
+func GetChapterDuplicatesByMangaSlug(mangaSlug string) (map[string]ChapterDuplicate, error) {
+	duplicates := make(map[string]ChapterDuplicate)
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("chapter_duplicates"))
+		for _, key := range keysWithPrefix(bucket, mangaSlug+":") {
+			var duplicate ChapterDuplicate
+			if err := json.Unmarshal(bucket.Get(key), &duplicate); err != nil {
+				return err
+			}
+			duplicates[duplicate.Number] = duplicate
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return duplicates, nil
+}
+
+// GetChapterDuplicates returns every recorded duplicate, the ones waiting for an admin first
+func GetChapterDuplicates() ([]ChapterDuplicate, error) {
+	duplicates := []ChapterDuplicate{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("chapter_duplicates")).ForEach(func(_, v []byte) error {
+			var duplicate ChapterDuplicate
+			if err := json.Unmarshal(v, &duplicate); err != nil {
+				return err
+			}
+			duplicates = append(duplicates, duplicate)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Kept == "" && duplicates[j].Kept != ""
+	})
+	return duplicates, nil
+}
+
+// ResolveChapterDuplicate records the file an admin picked out of duplicate files, it is kept by every later index
+func ResolveChapterDuplicate(mangaSlug, number, file string) (ChapterDuplicate, error) {
+	duplicate, err := GetChapterDuplicate(mangaSlug, number)
+	if err != nil {
+		return ChapterDuplicate{}, err
+	}
+	if _, ok := duplicate.File(file); !ok {
+		return ChapterDuplicate{}, fmt.Errorf("'%s' is not one of the files of chapter %s", file, number)
+	}
+	duplicate.Kept = file
+	duplicate.Resolved = true
+	return duplicate, update("chapter_duplicates", chapterDuplicateKey(mangaSlug, number), duplicate)
+}
+
+// DeleteChapterDuplicatesByMangaSlug forgets the duplicate chapters of a manga
+func DeleteChapterDuplicatesByMangaSlug(mangaSlug string) error {
+	return SetChapterDuplicates(mangaSlug, nil)
+}
+
+func chapterDuplicateKey(mangaSlug, number string) string {
+	return fmt.Sprintf("%s:%s", mangaSlug, number)
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/alexander-bruun/magi/utils"
+	"go.etcd.io/bbolt"
+)
+
+// ChapterIssue records the pages of a chapter that failed to decode during the last page check
+type ChapterIssue struct {
+	MangaSlug   string            `json:"manga_slug"`
+	ChapterSlug string            `json:"chapter_slug"`
+	Pages       []utils.PageIssue `json:"pages"`
+	CheckedAt   time.Time         `json:"checked_at"`
+}
+
+// BadPages returns the 1-based numbers of the unreadable pages
+func (i ChapterIssue) BadPages() map[int]bool {
+	pages := make(map[int]bool, len(i.Pages))
+	for _, page := range i.Pages {
+		pages[page.Page] = true
+	}
+	return pages
+}
+
+// SetChapterIssues stores the result of checking the pages of a chapter, a chapter without bad pages has its
+// previous issue cleared
+func SetChapterIssues(mangaSlug, chapterSlug string, pages []utils.PageIssue) error {
+	if len(pages) == 0 {
+		return delete("chapter_issues", chapterIssueKey(mangaSlug, chapterSlug))
+	}
+	return create("chapter_issues", chapterIssueKey(mangaSlug, chapterSlug), ChapterIssue{
+		MangaSlug:   mangaSlug,
+		ChapterSlug: chapterSlug,
+		Pages:       pages,
+		CheckedAt:   time.Now(),
+	})
+}
+
+// RecordPageIssue adds a page that failed to be served to the issues of its chapter
+func RecordPageIssue(mangaSlug, chapterSlug string, page utils.PageIssue) error {
+	issue, err := GetChapterIssue(mangaSlug, chapterSlug)
+	if err != nil {
+		issue = ChapterIssue{MangaSlug: mangaSlug, ChapterSlug: chapterSlug}
+	}
+	if issue.BadPages()[page.Page] {
+		return nil
+	}
+	pages := append(issue.Pages, page)
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Page < pages[j].Page })
+	return SetChapterIssues(mangaSlug, chapterSlug, pages)
+}
+
+// GetChapterIssue returns the issue recorded for a chapter, bbolt.ErrBucketNotFound when its pages are fine
+func GetChapterIssue(mangaSlug, chapterSlug string) (ChapterIssue, error) {
+	var issue ChapterIssue
+	err := get("chapter_issues", chapterIssueKey(mangaSlug, chapterSlug), &issue)
+	return issue, err
+}
+
+// GetChapterIssues returns every chapter with unreadable pages, ordered by manga and chapter
+func GetChapterIssues() ([]ChapterIssue, error) {
+	issues := []ChapterIssue{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("chapter_issues")).ForEach(func(_, v []byte) error {
+			var issue ChapterIssue
+			if err := json.Unmarshal(v, &issue); err != nil {
+				return err
+			}
+			issues = append(issues, issue)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+// DeleteChapterIssuesByMangaSlug removes the issues of every chapter of a manga
+func DeleteChapterIssuesByMangaSlug(mangaSlug string) error {
+	return deleteKeysWithPattern("chapter_issues", fmt.Sprintf("%s:*", mangaSlug))
+}
+
+func chapterIssueKey(mangaSlug, chapterSlug string) string {
+	return fmt.Sprintf("%s:%s", mangaSlug, chapterSlug)
+}
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// RenameChapter replaces an indexed chapter with the chapter it was renamed to, in a single transaction. Reading
+// states, comments, offline markers, page check results, share links and comment reports follow the chapter to its
+// new slug, so a renamed file keeps its history.
+func RenameChapter(mangaSlug, oldSlug string, chapter Chapter) error {
+	if chapter.MangaSlug != mangaSlug {
+		return fmt.Errorf("chapter '%s' does not belong to manga '%s'", chapter.Slug, mangaSlug)
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		chapters := tx.Bucket([]byte("chapters"))
+		if chapters.Get([]byte(chapterKey(mangaSlug, oldSlug))) == nil {
+			return fmt.Errorf("chapter '%s' of manga '%s' not found", oldSlug, mangaSlug)
+		}
+		if oldSlug != chapter.Slug && chapters.Get([]byte(chapterKey(mangaSlug, chapter.Slug))) != nil {
+			return errors.New("chapter already exists")
+		}
+		if err := chapters.Delete([]byte(chapterKey(mangaSlug, oldSlug))); err != nil {
+			return err
+		}
+		if err := putJSON(chapters, chapterKey(mangaSlug, chapter.Slug), chapter); err != nil {
+			return err
+		}
+
+		if err := renameChapterRecords(tx.Bucket([]byte("reading_states")), mangaSlug, oldSlug, func(state *ReadingState) string {
+			state.ChapterSlug = chapter.Slug
+			return readingStateKey(state.Username, mangaSlug, chapter.Slug)
+		}); err != nil {
+			return err
+		}
+		if err := renameChapterRecords(tx.Bucket([]byte("chapter_comments")), mangaSlug, oldSlug, func(comment *ChapterComment) string {
+			comment.ChapterSlug = chapter.Slug
+			return commentKey(mangaSlug, chapter.Slug, comment.ID)
+		}); err != nil {
+			return err
+		}
+		if err := renameChapterRecords(tx.Bucket([]byte("offline_chapters")), mangaSlug, oldSlug, func(offline *OfflineChapter) string {
+			offline.ChapterSlug = chapter.Slug
+			return offlineChapterKey(offline.Username, offline.Device, mangaSlug, chapter.Slug)
+		}); err != nil {
+			return err
+		}
+		if err := renameChapterRecords(tx.Bucket([]byte("chapter_issues")), mangaSlug, oldSlug, func(issue *ChapterIssue) string {
+			issue.ChapterSlug = chapter.Slug
+			return chapterIssueKey(mangaSlug, chapter.Slug)
+		}); err != nil {
+			return err
+		}
+		if err := renameChapterRecords(tx.Bucket([]byte("share_links")), mangaSlug, oldSlug, func(link *ShareLink) string {
+			link.ChapterSlug = chapter.Slug
+			return link.Token
+		}); err != nil {
+			return err
+		}
+		return renameCommentReports(tx.Bucket([]byte("reports")), mangaSlug, oldSlug, chapter.Slug)
+	})
+}
+
+// MergeChapter folds a chapter into another chapter of the same manga and removes it, in a single transaction.
+// Reading states, comments, share links and comment reports move to the chapter kept, a user who has read both keeps
+// the reading state of the kept chapter. Offline markers and page check results belong to the file of the removed
+// chapter and go with it.
+func MergeChapter(mangaSlug, fromSlug, intoSlug string) error {
+	if fromSlug == intoSlug {
+		return nil
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		chapters := tx.Bucket([]byte("chapters"))
+		if chapters.Get([]byte(chapterKey(mangaSlug, fromSlug))) == nil {
+			return fmt.Errorf("chapter '%s' of manga '%s' not found", fromSlug, mangaSlug)
+		}
+		if chapters.Get([]byte(chapterKey(mangaSlug, intoSlug))) == nil {
+			return fmt.Errorf("chapter '%s' of manga '%s' not found", intoSlug, mangaSlug)
+		}
+		if err := chapters.Delete([]byte(chapterKey(mangaSlug, fromSlug))); err != nil {
+			return err
+		}
+
+		readingStates := tx.Bucket([]byte("reading_states"))
+		if err := renameChapterRecords(readingStates, mangaSlug, fromSlug, func(state *ReadingState) string {
+			key := readingStateKey(state.Username, mangaSlug, intoSlug)
+			if readingStates.Get([]byte(key)) != nil {
+				return ""
+			}
+			state.ChapterSlug = intoSlug
+			return key
+		}); err != nil {
+			return err
+		}
+		if err := renameChapterRecords(tx.Bucket([]byte("chapter_comments")), mangaSlug, fromSlug, func(comment *ChapterComment) string {
+			comment.ChapterSlug = intoSlug
+			return commentKey(mangaSlug, intoSlug, comment.ID)
+		}); err != nil {
+			return err
+		}
+		if err := renameChapterRecords(tx.Bucket([]byte("offline_chapters")), mangaSlug, fromSlug, func(*OfflineChapter) string {
+			return ""
+		}); err != nil {
+			return err
+		}
+		if err := renameChapterRecords(tx.Bucket([]byte("chapter_issues")), mangaSlug, fromSlug, func(*ChapterIssue) string {
+			return ""
+		}); err != nil {
+			return err
+		}
+		if err := renameChapterRecords(tx.Bucket([]byte("share_links")), mangaSlug, fromSlug, func(link *ShareLink) string {
+			link.ChapterSlug = intoSlug
+			return link.Token
+		}); err != nil {
+			return err
+		}
+		return renameCommentReports(tx.Bucket([]byte("reports")), mangaSlug, fromSlug, intoSlug)
+	})
+}
+
+// chapterRecord is a stored value tied to a chapter of a manga
+type chapterRecord interface {
+	ReadingState | ChapterComment | OfflineChapter | ChapterIssue | ShareLink
+}
+
+// renameChapterRecords moves the records of a bucket tied to a chapter, rename updates a record and returns its new
+// key, or an empty key to drop it
+func renameChapterRecords[T chapterRecord](bucket *bbolt.Bucket, mangaSlug, chapterSlug string, rename func(*T) string) error {
+	moved := make(map[string]*T)
+	err := bucket.ForEach(func(k, v []byte) error {
+		// Every chapter record stores its manga and chapter under the keys of a share target
+		var target ShareTarget
+		if err := json.Unmarshal(v, &target); err != nil {
+			return nil
+		}
+		if target.MangaSlug != mangaSlug || target.ChapterSlug != chapterSlug {
+			return nil
+		}
+		record := new(T)
+		if err := json.Unmarshal(v, record); err != nil {
+			return err
+		}
+		moved[string(k)] = record
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, record := range moved {
+		if err := bucket.Delete([]byte(key)); err != nil {
+			return err
+		}
+		newKey := rename(record)
+		if newKey == "" {
+			continue
+		}
+		if err := putJSON(bucket, newKey, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameCommentReports points the reports of the comments of a chapter at its new slug
+func renameCommentReports(bucket *bbolt.Bucket, mangaSlug, oldSlug, newSlug string) error {
+	updated := make(map[string]Report)
+	err := bucket.ForEach(func(k, v []byte) error {
+		var report Report
+		if err := json.Unmarshal(v, &report); err != nil {
+			return err
+		}
+		if report.TargetType != ReportTargetComment {
+			return nil
+		}
+		reportManga, reportChapter, id, err := parseCommentTargetID(report.TargetID)
+		if err != nil || reportManga != mangaSlug || reportChapter != oldSlug {
+			return nil
+		}
+		report.TargetID = CommentTargetID(mangaSlug, newSlug, id)
+		updated[string(k)] = report
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, report := range updated {
+		if err := putJSON(bucket, key, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putJSON(bucket *bbolt.Bucket, key string, value any) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), encoded)
+}
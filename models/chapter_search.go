@@ -0,0 +1,82 @@
+package models
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alexander-bruun/magi/utils"
+)
+
+// chapterNumberQueryPattern matches a chapter number or range query such as "10.5", "ch. 12" or "120-121"
+var chapterNumberQueryPattern = regexp.MustCompile(`(?i)^(?:ch(?:ap(?:ter)?)?\.?\s*)?(\d+(?:\.\d+)?)(?:\s*-\s*(\d+(?:\.\d+)?))?$`)
+
+// SearchChapters finds the chapters of a manga to jump to. A number or range query returns the chapters ordered by
+// how close their number is, so the nearest chapters come back when the number itself is missing. Any other query
+// matches a fragment of the chapter names, in chapter order.
+func SearchChapters(mangaSlug, query string, limit int) ([]Chapter, error) {
+	chapters, err := GetChapters(mangaSlug)
+	if err != nil {
+		return nil, err
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []Chapter{}, nil
+	}
+
+	var matches []Chapter
+	if low, high, ok := parseChapterNumberQuery(query); ok {
+		distances := make(map[string]float64, len(chapters))
+		numbers := make(map[string]float64, len(chapters))
+		for _, chapter := range chapters {
+			number, err := utils.ExtractDecimalNumber(chapter.Name)
+			if err != nil {
+				continue
+			}
+			numbers[chapter.Slug] = number
+			distances[chapter.Slug] = math.Max(0, math.Max(low-number, number-high))
+			matches = append(matches, chapter)
+		}
+		sort.SliceStable(matches, func(i, j int) bool {
+			a, b := matches[i].Slug, matches[j].Slug
+			if distances[a] != distances[b] {
+				return distances[a] < distances[b]
+			}
+			return numbers[a] < numbers[b]
+		})
+	} else {
+		fragment := strings.ToLower(query)
+		for _, chapter := range chapters {
+			if strings.Contains(strings.ToLower(chapter.Name), fragment) {
+				matches = append(matches, chapter)
+			}
+		}
+	}
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	if matches == nil {
+		matches = []Chapter{}
+	}
+	return matches, nil
+}
+
+// parseChapterNumberQuery returns the bounds of a chapter number or range query, a single number has equal bounds
+func parseChapterNumberQuery(query string) (low, high float64, ok bool) {
+	match := chapterNumberQueryPattern.FindStringSubmatch(query)
+	if match == nil {
+		return 0, 0, false
+	}
+	low, _ = strconv.ParseFloat(match[1], 64)
+	high = low
+	if match[2] != "" {
+		high, _ = strconv.ParseFloat(match[2], 64)
+	}
+	if high < low {
+		low, high = high, low
+	}
+	return low, high, true
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// MediaFilter selects the mangas a bulk cleanup applies to, empty fields match everything
+type MediaFilter struct {
+	LibrarySlug   string `form:"library"`
+	Tag           string `form:"tag"`
+	ContentRating string `form:"content_rating"`
+	NoChapters    bool   `form:"no_chapters"`
+}
+
+// Empty reports whether the filter matches every manga
+func (f MediaFilter) Empty() bool {
+	return f == MediaFilter{}
+}
+
+// String describes the filter for the activity log
+func (f MediaFilter) String() string {
+	var parts []string
+	if f.LibrarySlug != "" {
+		parts = append(parts, "library="+f.LibrarySlug)
+	}
+	if f.Tag != "" {
+		parts = append(parts, "tag="+f.Tag)
+	}
+	if f.ContentRating != "" {
+		parts = append(parts, "content_rating="+f.ContentRating)
+	}
+	if f.NoChapters {
+		parts = append(parts, "no_chapters")
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// FindMedia returns the mangas matching a filter sorted by name, hidden mangas included
+func FindMedia(filter MediaFilter) ([]Manga, error) {
+	var mangas []Manga
+	if err := loadAllMangas(&mangas); err != nil {
+		return nil, err
+	}
+
+	var withChapters map[string]bool
+	if filter.NoChapters {
+		var err error
+		if withChapters, err = mangaSlugsWithChapters(); err != nil {
+			return nil, err
+		}
+	}
+
+	matched := []Manga{}
+	for _, manga := range mangas {
+		if filter.LibrarySlug != "" && manga.LibrarySlug != filter.LibrarySlug {
+			continue
+		}
+		if filter.Tag != "" && indexOfTag(manga.Tags, filter.Tag) == -1 {
+			continue
+		}
+		if filter.ContentRating != "" && manga.ContentRating != filter.ContentRating {
+			continue
+		}
+		if filter.NoChapters && withChapters[manga.Slug] {
+			continue
+		}
+		matched = append(matched, manga)
+	}
+	sortMangasByName(matched)
+	return matched, nil
+}
+
+// MediaDigest fingerprints a set of mangas, so a bulk change can check it applies to the set that was previewed
+func MediaDigest(mangas []Manga) string {
+	slugs := make([]string, len(mangas))
+	for i, manga := range mangas {
+		slugs[i] = manga.Slug
+	}
+	sort.Strings(slugs)
+	sum := sha256.Sum256([]byte(strings.Join(slugs, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetMediaHidden hides or unhides the given mangas in a single transaction, returning how many mangas were changed.
+// Hidden mangas stay indexed but are left out of every listing and only admins can open them.
+func SetMediaHidden(slugs []string, hidden bool) (int, error) {
+	updated := 0
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("mangas"))
+		for _, slug := range slugs {
+			data := bucket.Get([]byte(slug))
+			if data == nil {
+				return fmt.Errorf("manga not found: %s", slug)
+			}
+
+			var manga Manga
+			if err := json.Unmarshal(data, &manga); err != nil {
+				return err
+			}
+			if manga.Hidden == hidden {
+				continue
+			}
+
+			manga.Hidden = hidden
+			manga.UpdatedAt = time.Now()
+			encoded, err := json.Marshal(manga)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(slug), encoded); err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if updated > 0 {
+		invalidateSimilarMangas()
+	}
+	return updated, nil
+}
@@ -0,0 +1,290 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.etcd.io/bbolt"
+)
+
+// maxCommentLength limits the number of characters of a comment
+const maxCommentLength = 2000
+
+type ChapterComment struct {
+	ID          uint64    `json:"id"`
+	MangaSlug   string    `json:"manga_slug"`
+	ChapterSlug string    `json:"chapter_slug"`
+	Username    string    `json:"username"`
+	Body        string    `json:"body"`
+	ParentID    uint64    `json:"parent_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CommentThread is a top level comment along with its replies, oldest first
+type CommentThread struct {
+	ChapterComment
+	Replies []ChapterComment
+}
+
+// CreateChapterComment adds a comment to a chapter, replies to a reply are attached to the top level comment
+func CreateChapterComment(mangaSlug, chapterSlug, username, body string, parentID uint64) (*ChapterComment, error) {
+	body, err := sanitizeCommentBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := ChapterComment{
+		MangaSlug:   mangaSlug,
+		ChapterSlug: chapterSlug,
+		Username:    username,
+		Body:        body,
+		CreatedAt:   time.Now(),
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("chapter_comments"))
+
+		if parentID != 0 {
+			parent, err := commentInBucket(bucket, mangaSlug, chapterSlug, parentID)
+			if err != nil {
+				return err
+			}
+			comment.ParentID = parent.ID
+			if parent.ParentID != 0 {
+				comment.ParentID = parent.ParentID
+			}
+		}
+
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		comment.ID = id
+
+		encoded, err := json.Marshal(comment)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(commentKey(mangaSlug, chapterSlug, id)), encoded)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// GetChapterComment retrieves a single comment of a chapter
+func GetChapterComment(mangaSlug, chapterSlug string, id uint64) (*ChapterComment, error) {
+	var comment *ChapterComment
+	err := db.View(func(tx *bbolt.Tx) error {
+		var err error
+		comment, err = commentInBucket(tx.Bucket([]byte("chapter_comments")), mangaSlug, chapterSlug, id)
+		return err
+	})
+	return comment, err
+}
+
+// GetChapterComments returns a page of comment threads of a chapter, newest first, and the total number of threads
+func GetChapterComments(mangaSlug, chapterSlug string, page, pageSize int) ([]CommentThread, int, error) {
+	var comments []ChapterComment
+	err := db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket([]byte("chapter_comments")).Cursor()
+		prefix := []byte(commentPrefix(mangaSlug, chapterSlug))
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			var comment ChapterComment
+			if err := json.Unmarshal(v, &comment); err != nil {
+				return err
+			}
+			comments = append(comments, comment)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var threads []CommentThread
+	replies := make(map[uint64][]ChapterComment)
+	for _, comment := range comments {
+		if comment.ParentID == 0 {
+			threads = append(threads, CommentThread{ChapterComment: comment})
+		} else {
+			replies[comment.ParentID] = append(replies[comment.ParentID], comment)
+		}
+	}
+	sort.Slice(threads, func(i, j int) bool {
+		return threads[i].ID > threads[j].ID
+	})
+
+	total := len(threads)
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []CommentThread{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	threads = threads[start:end]
+	for i := range threads {
+		threads[i].Replies = replies[threads[i].ID]
+	}
+	return threads, total, nil
+}
+
+// DeleteChapterComment removes a comment along with its replies
+func DeleteChapterComment(mangaSlug, chapterSlug string, id uint64) error {
+	defer closeReportsWithoutTarget()
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("chapter_comments"))
+		for _, key := range keysWithPrefix(bucket, commentPrefix(mangaSlug, chapterSlug)) {
+			var comment ChapterComment
+			if err := json.Unmarshal(bucket.Get(key), &comment); err != nil {
+				return err
+			}
+			if comment.ID == id || comment.ParentID == id {
+				if err := bucket.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteChapterCommentsByMangaSlug removes the comments of every chapter of a manga
+func DeleteChapterCommentsByMangaSlug(mangaSlug string) error {
+	return deleteCommentsWithPrefix(mangaSlug + ":")
+}
+
+// DeleteChapterCommentsByChapter removes the comments of a single chapter
+func DeleteChapterCommentsByChapter(mangaSlug, chapterSlug string) error {
+	defer closeReportsWithoutTarget()
+	return deleteCommentsWithPrefix(commentPrefix(mangaSlug, chapterSlug))
+}
+
+// deleteChapterCommentsByUsername removes every comment written by a user, along with the replies to them. The reports
+// of the removed comments are left for closeReportsWithoutTarget once the transaction is committed.
+func deleteChapterCommentsByUsername(tx *bbolt.Tx, username string) error {
+	bucket := tx.Bucket([]byte("chapter_comments"))
+
+	deleted := make(map[string]bool)
+	err := bucket.ForEach(func(k, v []byte) error {
+		var comment ChapterComment
+		if err := json.Unmarshal(v, &comment); err != nil {
+			return err
+		}
+		if comment.Username == username {
+			deleted[commentKey(comment.MangaSlug, comment.ChapterSlug, comment.ID)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var keys [][]byte
+	err = bucket.ForEach(func(k, v []byte) error {
+		var comment ChapterComment
+		if err := json.Unmarshal(v, &comment); err != nil {
+			return err
+		}
+		if deleted[string(k)] || deleted[commentKey(comment.MangaSlug, comment.ChapterSlug, comment.ParentID)] {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anonymizeChapterComments moves the comments of a user to an anonymous placeholder user
+func anonymizeChapterComments(tx *bbolt.Tx, username, placeholder string) error {
+	bucket := tx.Bucket([]byte("chapter_comments"))
+
+	updated := make(map[string]ChapterComment)
+	err := bucket.ForEach(func(k, v []byte) error {
+		var comment ChapterComment
+		if err := json.Unmarshal(v, &comment); err != nil {
+			return err
+		}
+		if comment.Username == username {
+			comment.Username = placeholder
+			updated[string(k)] = comment
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, comment := range updated {
+		if err := putJSON(bucket, key, comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper functions
+
+func deleteCommentsWithPrefix(prefix string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("chapter_comments"))
+		for _, key := range keysWithPrefix(bucket, prefix) {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func commentInBucket(bucket *bbolt.Bucket, mangaSlug, chapterSlug string, id uint64) (*ChapterComment, error) {
+	data := bucket.Get([]byte(commentKey(mangaSlug, chapterSlug, id)))
+	if data == nil {
+		return nil, errors.New("comment not found")
+	}
+
+	var comment ChapterComment
+	if err := json.Unmarshal(data, &comment); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// sanitizeCommentBody trims the body and checks it is neither empty nor too long, HTML is escaped when rendering
+func sanitizeCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(strings.ToValidUTF8(body, ""))
+	if body == "" {
+		return "", errors.New("comment cannot be empty")
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return "", fmt.Errorf("comment cannot be longer than %d characters", maxCommentLength)
+	}
+	return body, nil
+}
+
+func commentPrefix(mangaSlug, chapterSlug string) string {
+	return fmt.Sprintf("%s:%s:", mangaSlug, chapterSlug)
+}
+
+// commentKey zero pads the id so the comments of a chapter are stored in creation order
+func commentKey(mangaSlug, chapterSlug string, id uint64) string {
+	return fmt.Sprintf("%s%020d", commentPrefix(mangaSlug, chapterSlug), id)
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// minCommunityReaders is how many readers have to be on the same chapter before it is shown as the community
+// position, fewer would be misleading and could point at the progress of a single user
+const minCommunityReaders = 3
+
+// CommunityReadingPosition is the chapter of a series most of its readers are currently on
+type CommunityReadingPosition struct {
+	ChapterSlug string `json:"chapter_slug"`
+	ChapterName string `json:"chapter_name"`
+	// AtChapter is the number of readers currently on the chapter, out of the Readers of the series
+	AtChapter int `json:"at_chapter"`
+	Readers   int `json:"readers"`
+}
+
+// GetCommunityReadingPosition returns the chapter of a series most readers are on, the current chapter of a reader
+// being the highest numbered chapter they read. It returns nil when too few readers share a chapter. Only the counts
+// are exposed, never who is where.
+func GetCommunityReadingPosition(mangaSlug string) (*CommunityReadingPosition, error) {
+	var position *CommunityReadingPosition
+	err := db.View(func(tx *bbolt.Tx) error {
+		chapters, err := chaptersInBucket(tx.Bucket([]byte("chapters")), mangaSlug)
+		if err != nil {
+			return err
+		}
+		sortChaptersByNumber(chapters)
+		indexes := make(map[string]int, len(chapters))
+		for i, chapter := range chapters {
+			indexes[chapter.Slug] = i
+		}
+
+		// A single pass over the keys of the reading states, the values aren't needed
+		current := make(map[string]int)
+		cursor := tx.Bucket([]byte("reading_states")).Cursor()
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+			parts := strings.SplitN(string(k), ":", 3)
+			if len(parts) != 3 || parts[1] != mangaSlug {
+				continue
+			}
+			index, ok := indexes[parts[2]]
+			if !ok {
+				continue
+			}
+			if highest, seen := current[parts[0]]; !seen || index > highest {
+				current[parts[0]] = index
+			}
+		}
+
+		readers := make([]int, len(chapters))
+		for _, index := range current {
+			readers[index]++
+		}
+		best := -1
+		for i, count := range readers {
+			// Ties go to the later chapter
+			if count >= minCommunityReaders && (best == -1 || count >= readers[best]) {
+				best = i
+			}
+		}
+		if best != -1 {
+			position = &CommunityReadingPosition{
+				ChapterSlug: chapters[best].Slug,
+				ChapterName: chapters[best].Name,
+				AtChapter:   readers[best],
+				Readers:     len(current),
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return position, nil
+}
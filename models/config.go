@@ -0,0 +1,597 @@
+package models
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alexander-bruun/magi/utils"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/robfig/cron/v3"
+)
+
+type AppConfig struct {
+	RequireAuthToRead           bool     `json:"require_auth_to_read" form:"require_auth_to_read"`
+	AnonymousContentRatingLimit string   `json:"anonymous_content_rating_limit" form:"anonymous_content_rating_limit"`
+	DisableSearchForAnonymous   bool     `json:"disable_search_for_anonymous" form:"disable_search_for_anonymous"`
+	EnableShareLinks            bool     `json:"enable_share_links" form:"enable_share_links"`
+	ShareLinkMaxDays            int      `json:"share_link_max_days" form:"share_link_max_days"`
+	SafeModeMaxRating           string   `json:"safe_mode_max_rating" form:"safe_mode_max_rating"`
+	ContentGateRating           string   `json:"content_gate_rating" form:"content_gate_rating"`
+	ContentGateText             string   `json:"content_gate_text" form:"content_gate_text"`
+	CoverBlurRating             string   `json:"cover_blur_rating" form:"cover_blur_rating"`
+	DeletedUserPolicy           string   `json:"deleted_user_policy" form:"deleted_user_policy"`
+	NewUserRole                 string   `json:"new_user_role" form:"new_user_role"`
+	EnablePWA                   bool     `json:"enable_pwa" form:"enable_pwa"`
+	HideEmptyMangas             bool     `json:"hide_empty_mangas" form:"hide_empty_mangas"`
+	TintMangaPages              bool     `json:"tint_manga_pages" form:"tint_manga_pages"`
+	DefaultLibrary              string   `json:"default_library" form:"default_library"`
+	IndexIgnorePatterns         string   `json:"index_ignore_patterns" form:"index_ignore_patterns"`
+	MetadataMatchThreshold      int      `json:"metadata_match_threshold" form:"metadata_match_threshold"`
+	MetadataTitleSource         string   `json:"metadata_title_source" form:"metadata_title_source"`
+	ChapterFormats              []string `json:"chapter_formats" form:"chapter_formats"`
+	CheckChapterPages           bool     `json:"check_chapter_pages" form:"check_chapter_pages"`
+	DetectChapterRenames        bool     `json:"detect_chapter_renames" form:"detect_chapter_renames"`
+	DuplicateChapterPolicy      string   `json:"duplicate_chapter_policy" form:"duplicate_chapter_policy"`
+	DuplicateChapterKeyword     string   `json:"duplicate_chapter_keyword" form:"duplicate_chapter_keyword"`
+	DuplicateChapterAutoMerge   bool     `json:"duplicate_chapter_auto_merge" form:"duplicate_chapter_auto_merge"`
+	SessionDurationHours        int      `json:"session_duration_hours" form:"session_duration_hours"`
+	SessionIdleTimeoutHours     int      `json:"session_idle_timeout_hours" form:"session_idle_timeout_hours"`
+	RememberMeDurationDays      int      `json:"remember_me_duration_days" form:"remember_me_duration_days"`
+	ContentRatingTagRules       string   `json:"content_rating_tag_rules" form:"content_rating_tag_rules"`
+	ContentRatingProviderRules  string   `json:"content_rating_provider_rules" form:"content_rating_provider_rules"`
+	ReadingModeManga            string   `json:"reading_mode_manga" form:"reading_mode_manga"`
+	ReadingModeManhwa           string   `json:"reading_mode_manhwa" form:"reading_mode_manhwa"`
+	ReadingModeManhua           string   `json:"reading_mode_manhua" form:"reading_mode_manhua"`
+	ReadingModeWebtoon          string   `json:"reading_mode_webtoon" form:"reading_mode_webtoon"`
+	ReadingModeNovel            string   `json:"reading_mode_novel" form:"reading_mode_novel"`
+	ReadingModeComic            string   `json:"reading_mode_comic" form:"reading_mode_comic"`
+	CoverDownloadTimeoutSeconds int      `json:"cover_download_timeout_seconds" form:"cover_download_timeout_seconds"`
+	CoverDownloadConcurrency    int      `json:"cover_download_concurrency" form:"cover_download_concurrency"`
+	CoverURLAllowedHosts        string   `json:"cover_url_allowed_hosts" form:"cover_url_allowed_hosts"`
+	CoverRepairSchedule         string   `json:"cover_repair_schedule" form:"cover_repair_schedule"`
+	CoverRepairMaxAttempts      int      `json:"cover_repair_max_attempts" form:"cover_repair_max_attempts"`
+	MetadataRetrySchedule       string   `json:"metadata_retry_schedule" form:"metadata_retry_schedule"`
+	MetadataRetryMaxAttempts    int      `json:"metadata_retry_max_attempts" form:"metadata_retry_max_attempts"`
+	PosterGeneration            string   `json:"poster_generation" form:"poster_generation"`
+	NormalizeImageOrientation   bool     `json:"normalize_image_orientation" form:"normalize_image_orientation"`
+	MarkReadPolicy              string   `json:"mark_read_policy" form:"mark_read_policy"`
+	MarkReadDwellSeconds        int      `json:"mark_read_dwell_seconds" form:"mark_read_dwell_seconds"`
+	FormBodyLimitKB             int      `json:"form_body_limit_kb" form:"form_body_limit_kb"`
+	UploadBodyLimitMB           int      `json:"upload_body_limit_mb" form:"upload_body_limit_mb"`
+	TrustedProxies              string   `json:"trusted_proxies" form:"trusted_proxies"`
+	ClientIPHeader              string   `json:"client_ip_header" form:"client_ip_header"`
+	RateLimitPerMinute          int      `json:"rate_limit_per_minute" form:"rate_limit_per_minute"`
+	RateLimitExemptNetworks     string   `json:"rate_limit_exempt_networks" form:"rate_limit_exempt_networks"`
+	RateLimitExemptKeys         string   `json:"rate_limit_exempt_keys" form:"rate_limit_exempt_keys"`
+	ViewBotUserAgents           string   `json:"view_bot_user_agents" form:"view_bot_user_agents"`
+	TypeReclassifySchedule      string   `json:"type_reclassify_schedule" form:"type_reclassify_schedule"`
+	ArchiveIndexCacheSize       int      `json:"archive_index_cache_size" form:"archive_index_cache_size"`
+	ExtractArchivePages         bool     `json:"extract_archive_pages" form:"extract_archive_pages"`
+	PageCacheSizeMB             int      `json:"page_cache_size_mb" form:"page_cache_size_mb"`
+	ArchiveCacheTTLMinutes      int      `json:"archive_cache_ttl_minutes" form:"archive_cache_ttl_minutes"`
+	CacheMinFreeMB              int      `json:"cache_min_free_mb" form:"cache_min_free_mb"`
+	CacheLowSpaceAction         string   `json:"cache_low_space_action" form:"cache_low_space_action"`
+	CacheWarmCount              int      `json:"cache_warm_count" form:"cache_warm_count"`
+	CacheWarmOrder              string   `json:"cache_warm_order" form:"cache_warm_order"`
+	CacheWarmPosters            bool     `json:"cache_warm_posters" form:"cache_warm_posters"`
+	CacheWarmFirstChapters      bool     `json:"cache_warm_first_chapters" form:"cache_warm_first_chapters"`
+	LogFormat                   string   `json:"log_format" form:"log_format"`
+	LogToFile                   bool     `json:"log_to_file" form:"log_to_file"`
+	LogMaxSizeMB                int      `json:"log_max_size_mb" form:"log_max_size_mb"`
+	LogMaxAgeDays               int      `json:"log_max_age_days" form:"log_max_age_days"`
+	LogMaxBackups               int      `json:"log_max_backups" form:"log_max_backups"`
+}
+
+// Bounds of the configurable session lifetimes
+const (
+	maxSessionHours   = 365 * 24
+	maxRememberMeDays = 365
+	minSessionHours   = 1
+
+	maxCoverDownloadTimeoutSeconds = 300
+	maxCoverDownloadConcurrency    = 32
+	maxCoverRepairAttempts         = 100
+	maxMetadataRetryAttempts       = 100
+
+	maxShareLinkDays = 365
+
+	maxRateLimitPerMinute = 100000
+
+	maxArchiveIndexCacheSize  = 10000
+	maxPageCacheSizeMB        = 1024 * 1024
+	maxArchiveCacheTTLMinutes = 7 * 24 * 60
+	maxCacheMinFreeMB         = 1024 * 1024
+
+	maxCacheWarmCount = 1000
+
+	maxLogSizeMB  = 10 * 1024
+	maxLogAgeDays = 10 * 365
+	maxLogBackups = 1000
+)
+
+// RateLimitKeyHeader carries the key of a client exempt from rate limiting
+const RateLimitKeyHeader = "X-Magi-Key"
+
+// MaxFormBodyLimitKB caps the configurable form limit, it is the body limit the server buffers by itself
+const MaxFormBodyLimitKB = 10 * 1024
+
+// MaxUploadBodyLimitMB caps the configurable upload limit
+const MaxUploadBodyLimitMB = 100
+
+const (
+	DeletedUserPolicyDelete    = "delete"
+	DeletedUserPolicyAnonymize = "anonymize"
+)
+
+// Moments at which a chapter counts as read
+const (
+	MarkReadOnOpen   = "open"
+	MarkReadOnFinish = "finish"
+	MarkReadOnDwell  = "dwell"
+)
+
+const maxMarkReadDwellSeconds = 600
+
+// Formats the logs can be written in
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// What happens to cache writes while the free disk space is below the minimum, they are skipped right away or the
+// extracted pages are evicted first
+const (
+	CacheLowSpaceSkip  = "skip"
+	CacheLowSpaceEvict = "evict"
+)
+
+// CacheWarmOrders lists the orders the mangas warmed on startup can be picked by, most viewed or most recently updated
+var CacheWarmOrders = []string{"views", "updated_at"}
+
+// Moments at which the cropped poster of a cover is generated
+const (
+	PosterGenerationEager = "eager"
+	PosterGenerationLazy  = "lazy"
+)
+
+// Titles the metadata of a new series is searched by, its folder name or the series title embedded in its chapters
+const (
+	MetadataTitleSourceFolder   = "folder"
+	MetadataTitleSourceEmbedded = "embedded"
+)
+
+// ContentRatings lists the supported content ratings ordered from least to most explicit
+var ContentRatings = []string{"safe", "suggestive", "erotica", "pornographic"}
+
+// DefaultAppConfig returns the configuration used when nothing has been stored yet, keeping the instance fully open
+func DefaultAppConfig() AppConfig {
+	return AppConfig{
+		DeletedUserPolicy:    DeletedUserPolicyDelete,
+		NewUserRole:          "reader",
+		ChapterFormats:       utils.ChapterFormatNames(),
+		DetectChapterRenames: true,
+
+		DuplicateChapterPolicy: DuplicateChapterPolicyManual,
+
+		SessionDurationHours:    30 * 24,
+		SessionIdleTimeoutHours: 7 * 24,
+		RememberMeDurationDays:  90,
+
+		ShareLinkMaxDays: 30,
+
+		ContentRatingTagRules:      "Ecchi = suggestive\nSmut = erotica\nHentai = pornographic",
+		ContentRatingProviderRules: DefaultContentRatingProviderRules,
+
+		ReadingModeManga:   ReadingModeRTL,
+		ReadingModeManhwa:  ReadingModeVertical,
+		ReadingModeManhua:  ReadingModeVertical,
+		ReadingModeWebtoon: ReadingModeVertical,
+		ReadingModeNovel:   ReadingModeVertical,
+		ReadingModeComic:   ReadingModeLTR,
+
+		CoverDownloadTimeoutSeconds: 30,
+		CoverDownloadConcurrency:    4,
+		PosterGeneration:            PosterGenerationEager,
+		MetadataTitleSource:         MetadataTitleSourceFolder,
+		CoverRepairSchedule:         "@every 6h",
+		CoverRepairMaxAttempts:      5,
+		MetadataRetrySchedule:       "@every 30m",
+		MetadataRetryMaxAttempts:    10,
+		CacheWarmOrder:              "views",
+		CacheWarmPosters:            true,
+		TintMangaPages:              true,
+
+		MarkReadPolicy:       MarkReadOnOpen,
+		MarkReadDwellSeconds: 30,
+
+		FormBodyLimitKB:   1024,
+		UploadBodyLimitMB: 10,
+
+		ClientIPHeader: ClientIPHeaderForwardedFor,
+
+		ViewBotUserAgents: "bot\ncrawl\nspider\nslurp\nfacebookexternalhit\nmediapartners",
+
+		ArchiveIndexCacheSize:  64,
+		PageCacheSizeMB:        1024,
+		ArchiveCacheTTLMinutes: 60,
+		CacheMinFreeMB:         256,
+		CacheLowSpaceAction:    CacheLowSpaceEvict,
+
+		LogFormat:     LogFormatText,
+		LogMaxSizeMB:  100,
+		LogMaxAgeDays: 30,
+		LogMaxBackups: 5,
+	}
+}
+
+// Validate checks if the AppConfig has valid values
+func (c *AppConfig) Validate() error {
+	if c.AnonymousContentRatingLimit != "" && contentRatingLevel(c.AnonymousContentRatingLimit) == -1 {
+		return fmt.Errorf("invalid content rating limit: %s", c.AnonymousContentRatingLimit)
+	}
+	if c.SafeModeMaxRating != "" && contentRatingLevel(c.SafeModeMaxRating) == -1 {
+		return fmt.Errorf("invalid safe mode rating: %s", c.SafeModeMaxRating)
+	}
+	if c.ContentGateRating != "" && contentRatingLevel(c.ContentGateRating) == -1 {
+		return fmt.Errorf("invalid content gate rating: %s", c.ContentGateRating)
+	}
+	if c.CoverBlurRating != "" && contentRatingLevel(c.CoverBlurRating) == -1 {
+		return fmt.Errorf("invalid cover blur rating: %s", c.CoverBlurRating)
+	}
+	if c.DeletedUserPolicy != "" && c.DeletedUserPolicy != DeletedUserPolicyDelete && c.DeletedUserPolicy != DeletedUserPolicyAnonymize {
+		return fmt.Errorf("invalid deleted user policy: %s", c.DeletedUserPolicy)
+	}
+	if c.NewUserRole != "" && c.NewUserRole != "reader" && c.NewUserRole != "moderator" {
+		return fmt.Errorf("new users can only be given the reader or moderator role: %s", c.NewUserRole)
+	}
+	if c.SessionDurationHours < minSessionHours || c.SessionDurationHours > maxSessionHours {
+		return fmt.Errorf("session duration must be between %d and %d hours", minSessionHours, maxSessionHours)
+	}
+	if c.SessionIdleTimeoutHours < minSessionHours || c.SessionIdleTimeoutHours > c.SessionDurationHours {
+		return fmt.Errorf("idle timeout must be between %d hour and the session duration", minSessionHours)
+	}
+	if c.RememberMeDurationDays < 1 || c.RememberMeDurationDays > maxRememberMeDays {
+		return fmt.Errorf("remember me duration must be between 1 and %d days", maxRememberMeDays)
+	}
+	if c.ShareLinkMaxDays < 1 || c.ShareLinkMaxDays > maxShareLinkDays {
+		return fmt.Errorf("share link lifetime must be between 1 and %d days", maxShareLinkDays)
+	}
+	if c.CoverDownloadTimeoutSeconds < 1 || c.CoverDownloadTimeoutSeconds > maxCoverDownloadTimeoutSeconds {
+		return fmt.Errorf("cover download timeout must be between 1 and %d seconds", maxCoverDownloadTimeoutSeconds)
+	}
+	if c.CoverDownloadConcurrency < 1 || c.CoverDownloadConcurrency > maxCoverDownloadConcurrency {
+		return fmt.Errorf("concurrent cover downloads must be between 1 and %d", maxCoverDownloadConcurrency)
+	}
+	if c.PosterGeneration != PosterGenerationEager && c.PosterGeneration != PosterGenerationLazy {
+		return fmt.Errorf("invalid poster generation: %s", c.PosterGeneration)
+	}
+	if c.MarkReadPolicy != MarkReadOnOpen && c.MarkReadPolicy != MarkReadOnFinish && c.MarkReadPolicy != MarkReadOnDwell {
+		return fmt.Errorf("invalid mark read policy: %s", c.MarkReadPolicy)
+	}
+	if c.MarkReadDwellSeconds < 1 || c.MarkReadDwellSeconds > maxMarkReadDwellSeconds {
+		return fmt.Errorf("mark read dwell time must be between 1 and %d seconds", maxMarkReadDwellSeconds)
+	}
+	if c.FormBodyLimitKB < 1 || c.FormBodyLimitKB > MaxFormBodyLimitKB {
+		return fmt.Errorf("form body limit must be between 1 and %d KB", MaxFormBodyLimitKB)
+	}
+	if c.UploadBodyLimitMB < 1 || c.UploadBodyLimitMB > MaxUploadBodyLimitMB {
+		return fmt.Errorf("upload body limit must be between 1 and %d MB", MaxUploadBodyLimitMB)
+	}
+	if _, err := ParseTrustedProxies(c.TrustedProxies); err != nil {
+		return err
+	}
+	if !slices.Contains(ClientIPHeaders, c.ClientIPHeader) {
+		return fmt.Errorf("invalid client IP header: %s", c.ClientIPHeader)
+	}
+	if c.RateLimitPerMinute < 0 || c.RateLimitPerMinute > maxRateLimitPerMinute {
+		return fmt.Errorf("rate limit must be between 0 and %d requests per minute", maxRateLimitPerMinute)
+	}
+	if _, err := ParseRateLimitExemptions(c.RateLimitExemptNetworks); err != nil {
+		return err
+	}
+	if c.ArchiveIndexCacheSize < 0 || c.ArchiveIndexCacheSize > maxArchiveIndexCacheSize {
+		return fmt.Errorf("archive index cache size must be between 0 and %d", maxArchiveIndexCacheSize)
+	}
+	if c.PageCacheSizeMB < 1 || c.PageCacheSizeMB > maxPageCacheSizeMB {
+		return fmt.Errorf("page cache size must be between 1 and %d MB", maxPageCacheSizeMB)
+	}
+	if c.ArchiveCacheTTLMinutes < 0 || c.ArchiveCacheTTLMinutes > maxArchiveCacheTTLMinutes {
+		return fmt.Errorf("archive cache lifetime must be between 0 and %d minutes", maxArchiveCacheTTLMinutes)
+	}
+	if c.CacheMinFreeMB < 0 || c.CacheMinFreeMB > maxCacheMinFreeMB {
+		return fmt.Errorf("minimum free disk space must be between 0 and %d MB", maxCacheMinFreeMB)
+	}
+	if c.CacheLowSpaceAction != CacheLowSpaceSkip && c.CacheLowSpaceAction != CacheLowSpaceEvict {
+		return fmt.Errorf("invalid low disk space action: %s", c.CacheLowSpaceAction)
+	}
+	if c.CacheWarmCount < 0 || c.CacheWarmCount > maxCacheWarmCount {
+		return fmt.Errorf("mangas warmed on startup must be between 0 and %d", maxCacheWarmCount)
+	}
+	if !slices.Contains(CacheWarmOrders, c.CacheWarmOrder) {
+		return fmt.Errorf("invalid cache warming order: %s", c.CacheWarmOrder)
+	}
+	if c.CoverRepairSchedule != "" {
+		if _, err := cron.ParseStandard(c.CoverRepairSchedule); err != nil {
+			return fmt.Errorf("invalid cover repair schedule: %w", err)
+		}
+	}
+	if c.TypeReclassifySchedule != "" {
+		if _, err := cron.ParseStandard(c.TypeReclassifySchedule); err != nil {
+			return fmt.Errorf("invalid type reclassification schedule: %w", err)
+		}
+	}
+	if c.CoverRepairMaxAttempts < 1 || c.CoverRepairMaxAttempts > maxCoverRepairAttempts {
+		return fmt.Errorf("cover repair attempts must be between 1 and %d", maxCoverRepairAttempts)
+	}
+	if c.MetadataRetrySchedule != "" {
+		if _, err := cron.ParseStandard(c.MetadataRetrySchedule); err != nil {
+			return fmt.Errorf("invalid metadata retry schedule: %w", err)
+		}
+	}
+	if c.MetadataRetryMaxAttempts < 1 || c.MetadataRetryMaxAttempts > maxMetadataRetryAttempts {
+		return fmt.Errorf("metadata retry attempts must be between 1 and %d", maxMetadataRetryAttempts)
+	}
+	if c.LogFormat != LogFormatText && c.LogFormat != LogFormatJSON {
+		return fmt.Errorf("invalid log format: %s", c.LogFormat)
+	}
+	if c.LogMaxSizeMB < 1 || c.LogMaxSizeMB > maxLogSizeMB {
+		return fmt.Errorf("log file size must be between 1 and %d MB", maxLogSizeMB)
+	}
+	if c.LogMaxAgeDays < 0 || c.LogMaxAgeDays > maxLogAgeDays {
+		return fmt.Errorf("log file age must be between 0 and %d days", maxLogAgeDays)
+	}
+	if c.LogMaxBackups < 0 || c.LogMaxBackups > maxLogBackups {
+		return fmt.Errorf("log file backups must be between 0 and %d", maxLogBackups)
+	}
+	if c.DefaultLibrary != "" {
+		if _, err := GetLibrary(c.DefaultLibrary); err != nil {
+			return fmt.Errorf("unknown library: %s", c.DefaultLibrary)
+		}
+	}
+	if c.MetadataMatchThreshold < 0 || c.MetadataMatchThreshold > 100 {
+		return fmt.Errorf("metadata match threshold must be between 0 and 100%%")
+	}
+	if c.MetadataTitleSource != MetadataTitleSourceFolder && c.MetadataTitleSource != MetadataTitleSourceEmbedded {
+		return fmt.Errorf("invalid metadata title source: %s", c.MetadataTitleSource)
+	}
+	switch c.DuplicateChapterPolicy {
+	case DuplicateChapterPolicyManual, DuplicateChapterPolicyLargest, DuplicateChapterPolicyNewest:
+	case DuplicateChapterPolicyKeyword:
+		if strings.TrimSpace(c.DuplicateChapterKeyword) == "" {
+			return fmt.Errorf("a keyword is required to keep duplicate chapters by keyword")
+		}
+	default:
+		return fmt.Errorf("invalid duplicate chapter policy: %s", c.DuplicateChapterPolicy)
+	}
+	if _, err := utils.ParseIgnorePatterns(c.IndexIgnorePatterns); err != nil {
+		return err
+	}
+	if _, err := ParseContentRatingTagRules(c.ContentRatingTagRules); err != nil {
+		return err
+	}
+	if _, err := ParseContentRatingProviderRules(c.ContentRatingProviderRules); err != nil {
+		return err
+	}
+	for _, mode := range []string{c.ReadingModeManga, c.ReadingModeManhwa, c.ReadingModeManhua, c.ReadingModeWebtoon, c.ReadingModeNovel, c.ReadingModeComic} {
+		if err := validateReadingMode(mode, false); err != nil {
+			return err
+		}
+	}
+	for _, name := range c.ChapterFormats {
+		if !slices.Contains(utils.ChapterFormatNames(), name) {
+			return fmt.Errorf("invalid chapter format: %s", name)
+		}
+	}
+	return nil
+}
+
+// IsChapterFormatEnabled reports whether a chapter file or folder is of a format that should be indexed
+func (c *AppConfig) IsChapterFormatEnabled(chapterPath string) bool {
+	format := utils.ChapterFormatOf(chapterPath)
+	return format != nil && slices.Contains(c.ChapterFormats, format.Name)
+}
+
+// IsCoverURLHostAllowed reports whether covers may be fetched from a host, an empty allowlist allows every host
+func (c *AppConfig) IsCoverURLHostAllowed(host string) bool {
+	allowed := strings.FieldsFunc(c.CoverURLAllowedHosts, func(r rune) bool { return r == ',' || r == '\n' })
+	if len(allowed) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry != "" && (host == entry || strings.HasSuffix(host, "."+entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRateLimitExemptKey reports whether a key is one of the keys exempt from rate limiting
+func (c *AppConfig) IsRateLimitExemptKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, exempt := range strings.Split(c.RateLimitExemptKeys, "\n") {
+		exempt = strings.TrimSpace(exempt)
+		if exempt != "" && subtle.ConstantTimeCompare([]byte(exempt), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultReadingMode returns the configured reading mode of a media type
+func (c *AppConfig) DefaultReadingMode(mangaType string) string {
+	switch mangaType {
+	case MangaTypeManga:
+		return c.ReadingModeManga
+	case MangaTypeManhwa:
+		return c.ReadingModeManhwa
+	case MangaTypeManhua:
+		return c.ReadingModeManhua
+	case MangaTypeWebtoon:
+		return c.ReadingModeWebtoon
+	case MangaTypeNovel:
+		return c.ReadingModeNovel
+	default:
+		return c.ReadingModeComic
+	}
+}
+
+// GetAppConfig retrieves the stored configuration, falling back to the defaults
+func GetAppConfig() (AppConfig, error) {
+	config := DefaultAppConfig()
+	exists, err := exists("config", "app_config")
+	if err != nil || !exists {
+		return config, err
+	}
+	if err := getFromBucket("config", "app_config", &config); err != nil {
+		return DefaultAppConfig(), err
+	}
+	return config, nil
+}
+
+// SeedAppConfig validates and stores a configuration when none has been stored yet, so a configuration file only
+// provides the initial values and changes made in the admin area survive restarts. It reports whether it was stored.
+func SeedAppConfig(config *AppConfig) (bool, error) {
+	if err := config.Validate(); err != nil {
+		return false, err
+	}
+	stored, err := exists("config", "app_config")
+	if err != nil || stored {
+		return false, err
+	}
+	if err := updateBucket("config", "app_config", config); err != nil {
+		return false, err
+	}
+	refreshRequestSettings(*config)
+	return true, nil
+}
+
+// UpdateAppConfig validates and stores the configuration
+func UpdateAppConfig(config *AppConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if err := updateBucket("config", "app_config", config); err != nil {
+		return err
+	}
+	refreshRequestSettings(*config)
+	config.ApplyImageSettings()
+	config.ApplyLogSettings()
+	NotifyListeners(Notification{Type: "config_updated", Payload: *config})
+	return nil
+}
+
+// ApplyImageSettings configures the cover downloads, poster generation, image normalization, chapter archive caches and
+// the free disk space guard with the values of the configuration
+func (c *AppConfig) ApplyImageSettings() {
+	utils.SetImageDownloadLimits(time.Duration(c.CoverDownloadTimeoutSeconds)*time.Second, c.CoverDownloadConcurrency)
+	utils.SetLazyPosters(c.PosterGeneration == PosterGenerationLazy)
+	utils.SetNormalizeOrientation(c.NormalizeImageOrientation)
+	utils.SetArchiveCacheSettings(utils.ArchiveCacheSettings{
+		IndexEntries:      c.ArchiveIndexCacheSize,
+		ExtractPages:      c.ExtractArchivePages,
+		MaxExtractedBytes: int64(c.PageCacheSizeMB) * 1024 * 1024,
+		TTL:               time.Duration(c.ArchiveCacheTTLMinutes) * time.Minute,
+	})
+	utils.SetCacheSpaceSettings(utils.CacheSpaceSettings{
+		MinFreeBytes: uint64(c.CacheMinFreeMB) * 1024 * 1024,
+		Evict:        c.CacheLowSpaceAction == CacheLowSpaceEvict,
+	})
+}
+
+// ApplyLogSettings switches the log format and the rotating log file to the values of the configuration
+func (c *AppConfig) ApplyLogSettings() {
+	err := utils.ConfigureLogger(utils.LogSettings{
+		JSON:       c.LogFormat == LogFormatJSON,
+		ToFile:     c.LogToFile,
+		MaxBytes:   int64(c.LogMaxSizeMB) * 1024 * 1024,
+		MaxAge:     time.Duration(c.LogMaxAgeDays) * 24 * time.Hour,
+		MaxBackups: c.LogMaxBackups,
+	})
+	if err != nil {
+		log.Errorf("Failed to open the log file: %v", err)
+	}
+}
+
+// IsContentRatingAllowed reports whether a rating is within the limit, an empty limit allows everything
+func IsContentRatingAllowed(rating, limit string) bool {
+	if limit == "" {
+		return true
+	}
+	// Mangas without a known rating (e.g. local metadata) are treated as safe
+	level := contentRatingLevel(rating)
+	if level == -1 {
+		level = 0
+	}
+	return level <= contentRatingLevel(limit)
+}
+
+// IsContentGated reports whether a rating is at or above the content gate rating, viewing it requires an age
+// confirmation
+func (c *AppConfig) IsContentGated(rating string) bool {
+	if c.ContentGateRating == "" {
+		return false
+	}
+	// Like for the limits, mangas without a known rating are treated as safe
+	level := contentRatingLevel(rating)
+	if level == -1 {
+		level = 0
+	}
+	return level >= contentRatingLevel(c.ContentGateRating)
+}
+
+// IsCoverBlurred reports whether the cover of a manga is blurred until revealed, the cover blur rating of its library
+// overrides the one of the instance
+func (c *AppConfig) IsCoverBlurred(manga *Manga) bool {
+	threshold := c.CoverBlurRating
+	if library, err := GetLibrary(manga.LibrarySlug); err == nil && library.CoverBlurRating != "" {
+		threshold = library.CoverBlurRating
+	}
+	if threshold == "" || threshold == CoverBlurOff {
+		return false
+	}
+	// Mangas without a known rating are treated as safe, so they are only blurred when safe covers are
+	level := contentRatingLevel(manga.ContentRating)
+	if level == -1 {
+		level = 0
+	}
+	return level >= contentRatingLevel(threshold)
+}
+
+// EffectiveContentRatingLimit clamps a limit to the safe mode rating, which applies to every user including admins
+func EffectiveContentRatingLimit(limit string) string {
+	config, err := GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+	return stricterContentRating(limit, config.SafeModeMaxRating)
+}
+
+// stricterContentRating returns the most restrictive of two limits, where an empty limit means no limit
+func stricterContentRating(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	if contentRatingLevel(b) < contentRatingLevel(a) {
+		return b
+	}
+	return a
+}
+
+func contentRatingLevel(rating string) int {
+	for i, r := range ContentRatings {
+		if r == rating {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+// enableSafeMode stores a config with the given safe mode rating
+func enableSafeMode(t *testing.T, rating string) {
+	t.Helper()
+	config := DefaultAppConfig()
+	config.SafeModeMaxRating = rating
+	if err := UpdateAppConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEffectiveContentRatingLimit(t *testing.T) {
+	setupTestDB(t)
+	if got := EffectiveContentRatingLimit(""); got != "" {
+		t.Errorf("got '%s' without safe mode, want no limit", got)
+	}
+
+	enableSafeMode(t, "suggestive")
+	for limit, want := range map[string]string{
+		"":             "suggestive", // admins and logged in users have no limit of their own
+		"pornographic": "suggestive",
+		"suggestive":   "suggestive",
+		"safe":         "safe",
+	} {
+		if got := EffectiveContentRatingLimit(limit); got != want {
+			t.Errorf("EffectiveContentRatingLimit(%q) = '%s', want '%s'", limit, got, want)
+		}
+	}
+}
+
+func TestSafeModeClampsUnlimitedQueries(t *testing.T) {
+	setupTestDB(t)
+	for _, manga := range []Manga{
+		{Name: "Safe", Tags: []string{"Action"}, ContentRating: "safe"},
+		{Name: "Suggestive", Tags: []string{"Action"}, ContentRating: "suggestive"},
+		{Name: "Erotica", Tags: []string{"Action"}, ContentRating: "erotica"},
+	} {
+		if err := CreateManga(manga); err != nil {
+			t.Fatalf("failed to create '%s': %v", manga.Name, err)
+		}
+	}
+	slugs := func(mangas []Manga) []string {
+		var slugs []string
+		for _, manga := range mangas {
+			slugs = append(slugs, manga.Slug)
+		}
+		slices.Sort(slugs)
+		return slugs
+	}
+
+	// The empty limit is the one admins query with
+	mangas, _, err := SearchMangas("", 1, 10, "name", "asc", "", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"erotica", "safe", "suggestive"}; !slices.Equal(slugs(mangas), want) {
+		t.Errorf("got %v without safe mode, want %v", slugs(mangas), want)
+	}
+
+	enableSafeMode(t, "suggestive")
+	mangas, _, err = SearchMangas("", 1, 10, "name", "asc", "", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"safe", "suggestive"}; !slices.Equal(slugs(mangas), want) {
+		t.Errorf("searched %v with safe mode, want %v", slugs(mangas), want)
+	}
+
+	similar, err := GetSimilarMangas("safe", 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"suggestive"}; !slices.Equal(slugs(similar), want) {
+		t.Errorf("got similar %v with safe mode, want %v", slugs(similar), want)
+	}
+}
+
+func TestRequestSettingsFollowTheConfiguration(t *testing.T) {
+	setupTestDB(t)
+	config := DefaultAppConfig()
+	config.TrustedProxies = "10.0.0.0/8"
+	if err := UpdateAppConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+	settings := GetRequestSettings()
+	if len(settings.TrustedProxies) != 1 || GetRequestSettings() != settings {
+		t.Fatalf("got %+v, want the parsed trusted proxies cached", settings)
+	}
+
+	config.TrustedProxies = ""
+	config.RateLimitExemptNetworks = "192.168.0.0/16"
+	if err := UpdateAppConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+	settings = GetRequestSettings()
+	if len(settings.TrustedProxies) != 0 || len(settings.RateLimitExemptions) != 1 {
+		t.Errorf("got %+v, want the settings refreshed when the configuration is stored", settings)
+	}
+}
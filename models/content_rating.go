@@ -0,0 +1,283 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2/log"
+	"go.etcd.io/bbolt"
+)
+
+// ParseContentRatingTagRules parses "Tag = rating" lines into a map of lowercased tags to the minimum rating they imply
+func ParseContentRatingTagRules(rules string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	for i, line := range strings.Split(rules, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		tag, rating, ok := strings.Cut(line, "=")
+		tag, rating = strings.TrimSpace(tag), strings.TrimSpace(rating)
+		if !ok || tag == "" {
+			return nil, fmt.Errorf("invalid tag rule on line %d: %s", i+1, line)
+		}
+		if contentRatingLevel(rating) == -1 {
+			return nil, fmt.Errorf("invalid content rating on line %d: %s", i+1, rating)
+		}
+		parsed[strings.ToLower(tag)] = rating
+	}
+	return parsed, nil
+}
+
+// InferContentRating raises a missing or safe rating to the strongest rating implied by the tags of a manga,
+// returning the resulting rating and whether it was inferred
+func InferContentRating(rating string, tags []string) (string, bool) {
+	if contentRatingLevel(rating) > 0 {
+		return rating, false
+	}
+
+	config, err := GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+		return rating, false
+	}
+	rules, err := ParseContentRatingTagRules(config.ContentRatingTagRules)
+	if err != nil {
+		log.Errorf("Failed to parse content rating tag rules: %v", err)
+		return rating, false
+	}
+
+	inferred := ""
+	for _, tag := range tags {
+		if implied, ok := rules[strings.ToLower(tag)]; ok && contentRatingLevel(implied) > contentRatingLevel(inferred) {
+			inferred = implied
+		}
+	}
+	if contentRatingLevel(inferred) <= 0 {
+		return rating, false
+	}
+	return inferred, true
+}
+
+// ApplyInferredContentRating updates the rating of a manga in place when its tags imply a stronger one
+func ApplyInferredContentRating(manga *Manga) bool {
+	rating, inferred := InferContentRating(manga.ContentRating, manga.Tags)
+	if !inferred {
+		return false
+	}
+
+	log.Infof("Inferred content rating '%s' for '%s' from its tags (was '%s')", rating, manga.Slug, manga.ContentRating)
+	manga.ContentRating = rating
+	return true
+}
+
+// ReinferContentRatings applies the tag rules to every existing manga, returning how many were updated
+func ReinferContentRatings() (int, error) {
+	var mangas []Manga
+	if err := loadAllMangas(&mangas); err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for i := range mangas {
+		if !ApplyInferredContentRating(&mangas[i]) {
+			continue
+		}
+		// Stored directly, a re-inferred rating is not a content update of the manga
+		if err := update("mangas", mangas[i].Slug, mangas[i]); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// MetadataProviderMangaDex is the metadata provider mangas are matched against
+const MetadataProviderMangaDex = "mangadex"
+
+// providerContentRatings lists the content ratings each metadata provider reports
+var providerContentRatings = map[string][]string{
+	MetadataProviderMangaDex: {"safe", "suggestive", "erotica", "pornographic"},
+}
+
+// DefaultContentRatingProviderRules maps the ratings of every provider the way they were mapped before the rules
+// could be configured
+const DefaultContentRatingProviderRules = "mangadex: safe = safe\nmangadex: suggestive = suggestive\nmangadex: erotica = erotica\nmangadex: pornographic = pornographic"
+
+// ParseContentRatingProviderRules parses "provider: rating = rating" lines into the content rating each rating
+// reported by a provider maps to. Every rating a provider reports must be mapped.
+func ParseContentRatingProviderRules(rules string) (map[string]map[string]string, error) {
+	parsed := make(map[string]map[string]string)
+	for i, line := range strings.Split(rules, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		provider, rule, ok := strings.Cut(line, ":")
+		from, to, hasRating := strings.Cut(rule, "=")
+		provider, from, to = strings.ToLower(strings.TrimSpace(provider)), strings.ToLower(strings.TrimSpace(from)), strings.TrimSpace(to)
+		if !ok || !hasRating || from == "" {
+			return nil, fmt.Errorf("invalid provider rating rule on line %d: %s", i+1, line)
+		}
+		ratings, known := providerContentRatings[provider]
+		if !known {
+			return nil, fmt.Errorf("unknown metadata provider on line %d: %s", i+1, provider)
+		}
+		if !slices.Contains(ratings, from) {
+			return nil, fmt.Errorf("%s doesn't report the content rating '%s' on line %d", provider, from, i+1)
+		}
+		if contentRatingLevel(to) == -1 {
+			return nil, fmt.Errorf("invalid content rating on line %d: %s", i+1, to)
+		}
+		if parsed[provider] == nil {
+			parsed[provider] = make(map[string]string)
+		}
+		parsed[provider][from] = to
+	}
+
+	for provider, ratings := range providerContentRatings {
+		for _, rating := range ratings {
+			if _, ok := parsed[provider][rating]; !ok {
+				return nil, fmt.Errorf("the content rating '%s' of %s is not mapped", rating, provider)
+			}
+		}
+	}
+	return parsed, nil
+}
+
+// MapProviderContentRating returns the content rating a rating reported by a provider maps to, a rating without a
+// rule is kept as reported
+func MapProviderContentRating(provider, rating string) string {
+	config, err := GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+		return rating
+	}
+	rules, err := ParseContentRatingProviderRules(config.ContentRatingProviderRules)
+	if err != nil {
+		log.Errorf("Failed to parse provider content rating rules: %v", err)
+		return rating
+	}
+	if mapped, ok := rules[provider][strings.ToLower(rating)]; ok {
+		return mapped
+	}
+	return rating
+}
+
+// ApplyProviderContentRating sets the content rating of a manga from the rating reported by its metadata provider,
+// which is kept so the rating can be mapped again when the rules change
+func ApplyProviderContentRating(manga *Manga, provider, rating string) {
+	manga.MetadataProvider = provider
+	manga.ProviderRating = rating
+	manga.ContentRating = MapProviderContentRating(provider, rating)
+}
+
+// RemapContentRatings maps the ratings reported by a provider again for every manga matched against it and applies
+// the tag rules on top, returning how many mangas were updated. Mangas matched before the reported rating was kept
+// are skipped until their metadata is refreshed.
+func RemapContentRatings(provider string) (int, error) {
+	if _, ok := providerContentRatings[provider]; !ok {
+		return 0, fmt.Errorf("unknown metadata provider: %s", provider)
+	}
+	var mangas []Manga
+	if err := loadAllMangas(&mangas); err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for i := range mangas {
+		if mangas[i].MetadataProvider != provider || mangas[i].ProviderRating == "" {
+			continue
+		}
+		rating, _ := InferContentRating(MapProviderContentRating(provider, mangas[i].ProviderRating), mangas[i].Tags)
+		if rating == mangas[i].ContentRating {
+			continue
+		}
+		log.Infof("Remapped content rating of '%s' from '%s' to '%s'", mangas[i].Slug, mangas[i].ContentRating, rating)
+		mangas[i].ContentRating = rating
+		// Stored directly, a remapped rating is not a content update of the manga
+		if err := update("mangas", mangas[i].Slug, mangas[i]); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// ContentRatingCount is the number of mangas and chapters with a content rating, an empty rating stands for the
+// mangas without a known rating
+type ContentRatingCount struct {
+	Rating   string
+	Mangas   int
+	Chapters int
+}
+
+// GetContentRatingBreakdown counts the mangas and chapters of a library per content rating, from least to most
+// explicit with the unrated ones last. Hidden mangas and every rating limit are ignored so the counts are the true
+// totals of the library.
+func GetContentRatingBreakdown(librarySlug string) ([]ContentRatingCount, error) {
+	counts := make(map[string]*ContentRatingCount)
+	err := db.View(func(tx *bbolt.Tx) error {
+		ratings := make(map[string]string)
+		err := tx.Bucket([]byte("mangas")).ForEach(func(_, v []byte) error {
+			var manga struct {
+				Slug          string `json:"slug"`
+				LibrarySlug   string `json:"library_slug"`
+				ContentRating string `json:"content_rating"`
+			}
+			if err := json.Unmarshal(v, &manga); err != nil {
+				return err
+			}
+			if librarySlug != "" && manga.LibrarySlug != librarySlug {
+				return nil
+			}
+
+			rating := manga.ContentRating
+			if contentRatingLevel(rating) == -1 {
+				rating = ""
+			}
+			ratings[manga.Slug] = rating
+			if counts[rating] == nil {
+				counts[rating] = &ContentRatingCount{Rating: rating}
+			}
+			counts[rating].Mangas++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket([]byte("chapters")).ForEach(func(k, _ []byte) error {
+			mangaSlug, _, ok := strings.Cut(string(k), ":")
+			if !ok {
+				return nil
+			}
+			if rating, ok := ratings[mangaSlug]; ok {
+				counts[rating].Chapters++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	breakdown := make([]ContentRatingCount, 0, len(ContentRatings)+1)
+	for _, rating := range slices.Concat(ContentRatings, []string{""}) {
+		count := ContentRatingCount{Rating: rating}
+		if counted, ok := counts[rating]; ok {
+			count = *counted
+		}
+		breakdown = append(breakdown, count)
+	}
+	return breakdown, nil
+}
+
+// GetGlobalContentRatingBreakdown counts the mangas and chapters of every library per content rating
+func GetGlobalContentRatingBreakdown() ([]ContentRatingCount, error) {
+	return GetContentRatingBreakdown("")
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Backoff between the repair attempts of a cover, doubling from the base up to the cap
+const (
+	coverRepairBaseBackoff = time.Hour
+	coverRepairMaxBackoff  = 7 * 24 * time.Hour
+)
+
+// CoverRepair tracks the failed attempts at repairing the cover of a manga
+type CoverRepair struct {
+	MangaSlug   string    `json:"manga_slug"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"last_attempt"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error"`
+}
+
+// Due reports whether the cover may be attempted again, attempts stop once maxAttempts is reached
+func (r CoverRepair) Due(now time.Time, maxAttempts int) bool {
+	return r.Attempts < maxAttempts && !now.Before(r.NextAttempt)
+}
+
+// GetMangasWithBrokenCovers returns the mangas without a cover, with a cover that was never downloaded or whose
+// cached cover file is gone, uploaded covers are left alone
+func GetMangasWithBrokenCovers(cacheDirectory string) ([]Manga, error) {
+	var mangas []Manga
+	if err := loadAllMangas(&mangas); err != nil {
+		return nil, err
+	}
+
+	var broken []Manga
+	for _, manga := range mangas {
+		if !manga.CoverLocked && !coverIsCached(cacheDirectory, manga.CoverArtURL) {
+			broken = append(broken, manga)
+		}
+	}
+	return broken, nil
+}
+
+// coverIsCached reports whether a cover URL points at the image cache and either the original or the cropped
+// poster is still on disk
+func coverIsCached(cacheDirectory, coverArtURL string) bool {
+	if !strings.Contains(coverArtURL, "/api/images/") {
+		return false
+	}
+	name := filepath.Base(coverArtURL)
+	ext := filepath.Ext(name)
+	for _, file := range []string{name, strings.TrimSuffix(name, ext) + "_original" + ext} {
+		if _, err := os.Stat(filepath.Join(cacheDirectory, file)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCoverRepairs returns the repair records of every manga whose cover failed to repair, keyed by manga slug
+func GetCoverRepairs() (map[string]CoverRepair, error) {
+	repairs := make(map[string]CoverRepair)
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("cover_repairs")).ForEach(func(_, v []byte) error {
+			var repair CoverRepair
+			if err := json.Unmarshal(v, &repair); err != nil {
+				return err
+			}
+			repairs[repair.MangaSlug] = repair
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repairs, nil
+}
+
+// RecordCoverRepairFailure counts a failed repair attempt and schedules the next one with exponential backoff
+func RecordCoverRepairFailure(mangaSlug string, cause error) (CoverRepair, error) {
+	repair := CoverRepair{MangaSlug: mangaSlug}
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("cover_repairs"))
+		if data := bucket.Get([]byte(mangaSlug)); data != nil {
+			if err := json.Unmarshal(data, &repair); err != nil {
+				return err
+			}
+		}
+
+		backoff := coverRepairBaseBackoff << repair.Attempts
+		if backoff <= 0 || backoff > coverRepairMaxBackoff {
+			backoff = coverRepairMaxBackoff
+		}
+		repair.Attempts++
+		repair.LastAttempt = time.Now()
+		repair.NextAttempt = repair.LastAttempt.Add(backoff)
+		repair.LastError = cause.Error()
+
+		encoded, err := json.Marshal(repair)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(mangaSlug), encoded)
+	})
+	return repair, err
+}
+
+// SetRepairedCover stores a cover found by the repair job and forgets its failed attempts, unlike an upload
+// the cover stays unlocked so metadata updates can still replace it
+func SetRepairedCover(slug, coverArtURL, accentColor string) error {
+	manga, err := GetManga(slug)
+	if err != nil {
+		return err
+	}
+	manga.CoverArtURL = coverArtURL
+	manga.AccentColor = accentColor
+	if err := UpdateManga(manga); err != nil {
+		return err
+	}
+	return DeleteCoverRepair(slug)
+}
+
+// DeleteCoverRepair forgets the failed repair attempts of a manga
+func DeleteCoverRepair(mangaSlug string) error {
+	return delete("cover_repairs", mangaSlug)
+}
@@ -28,7 +28,7 @@ func Initialize(cacheDirectory string) error {
 	}
 
 	// Create buckets
-	buckets := []string{"libraries", "mangas", "chapters", "users", "jwt"}
+	buckets := []string{"libraries", "mangas", "chapters", "users", "jwt", "reading_states", "config", "schema", "activity_log", "chapter_comments", "reports", "favorites", "offline_chapters", "cover_repairs", "featured_media", "chapter_issues", "share_links", "metadata_reviews", "user_series_status", "media_views", "media_covers", "recently_viewed", "chapter_duplicates", "metadata_retries"}
 	return createBuckets(buckets)
 }
 
@@ -37,7 +37,10 @@ func Close() error {
 	start := time.Now()
 	defer utils.LogDuration("Close", start)
 
+	// The next database can hold another configuration
+	requestSettings.Store(nil)
 	if db != nil {
+		FlushMediaViews()
 		return db.Close()
 	}
 	return nil
@@ -0,0 +1,16 @@
+package models
+
+import "testing"
+
+// setupTestDB opens a fresh database in a temporary directory for the duration of a test
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	if err := Initialize(t.TempDir()); err != nil {
+		t.Fatalf("failed to initialize the database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := Close(); err != nil {
+			t.Errorf("failed to close the database: %v", err)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexander-bruun/magi/utils"
+	"go.etcd.io/bbolt"
+)
+
+// favoriteMatchThreshold is the title similarity an imported favorite needs to be matched to a local manga
+const favoriteMatchThreshold = 0.8
+
+type Favorite struct {
+	Username  string    `json:"username"`
+	MangaSlug string    `json:"manga_slug"`
+	AddedAt   time.Time `json:"added_at"`
+}
+
+// FavoriteImportResult reports how the titles of an import were matched
+type FavoriteImportResult struct {
+	Added           []Manga
+	AlreadyFavorite []Manga
+	Unmatched       []string
+}
+
+// AddFavorite marks a manga as a favorite of a user, a manga already marked keeps its original date
+func AddFavorite(username, mangaSlug string) error {
+	if exists, err := MangaExists(mangaSlug); err != nil {
+		return err
+	} else if !exists {
+		return errors.New("manga not found")
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		return putFavorite(tx.Bucket([]byte("favorites")), username, mangaSlug)
+	})
+}
+
+// RemoveFavorite unmarks a manga as a favorite of a user
+func RemoveFavorite(username, mangaSlug string) error {
+	return delete("favorites", favoriteKey(username, mangaSlug))
+}
+
+// IsFavorite reports whether a user marked a manga as a favorite
+func IsFavorite(username, mangaSlug string) (bool, error) {
+	return exists("favorites", favoriteKey(username, mangaSlug))
+}
+
+// GetFavoriteMangas returns the favorite mangas of a user sorted by name, leaving out those above the content rating limit
+func GetFavoriteMangas(username, contentRatingLimit string) ([]Manga, error) {
+	var slugs map[string]bool
+	err := db.View(func(tx *bbolt.Tx) error {
+		slugs = favoriteSlugs(tx.Bucket([]byte("favorites")), username)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mangas, err := listableMangas("", contentRatingLimit, false)
+	if err != nil {
+		return nil, err
+	}
+	favorites := filterBySlugs(mangas, slugs)
+	sortMangasByName(favorites)
+	return favorites, nil
+}
+
+// ImportFavorites matches titles to the local mangas and adds the confident matches as favorites of a user
+// in a single transaction, titles without a confident match are reported back
+func ImportFavorites(username string, titles []string, contentRatingLimit string) (FavoriteImportResult, error) {
+	var result FavoriteImportResult
+	mangas, err := listableMangas("", contentRatingLimit, false)
+	if err != nil {
+		return result, err
+	}
+
+	byName := make(map[string]Manga, len(mangas))
+	names := make([]string, 0, len(mangas))
+	for _, manga := range mangas {
+		for _, title := range manga.Titles() {
+			name := utils.FoldTitle(title)
+			if _, ok := byName[name]; !ok {
+				byName[name] = manga
+				names = append(names, name)
+			}
+		}
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("favorites"))
+		favorites := favoriteSlugs(bucket, username)
+		for _, title := range titles {
+			manga, ok := matchFavoriteTitle(title, names, byName)
+			if !ok {
+				result.Unmatched = append(result.Unmatched, title)
+				continue
+			}
+			if favorites[manga.Slug] {
+				result.AlreadyFavorite = append(result.AlreadyFavorite, manga)
+				continue
+			}
+			if err := putFavorite(bucket, username, manga.Slug); err != nil {
+				return err
+			}
+			favorites[manga.Slug] = true
+			result.Added = append(result.Added, manga)
+		}
+		return nil
+	})
+	if err != nil {
+		return FavoriteImportResult{}, err
+	}
+	return result, nil
+}
+
+// DeleteFavoritesByMangaSlug removes a manga from the favorites of every user
+func DeleteFavoritesByMangaSlug(mangaSlug string) error {
+	return deleteKeysWithPattern("favorites", fmt.Sprintf("*:%s", mangaSlug))
+}
+
+// Helper functions
+
+// matchFavoriteTitle finds the most similar local manga name or alias among the bigram search candidates
+func matchFavoriteTitle(title string, names []string, byName map[string]Manga) (Manga, bool) {
+	title = utils.FoldTitle(title)
+	if manga, ok := byName[title]; ok {
+		return manga, true
+	}
+
+	best, bestScore := "", 0.0
+	for _, name := range utils.BigramSearch(title, names) {
+		if score := utils.CompareStrings(title, name); score > bestScore {
+			best, bestScore = name, score
+		}
+	}
+	if bestScore < favoriteMatchThreshold {
+		return Manga{}, false
+	}
+	return byName[best], true
+}
+
+func putFavorite(bucket *bbolt.Bucket, username, mangaSlug string) error {
+	key := []byte(favoriteKey(username, mangaSlug))
+	if bucket.Get(key) != nil {
+		return nil
+	}
+
+	encoded, err := json.Marshal(Favorite{Username: username, MangaSlug: mangaSlug, AddedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, encoded)
+}
+
+func favoriteSlugs(bucket *bbolt.Bucket, username string) map[string]bool {
+	slugs := make(map[string]bool)
+	prefix := username + ":"
+	for _, key := range keysWithPrefix(bucket, prefix) {
+		slugs[strings.TrimPrefix(string(key), prefix)] = true
+	}
+	return slugs
+}
+
+func sortMangasByName(mangas []Manga) {
+	sort.Slice(mangas, func(i, j int) bool {
+		return strings.ToLower(mangas[i].Name) < strings.ToLower(mangas[j].Name)
+	})
+}
+
+func favoriteKey(username, mangaSlug string) string {
+	return fmt.Sprintf("%s:%s", username, mangaSlug)
+}
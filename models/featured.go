@@ -0,0 +1,119 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// FeaturedMedia places a manga on the hand-curated featured row, optionally only within a window of time
+type FeaturedMedia struct {
+	MangaSlug string `json:"manga_slug"`
+	// Order positions the manga on the row, lower orders come first
+	Order    int        `json:"order"`
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+	AddedAt  time.Time  `json:"added_at"`
+}
+
+// Active reports whether the manga is within its featured window
+func (f FeaturedMedia) Active(now time.Time) bool {
+	if f.StartsAt != nil && now.Before(*f.StartsAt) {
+		return false
+	}
+	return f.EndsAt == nil || now.Before(*f.EndsAt)
+}
+
+// SetFeaturedMedia features a manga at the given position, replacing its previous order and window. A nil start
+// or end leaves that side of the window open.
+func SetFeaturedMedia(slug string, order int, startsAt, endsAt *time.Time) error {
+	if order < 1 {
+		return errors.New("featured order must be at least 1")
+	}
+	if startsAt != nil && endsAt != nil && !endsAt.After(*startsAt) {
+		return errors.New("featured end must be after its start")
+	}
+	if _, err := GetManga(slug); err != nil {
+		return err
+	}
+
+	featured := FeaturedMedia{
+		MangaSlug: slug,
+		Order:     order,
+		StartsAt:  startsAt,
+		EndsAt:    endsAt,
+		AddedAt:   time.Now(),
+	}
+	if existing, err := GetFeaturedEntry(slug); err == nil {
+		featured.AddedAt = existing.AddedAt
+	}
+	return create("featured_media", slug, featured)
+}
+
+// GetFeaturedEntry returns the featured entry of a manga, bbolt.ErrBucketNotFound when it isn't featured
+func GetFeaturedEntry(slug string) (FeaturedMedia, error) {
+	var featured FeaturedMedia
+	err := get("featured_media", slug, &featured)
+	return featured, err
+}
+
+// GetFeaturedEntries returns every featured entry in row order, including the ones outside their window
+func GetFeaturedEntries() ([]FeaturedMedia, error) {
+	entries := []FeaturedMedia{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("featured_media")).ForEach(func(_, v []byte) error {
+			var featured FeaturedMedia
+			if err := json.Unmarshal(v, &featured); err != nil {
+				return err
+			}
+			entries = append(entries, featured)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Order != entries[j].Order {
+			return entries[i].Order < entries[j].Order
+		}
+		return entries[i].AddedAt.Before(entries[j].AddedAt)
+	})
+	return entries, nil
+}
+
+// GetFeaturedMedia returns the featured mangas within their window in row order, leaving out those above the
+// content rating limit
+func GetFeaturedMedia(contentRatingLimit string) ([]Manga, error) {
+	entries, err := GetFeaturedEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	contentRatingLimit = EffectiveContentRatingLimit(contentRatingLimit)
+	now := time.Now()
+	mangas := []Manga{}
+	for _, entry := range entries {
+		if !entry.Active(now) {
+			continue
+		}
+		manga, err := GetManga(entry.MangaSlug)
+		if err != nil {
+			continue
+		}
+		if manga.Hidden || contentRatingLimit != "" && !IsContentRatingAllowed(manga.ContentRating, contentRatingLimit) {
+			continue
+		}
+		mangas = append(mangas, *manga)
+	}
+	return mangas, nil
+}
+
+// DeleteFeaturedMedia removes a manga from the featured row
+func DeleteFeaturedMedia(slug string) error {
+	return delete("featured_media", slug)
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/gofiber/fiber/v2/log"
 	"github.com/golang-jwt/jwt/v4"
 	"go.etcd.io/bbolt"
 )
@@ -45,13 +46,52 @@ func CreateAccessToken(userName string) (string, error) {
 	return createToken(userName, nil, 15*time.Minute)
 }
 
-// CreateRefreshToken generates a new refresh token with a 7-day expiry
-func CreateRefreshToken(userName string, version int) (string, error) {
+// Session describes the lifetime of a login session, carried over by every refresh token issued for it
+type Session struct {
+	Expires    time.Time
+	RememberMe bool
+}
+
+// NewSession starts a session with the lifetimes configured at login, so later changes only affect new sessions
+func NewSession(rememberMe bool) (Session, error) {
+	config, err := GetAppConfig()
+	if err != nil {
+		return Session{}, err
+	}
+
+	duration := time.Duration(config.SessionDurationHours) * time.Hour
+	if rememberMe {
+		duration = time.Duration(config.RememberMeDurationDays) * 24 * time.Hour
+	}
+	return Session{Expires: time.Now().Add(duration), RememberMe: rememberMe}, nil
+}
+
+// RefreshTokenExpiry returns when a refresh token issued now expires, refreshing extends it up to the session expiry
+func RefreshTokenExpiry(session Session) time.Time {
+	if session.RememberMe {
+		return session.Expires
+	}
+
+	config, err := GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+	idleExpiry := time.Now().Add(time.Duration(config.SessionIdleTimeoutHours) * time.Hour)
+	if idleExpiry.Before(session.Expires) {
+		return idleExpiry
+	}
+	return session.Expires
+}
+
+// CreateRefreshToken generates a new refresh token for a session, expiring after the idle timeout or with the session
+func CreateRefreshToken(userName string, version int, session Session) (string, error) {
 	claims := jwt.MapClaims{
-		"user_name": userName,
-		"version":   version,
+		"user_name":       userName,
+		"version":         version,
+		"session_expires": session.Expires.Unix(),
+		"remember_me":     session.RememberMe,
 	}
-	return createToken(userName, claims, 7*24*time.Hour)
+	return createToken(userName, claims, time.Until(RefreshTokenExpiry(session)))
 }
 
 // ValidateToken validates a token and returns its claims
@@ -74,28 +114,36 @@ func ValidateToken(tokenString string) (jwt.MapClaims, error) {
 	return nil, errors.New("token invalid")
 }
 
-// RefreshAccessToken generates a new access token from a valid refresh token
-func RefreshAccessToken(refreshToken string) (string, string, error) {
+// RefreshAccessToken generates a new access token from a valid refresh token, returning the session it belongs to
+func RefreshAccessToken(refreshToken string) (string, string, Session, error) {
 	claims, err := ValidateToken(refreshToken)
 	if err != nil {
-		return "", "", err
+		return "", "", Session{}, err
 	}
 
 	userName, version := claims["user_name"].(string), int(claims["version"].(float64))
 	user, err := FindUserByUsername(userName)
 	if err != nil || user.RefreshTokenVersion != version {
-		return "", "", errors.New("invalid refresh token version")
+		return "", "", Session{}, errors.New("invalid refresh token version")
+	}
+
+	session, err := sessionFromClaims(claims)
+	if err != nil {
+		return "", "", Session{}, err
+	}
+	if time.Now().After(session.Expires) {
+		return "", "", Session{}, errors.New("session expired")
 	}
 
 	newAccessToken, err := CreateAccessToken(userName)
 	if err != nil {
-		return "", "", err
+		return "", "", Session{}, err
 	}
-	return newAccessToken, userName, nil
+	return newAccessToken, userName, session, nil
 }
 
-// GenerateNewRefreshToken creates a new refresh token and updates the user's version
-func GenerateNewRefreshToken(userName string) (string, error) {
+// GenerateNewRefreshToken creates a new refresh token for the session and updates the user's version
+func GenerateNewRefreshToken(userName string, session Session) (string, error) {
 	user, err := FindUserByUsername(userName)
 	if err != nil {
 		return "", errors.New("user not found")
@@ -105,7 +153,26 @@ func GenerateNewRefreshToken(userName string) (string, error) {
 		return "", errors.New("failed to increment refresh token version")
 	}
 
-	return CreateRefreshToken(userName, user.RefreshTokenVersion)
+	return CreateRefreshToken(userName, user.RefreshTokenVersion+1, session)
+}
+
+// SessionOfRefreshToken returns the session a refresh token belongs to
+func SessionOfRefreshToken(refreshToken string) (Session, error) {
+	claims, err := ValidateToken(refreshToken)
+	if err != nil {
+		return Session{}, err
+	}
+	return sessionFromClaims(claims)
+}
+
+// sessionFromClaims reads the session of a refresh token, tokens issued before sessions existed start a new one
+func sessionFromClaims(claims jwt.MapClaims) (Session, error) {
+	expires, ok := claims["session_expires"].(float64)
+	if !ok {
+		return NewSession(false)
+	}
+	rememberMe, _ := claims["remember_me"].(bool)
+	return Session{Expires: time.Unix(int64(expires), 0), RememberMe: rememberMe}, nil
 }
 
 // createToken generates a JWT token with specified claims and expiry duration
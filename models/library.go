@@ -3,9 +3,13 @@ package models
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/alexander-bruun/magi/utils"
 	"github.com/gofiber/fiber/v2/log"
@@ -18,10 +22,62 @@ type Library struct {
 	Description string   `json:"description"`
 	Cron        string   `json:"cron"`
 	Folders     []string `json:"folders"`
+	// ChapterOrder is the default order of the chapter lists of the library, empty lists oldest first
+	ChapterOrder string `json:"chapter_order,omitempty" form:"chapter_order"`
+	// ExcludedExtensions are file extensions never indexed as chapters in this library, whatever the enabled formats
+	ExcludedExtensions []string `json:"excluded_extensions,omitempty" form:"excluded_extensions"`
+	// CoverBlurRating overrides the content rating from which covers are blurred, CoverBlurOff never blurs them
+	CoverBlurRating string `json:"cover_blur_rating,omitempty" form:"cover_blur_rating"`
+	// Layout tells the indexer where the series of the library folders are, empty means a folder per series
+	Layout string `json:"layout,omitempty" form:"layout"`
+	// TagPatterns are regular expressions, one per line, pulling tags out of the folder names of the series
+	TagPatterns string `json:"tag_patterns,omitempty" form:"tag_patterns"`
+	// MetadataDisabled keeps the series of the library on local metadata, no metadata provider is ever asked
+	MetadataDisabled bool `json:"metadata_disabled,omitempty" form:"metadata_disabled"`
 	CreatedAt   int64    `json:"created_at"` // Unix timestamp
 	UpdatedAt   int64    `json:"updated_at"` // Unix timestamp
 }
 
+// MetadataProvider returns the provider the series of the library get their metadata from, empty when the library
+// has metadata disabled
+func (l Library) MetadataProvider() string {
+	if l.MetadataDisabled {
+		return ""
+	}
+	return MetadataProviderMangaDex
+}
+
+// CoverBlurOff is the cover blur rating of a library whose covers are never blurred, whatever the default
+const CoverBlurOff = "off"
+
+// Library layouts, the way the series of a library are laid out in its folders
+const (
+	// LibraryLayoutAuto guesses the layout of each folder from a sample of its entries on every index
+	LibraryLayoutAuto = "auto"
+	// LibraryLayoutSeriesFolders holds a folder per series, the chapters inside it
+	LibraryLayoutSeriesFolders = "series-folders"
+	// LibraryLayoutPublisherSeries holds a folder per publisher, with a folder per series inside it
+	LibraryLayoutPublisherSeries = "publisher/series"
+	// LibraryLayoutFlat holds the chapters of every series side by side, grouped by the series name of their files
+	LibraryLayoutFlat = "flat"
+	// LibraryLayoutFilePerSeries holds a file per series, such as one-shots and complete volumes
+	LibraryLayoutFilePerSeries = "file-per-series"
+)
+
+// LibraryLayouts lists the supported library layouts
+var LibraryLayouts = []string{LibraryLayoutSeriesFolders, LibraryLayoutPublisherSeries, LibraryLayoutFlat, LibraryLayoutFilePerSeries, LibraryLayoutAuto}
+
+// EffectiveLayout returns the layout of the library, libraries created before layouts hold a folder per series
+func (l *Library) EffectiveLayout() string {
+	if l.Layout == "" {
+		return LibraryLayoutSeriesFolders
+	}
+	return l.Layout
+}
+
+// extensionPattern matches a file extension, including double ones such as .tar.gz
+var extensionPattern = regexp.MustCompile(`^(\.[a-z0-9]{1,10}){1,2}$`)
+
 // GetFolderNames returns a comma-separated string of folder names
 func (l *Library) GetFolderNames() string {
 	return strings.Join(l.Folders, ", ")
@@ -38,10 +94,65 @@ func (l *Library) Validate() error {
 	if l.Cron == "" {
 		return errors.New("library cron cannot be empty")
 	}
+	if l.ChapterOrder != "" && !slices.Contains(ChapterOrders, l.ChapterOrder) {
+		return errors.New("invalid chapter order")
+	}
+	if l.CoverBlurRating != "" && l.CoverBlurRating != CoverBlurOff && contentRatingLevel(l.CoverBlurRating) == -1 {
+		return errors.New("invalid cover blur rating")
+	}
+	if err := l.ValidateIndexSettings(); err != nil {
+		return err
+	}
 	l.Slug = utils.Sluggify(l.Name)
 	return nil
 }
 
+// ValidateIndexSettings checks the settings the indexer reads and normalizes the excluded extensions, a scan preview
+// checks them without the rest of the library
+func (l *Library) ValidateIndexSettings() error {
+	if l.Layout != "" && !slices.Contains(LibraryLayouts, l.Layout) {
+		return errors.New("invalid library layout")
+	}
+	if _, err := utils.ParseTagPatterns(l.TagPatterns); err != nil {
+		return err
+	}
+	extensions, err := normalizeExtensions(l.ExcludedExtensions)
+	if err != nil {
+		return err
+	}
+	l.ExcludedExtensions = extensions
+	return nil
+}
+
+// ExcludesFile reports whether a chapter file or folder has one of the extensions excluded from the library
+func (l *Library) ExcludesFile(name string) bool {
+	name = strings.ToLower(name)
+	for _, extension := range l.ExcludedExtensions {
+		if strings.HasSuffix(name, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeExtensions splits the entries on commas and spaces, so a form can send a single list, and returns them in
+// lower case with a leading dot and without duplicates
+func normalizeExtensions(entries []string) ([]string, error) {
+	var extensions []string
+	for _, entry := range entries {
+		for _, extension := range strings.FieldsFunc(entry, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+			extension = "." + strings.TrimPrefix(strings.ToLower(extension), ".")
+			if !extensionPattern.MatchString(extension) {
+				return nil, fmt.Errorf("invalid excluded extension: %s", extension)
+			}
+			if !slices.Contains(extensions, extension) {
+				extensions = append(extensions, extension)
+			}
+		}
+	}
+	return extensions, nil
+}
+
 // CreateLibrary adds a new Library to the database
 func CreateLibrary(library Library) error {
 	if err := library.Validate(); err != nil {
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateIndexSettingsNormalizesExcludedExtensions(t *testing.T) {
+	library := Library{ExcludedExtensions: []string{"nfo, .TXT", "zip  tar.gz nfo"}}
+	if err := library.ValidateIndexSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{".nfo", ".txt", ".zip", ".tar.gz"}; !slices.Equal(library.ExcludedExtensions, want) {
+		t.Errorf("got %v, want %v", library.ExcludedExtensions, want)
+	}
+
+	for _, invalid := range []string{"../cbz", "a.b.c", ".", "mp4!"} {
+		library := Library{ExcludedExtensions: []string{invalid}}
+		if err := library.ValidateIndexSettings(); err == nil {
+			t.Errorf("excluding %q succeeded, want an error", invalid)
+		}
+	}
+}
+
+func TestExcludesFile(t *testing.T) {
+	library := Library{ExcludedExtensions: []string{".zip", ".tar.gz"}}
+	for name, want := range map[string]bool{
+		"Chapter 1.ZIP":    true,
+		"Chapter 1.tar.gz": true,
+		"Chapter 1.cbz":    false,
+		"Chapter 1":        false,
+	} {
+		if got := library.ExcludesFile(name); got != want {
+			t.Errorf("ExcludesFile(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestMetadataProvider(t *testing.T) {
+	if got := (Library{}).MetadataProvider(); got != MetadataProviderMangaDex {
+		t.Errorf("got '%s', want '%s'", got, MetadataProviderMangaDex)
+	}
+	if got := (Library{MetadataDisabled: true}).MetadataProvider(); got != "" {
+		t.Errorf("got '%s' with metadata disabled, want no provider", got)
+	}
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// compactTxMaxSize bounds the size of each transaction while compacting the database
+	compactTxMaxSize = 64 * 1024
+	// compactionPendingSuffix names the file next to the database asking for it to be compacted on the next start
+	compactionPendingSuffix = ".compact-pending"
+)
+
+// ErrIndexingInProgress is returned when maintenance is requested while a library is being indexed
+var ErrIndexingInProgress = errors.New("indexing is in progress, try again once it has finished")
+
+// indexingLock is held for reading by indexing jobs and for writing by maintenance tasks
+var indexingLock sync.RWMutex
+
+// StartIndexing marks an indexing job as running, blocking while maintenance is in progress, and returns the function ending it
+func StartIndexing() func() {
+	indexingLock.RLock()
+	return indexingLock.RUnlock
+}
+
+// CheckIntegrity verifies the consistency of the database pages and returns the problems found
+func CheckIntegrity() ([]string, error) {
+	if !indexingLock.TryLock() {
+		return nil, ErrIndexingInProgress
+	}
+	defer indexingLock.Unlock()
+
+	var problems []string
+	err := db.View(func(tx *bbolt.Tx) error {
+		for err := range tx.Check() {
+			problems = append(problems, err.Error())
+		}
+		return nil
+	})
+	return problems, err
+}
+
+// CompactDatabase rewrites the database into a new file to reclaim free pages, returning the sizes before and after.
+// It reopens the database afterwards, so it must only run while nothing else is using it.
+func CompactDatabase(dataDirectory string) (int64, int64, error) {
+	if !indexingLock.TryLock() {
+		return 0, 0, ErrIndexingInProgress
+	}
+	defer indexingLock.Unlock()
+
+	databasePath := db.Path()
+	compactedPath := databasePath + ".compact"
+
+	before, err := fileSize(databasePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	os.Remove(compactedPath)
+	dst, err := bbolt.Open(compactedPath, 0600, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create compacted database: %w", err)
+	}
+	if err := bbolt.Compact(dst, db, compactTxMaxSize); err != nil {
+		dst.Close()
+		os.Remove(compactedPath)
+		return 0, 0, fmt.Errorf("failed to compact database: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := Close(); err != nil {
+		return 0, 0, err
+	}
+	if err := os.Rename(compactedPath, databasePath); err != nil {
+		return 0, 0, fmt.Errorf("failed to replace database: %w", err)
+	}
+	if err := Initialize(filepath.Clean(dataDirectory)); err != nil {
+		return 0, 0, fmt.Errorf("failed to reopen database: %w", err)
+	}
+
+	after, err := fileSize(databasePath)
+	return before, after, err
+}
+
+// ScheduleCompaction asks for the database to be compacted the next time Magi starts. Compacting reopens the database,
+// which can't happen while the server is using it.
+func ScheduleCompaction() error {
+	return os.WriteFile(db.Path()+compactionPendingSuffix, nil, 0600)
+}
+
+// CompactionScheduled reports whether the database is compacted the next time Magi starts
+func CompactionScheduled() bool {
+	_, err := os.Stat(db.Path() + compactionPendingSuffix)
+	return err == nil
+}
+
+// CompactScheduledDatabase compacts the database when a compaction was scheduled, reporting whether it ran along with the
+// sizes before and after. It must run before anything else uses the database.
+func CompactScheduledDatabase(dataDirectory string) (bool, int64, int64, error) {
+	pendingPath := db.Path() + compactionPendingSuffix
+	if _, err := os.Stat(pendingPath); err != nil {
+		return false, 0, 0, nil
+	}
+	// A compaction is only attempted once, so a failing one doesn't keep getting in the way of starting
+	if err := os.Remove(pendingPath); err != nil {
+		return false, 0, 0, err
+	}
+	before, after, err := CompactDatabase(dataDirectory)
+	return true, before, after, err
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
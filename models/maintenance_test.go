@@ -0,0 +1,51 @@
+package models
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompactScheduledDatabase(t *testing.T) {
+	setupTestDB(t)
+	dataDirectory := filepath.Dir(db.Path())
+	if err := CreateManga(Manga{Name: "Kept"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if compacted, _, _, err := CompactScheduledDatabase(dataDirectory); err != nil || compacted {
+		t.Fatalf("compacted = %v, err = %v without a scheduled compaction", compacted, err)
+	}
+
+	if err := ScheduleCompaction(); err != nil {
+		t.Fatal(err)
+	}
+	if !CompactionScheduled() {
+		t.Fatal("the compaction isn't scheduled")
+	}
+	compacted, before, after, err := CompactScheduledDatabase(dataDirectory)
+	if err != nil || !compacted {
+		t.Fatalf("compacted = %v, err = %v with a scheduled compaction", compacted, err)
+	}
+	if after > before {
+		t.Errorf("the database grew from %d to %d bytes", before, after)
+	}
+	if _, err := GetManga("kept"); err != nil {
+		t.Errorf("the reopened database lost a manga: %v", err)
+	}
+
+	// The compaction ran once, the next start doesn't repeat it
+	if CompactionScheduled() {
+		t.Error("the compaction is still scheduled after it ran")
+	}
+}
+
+func TestCompactDatabaseWaitsForIndexing(t *testing.T) {
+	setupTestDB(t)
+	done := StartIndexing()
+	defer done()
+
+	if _, _, err := CompactDatabase(filepath.Dir(db.Path())); !errors.Is(err, ErrIndexingInProgress) {
+		t.Errorf("got %v, want %v", err, ErrIndexingInProgress)
+	}
+}
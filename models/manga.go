@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
 	"sort"
 	"strings"
@@ -10,24 +11,85 @@ import (
 
 	"github.com/alexander-bruun/magi/utils"
 	"github.com/gofiber/fiber/v2/log"
+	"go.etcd.io/bbolt"
 )
 
 type Manga struct {
 	Slug             string    `json:"slug"`
 	Name             string    `json:"name"`
+	Aliases          []string  `json:"aliases,omitempty"`
 	Author           string    `json:"author"`
 	Description      string    `json:"description"`
 	Year             int       `json:"year"`
 	OriginalLanguage string    `json:"original_language"`
 	Status           string    `json:"status"`
 	ContentRating    string    `json:"content_rating"`
+	MetadataProvider string    `json:"metadata_provider,omitempty"` // Provider the metadata came from, empty for local metadata
+	ProviderRating   string    `json:"provider_rating,omitempty"`   // Content rating reported by the provider, before it was mapped
 	LibrarySlug      string    `json:"library_slug"`
 	CoverArtURL      string    `json:"cover_art_url"`
+	CoverLocked      bool      `json:"cover_locked,omitempty"`
+	AccentColor      string    `json:"accent_color,omitempty"`
 	Path             string    `json:"path"`
+	Tags             []string  `json:"tags"`
+	Type             string    `json:"type"`
+	ReadingMode      string    `json:"reading_mode,omitempty"`
+	PinOrder         *int      `json:"pin_order,omitempty"` // Position among the pinned mangas of the library, nil when not pinned
+	Hidden           bool      `json:"hidden,omitempty"`    // Left out of every listing, only admins can open hidden mangas
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
 }
 
+// PosterURL returns the URL serving the cover of the manga, which falls back to a default cover when missing
+func (m Manga) PosterURL() string {
+	return fmt.Sprintf("/api/posters/%s", m.Slug)
+}
+
+// NeutralAccentColor is used for mangas whose cover is missing or has no dominant color
+const NeutralAccentColor = "#6b7280"
+
+// Accent returns the dominant color of the cover, falling back to a neutral color
+func (m Manga) Accent() string {
+	if m.AccentColor == "" {
+		return NeutralAccentColor
+	}
+	return m.AccentColor
+}
+
+// EnrichedManga wraps a Manga with user specific details used by the listing views
+type EnrichedManga struct {
+	Manga
+	LastReadChapterSlug string
+	LastReadChapterName string
+	LastReadPercent     int
+	LatestChapterSlug   string
+	LatestChapterName   string
+	UnreadCount         int
+}
+
+// LastReadLabel returns a short "Ch. 45 · 60%" style label, or an empty string if nothing has been read
+func (m EnrichedManga) LastReadLabel() string {
+	if m.LastReadChapterSlug == "" {
+		return ""
+	}
+	label := m.LastReadChapterName
+	if number, err := utils.ExtractNumber(m.LastReadChapterName); err == nil {
+		label = fmt.Sprintf("Ch. %d", number)
+	}
+	return fmt.Sprintf("%s · %d%%", label, m.LastReadPercent)
+}
+
+// LatestChapterLabel returns a short "Ch. 45" style label of the latest chapter, or an empty string without chapters
+func (m EnrichedManga) LatestChapterLabel() string {
+	if m.LatestChapterSlug == "" {
+		return ""
+	}
+	if number, err := utils.ExtractNumber(m.LatestChapterName); err == nil {
+		return fmt.Sprintf("Ch. %d", number)
+	}
+	return m.LatestChapterName
+}
+
 // CreateManga adds a new Manga to the database
 func CreateManga(manga Manga) error {
 	manga.Slug = utils.Sluggify(manga.Name)
@@ -42,6 +104,7 @@ func CreateManga(manga Manga) error {
 	now := time.Now()
 	manga.CreatedAt = now
 	manga.UpdatedAt = now
+	invalidateSimilarMangas()
 	return create("mangas", manga.Slug, manga)
 }
 
@@ -54,32 +117,103 @@ func GetManga(slug string) (*Manga, error) {
 	return &manga, nil
 }
 
+// GetAllMangas returns every manga of every library
+func GetAllMangas() ([]Manga, error) {
+	var mangas []Manga
+	if err := loadAllMangas(&mangas); err != nil {
+		return nil, err
+	}
+	return mangas, nil
+}
+
 // UpdateManga modifies an existing Manga
 func UpdateManga(manga *Manga) error {
 	manga.UpdatedAt = time.Now()
+	invalidateSimilarMangas()
 	return update("mangas", manga.Slug, manga)
 }
 
+// SetMangaCover stores an uploaded cover and its accent color and locks it, so metadata updates keep it
+func SetMangaCover(slug, coverArtURL, accentColor string) error {
+	manga, err := GetManga(slug)
+	if err != nil {
+		return err
+	}
+	manga.CoverArtURL = coverArtURL
+	manga.AccentColor = accentColor
+	manga.CoverLocked = true
+	return UpdateManga(manga)
+}
+
+// UnlockMangaCover lets the next metadata update replace the cover again
+func UnlockMangaCover(slug string) error {
+	manga, err := GetManga(slug)
+	if err != nil {
+		return err
+	}
+	manga.CoverLocked = false
+	return UpdateManga(manga)
+}
+
 // DeleteManga removes a Manga and its associated chapters
 func DeleteManga(slug string) error {
 	if err := delete("mangas", slug); err != nil {
 		return err
 	}
+	invalidateSimilarMangas()
+	if err := DeleteReadingStatesByMangaSlug(slug); err != nil {
+		return err
+	}
+	if err := DeleteChapterCommentsByMangaSlug(slug); err != nil {
+		return err
+	}
+	if err := DeleteFavoritesByMangaSlug(slug); err != nil {
+		return err
+	}
+	if err := DeleteOfflineChaptersByMangaSlug(slug); err != nil {
+		return err
+	}
+	if err := DeleteCoverRepair(slug); err != nil {
+		return err
+	}
+	if err := DeleteFeaturedMedia(slug); err != nil {
+		return err
+	}
+	if err := DeleteChapterIssuesByMangaSlug(slug); err != nil {
+		return err
+	}
+	if err := DeleteChapterDuplicatesByMangaSlug(slug); err != nil {
+		return err
+	}
+	if err := DeleteShareLinksByMangaSlug(slug); err != nil {
+		return err
+	}
+	if err := DeleteMetadataReview(slug); err != nil {
+		return err
+	}
+	if err := DeleteMetadataRetry(slug); err != nil {
+		return err
+	}
+	if err := DeleteSeriesStatusesByMangaSlug(slug); err != nil {
+		return err
+	}
+	if err := DeleteMediaViews(slug); err != nil {
+		return err
+	}
+	if err := DeleteMangaCoversByMangaSlug(slug); err != nil {
+		return err
+	}
+	closeReportsWithoutTarget()
 	return DeleteChaptersByMangaSlug(slug)
 }
 
-// SearchMangas filters, sorts, and paginates mangas based on provided criteria
-func SearchMangas(filter string, page, pageSize int, sortBy, sortOrder, filterBy, librarySlug string) ([]Manga, int64, error) {
-	var mangas []Manga
-	if err := loadAllMangas(&mangas); err != nil {
+// SearchMangas filters, sorts, and paginates mangas based on provided criteria, hideEmpty leaves out mangas without chapters
+func SearchMangas(filter string, page, pageSize int, sortBy, sortOrder, filterBy, librarySlug, contentRatingLimit string, hideEmpty bool) ([]Manga, int64, error) {
+	mangas, err := listableMangas(librarySlug, contentRatingLimit, hideEmpty)
+	if err != nil {
 		return nil, 0, err
 	}
 
-	// Filter by librarySlug
-	if librarySlug != "" {
-		mangas = filterByLibrarySlug(mangas, librarySlug)
-	}
-
 	total := int64(len(mangas))
 
 	// Apply bigram search if filter is provided
@@ -89,12 +223,180 @@ func SearchMangas(filter string, page, pageSize int, sortBy, sortOrder, filterBy
 	}
 
 	// Sort mangas based on sortBy and sortOrder
-	sortMangas(mangas, sortBy, sortOrder)
+	SortMangas(mangas, sortBy, sortOrder)
+	// Pins are scoped to a library, so they only lead listings limited to one
+	if librarySlug != "" {
+		pinnedFirst(mangas)
+	}
 
 	// Apply pagination
 	return paginateMangas(mangas, page, pageSize), total, nil
 }
 
+// GetAdjacentMangas returns the mangas before and after a manga in the listing with the same filters and sorting,
+// nil at either end or when the manga isn't part of the listing
+func GetAdjacentMangas(slug, librarySlug, sortBy, sortOrder, contentRatingLimit string, hideEmpty bool) (prev, next *Manga, err error) {
+	mangas, err := listableMangas(librarySlug, contentRatingLimit, hideEmpty)
+	if err != nil {
+		return nil, nil, err
+	}
+	SortMangas(mangas, sortBy, sortOrder)
+	if librarySlug != "" {
+		pinnedFirst(mangas)
+	}
+
+	for i := range mangas {
+		if mangas[i].Slug != slug {
+			continue
+		}
+		if i > 0 {
+			prev = &mangas[i-1]
+		}
+		if i < len(mangas)-1 {
+			next = &mangas[i+1]
+		}
+		break
+	}
+	return prev, next, nil
+}
+
+// GetRecentlyUpdatedMangas returns the mangas whose newest chapter was indexed most recently. The newest chapter of
+// each manga is found in a single pass over the chapters, and only the mangas that make it into the result are loaded.
+func GetRecentlyUpdatedMangas(limit int, contentRatingLimit string) ([]Manga, error) {
+	contentRatingLimit = EffectiveContentRatingLimit(contentRatingLimit)
+	var mangas []Manga
+	err := db.View(func(tx *bbolt.Tx) error {
+		newest := make(map[string]time.Time)
+		err := tx.Bucket([]byte("chapters")).ForEach(func(k, v []byte) error {
+			mangaSlug, _, ok := strings.Cut(string(k), ":")
+			if !ok {
+				return nil
+			}
+			var chapter struct {
+				CreatedAt time.Time `json:"created_at"`
+			}
+			if err := json.Unmarshal(v, &chapter); err != nil {
+				return err
+			}
+			if latest, ok := newest[mangaSlug]; !ok || chapter.CreatedAt.After(latest) {
+				newest[mangaSlug] = chapter.CreatedAt
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		slugs := make([]string, 0, len(newest))
+		for slug := range newest {
+			slugs = append(slugs, slug)
+		}
+		sort.Slice(slugs, func(i, j int) bool {
+			if !newest[slugs[i]].Equal(newest[slugs[j]]) {
+				return newest[slugs[i]].After(newest[slugs[j]])
+			}
+			return slugs[i] < slugs[j]
+		})
+
+		bucket := tx.Bucket([]byte("mangas"))
+		for _, slug := range slugs {
+			if len(mangas) >= limit {
+				break
+			}
+			data := bucket.Get([]byte(slug))
+			if data == nil {
+				continue
+			}
+			var manga Manga
+			if err := json.Unmarshal(data, &manga); err != nil {
+				return err
+			}
+			if manga.Hidden || contentRatingLimit != "" && !IsContentRatingAllowed(manga.ContentRating, contentRatingLimit) {
+				continue
+			}
+			mangas = append(mangas, manga)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mangas, nil
+}
+
+// EnrichMangas attaches the latest chapter and the reading progress of the given user to each manga
+func EnrichMangas(mangas []Manga, username string) ([]EnrichedManga, error) {
+	enriched := make([]EnrichedManga, len(mangas))
+	slugs := make([]string, len(mangas))
+	for i, manga := range mangas {
+		enriched[i] = EnrichedManga{Manga: manga}
+		slugs[i] = manga.Slug
+	}
+
+	latest, err := GetLatestChapters(slugs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range enriched {
+		if chapter, ok := latest[enriched[i].Slug]; ok {
+			enriched[i].LatestChapterSlug = chapter.Slug
+			enriched[i].LatestChapterName = chapter.Name
+		}
+	}
+	unread, err := GetUnreadCounts(username, slugs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range enriched {
+		enriched[i].UnreadCount = unread[enriched[i].Slug]
+	}
+	if username == "" {
+		return enriched, nil
+	}
+
+	lastRead, err := GetLastReadChapters(username, slugs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range enriched {
+		if chapter, ok := lastRead[enriched[i].Slug]; ok {
+			enriched[i].LastReadChapterSlug = chapter.ChapterSlug
+			enriched[i].LastReadChapterName = chapter.ChapterName
+			enriched[i].LastReadPercent = chapter.Percent
+		}
+	}
+	return enriched, nil
+}
+
+// BackfillAccentColors extracts the accent color of every manga without one from its cached cover
+func BackfillAccentColors(cacheDirectory string) (int, error) {
+	var mangas []Manga
+	if err := loadAllMangas(&mangas); err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for i, manga := range mangas {
+		if manga.AccentColor != "" {
+			continue
+		}
+		manga.AccentColor = utils.CoverAccentColor(cacheDirectory, manga.CoverArtURL)
+		if manga.AccentColor == "" {
+			continue
+		}
+		// Stored directly, a backfilled color is not a content update of the manga
+		if err := update("mangas", manga.Slug, manga); err != nil {
+			return updated, err
+		}
+		updated++
+		if updated%100 == 0 {
+			log.Infof("Extracted accent colors for %d mangas (%d/%d checked)", updated, i+1, len(mangas))
+		}
+	}
+	return updated, nil
+}
+
 // MangaExists checks if a Manga exists by slug
 func MangaExists(slug string) (bool, error) {
 	return exists("mangas", slug)
@@ -137,20 +439,13 @@ func DeleteMangasByLibrarySlug(librarySlug string) error {
 		}
 
 		if manga.LibrarySlug == librarySlug {
-			if err := DeleteChaptersByMangaSlug(manga.Slug); err != nil {
-				log.Errorf("Failed to delete chapters for manga slug '%s': %s", manga.Slug, err.Error())
-				return err
-			}
-			log.Infof("Deleted chapters for manga: '%s'", manga.Slug)
-
-			if err := delete("mangas", manga.Slug); err != nil {
+			if err := DeleteManga(manga.Slug); err != nil {
 				log.Errorf("Failed to delete manga with slug '%s': %s", manga.Slug, err.Error())
 				return err
 			}
 			log.Infof("Deleted manga with slug '%s'", manga.Slug)
 		}
 	}
-
 	return nil
 }
 
@@ -173,6 +468,35 @@ func loadAllMangas(mangas *[]Manga) error {
 	return nil
 }
 
+// listableMangas loads the mangas a listing may show, before searching, sorting and paginating
+func listableMangas(librarySlug, contentRatingLimit string, hideEmpty bool) ([]Manga, error) {
+	var mangas []Manga
+	if err := loadAllMangas(&mangas); err != nil {
+		return nil, err
+	}
+	mangas = filterHidden(mangas)
+
+	if hideEmpty {
+		withChapters, err := mangaSlugsWithChapters()
+		if err != nil {
+			return nil, err
+		}
+		mangas = filterBySlugs(mangas, withChapters)
+	}
+
+	// Filter by librarySlug
+	if librarySlug != "" {
+		mangas = filterByLibrarySlug(mangas, librarySlug)
+	}
+
+	// Filter by contentRatingLimit, clamped by safe mode so no caller can bypass it
+	contentRatingLimit = EffectiveContentRatingLimit(contentRatingLimit)
+	if contentRatingLimit != "" {
+		mangas = filterByContentRating(mangas, contentRatingLimit)
+	}
+	return mangas, nil
+}
+
 func filterByLibrarySlug(mangas []Manga, librarySlug string) []Manga {
 	var filteredMangas []Manga
 	for _, manga := range mangas {
@@ -183,27 +507,68 @@ func filterByLibrarySlug(mangas []Manga, librarySlug string) []Manga {
 	return filteredMangas
 }
 
-func applyBigramSearch(filter string, mangas []Manga) []Manga {
-	var mangaNames []string
-	nameToManga := make(map[string]Manga)
-
+func filterHidden(mangas []Manga) []Manga {
+	var filteredMangas []Manga
 	for _, manga := range mangas {
-		mangaNames = append(mangaNames, manga.Name)
-		nameToManga[manga.Name] = manga
+		if !manga.Hidden {
+			filteredMangas = append(filteredMangas, manga)
+		}
 	}
+	return filteredMangas
+}
 
-	matchingNames := utils.BigramSearch(filter, mangaNames)
+func filterBySlugs(mangas []Manga, slugs map[string]bool) []Manga {
+	var filteredMangas []Manga
+	for _, manga := range mangas {
+		if slugs[manga.Slug] {
+			filteredMangas = append(filteredMangas, manga)
+		}
+	}
+	return filteredMangas
+}
 
+func filterByContentRating(mangas []Manga, contentRatingLimit string) []Manga {
 	var filteredMangas []Manga
-	for _, name := range matchingNames {
-		if manga, ok := nameToManga[name]; ok {
+	for _, manga := range mangas {
+		if IsContentRatingAllowed(manga.ContentRating, contentRatingLimit) {
 			filteredMangas = append(filteredMangas, manga)
 		}
 	}
+	return filteredMangas
+}
 
+func applyBigramSearch(filter string, mangas []Manga) []Manga {
+	var filteredMangas []Manga
+	for _, manga := range mangas {
+		if utils.BestTitleScore(filter, manga.Titles()) > utils.SearchThreshold {
+			filteredMangas = append(filteredMangas, manga)
+		}
+	}
 	return filteredMangas
 }
 
+// SearchHighlight holds the portions of the name and author of a search result matching the search
+type SearchHighlight struct {
+	Name   []utils.HighlightSpan `json:"name,omitempty"`
+	Author []utils.HighlightSpan `json:"author,omitempty"`
+}
+
+// HighlightSearchResults returns the matched portions of search results by manga slug, leaving out the results
+// matched by an alias or by similarity alone
+func HighlightSearchResults(filter string, mangas []Manga) map[string]SearchHighlight {
+	highlights := make(map[string]SearchHighlight)
+	for _, manga := range mangas {
+		highlight := SearchHighlight{
+			Name:   utils.HighlightMatches(filter, manga.Name),
+			Author: utils.HighlightMatches(filter, manga.Author),
+		}
+		if len(highlight.Name) > 0 || len(highlight.Author) > 0 {
+			highlights[manga.Slug] = highlight
+		}
+	}
+	return highlights
+}
+
 func paginateMangas(mangas []Manga, page, pageSize int) []Manga {
 	start := (page - 1) * pageSize
 	end := start + pageSize
@@ -216,8 +581,19 @@ func paginateMangas(mangas []Manga, page, pageSize int) []Manga {
 	return []Manga{}
 }
 
-func sortMangas(mangas []Manga, sortBy, sortOrder string) {
+// SortMangas sorts mangas in place by one of the MangaSortKeys, an unknown key leaves them as they are
+func SortMangas(mangas []Manga, sortBy, sortOrder string) {
 	switch sortBy {
+	case "name":
+		if sortOrder == "desc" {
+			sort.Slice(mangas, func(i, j int) bool {
+				return strings.ToLower(mangas[i].Name) > strings.ToLower(mangas[j].Name)
+			})
+		} else {
+			sort.Slice(mangas, func(i, j int) bool {
+				return strings.ToLower(mangas[i].Name) < strings.ToLower(mangas[j].Name)
+			})
+		}
 	case "created_at":
 		if sortOrder == "asc" {
 			sort.Slice(mangas, func(i, j int) bool {
@@ -238,6 +614,20 @@ func sortMangas(mangas []Manga, sortBy, sortOrder string) {
 				return mangas[i].UpdatedAt.After(mangas[j].UpdatedAt)
 			})
 		}
+	case "views":
+		views, err := GetAllMediaViews()
+		if err != nil {
+			log.Errorf("Failed to get media views: %v", err)
+		}
+		if sortOrder == "asc" {
+			sort.SliceStable(mangas, func(i, j int) bool {
+				return views[mangas[i].Slug] < views[mangas[j].Slug]
+			})
+		} else {
+			sort.SliceStable(mangas, func(i, j int) bool {
+				return views[mangas[i].Slug] > views[mangas[j].Slug]
+			})
+		}
 	default:
 		// No sorting applied
 	}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// maxMangaCovers bounds the additional covers kept per manga, a long series can have a cover per volume
+const maxMangaCovers = 100
+
+// MangaCover is an additional cover of a manga, such as the cover of a volume, shown in a carousel after the
+// primary cover
+type MangaCover struct {
+	MangaSlug string `json:"manga_slug"`
+	URL       string `json:"url"`
+	// Order positions the cover in the carousel, lower orders come first
+	Order int `json:"order"`
+	// File is the image in the series folder the indexer found the cover in, empty for covers added by hand
+	File string `json:"file,omitempty"`
+	// Removed keeps a removed cover that was found by the indexer, so the next index doesn't add it back
+	Removed bool      `json:"removed,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// ImageURL returns the URL the cover is served at, covers in the image cache are served relative to the server
+func (c MangaCover) ImageURL() string {
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Host != "localhost:3000" {
+		return c.URL
+	}
+	return u.Path
+}
+
+func mangaCoverKey(mangaSlug, coverURL string) string {
+	return fmt.Sprintf("%s:%s", mangaSlug, coverURL)
+}
+
+// GetMangaCovers returns the additional covers of a manga in carousel order
+func GetMangaCovers(mangaSlug string) ([]MangaCover, error) {
+	covers, err := loadMangaCovers(mangaSlug)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(covers, func(cover MangaCover) bool { return cover.Removed }), nil
+}
+
+// loadMangaCovers returns every cover record of a manga in carousel order, including the removed ones
+func loadMangaCovers(mangaSlug string) ([]MangaCover, error) {
+	covers := []MangaCover{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("media_covers"))
+		for _, key := range keysWithPrefix(bucket, mangaSlug+":") {
+			var cover MangaCover
+			if err := json.Unmarshal(bucket.Get(key), &cover); err != nil {
+				return err
+			}
+			covers = append(covers, cover)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(covers, func(i, j int) bool {
+		return covers[i].Order < covers[j].Order
+	})
+	return covers, nil
+}
+
+// AddMangaCover adds a cover to the end of the carousel of a manga, file is the image the indexer found it in.
+// Adding a cover the manga already has does nothing, adding a removed cover by hand restores it.
+func AddMangaCover(mangaSlug, coverURL, file string) error {
+	if coverURL == "" {
+		return errors.New("cover URL is required")
+	}
+	if _, err := GetManga(mangaSlug); err != nil {
+		return err
+	}
+
+	covers, err := loadMangaCovers(mangaSlug)
+	if err != nil {
+		return err
+	}
+	order := 1
+	for _, cover := range covers {
+		if cover.URL == coverURL {
+			if !cover.Removed || file != "" {
+				return nil
+			}
+			cover.Removed = false
+			return update("media_covers", mangaCoverKey(mangaSlug, coverURL), cover)
+		}
+		order = max(order, cover.Order+1)
+	}
+	if len(covers) >= maxMangaCovers {
+		return fmt.Errorf("a manga can have at most %d additional covers", maxMangaCovers)
+	}
+
+	return create("media_covers", mangaCoverKey(mangaSlug, coverURL), MangaCover{
+		MangaSlug: mangaSlug,
+		URL:       coverURL,
+		Order:     order,
+		File:      file,
+		AddedAt:   time.Now(),
+	})
+}
+
+// RemoveMangaCover removes a cover from the carousel of a manga
+func RemoveMangaCover(mangaSlug, coverURL string) error {
+	var cover MangaCover
+	if err := get("media_covers", mangaCoverKey(mangaSlug, coverURL), &cover); err != nil {
+		return err
+	}
+	if cover.File == "" {
+		return delete("media_covers", mangaCoverKey(mangaSlug, coverURL))
+	}
+	cover.Removed = true
+	return update("media_covers", mangaCoverKey(mangaSlug, coverURL), cover)
+}
+
+// ReorderMangaCovers puts the covers of a manga in the given order, which must list each of its covers once
+func ReorderMangaCovers(mangaSlug string, coverURLs []string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("media_covers"))
+		covers := make(map[string]MangaCover)
+		for _, key := range keysWithPrefix(bucket, mangaSlug+":") {
+			var cover MangaCover
+			if err := json.Unmarshal(bucket.Get(key), &cover); err != nil {
+				return err
+			}
+			if !cover.Removed {
+				covers[cover.URL] = cover
+			}
+		}
+		if len(coverURLs) != len(covers) {
+			return errors.New("the new order must list every cover of the manga once")
+		}
+
+		seen := make(map[string]bool, len(coverURLs))
+		for i, coverURL := range coverURLs {
+			cover, ok := covers[coverURL]
+			if !ok || seen[coverURL] {
+				return errors.New("the new order must list every cover of the manga once")
+			}
+			seen[coverURL] = true
+			cover.Order = i + 1
+			if err := putJSON(bucket, mangaCoverKey(mangaSlug, coverURL), cover); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteMangaCoversByMangaSlug forgets the additional covers of a manga
+func DeleteMangaCoversByMangaSlug(mangaSlug string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("media_covers"))
+		for _, key := range keysWithPrefix(bucket, mangaSlug+":") {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexander-bruun/magi/utils"
+)
+
+// createLibrarySeries creates a series in the library that gets deleted and one in a library that stays, each with
+// the data of a reader
+func createLibrarySeries(t *testing.T) {
+	t.Helper()
+	for _, manga := range []Manga{
+		{Name: "Deleted", LibrarySlug: "deleted"},
+		{Name: "Kept", LibrarySlug: "kept"},
+	} {
+		if err := CreateManga(manga); err != nil {
+			t.Fatalf("failed to create '%s': %v", manga.Name, err)
+		}
+		if err := MarkChapterRead("reader", utils.Sluggify(manga.Name), "chapter-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeleteMangasByLibrarySlugDeletesReadingStates(t *testing.T) {
+	setupTestDB(t)
+	createLibrarySeries(t)
+	if err := DeleteMangasByLibrarySlug("deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := MangaExists("deleted"); exists {
+		t.Error("the series of the deleted library still exists")
+	}
+	if read, err := GetReadChapterSlugs("reader", "deleted"); err != nil || len(read) != 0 {
+		t.Errorf("got reading states %v (%v) for the deleted series, want none", read, err)
+	}
+	if read, err := GetReadChapterSlugs("reader", "kept"); err != nil || !read["chapter-1"] {
+		t.Errorf("got reading states %v (%v) for the series of another library, want them kept", read, err)
+	}
+}
+
+func TestDeleteMangasByLibrarySlugDeletesFavorites(t *testing.T) {
+	setupTestDB(t)
+	createLibrarySeries(t)
+	for _, slug := range []string{"deleted", "kept"} {
+		if err := AddFavorite("reader", slug); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := DeleteMangasByLibrarySlug("deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	if favorite, err := IsFavorite("reader", "deleted"); err != nil || favorite {
+		t.Errorf("the deleted series is still a favorite (%v)", err)
+	}
+	if favorite, err := IsFavorite("reader", "kept"); err != nil || !favorite {
+		t.Errorf("the series of another library is no longer a favorite (%v)", err)
+	}
+}
+
+func TestDeleteMangasByLibrarySlugDeletesOfflineChapters(t *testing.T) {
+	setupTestDB(t)
+	createLibrarySeries(t)
+	device, err := NewDeviceID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, slug := range []string{"deleted", "kept"} {
+		if err := CreateChapter(Chapter{Name: "Chapter 1", MangaSlug: slug}); err != nil {
+			t.Fatal(err)
+		}
+		if err := MarkChapterOffline("reader", device, slug, "chapter-1", time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := DeleteMangasByLibrarySlug("deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	chapters, err := GetOfflineChapters("reader", device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chapters) != 1 || chapters[0].MangaSlug != "kept" {
+		t.Errorf("got offline chapters %+v, want only the one of the series of another library", chapters)
+	}
+}
+
+func TestDeleteMangasByLibrarySlugDeletesCoverRepairs(t *testing.T) {
+	setupTestDB(t)
+	createLibrarySeries(t)
+	for _, slug := range []string{"deleted", "kept"} {
+		if _, err := RecordCoverRepairFailure(slug, errors.New("cover not found")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := DeleteMangasByLibrarySlug("deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	repairs, err := GetCoverRepairs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repairs["deleted"]; ok {
+		t.Error("the cover repair of the deleted series is still recorded")
+	}
+	if _, ok := repairs["kept"]; !ok {
+		t.Error("the cover repair of the series of another library was deleted")
+	}
+}
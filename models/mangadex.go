@@ -4,17 +4,50 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/alexander-bruun/magi/utils"
+	"github.com/gofiber/fiber/v2/log"
 )
 
 // API Base URL
 const baseURL = "https://api.mangadex.org"
 
+// ProviderUnavailableError reports a metadata provider that couldn't be reached or failed to answer. Unlike a search
+// without a match, the same request may succeed later.
+type ProviderUnavailableError struct {
+	Err error
+}
+
+func (e *ProviderUnavailableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProviderUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// IsProviderUnavailable reports whether a metadata lookup failed because the provider is down rather than because the
+// title has no match
+func IsProviderUnavailable(err error) bool {
+	var unavailable *ProviderUnavailableError
+	return errors.As(err, &unavailable)
+}
+
+// providerStatusError returns the error of a failed provider response, rate limits and server errors are temporary
+func providerStatusError(resp *http.Response) error {
+	err := fmt.Errorf("request failed with status: %s", resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return &ProviderUnavailableError{Err: err}
+	}
+	return err
+}
+
 // SingleMangaResponse represents the JSON response for a single manga
 type SingleMangaResponse struct {
 	Result   string      `json:"result"`
@@ -77,6 +110,42 @@ type Tag struct {
 	Relationships []interface{} `json:"relationships"`
 }
 
+// TagNames returns the english names of the tags of a manga, or nil if there is no match
+func (m *MangaDetail) TagNames() []string {
+	if m == nil {
+		return nil
+	}
+	var names []string
+	for _, tag := range m.Attributes.Tags {
+		if name := tag.Attributes.Name["en"]; name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// AliasNames returns the titles and alternative titles of a manga in every language other than the given name,
+// or nil if there is no match
+func (m *MangaDetail) AliasNames(name string) []string {
+	if m == nil {
+		return nil
+	}
+	var titles []string
+	for _, language := range slices.Sorted(maps.Keys(m.Attributes.Title)) {
+		titles = append(titles, m.Attributes.Title[language])
+	}
+	for _, altTitles := range m.Attributes.AltTitles {
+		for _, language := range slices.Sorted(maps.Keys(altTitles)) {
+			titles = append(titles, altTitles[language])
+		}
+	}
+	aliases := NormalizeAliases(name, titles)
+	if len(aliases) > maxAliases {
+		aliases = aliases[:maxAliases]
+	}
+	return aliases
+}
+
 // Relationship represents the relationship details in MangaDetail
 type Relationship struct {
 	ID         string      `json:"id"`
@@ -90,12 +159,12 @@ func GetMangadexManga(id string) (*MangaDetail, error) {
 
 	resp, err := http.Get(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch manga details: %w", err)
+		return nil, &ProviderUnavailableError{Err: fmt.Errorf("failed to fetch manga details: %w", err)}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request failed with status: %s", resp.Status)
+		return nil, providerStatusError(resp)
 	}
 
 	var mangaResponse SingleMangaResponse
@@ -117,12 +186,12 @@ func GetMangadexMangas(title string) (*ListMangaResponse, error) {
 
 	resp, err := http.Get(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search for mangas: %w", err)
+		return nil, &ProviderUnavailableError{Err: fmt.Errorf("failed to search for mangas: %w", err)}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request failed with status: %s", resp.Status)
+		return nil, providerStatusError(resp)
 	}
 
 	var mangaResponse ListMangaResponse
@@ -148,7 +217,12 @@ func GetBestMatchMangadexManga(title string) (*MangaDetail, error) {
 		return nil, err
 	}
 
-	bestMatch, err := findBestMatch(mangaResponse.Data, title)
+	config, err := GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+
+	bestMatch, err := findBestMatch(mangaResponse.Data, title, float64(config.MetadataMatchThreshold)/100)
 	if err != nil {
 		return nil, err
 	}
@@ -156,32 +230,42 @@ func GetBestMatchMangadexManga(title string) (*MangaDetail, error) {
 	return bestMatch, nil
 }
 
-// findBestMatch identifies the manga with the highest similarity to the original title
-func findBestMatch(mangas []MangaDetail, originalTitle string) (*MangaDetail, error) {
+// findBestMatch identifies the manga with the highest similarity to the original title, requiring at least the
+// threshold. A best match below the threshold is reported as a LowConfidenceMatchError holding the best candidates.
+func findBestMatch(mangas []MangaDetail, originalTitle string, threshold float64) (*MangaDetail, error) {
 	originalTitleLower := strings.ToLower(originalTitle)
 	var bestMatch *MangaDetail
 	highestScore := 0.0
+	scores := make([]float64, len(mangas))
 
-	for _, manga := range mangas {
+	for i, manga := range mangas {
 		mangaTitle := extractTitle(manga.Attributes)
 		if mangaTitle == "" {
 			continue
 		}
 
-		similarityScore := utils.CompareStrings(originalTitleLower, strings.ToLower(mangaTitle))
-		if similarityScore > highestScore {
-			highestScore = similarityScore
-			bestMatch = &manga
+		scores[i] = utils.CompareStrings(originalTitleLower, strings.ToLower(mangaTitle))
+		if scores[i] > highestScore {
+			highestScore = scores[i]
+			bestMatch = &mangas[i]
 		}
 	}
 
 	if bestMatch == nil {
 		return nil, errors.New("no suitable match found")
 	}
+	if highestScore < threshold {
+		return nil, &LowConfidenceMatchError{Candidates: metadataCandidates(mangas, scores)}
+	}
 
 	return bestMatch, nil
 }
 
+// MatchTitle returns the title the result was matched by
+func (m *MangaDetail) MatchTitle() string {
+	return extractTitle(m.Attributes)
+}
+
 // extractTitle determines the best title to use for similarity comparison
 func extractTitle(attributes MangaAttributes) string {
 	if title, ok := attributes.Title["en"]; ok && title != "" {
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// mediaViewDedupeWindow is how long repeated views of a manga from the same session count once
+	mediaViewDedupeWindow = 30 * time.Minute
+	// mediaViewFlushInterval is how often the pending views are written, in a single transaction
+	mediaViewFlushInterval = 30 * time.Second
+)
+
+// mediaViews counts the views of manga pages in memory, they are deduplicated per session and written in batches so
+// opening a manga page never waits on a write
+var mediaViews = struct {
+	sync.Mutex
+	seen    map[string]time.Time // Last counted view per manga and session
+	pending map[string]int       // Views not written yet per manga
+	start   sync.Once
+}{
+	seen:    make(map[string]time.Time),
+	pending: make(map[string]int),
+}
+
+// IncrementMediaView counts a view of a manga page, unless the session viewed it within the dedupe window. It
+// reports whether the view was counted.
+func IncrementMediaView(slug, sessionID string) bool {
+	mediaViews.start.Do(func() {
+		go func() {
+			for range time.Tick(mediaViewFlushInterval) {
+				FlushMediaViews()
+			}
+		}()
+	})
+
+	now := time.Now()
+	key := slug + "|" + sessionID
+
+	mediaViews.Lock()
+	defer mediaViews.Unlock()
+	if last, ok := mediaViews.seen[key]; ok && now.Sub(last) < mediaViewDedupeWindow {
+		return false
+	}
+	mediaViews.seen[key] = now
+	mediaViews.pending[slug]++
+	return true
+}
+
+// FlushMediaViews writes the pending views and forgets the sessions whose dedupe window is over, views that fail to
+// be written are kept for the next flush
+func FlushMediaViews() {
+	mediaViews.Lock()
+	pending := mediaViews.pending
+	mediaViews.pending = make(map[string]int)
+	seen := make(map[string]time.Time, len(mediaViews.seen))
+	for key, last := range mediaViews.seen {
+		if time.Since(last) < mediaViewDedupeWindow {
+			seen[key] = last
+		}
+	}
+	mediaViews.seen = seen
+	mediaViews.Unlock()
+
+	if len(pending) == 0 || db == nil {
+		return
+	}
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("media_views"))
+		for slug, views := range pending {
+			var count int
+			if data := bucket.Get([]byte(slug)); data != nil {
+				if err := json.Unmarshal(data, &count); err != nil {
+					return err
+				}
+			}
+			data, err := json.Marshal(count + views)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(slug), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Failed to write media views: %v", err)
+		mediaViews.Lock()
+		for slug, views := range pending {
+			mediaViews.pending[slug] += views
+		}
+		mediaViews.Unlock()
+	}
+}
+
+// GetMediaViews returns the number of views of a manga page, including the ones not written yet
+func GetMediaViews(slug string) (int, error) {
+	views, err := GetAllMediaViews()
+	if err != nil {
+		return 0, err
+	}
+	return views[slug], nil
+}
+
+// GetAllMediaViews returns the number of views of every viewed manga page, including the ones not written yet
+func GetAllMediaViews() (map[string]int, error) {
+	views := make(map[string]int)
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("media_views")).ForEach(func(k, v []byte) error {
+			var count int
+			if err := json.Unmarshal(v, &count); err != nil {
+				return err
+			}
+			views[string(k)] = count
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mediaViews.Lock()
+	defer mediaViews.Unlock()
+	for slug, pending := range mediaViews.pending {
+		views[slug] += pending
+	}
+	return views, nil
+}
+
+// DeleteMediaViews forgets the views of a manga
+func DeleteMediaViews(slug string) error {
+	mediaViews.Lock()
+	pending := make(map[string]int, len(mediaViews.pending))
+	for pendingSlug, views := range mediaViews.pending {
+		if pendingSlug != slug {
+			pending[pendingSlug] = views
+		}
+	}
+	mediaViews.pending = pending
+	mediaViews.Unlock()
+	return delete("media_views", slug)
+}
+
+// IsBotUserAgent reports whether a user agent matches one of the patterns, one case insensitive substring per line.
+// Requests without a user agent are treated as bots.
+func IsBotUserAgent(userAgent, patterns string) bool {
+	if strings.TrimSpace(userAgent) == "" {
+		return true
+	}
+	userAgent = strings.ToLower(userAgent)
+	for _, pattern := range strings.Split(patterns, "\n") {
+		if pattern = strings.ToLower(strings.TrimSpace(pattern)); pattern != "" && strings.Contains(userAgent, pattern) {
+			return true
+		}
+	}
+	return false
+}
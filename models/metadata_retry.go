@@ -0,0 +1,93 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Backoff between the metadata retries of a manga, doubling from the base up to the cap
+const (
+	metadataRetryBaseBackoff = 30 * time.Minute
+	metadataRetryMaxBackoff  = 24 * time.Hour
+)
+
+// MetadataRetry marks a manga indexed with local metadata because the metadata provider was down, its metadata is
+// pending until a retry reaches the provider
+type MetadataRetry struct {
+	MangaSlug string `json:"manga_slug"`
+	// Title is the title the metadata is searched by
+	Title       string    `json:"title"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"last_attempt"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error"`
+}
+
+// Due reports whether the metadata may be retried, retries stop once maxAttempts is reached
+func (r MetadataRetry) Due(now time.Time, maxAttempts int) bool {
+	return r.Attempts < maxAttempts && !now.Before(r.NextAttempt)
+}
+
+// QueueMetadataRetry marks the metadata of a manga as pending after the provider failed to answer, the first retry is
+// due after the base backoff
+func QueueMetadataRetry(mangaSlug, title string, cause error) error {
+	now := time.Now()
+	return create("metadata_retries", mangaSlug, MetadataRetry{
+		MangaSlug:   mangaSlug,
+		Title:       title,
+		LastAttempt: now,
+		NextAttempt: now.Add(metadataRetryBaseBackoff),
+		LastError:   cause.Error(),
+	})
+}
+
+// GetMetadataRetries returns the mangas whose metadata is pending
+func GetMetadataRetries() ([]MetadataRetry, error) {
+	retries := []MetadataRetry{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("metadata_retries")).ForEach(func(_, v []byte) error {
+			var retry MetadataRetry
+			if err := json.Unmarshal(v, &retry); err != nil {
+				return err
+			}
+			retries = append(retries, retry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return retries, nil
+}
+
+// RecordMetadataRetryFailure counts a retry that found the provider still down and schedules the next one with
+// exponential backoff
+func RecordMetadataRetryFailure(mangaSlug string, cause error) (MetadataRetry, error) {
+	retry := MetadataRetry{MangaSlug: mangaSlug}
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("metadata_retries"))
+		if data := bucket.Get([]byte(mangaSlug)); data != nil {
+			if err := json.Unmarshal(data, &retry); err != nil {
+				return err
+			}
+		}
+
+		backoff := metadataRetryBaseBackoff << (retry.Attempts + 1)
+		if backoff <= 0 || backoff > metadataRetryMaxBackoff {
+			backoff = metadataRetryMaxBackoff
+		}
+		retry.Attempts++
+		retry.LastAttempt = time.Now()
+		retry.NextAttempt = retry.LastAttempt.Add(backoff)
+		retry.LastError = cause.Error()
+		return putJSON(bucket, mangaSlug, retry)
+	})
+	return retry, err
+}
+
+// DeleteMetadataRetry clears the pending metadata marker of a manga
+func DeleteMetadataRetry(mangaSlug string) error {
+	return delete("metadata_retries", mangaSlug)
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// maxMetadataCandidates is how many MangaDex results are kept for an admin to pick from
+const maxMetadataCandidates = 5
+
+// MetadataCandidate is a MangaDex result offered for a manga awaiting metadata review
+type MetadataCandidate struct {
+	ID            string  `json:"id"`
+	Title         string  `json:"title"`
+	Score         float64 `json:"score"` // Title similarity between 0 and 1
+	Year          int     `json:"year,omitempty"`
+	Status        string  `json:"status,omitempty"`
+	ContentRating string  `json:"content_rating,omitempty"`
+}
+
+// URL returns the MangaDex page of the candidate
+func (c MetadataCandidate) URL() string {
+	return fmt.Sprintf("https://mangadex.org/title/%s", c.ID)
+}
+
+// LowConfidenceMatchError is returned when no MangaDex result is similar enough to a title to be used, it carries the
+// best results so they can be reviewed
+type LowConfidenceMatchError struct {
+	Candidates []MetadataCandidate
+}
+
+func (e *LowConfidenceMatchError) Error() string {
+	best := e.Candidates[0]
+	return fmt.Sprintf("best match '%s' is only %.0f%% similar", best.Title, best.Score*100)
+}
+
+// MetadataReview is a manga indexed with local metadata because its MangaDex match wasn't confident enough
+type MetadataReview struct {
+	MangaSlug  string              `json:"manga_slug"`
+	Title      string              `json:"title"`
+	Candidates []MetadataCandidate `json:"candidates"`
+	QueuedAt   time.Time           `json:"queued_at"`
+}
+
+// QueueMetadataReview adds a manga to the metadata review queue, replacing its previous candidates
+func QueueMetadataReview(mangaSlug, title string, candidates []MetadataCandidate) error {
+	return create("metadata_reviews", mangaSlug, MetadataReview{
+		MangaSlug:  mangaSlug,
+		Title:      title,
+		Candidates: candidates,
+		QueuedAt:   time.Now(),
+	})
+}
+
+// GetMetadataReview returns the pending review of a manga
+func GetMetadataReview(mangaSlug string) (MetadataReview, error) {
+	var review MetadataReview
+	if err := get("metadata_reviews", mangaSlug, &review); err != nil {
+		return MetadataReview{}, fmt.Errorf("'%s' is not awaiting metadata review", mangaSlug)
+	}
+	return review, nil
+}
+
+// GetMetadataReviews returns the mangas awaiting metadata review, oldest first
+func GetMetadataReviews() ([]MetadataReview, error) {
+	reviews := []MetadataReview{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("metadata_reviews")).ForEach(func(_, v []byte) error {
+			var review MetadataReview
+			if err := json.Unmarshal(v, &review); err != nil {
+				return err
+			}
+			reviews = append(reviews, review)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(reviews, func(i, j int) bool { return reviews[i].QueuedAt.Before(reviews[j].QueuedAt) })
+	return reviews, nil
+}
+
+// DeleteMetadataReview removes a manga from the metadata review queue
+func DeleteMetadataReview(mangaSlug string) error {
+	return delete("metadata_reviews", mangaSlug)
+}
+
+// metadataCandidates ranks MangaDex results by their similarity to a title, best first
+func metadataCandidates(mangas []MangaDetail, scores []float64) []MetadataCandidate {
+	candidates := make([]MetadataCandidate, 0, len(mangas))
+	for i, manga := range mangas {
+		title := extractTitle(manga.Attributes)
+		if title == "" {
+			continue
+		}
+		candidates = append(candidates, MetadataCandidate{
+			ID:            manga.ID,
+			Title:         title,
+			Score:         scores[i],
+			Year:          manga.Attributes.Year,
+			Status:        manga.Attributes.Status,
+			ContentRating: manga.Attributes.ContentRating,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	if len(candidates) > maxMetadataCandidates {
+		candidates = candidates[:maxMetadataCandidates]
+	}
+	return candidates
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/alexander-bruun/magi/utils"
+	"github.com/gofiber/fiber/v2/log"
+	"go.etcd.io/bbolt"
+)
+
+type migration struct {
+	Version     int
+	Description string
+	Apply       func() error
+}
+
+// migrations lists every data migration in the order they must be applied
+var migrations = []migration{
+	{Version: 1, Description: "Backfill chapter page counts", Apply: backfillChapterPageCounts},
+	{Version: 2, Description: "Enable image folder chapters", Apply: enableFolderChapterFormat},
+}
+
+// Migrate applies all pending migrations and records the resulting schema version
+func Migrate() error {
+	start := time.Now()
+	defer utils.LogDuration("Migrate", start)
+
+	current, err := GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		log.Infof("Applying migration %d: %s", m.Version, m.Description)
+		if err := m.Apply(); err != nil {
+			return fmt.Errorf("migration %d failed: %w", m.Version, err)
+		}
+		if err := setSchemaVersion(m.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrationInfo describes a data migration without applying it
+type MigrationInfo struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+}
+
+// PendingMigrations returns the current schema version and the migrations that Migrate would apply, without writing anything
+func PendingMigrations() (int, []MigrationInfo, error) {
+	current, err := GetSchemaVersion()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	pending := []MigrationInfo{}
+	for _, m := range migrations {
+		if m.Version > current {
+			pending = append(pending, MigrationInfo{Version: m.Version, Description: m.Description})
+		}
+	}
+	return current, pending, nil
+}
+
+// LatestSchemaVersion returns the schema version after applying every known migration
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// GetSchemaVersion returns the version of the last applied migration
+func GetSchemaVersion() (int, error) {
+	var version int
+	err := db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte("schema")).Get([]byte("version"))
+		if v == nil {
+			return nil
+		}
+		var err error
+		version, err = strconv.Atoi(string(v))
+		return err
+	})
+	return version, err
+}
+
+func setSchemaVersion(version int) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("schema")).Put([]byte("version"), []byte(strconv.Itoa(version)))
+	})
+}
+
+// backfillChapterPageCounts counts the pages of every chapter indexed before page counts were stored
+func backfillChapterPageCounts() error {
+	var mangas []Manga
+	if err := loadAllMangas(&mangas); err != nil {
+		return err
+	}
+
+	mangaPaths := make(map[string]string)
+	for _, manga := range mangas {
+		mangaPaths[manga.Slug] = manga.Path
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("chapters"))
+		updated := make(map[string][]byte)
+
+		err := bucket.ForEach(func(k, v []byte) error {
+			var chapter Chapter
+			if err := json.Unmarshal(v, &chapter); err != nil {
+				return err
+			}
+
+			mangaPath, ok := mangaPaths[chapter.MangaSlug]
+			if !ok || chapter.PageCount > 0 {
+				return nil
+			}
+
+			pageCount, err := utils.CountImageFiles(filepath.Join(mangaPath, chapter.File))
+			if err != nil {
+				log.Debugf("Failed to count pages for chapter '%s': %s", string(k), err)
+				return nil
+			}
+
+			chapter.PageCount = pageCount
+			encoded, err := json.Marshal(chapter)
+			if err != nil {
+				return err
+			}
+			updated[string(k)] = encoded
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Keys can't be modified while iterating the bucket
+		for k, v := range updated {
+			if err := bucket.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// enableFolderChapterFormat adds image folders to the chapter formats of configurations stored before they were supported
+func enableFolderChapterFormat() error {
+	exists, err := exists("config", "app_config")
+	if err != nil || !exists {
+		return err
+	}
+
+	config, err := GetAppConfig()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(config.ChapterFormats, "folder") {
+		return nil
+	}
+	config.ChapterFormats = append(config.ChapterFormats, "folder")
+	return updateBucket("config", "app_config", config)
+}
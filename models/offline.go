@@ -0,0 +1,112 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// OfflineChapter records that a device of a user keeps a chapter for offline reading, the pages themselves
+// only live in the cache of the device
+type OfflineChapter struct {
+	Username    string    `json:"username"`
+	Device      string    `json:"device"`
+	MangaSlug   string    `json:"manga_slug"`
+	ChapterSlug string    `json:"chapter_slug"`
+	MarkedAt    time.Time `json:"marked_at"`
+	Expires     time.Time `json:"expires"`
+}
+
+// ErrInvalidDevice is returned for a device ID that was not issued by NewDeviceID
+var ErrInvalidDevice = errors.New("invalid device")
+
+var deviceIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// NewDeviceID generates the random ID a device keeps its offline chapters under
+func NewDeviceID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// MarkChapterOffline records a chapter as available offline on a device until the marker expires with the session
+func MarkChapterOffline(username, device, mangaSlug, chapterSlug string, expires time.Time) error {
+	if !deviceIDPattern.MatchString(device) {
+		return ErrInvalidDevice
+	}
+	if exists, err := ChapterExists(chapterSlug, mangaSlug); err != nil {
+		return err
+	} else if !exists {
+		return errors.New("chapter not found")
+	}
+
+	return create("offline_chapters", offlineChapterKey(username, device, mangaSlug, chapterSlug), OfflineChapter{
+		Username:    username,
+		Device:      device,
+		MangaSlug:   mangaSlug,
+		ChapterSlug: chapterSlug,
+		MarkedAt:    time.Now(),
+		Expires:     expires,
+	})
+}
+
+// UnmarkChapterOffline removes the offline marker of a chapter on a device
+func UnmarkChapterOffline(username, device, mangaSlug, chapterSlug string) error {
+	return delete("offline_chapters", offlineChapterKey(username, device, mangaSlug, chapterSlug))
+}
+
+// GetOfflineChapters returns the chapters a device of a user keeps offline, dropping the expired markers
+func GetOfflineChapters(username, device string) ([]OfflineChapter, error) {
+	chapters := []OfflineChapter{}
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("offline_chapters"))
+		now := time.Now()
+		for _, key := range keysWithPrefix(bucket, fmt.Sprintf("%s:%s:", username, device)) {
+			var chapter OfflineChapter
+			if err := json.Unmarshal(bucket.Get(key), &chapter); err != nil {
+				return err
+			}
+			if now.After(chapter.Expires) {
+				if err := bucket.Delete(key); err != nil {
+					return err
+				}
+				continue
+			}
+			chapters = append(chapters, chapter)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chapters, nil
+}
+
+// ClearOfflineChapters removes the offline markers of a device of a user, an empty device clears every device
+func ClearOfflineChapters(username, device string) error {
+	prefix := username + ":"
+	if device != "" {
+		prefix = fmt.Sprintf("%s:%s:", username, device)
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		return deleteKeysWithPrefix(tx.Bucket([]byte("offline_chapters")), prefix)
+	})
+}
+
+// DeleteOfflineChaptersByMangaSlug removes the offline markers of every chapter of a manga
+func DeleteOfflineChaptersByMangaSlug(mangaSlug string) error {
+	return deleteKeysWithPattern("offline_chapters", fmt.Sprintf("*:*:%s:*", mangaSlug))
+}
+
+func offlineChapterKey(username, device, mangaSlug, chapterSlug string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", username, device, mangaSlug, chapterSlug)
+}
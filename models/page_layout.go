@@ -0,0 +1,26 @@
+package models
+
+// Layouts the reader can request the pages of a chapter in
+const (
+	PageLayoutSingle   = "single"
+	PageLayoutDouble   = "double"
+	PageLayoutVertical = "vertical"
+)
+
+// PageLayouts lists the valid page layouts
+var PageLayouts = []string{PageLayoutSingle, PageLayoutDouble, PageLayoutVertical}
+
+// PageGroups splits the pages of a chapter into the groups shown together, as 1-based page numbers. The double
+// page layout shows the cover alone and pairs the pages after it, the other layouts show one page per group.
+func PageGroups(pageCount int, layout string) [][]int {
+	groups := make([][]int, 0, pageCount)
+	for page := 1; page <= pageCount; page++ {
+		if layout == PageLayoutDouble && page > 1 && page < pageCount {
+			groups = append(groups, []int{page, page + 1})
+			page++
+			continue
+		}
+		groups = append(groups, []int{page})
+	}
+	return groups
+}
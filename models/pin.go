@@ -0,0 +1,42 @@
+package models
+
+import (
+	"errors"
+	"sort"
+)
+
+// SetMangaPin pins a manga to the top of the listing of its library, lower pin orders come first
+func SetMangaPin(slug string, order int) error {
+	if order < 1 {
+		return errors.New("pin order must be at least 1")
+	}
+	manga, err := GetManga(slug)
+	if err != nil {
+		return err
+	}
+	manga.PinOrder = &order
+	return UpdateManga(manga)
+}
+
+// ClearMangaPin returns a pinned manga to its place in the chosen sort
+func ClearMangaPin(slug string) error {
+	manga, err := GetManga(slug)
+	if err != nil {
+		return err
+	}
+	manga.PinOrder = nil
+	return UpdateManga(manga)
+}
+
+// pinnedFirst moves the pinned mangas ahead of the rest in pin order, keeping the sort of the others
+func pinnedFirst(mangas []Manga) {
+	sort.SliceStable(mangas, func(i, j int) bool {
+		if mangas[i].PinOrder == nil {
+			return false
+		}
+		if mangas[j].PinOrder == nil {
+			return true
+		}
+		return *mangas[i].PinOrder < *mangas[j].PinOrder
+	})
+}
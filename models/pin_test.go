@@ -0,0 +1,70 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPinnedMangasLeadTheirLibrary(t *testing.T) {
+	setupTestDB(t)
+	for _, manga := range []Manga{
+		{Name: "Alpha", LibrarySlug: "first", ContentRating: "safe"},
+		{Name: "Bravo", LibrarySlug: "first", ContentRating: "safe"},
+		{Name: "Charlie", LibrarySlug: "first", ContentRating: "safe"},
+		{Name: "Delta", LibrarySlug: "first", ContentRating: "safe"},
+		{Name: "Echo", LibrarySlug: "second", ContentRating: "safe"},
+	} {
+		if err := CreateManga(manga); err != nil {
+			t.Fatalf("failed to create '%s': %v", manga.Name, err)
+		}
+	}
+	if err := SetMangaPin("delta", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMangaPin("charlie", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMangaPin("alpha", 0); err == nil {
+		t.Error("pinning at 0 succeeded, want an error")
+	}
+
+	search := func(librarySlug, sortOrder string) []string {
+		t.Helper()
+		mangas, _, err := SearchMangas("", 1, 10, "name", sortOrder, "", librarySlug, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var slugs []string
+		for _, manga := range mangas {
+			slugs = append(slugs, manga.Slug)
+		}
+		return slugs
+	}
+
+	// Pinned mangas lead in pin order whatever the sort, the others follow the sort
+	if got, want := search("first", "asc"), []string{"delta", "charlie", "alpha", "bravo"}; !slices.Equal(got, want) {
+		t.Errorf("sorted by name got %v, want %v", got, want)
+	}
+	if got, want := search("first", "desc"), []string{"delta", "charlie", "bravo", "alpha"}; !slices.Equal(got, want) {
+		t.Errorf("sorted by name descending got %v, want %v", got, want)
+	}
+	// Pins are scoped to a library, listings across libraries ignore them
+	if got, want := search("", "asc"), []string{"alpha", "bravo", "charlie", "delta", "echo"}; !slices.Equal(got, want) {
+		t.Errorf("across libraries got %v, want %v", got, want)
+	}
+
+	prev, next, err := GetAdjacentMangas("charlie", "first", "name", "asc", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev == nil || prev.Slug != "delta" || next == nil || next.Slug != "alpha" {
+		t.Errorf("got %v and %v around 'charlie', want 'delta' and 'alpha'", prev, next)
+	}
+
+	if err := ClearMangaPin("delta"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := search("first", "asc"), []string{"charlie", "alpha", "bravo", "delta"}; !slices.Equal(got, want) {
+		t.Errorf("after unpinning got %v, want %v", got, want)
+	}
+}
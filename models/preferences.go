@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+)
+
+// UserPreferences holds the listing defaults of a user, used when a request doesn't override them, and reading options
+type UserPreferences struct {
+	SortBy    string `json:"sort_by" form:"sort_by"`
+	SortOrder string `json:"sort_order" form:"sort_order"`
+	PageSize  int    `json:"page_size" form:"page_size"`
+	View      string `json:"view" form:"view"`
+
+	HideReadChapters bool   `json:"hide_read_chapters" form:"hide_read_chapters"`
+	ChapterOrder     string `json:"chapter_order,omitempty" form:"chapter_order"`
+}
+
+// MangaSortKeys lists the keys mangas can be sorted by
+var MangaSortKeys = []string{"name", "created_at", "updated_at", "views"}
+
+// SortOrders lists the supported sort orders
+var SortOrders = []string{"asc", "desc"}
+
+// PageSizes lists the supported page sizes of the manga listing
+var PageSizes = []int{16, 32, 48}
+
+// ListingViews lists the supported ways of displaying the manga listing
+var ListingViews = []string{"grid", "list"}
+
+// DefaultUserPreferences returns the server defaults, also used for anonymous users
+func DefaultUserPreferences() UserPreferences {
+	return UserPreferences{
+		SortBy:    "name",
+		SortOrder: "asc",
+		PageSize:  PageSizes[0],
+		View:      "grid",
+	}
+}
+
+// Validate checks if the UserPreferences has valid values
+func (p *UserPreferences) Validate() error {
+	if !slices.Contains(MangaSortKeys, p.SortBy) {
+		return fmt.Errorf("invalid sort key: %s", p.SortBy)
+	}
+	if !slices.Contains(SortOrders, p.SortOrder) {
+		return fmt.Errorf("invalid sort order: %s", p.SortOrder)
+	}
+	if !slices.Contains(PageSizes, p.PageSize) {
+		return fmt.Errorf("invalid page size: %d", p.PageSize)
+	}
+	if !slices.Contains(ListingViews, p.View) {
+		return fmt.Errorf("invalid view: %s", p.View)
+	}
+	if p.ChapterOrder != "" && !slices.Contains(ChapterOrders, p.ChapterOrder) {
+		return fmt.Errorf("invalid chapter order: %s", p.ChapterOrder)
+	}
+	return nil
+}
+
+// GetUserPreferences returns the preferences of a user, falling back to the defaults for anonymous users
+func GetUserPreferences(username string) (UserPreferences, error) {
+	if username == "" {
+		return DefaultUserPreferences(), nil
+	}
+
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return DefaultUserPreferences(), err
+	}
+	if user.Preferences == nil {
+		return DefaultUserPreferences(), nil
+	}
+	return *user.Preferences, nil
+}
+
+// UpdateUserPreferences validates and stores the preferences of a user
+func UpdateUserPreferences(username string, preferences *UserPreferences) error {
+	if err := preferences.Validate(); err != nil {
+		return err
+	}
+
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	user.Preferences = preferences
+	return update("users", username, user)
+}
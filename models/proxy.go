@@ -0,0 +1,66 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Headers a trusted reverse proxy can pass the client IP in
+const (
+	ClientIPHeaderForwardedFor = "X-Forwarded-For"
+	ClientIPHeaderRealIP       = "X-Real-IP"
+)
+
+// ClientIPHeaders lists the supported client IP headers
+var ClientIPHeaders = []string{ClientIPHeaderForwardedFor, ClientIPHeaderRealIP}
+
+// ParseTrustedProxies parses CIDRs separated by commas or new lines, a plain IP is trusted on its own
+func ParseTrustedProxies(proxies string) ([]*net.IPNet, error) {
+	return parseNetworks(proxies, "trusted proxy")
+}
+
+// ParseRateLimitExemptions parses the networks exempt from rate limiting, in the format of ParseTrustedProxies
+func ParseRateLimitExemptions(exemptions string) ([]*net.IPNet, error) {
+	return parseNetworks(exemptions, "rate limit exemption")
+}
+
+func parseNetworks(networks, kind string) ([]*net.IPNet, error) {
+	var parsed []*net.IPNet
+	for _, entry := range strings.FieldsFunc(networks, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid %s: %s", kind, entry)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			parsed = append(parsed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", kind, entry)
+		}
+		parsed = append(parsed, network)
+	}
+	return parsed, nil
+}
+
+// InNetworks reports whether an IP is within one of the networks
+func InNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
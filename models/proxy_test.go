@@ -0,0 +1,33 @@
+package models
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	networks, err := ParseTrustedProxies("10.0.0.0/8,\n 192.168.1.1 \n\n::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(networks) != 3 {
+		t.Fatalf("got %d networks, want 3", len(networks))
+	}
+	for ip, want := range map[string]bool{
+		"10.20.30.40": true,
+		"192.168.1.1": true,
+		"192.168.1.2": false, // a plain IP is trusted on its own, not its network
+		"::1":         true,
+		"11.0.0.1":    false,
+	} {
+		if got := InNetworks(net.ParseIP(ip), networks); got != want {
+			t.Errorf("InNetworks(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	for _, invalid := range []string{"10.0.0.0/33", "proxy.local", "10.0.0"} {
+		if _, err := ParseTrustedProxies(invalid); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded, want an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"unicode"
+)
+
+// Ways the reader fits a page into the viewport
+const (
+	FitModeWidth    = "width"
+	FitModeHeight   = "height"
+	FitModeOriginal = "original"
+)
+
+// FitModes lists the valid fit modes
+var FitModes = []string{FitModeWidth, FitModeHeight, FitModeOriginal}
+
+// ReaderBackgrounds lists the background colors the reader can be shown on
+var ReaderBackgrounds = []string{"default", "black", "gray", "white"}
+
+// Bounds of the spacing around and between pages, in pixels
+const (
+	maxReaderMargin = 200
+	maxReaderGap    = 100
+)
+
+// Sides of the reader a tap turns to the next page on, the other side turns back
+const (
+	TapSideLeft  = "left"
+	TapSideRight = "right"
+	TapSideNone  = "none"
+)
+
+// TapSides lists the valid tap sides
+var TapSides = []string{TapSideLeft, TapSideRight, TapSideNone}
+
+// Actions the reader can run on a double tap
+const (
+	ReaderActionNone            = "none"
+	ReaderActionToggleFit       = "toggle_fit"
+	ReaderActionNextChapter     = "next_chapter"
+	ReaderActionPreviousChapter = "previous_chapter"
+)
+
+// ReaderActions lists the valid double tap actions
+var ReaderActions = []string{ReaderActionNone, ReaderActionToggleFit, ReaderActionNextChapter, ReaderActionPreviousChapter}
+
+// ReaderKeys lists the named keys that can turn pages, along with any single letter or digit
+var ReaderKeys = []string{"ArrowLeft", "ArrowRight", "ArrowUp", "ArrowDown", "PageUp", "PageDown", "Home", "End", "Enter", "Backspace", " "}
+
+// ReaderPreferences holds how the reader lays out pages for a user, kept apart from the listing preferences so
+// saving one form doesn't reset the other. Empty controls follow the reading mode, see Controls.
+type ReaderPreferences struct {
+	FitMode         string `json:"fit_mode" form:"fit_mode"`
+	Margin          int    `json:"margin" form:"margin"`
+	Background      string `json:"background" form:"background"`
+	Gap             int    `json:"gap" form:"gap"`
+	NextPageKey     string `json:"next_page_key,omitempty" form:"next_page_key"`
+	PreviousPageKey string `json:"previous_page_key,omitempty" form:"previous_page_key"`
+	TapNextSide     string `json:"tap_next_side,omitempty" form:"tap_next_side"`
+	DoubleTapAction string `json:"double_tap_action,omitempty" form:"double_tap_action"`
+}
+
+// ReaderControls are the key and tap bindings the reader applies for a reading mode
+type ReaderControls struct {
+	NextPageKey     string `json:"next_page_key"`
+	PreviousPageKey string `json:"previous_page_key"`
+	TapNextSide     string `json:"tap_next_side"`
+	DoubleTapAction string `json:"double_tap_action"`
+}
+
+// DefaultReaderControls returns the bindings of a reading mode, right to left turns forward with the left arrow and
+// the left side, vertical scrolls a screen with the page keys and leaves taps to the browser
+func DefaultReaderControls(readingMode string) ReaderControls {
+	switch readingMode {
+	case ReadingModeRTL:
+		return ReaderControls{"ArrowLeft", "ArrowRight", TapSideLeft, ReaderActionNone}
+	case ReadingModeVertical:
+		return ReaderControls{"PageDown", "PageUp", TapSideNone, ReaderActionNone}
+	default:
+		return ReaderControls{"ArrowRight", "ArrowLeft", TapSideRight, ReaderActionNone}
+	}
+}
+
+// Controls returns the bindings the reader applies for a reading mode, the ones the user didn't customize come from
+// the defaults of the mode
+func (p ReaderPreferences) Controls(readingMode string) ReaderControls {
+	defaults := DefaultReaderControls(readingMode)
+	controls := defaults
+	if p.NextPageKey != "" {
+		controls.NextPageKey = p.NextPageKey
+	}
+	if p.PreviousPageKey != "" {
+		controls.PreviousPageKey = p.PreviousPageKey
+	}
+	// A single customized key taking the default of the other one swaps them, so both keys keep working
+	if controls.NextPageKey == controls.PreviousPageKey {
+		if p.PreviousPageKey == "" {
+			controls.PreviousPageKey = defaults.NextPageKey
+		} else {
+			controls.NextPageKey = defaults.PreviousPageKey
+		}
+	}
+	if p.TapNextSide != "" {
+		controls.TapNextSide = p.TapNextSide
+	}
+	if p.DoubleTapAction != "" {
+		controls.DoubleTapAction = p.DoubleTapAction
+	}
+	return controls
+}
+
+// DefaultReaderPreferences returns the reader defaults, also used for anonymous users
+func DefaultReaderPreferences() ReaderPreferences {
+	return ReaderPreferences{
+		FitMode:    FitModeWidth,
+		Background: ReaderBackgrounds[0],
+	}
+}
+
+// Validate checks if the ReaderPreferences has valid values
+func (p *ReaderPreferences) Validate() error {
+	if !slices.Contains(FitModes, p.FitMode) {
+		return fmt.Errorf("invalid fit mode: %s", p.FitMode)
+	}
+	if !slices.Contains(ReaderBackgrounds, p.Background) {
+		return fmt.Errorf("invalid background: %s", p.Background)
+	}
+	if p.Margin < 0 || p.Margin > maxReaderMargin {
+		return fmt.Errorf("margin must be between 0 and %d pixels", maxReaderMargin)
+	}
+	if p.Gap < 0 || p.Gap > maxReaderGap {
+		return fmt.Errorf("gap must be between 0 and %d pixels", maxReaderGap)
+	}
+	for _, key := range []string{p.NextPageKey, p.PreviousPageKey} {
+		if key != "" && !isReaderKey(key) {
+			return fmt.Errorf("invalid reader key: %q", key)
+		}
+	}
+	if p.NextPageKey != "" && p.NextPageKey == p.PreviousPageKey {
+		return fmt.Errorf("the next and previous page keys must differ")
+	}
+	if p.TapNextSide != "" && !slices.Contains(TapSides, p.TapNextSide) {
+		return fmt.Errorf("invalid tap side: %s", p.TapNextSide)
+	}
+	if p.DoubleTapAction != "" && !slices.Contains(ReaderActions, p.DoubleTapAction) {
+		return fmt.Errorf("invalid double tap action: %s", p.DoubleTapAction)
+	}
+	return nil
+}
+
+// isReaderKey reports whether a KeyboardEvent key value can be bound, a named key or a single letter or digit
+func isReaderKey(key string) bool {
+	if slices.Contains(ReaderKeys, key) {
+		return true
+	}
+	runes := []rune(key)
+	return len(runes) == 1 && (unicode.IsLetter(runes[0]) || unicode.IsDigit(runes[0]))
+}
+
+// GetReaderPreferences returns the reader preferences of a user, falling back to the defaults for anonymous users
+func GetReaderPreferences(username string) (ReaderPreferences, error) {
+	if username == "" {
+		return DefaultReaderPreferences(), nil
+	}
+
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return DefaultReaderPreferences(), err
+	}
+	if user.ReaderPreferences == nil {
+		return DefaultReaderPreferences(), nil
+	}
+	return *user.ReaderPreferences, nil
+}
+
+// UpdateReaderPreferences validates and stores the reader preferences of a user
+func UpdateReaderPreferences(username string, preferences *ReaderPreferences) error {
+	if err := preferences.Validate(); err != nil {
+		return err
+	}
+
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	user.ReaderPreferences = preferences
+	return update("users", username, user)
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// Reading modes supported by the chapter reader
+const (
+	ReadingModeLTR      = "ltr"
+	ReadingModeRTL      = "rtl"
+	ReadingModeVertical = "vertical"
+)
+
+// ReadingModes lists the valid reading modes
+var ReadingModes = []string{ReadingModeLTR, ReadingModeRTL, ReadingModeVertical}
+
+// Media types used to pick the default reading mode
+const (
+	MangaTypeManga   = "manga"
+	MangaTypeManhwa  = "manhwa"
+	MangaTypeManhua  = "manhua"
+	MangaTypeWebtoon = "webtoon"
+	MangaTypeNovel   = "novel"
+	MangaTypeComic   = "comic"
+)
+
+// MangaTypes lists the valid media types
+var MangaTypes = []string{MangaTypeManga, MangaTypeManhwa, MangaTypeManhua, MangaTypeWebtoon, MangaTypeNovel, MangaTypeComic}
+
+// webtoonTag is the MangaDex format tag of vertically scrolling series
+const webtoonTag = "Long Strip"
+
+// MangaType detects the media type of a match, long strip series are treated as webtoons
+func (m *MangaDetail) MangaType() string {
+	if m == nil {
+		return ""
+	}
+	if slices.Contains(m.TagNames(), webtoonTag) {
+		return MangaTypeWebtoon
+	}
+	return mangaTypeFromLanguage(m.Attributes.OriginalLanguage)
+}
+
+// MediaType returns the type of the manga, falling back to its original language for mangas indexed without one
+func (m Manga) MediaType() string {
+	if m.Type != "" {
+		return m.Type
+	}
+	if slices.Contains(m.Tags, webtoonTag) {
+		return MangaTypeWebtoon
+	}
+	return mangaTypeFromLanguage(m.OriginalLanguage)
+}
+
+// ResolveReadingMode returns the reading mode the reader should start in, preferring the per-manga override
+func ResolveReadingMode(manga Manga) string {
+	if manga.ReadingMode != "" {
+		return manga.ReadingMode
+	}
+	config, err := GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+	return config.DefaultReadingMode(manga.MediaType())
+}
+
+// SetMediaReadingMode overrides the reading mode of a manga, an empty mode restores the type default
+func SetMediaReadingMode(slug, mode string) error {
+	if err := validateReadingMode(mode, true); err != nil {
+		return err
+	}
+	manga, err := GetManga(slug)
+	if err != nil {
+		return err
+	}
+	manga.ReadingMode = mode
+	return UpdateManga(manga)
+}
+
+// SetMangaType changes the type of a manga, stored directly as a detected type is not a content update of the manga
+func SetMangaType(slug, mangaType string) error {
+	if !slices.Contains(MangaTypes, mangaType) {
+		return fmt.Errorf("invalid manga type: %s", mangaType)
+	}
+	manga, err := GetManga(slug)
+	if err != nil {
+		return err
+	}
+	manga.Type = mangaType
+	return update("mangas", slug, manga)
+}
+
+func validateReadingMode(mode string, allowEmpty bool) error {
+	if (mode == "" && allowEmpty) || slices.Contains(ReadingModes, mode) {
+		return nil
+	}
+	return fmt.Errorf("invalid reading mode: %s", mode)
+}
+
+func mangaTypeFromLanguage(language string) string {
+	switch {
+	case language == "ja":
+		return MangaTypeManga
+	case language == "ko":
+		return MangaTypeManhwa
+	case language == "zh" || strings.HasPrefix(language, "zh-"):
+		return MangaTypeManhua
+	default:
+		return MangaTypeComic
+	}
+}
@@ -0,0 +1,322 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexander-bruun/magi/utils"
+	"go.etcd.io/bbolt"
+)
+
+type ReadingState struct {
+	Username    string    `json:"username"`
+	MangaSlug   string    `json:"manga_slug"`
+	ChapterSlug string    `json:"chapter_slug"`
+	ReadAt      time.Time `json:"read_at"`
+}
+
+// LastReadChapter describes where a user left off in a manga
+type LastReadChapter struct {
+	ChapterSlug string
+	ChapterName string
+	Percent     int
+}
+
+// MarkChapterRead records that a user has read a chapter, refreshing the read time if already present
+func MarkChapterRead(username, mangaSlug, chapterSlug string) error {
+	state := ReadingState{
+		Username:    username,
+		MangaSlug:   mangaSlug,
+		ChapterSlug: chapterSlug,
+		ReadAt:      time.Now(),
+	}
+	return create("reading_states", readingStateKey(username, mangaSlug, chapterSlug), state)
+}
+
+// MarkReadUpTo marks the chapter and every numerically earlier chapter of a manga as read in a single transaction
+func MarkReadUpTo(username, mangaSlug, chapterSlug string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		states := tx.Bucket([]byte("reading_states"))
+		chapters, index, err := sortedChaptersUpTo(tx, mangaSlug, chapterSlug)
+		if err != nil {
+			return err
+		}
+
+		readAt := time.Now()
+		for i := index; i >= 0; i-- {
+			key := []byte(readingStateKey(username, mangaSlug, chapters[i].Slug))
+			// The selected chapter is always refreshed so it becomes the last read chapter
+			if i != index && states.Get(key) != nil {
+				continue
+			}
+
+			encoded, err := json.Marshal(ReadingState{
+				Username:    username,
+				MangaSlug:   mangaSlug,
+				ChapterSlug: chapters[i].Slug,
+				ReadAt:      readAt.Add(-time.Duration(index-i) * time.Millisecond),
+			})
+			if err != nil {
+				return err
+			}
+			if err := states.Put(key, encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MarkUnreadFrom removes the reading state of the chapter and every numerically later chapter of a manga
+func MarkUnreadFrom(username, mangaSlug, chapterSlug string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		states := tx.Bucket([]byte("reading_states"))
+		chapters, index, err := sortedChaptersUpTo(tx, mangaSlug, chapterSlug)
+		if err != nil {
+			return err
+		}
+
+		for _, chapter := range chapters[index:] {
+			if err := states.Delete([]byte(readingStateKey(username, mangaSlug, chapter.Slug))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetLastReadChapters returns the most recently read chapter for each of the given mangas in a single transaction
+func GetLastReadChapters(username string, mangaSlugs []string) (map[string]LastReadChapter, error) {
+	lastRead := make(map[string]LastReadChapter)
+	if username == "" || len(mangaSlugs) == 0 {
+		return lastRead, nil
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		states := tx.Bucket([]byte("reading_states"))
+		chapters := tx.Bucket([]byte("chapters"))
+
+		for _, mangaSlug := range mangaSlugs {
+			latest, err := latestReadingState(states, username, mangaSlug)
+			if err != nil {
+				return err
+			}
+			if latest == nil {
+				continue
+			}
+
+			mangaChapters, err := chaptersInBucket(chapters, mangaSlug)
+			if err != nil {
+				return err
+			}
+			sortChaptersByNumber(mangaChapters)
+
+			index := indexOfChapter(mangaChapters, latest.ChapterSlug)
+			if index == -1 {
+				continue
+			}
+
+			lastRead[mangaSlug] = LastReadChapter{
+				ChapterSlug: mangaChapters[index].Slug,
+				ChapterName: mangaChapters[index].Name,
+				Percent:     (index + 1) * 100 / len(mangaChapters),
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lastRead, nil
+}
+
+// GetReadChapterSlugs returns the slugs of the chapters of a manga a user has read
+func GetReadChapterSlugs(username, mangaSlug string) (map[string]bool, error) {
+	read := make(map[string]bool)
+	if username == "" {
+		return read, nil
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		read = readChapterSlugs(tx.Bucket([]byte("reading_states")), username, mangaSlug)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return read, nil
+}
+
+// GetUnreadCount returns how many chapters of a manga are numbered after the highest chapter the user has read
+func GetUnreadCount(username, mangaSlug string) (int, error) {
+	counts, err := GetUnreadCounts(username, []string{mangaSlug})
+	if err != nil {
+		return 0, err
+	}
+	return counts[mangaSlug], nil
+}
+
+// GetUnreadCounts returns the unread chapter count of each of the given mangas in a single transaction,
+// anonymous users have every chapter unread
+func GetUnreadCounts(username string, mangaSlugs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	err := db.View(func(tx *bbolt.Tx) error {
+		states := tx.Bucket([]byte("reading_states"))
+		chapters := tx.Bucket([]byte("chapters"))
+
+		for _, mangaSlug := range mangaSlugs {
+			mangaChapters, err := chaptersInBucket(chapters, mangaSlug)
+			if err != nil {
+				return err
+			}
+			if username == "" {
+				counts[mangaSlug] = len(mangaChapters)
+				continue
+			}
+			counts[mangaSlug] = countUnreadChapters(mangaChapters, readChapterSlugs(states, username, mangaSlug))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// DeleteReadingStatesByMangaSlug removes every user's reading state for a specific manga
+func DeleteReadingStatesByMangaSlug(mangaSlug string) error {
+	return deleteKeysWithPattern("reading_states", fmt.Sprintf("*:%s:*", mangaSlug))
+}
+
+// anonymizeReadingStates moves all reading states of a user to an anonymous placeholder user
+func anonymizeReadingStates(tx *bbolt.Tx, username, placeholder string) error {
+	bucket := tx.Bucket([]byte("reading_states"))
+	for _, key := range keysWithPrefix(bucket, username+":") {
+		var state ReadingState
+		if err := json.Unmarshal(bucket.Get(key), &state); err != nil {
+			return err
+		}
+
+		state.Username = placeholder
+		if err := putJSON(bucket, readingStateKey(placeholder, state.MangaSlug, state.ChapterSlug), state); err != nil {
+			return err
+		}
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper functions
+
+// keysWithPrefix collects the keys matching a prefix, so they can be modified after iterating
+func keysWithPrefix(bucket *bbolt.Bucket, prefix string) [][]byte {
+	var keys [][]byte
+	cursor := bucket.Cursor()
+	for k, _ := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = cursor.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	return keys
+}
+
+func deleteKeysWithPrefix(bucket *bbolt.Bucket, prefix string) error {
+	for _, key := range keysWithPrefix(bucket, prefix) {
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readChapterSlugs(bucket *bbolt.Bucket, username, mangaSlug string) map[string]bool {
+	read := make(map[string]bool)
+	prefix := fmt.Sprintf("%s:%s:", username, mangaSlug)
+	for _, key := range keysWithPrefix(bucket, prefix) {
+		read[strings.TrimPrefix(string(key), prefix)] = true
+	}
+	return read
+}
+
+// countUnreadChapters counts the chapters numbered after the highest read chapter, chapters without a number
+// count as unread until they are read themselves
+func countUnreadChapters(chapters []Chapter, read map[string]bool) int {
+	highestRead := -1
+	for _, chapter := range chapters {
+		if !read[chapter.Slug] {
+			continue
+		}
+		if number, err := utils.ExtractNumber(chapter.Name); err == nil && number > highestRead {
+			highestRead = number
+		}
+	}
+
+	unread := 0
+	for _, chapter := range chapters {
+		number, err := utils.ExtractNumber(chapter.Name)
+		if err != nil {
+			if !read[chapter.Slug] {
+				unread++
+			}
+			continue
+		}
+		if number > highestRead {
+			unread++
+		}
+	}
+	return unread
+}
+
+func readingStateKey(username, mangaSlug, chapterSlug string) string {
+	return fmt.Sprintf("%s:%s:%s", username, mangaSlug, chapterSlug)
+}
+
+func latestReadingState(bucket *bbolt.Bucket, username, mangaSlug string) (*ReadingState, error) {
+	var latest *ReadingState
+	cursor := bucket.Cursor()
+	prefix := []byte(fmt.Sprintf("%s:%s:", username, mangaSlug))
+
+	for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+		var state ReadingState
+		if err := json.Unmarshal(v, &state); err != nil {
+			return nil, err
+		}
+		if latest == nil || state.ReadAt.After(latest.ReadAt) {
+			latest = &state
+		}
+	}
+	return latest, nil
+}
+
+// sortedChaptersUpTo returns the chapters of a manga sorted by chapter number along with the index of the given chapter
+func sortedChaptersUpTo(tx *bbolt.Tx, mangaSlug, chapterSlug string) ([]Chapter, int, error) {
+	chapters, err := chaptersInBucket(tx.Bucket([]byte("chapters")), mangaSlug)
+	if err != nil {
+		return nil, -1, err
+	}
+	sortChaptersByNumber(chapters)
+
+	index := indexOfChapter(chapters, chapterSlug)
+	if index == -1 {
+		return nil, -1, fmt.Errorf("chapter not found: %s", chapterSlug)
+	}
+	return chapters, index, nil
+}
+
+func chaptersInBucket(bucket *bbolt.Bucket, mangaSlug string) ([]Chapter, error) {
+	var chapters []Chapter
+	cursor := bucket.Cursor()
+	prefix := []byte(mangaSlug + ":")
+
+	for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+		var chapter Chapter
+		if err := json.Unmarshal(v, &chapter); err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, chapter)
+	}
+	return chapters, nil
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// maxRecentlyViewed bounds the trail of series pages kept per user
+	maxRecentlyViewed = 20
+	// recentVisitRefreshInterval is how long visiting the latest series again skips the write
+	recentVisitRefreshInterval = 10 * time.Minute
+)
+
+// RecentVisit is a visit of a user to the page of a series, whether or not they read it
+type RecentVisit struct {
+	MangaSlug string    `json:"manga_slug"`
+	VisitedAt time.Time `json:"visited_at"`
+}
+
+// RecordMediaVisit puts a series at the front of the recently viewed trail of a user, dropping its earlier visit
+// and the oldest visits beyond the trail length. Revisiting the latest series shortly after is not written again.
+func RecordMediaVisit(username, mangaSlug string) error {
+	now := time.Now()
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("recently_viewed"))
+		visits, err := recentVisits(bucket, username)
+		if err != nil {
+			return err
+		}
+		if len(visits) > 0 && visits[0].MangaSlug == mangaSlug && now.Sub(visits[0].VisitedAt) < recentVisitRefreshInterval {
+			return nil
+		}
+
+		visits = slices.DeleteFunc(visits, func(visit RecentVisit) bool { return visit.MangaSlug == mangaSlug })
+		visits = slices.Insert(visits, 0, RecentVisit{MangaSlug: mangaSlug, VisitedAt: now})
+		return putJSON(bucket, username, visits[:min(len(visits), maxRecentlyViewed)])
+	})
+}
+
+// GetRecentVisits returns the recently viewed trail of a user, latest first
+func GetRecentVisits(username string) ([]RecentVisit, error) {
+	var visits []RecentVisit
+	err := db.View(func(tx *bbolt.Tx) error {
+		var err error
+		visits, err = recentVisits(tx.Bucket([]byte("recently_viewed")), username)
+		return err
+	})
+	return visits, err
+}
+
+// GetRecentlyViewed returns up to limit of the series a user recently visited, latest first, leaving out series that
+// are gone, hidden or above the content rating limit
+func GetRecentlyViewed(username string, limit int, contentRatingLimit string) ([]Manga, error) {
+	visits, err := GetRecentVisits(username)
+	if err != nil {
+		return nil, err
+	}
+
+	contentRatingLimit = EffectiveContentRatingLimit(contentRatingLimit)
+	mangas := []Manga{}
+	for _, visit := range visits {
+		if len(mangas) == limit {
+			break
+		}
+		manga, err := GetManga(visit.MangaSlug)
+		if err != nil {
+			continue
+		}
+		if manga.Hidden || contentRatingLimit != "" && !IsContentRatingAllowed(manga.ContentRating, contentRatingLimit) {
+			continue
+		}
+		mangas = append(mangas, *manga)
+	}
+	return mangas, nil
+}
+
+// recentVisits decodes the recently viewed trail of a user, an empty trail when there is none
+func recentVisits(bucket *bbolt.Bucket, username string) ([]RecentVisit, error) {
+	visits := []RecentVisit{}
+	data := bucket.Get([]byte(username))
+	if data == nil {
+		return visits, nil
+	}
+	if err := json.Unmarshal(data, &visits); err != nil {
+		return nil, err
+	}
+	return visits, nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// RelocateLibrary moves a folder of a library to a new root, rewriting the paths of the mangas under it so the
+// move doesn't require indexing the library again. It returns the number of relocated mangas.
+func RelocateLibrary(slug, oldRoot, newRoot string) (int, error) {
+	oldRoot, newRoot = filepath.Clean(oldRoot), filepath.Clean(newRoot)
+	if info, err := os.Stat(newRoot); err != nil || !info.IsDir() {
+		return 0, fmt.Errorf("new folder is not a directory: %s", newRoot)
+	}
+
+	library, err := GetLibrary(slug)
+	if err != nil {
+		return 0, err
+	}
+	index := slices.IndexFunc(library.Folders, func(folder string) bool {
+		return filepath.Clean(folder) == oldRoot
+	})
+	if index == -1 {
+		return 0, fmt.Errorf("library '%s' has no folder %s", library.Name, oldRoot)
+	}
+
+	relocated := 0
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("mangas"))
+		moved := make(map[string]Manga)
+		err := bucket.ForEach(func(k, v []byte) error {
+			var manga Manga
+			if err := json.Unmarshal(v, &manga); err != nil {
+				return err
+			}
+			if manga.LibrarySlug != slug {
+				return nil
+			}
+			rel, err := filepath.Rel(oldRoot, manga.Path)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return nil
+			}
+			manga.Path = filepath.Join(newRoot, rel)
+			moved[string(k)] = manga
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Written after the iteration, a bucket must not be modified during ForEach
+		for key, manga := range moved {
+			encoded, err := json.Marshal(manga)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(key), encoded); err != nil {
+				return err
+			}
+		}
+		relocated = len(moved)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	library.Folders[index] = newRoot
+	if err := UpdateLibrary(library); err != nil {
+		return relocated, err
+	}
+	return relocated, nil
+}
@@ -0,0 +1,291 @@
+package models
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2/log"
+	"go.etcd.io/bbolt"
+)
+
+// Kinds of content that can be reported
+const (
+	ReportTargetManga   = "manga"
+	ReportTargetComment = "comment"
+)
+
+// Report statuses, closed reports had their target deleted before being reviewed
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+	ReportStatusClosed    = "closed"
+)
+
+const (
+	maxReportReasonLength = 500
+	maxReportsPerHour     = 10
+)
+
+// ErrReportRateLimited is returned when a user files too many reports in a short time
+var ErrReportRateLimited = errors.New("too many reports, please try again later")
+
+type Report struct {
+	ID         uint64    `json:"id"`
+	Reporter   string    `json:"reporter"`
+	TargetType string    `json:"target_type"`
+	TargetID   string    `json:"target_id"`
+	Reason     string    `json:"reason"`
+	Status     string    `json:"status"`
+	ResolvedBy string    `json:"resolved_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ResolvedAt time.Time `json:"resolved_at,omitempty"`
+}
+
+// TargetURL returns the page the reported content is shown on
+func (r Report) TargetURL() string {
+	if r.TargetType == ReportTargetComment {
+		if mangaSlug, chapterSlug, _, err := parseCommentTargetID(r.TargetID); err == nil {
+			return fmt.Sprintf("/mangas/%s/%s", mangaSlug, chapterSlug)
+		}
+	}
+	return fmt.Sprintf("/mangas/%s", strings.SplitN(r.TargetID, ":", 2)[0])
+}
+
+// CommentTargetID identifies a chapter comment as the target of a report
+func CommentTargetID(mangaSlug, chapterSlug string, id uint64) string {
+	return fmt.Sprintf("%s:%s:%d", mangaSlug, chapterSlug, id)
+}
+
+// CreateReport files a report against a manga or comment, limiting how many reports a user can file per hour
+func CreateReport(reporter, targetType, targetID, reason string) (*Report, error) {
+	reason = strings.TrimSpace(strings.ToValidUTF8(reason, ""))
+	if reason == "" {
+		return nil, errors.New("a reason is required")
+	}
+	if utf8.RuneCountInString(reason) > maxReportReasonLength {
+		return nil, fmt.Errorf("reason cannot be longer than %d characters", maxReportReasonLength)
+	}
+
+	report := Report{
+		Reporter:   reporter,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Reason:     reason,
+		Status:     ReportStatusOpen,
+		CreatedAt:  time.Now(),
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		if !reportTargetExists(tx, targetType, targetID) {
+			return fmt.Errorf("reported %s not found", targetType)
+		}
+
+		bucket := tx.Bucket([]byte("reports"))
+		recent := 0
+		err := bucket.ForEach(func(k, v []byte) error {
+			var existing Report
+			if err := json.Unmarshal(v, &existing); err != nil {
+				return err
+			}
+			if existing.Reporter != reporter {
+				return nil
+			}
+			if existing.Status == ReportStatusOpen && existing.TargetType == targetType && existing.TargetID == targetID {
+				return errors.New("you have already reported this")
+			}
+			if time.Since(existing.CreatedAt) < time.Hour {
+				recent++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if recent >= maxReportsPerHour {
+			return ErrReportRateLimited
+		}
+
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		report.ID = id
+		return putReport(bucket, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	NotifyListeners(Notification{Type: "report_created", Payload: report})
+	return &report, nil
+}
+
+// GetOpenReports returns the reports awaiting review, oldest first
+func GetOpenReports() ([]Report, error) {
+	var reports []Report
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("reports")).ForEach(func(k, v []byte) error {
+			var report Report
+			if err := json.Unmarshal(v, &report); err != nil {
+				return err
+			}
+			if report.Status == ReportStatusOpen {
+				reports = append(reports, report)
+			}
+			return nil
+		})
+	})
+	return reports, err
+}
+
+// ResolveReport closes an open report as resolved or dismissed by a moderator
+func ResolveReport(id uint64, moderator, status string) error {
+	if status != ReportStatusResolved && status != ReportStatusDismissed {
+		return fmt.Errorf("invalid report status: %s", status)
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("reports"))
+		data := bucket.Get(reportKey(id))
+		if data == nil {
+			return errors.New("report not found")
+		}
+
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			return err
+		}
+		if report.Status != ReportStatusOpen {
+			return errors.New("report has already been reviewed")
+		}
+
+		report.Status = status
+		report.ResolvedBy = moderator
+		report.ResolvedAt = time.Now()
+		return putReport(bucket, report)
+	})
+}
+
+// closeReportsWithoutTarget closes the open reports whose manga or comment has been deleted
+func closeReportsWithoutTarget() {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("reports"))
+
+		var closed []Report
+		err := bucket.ForEach(func(k, v []byte) error {
+			var report Report
+			if err := json.Unmarshal(v, &report); err != nil {
+				return err
+			}
+			if report.Status == ReportStatusOpen && !reportTargetExists(tx, report.TargetType, report.TargetID) {
+				report.Status = ReportStatusClosed
+				report.ResolvedAt = time.Now()
+				closed = append(closed, report)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, report := range closed {
+			if err := putReport(bucket, report); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Failed to close reports of deleted content: %v", err)
+	}
+}
+
+// forgetReportUser removes a deleted user from the reports. The reports they filed are deleted, or moved to the
+// placeholder user when keepFiled is set, and the reports they resolved show the placeholder as the moderator.
+func forgetReportUser(tx *bbolt.Tx, username, placeholder string, keepFiled bool) error {
+	bucket := tx.Bucket([]byte("reports"))
+
+	var updated []Report
+	var deleted [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var report Report
+		if err := json.Unmarshal(v, &report); err != nil {
+			return err
+		}
+		if report.Reporter == username && !keepFiled {
+			deleted = append(deleted, append([]byte(nil), k...))
+			return nil
+		}
+		if report.Reporter != username && report.ResolvedBy != username {
+			return nil
+		}
+		if report.Reporter == username {
+			report.Reporter = placeholder
+		}
+		if report.ResolvedBy == username {
+			report.ResolvedBy = placeholder
+		}
+		updated = append(updated, report)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range deleted {
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	for _, report := range updated {
+		if err := putReport(bucket, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper functions
+
+func reportTargetExists(tx *bbolt.Tx, targetType, targetID string) bool {
+	switch targetType {
+	case ReportTargetManga:
+		return tx.Bucket([]byte("mangas")).Get([]byte(targetID)) != nil
+	case ReportTargetComment:
+		mangaSlug, chapterSlug, id, err := parseCommentTargetID(targetID)
+		return err == nil && tx.Bucket([]byte("chapter_comments")).Get([]byte(commentKey(mangaSlug, chapterSlug, id))) != nil
+	default:
+		return false
+	}
+}
+
+func parseCommentTargetID(targetID string) (string, string, uint64, error) {
+	parts := strings.Split(targetID, ":")
+	if len(parts) != 3 {
+		return "", "", 0, fmt.Errorf("invalid comment: %s", targetID)
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	return parts[0], parts[1], id, err
+}
+
+func putReport(bucket *bbolt.Bucket, report Report) error {
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(reportKey(report.ID), encoded)
+}
+
+// reportKey encodes the id big-endian so reports are stored in filing order
+func reportKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
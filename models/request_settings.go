@@ -0,0 +1,46 @@
+package models
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// RequestSettings are the settings the middlewares read on every request, parsed once and kept until the
+// configuration is stored again
+type RequestSettings struct {
+	Config AppConfig
+	// TrustedProxies are the parsed networks of Config.TrustedProxies
+	TrustedProxies []*net.IPNet
+	// RateLimitExemptions are the parsed networks of Config.RateLimitExemptNetworks
+	RateLimitExemptions []*net.IPNet
+}
+
+var requestSettings atomic.Pointer[RequestSettings]
+
+// GetRequestSettings returns the cached request settings, reading the configuration the first time
+func GetRequestSettings() *RequestSettings {
+	if settings := requestSettings.Load(); settings != nil {
+		return settings
+	}
+	config, err := GetAppConfig()
+	if err != nil {
+		log.Errorf("Failed to get app config: %v", err)
+	}
+	return refreshRequestSettings(config)
+}
+
+// refreshRequestSettings parses the request settings of a configuration and caches them
+func refreshRequestSettings(config AppConfig) *RequestSettings {
+	settings := &RequestSettings{Config: config}
+	var err error
+	if settings.TrustedProxies, err = ParseTrustedProxies(config.TrustedProxies); err != nil {
+		log.Errorf("Failed to parse trusted proxies: %v", err)
+	}
+	if settings.RateLimitExemptions, err = ParseRateLimitExemptions(config.RateLimitExemptNetworks); err != nil {
+		log.Errorf("Failed to parse rate limit exemptions: %v", err)
+	}
+	requestSettings.Store(settings)
+	return settings
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Statuses a user can give a series in their reading lists
+const (
+	SeriesStatusReading    = "reading"
+	SeriesStatusCompleted  = "completed"
+	SeriesStatusDropped    = "dropped"
+	SeriesStatusPlanToRead = "plan_to_read"
+)
+
+// SeriesStatuses lists the valid series statuses in display order
+var SeriesStatuses = []string{SeriesStatusReading, SeriesStatusCompleted, SeriesStatusDropped, SeriesStatusPlanToRead}
+
+// ErrInvalidSeriesStatus is returned when setting a status that isn't one of SeriesStatuses
+var ErrInvalidSeriesStatus = errors.New("invalid series status")
+
+// SeriesStatus is the status a user gave a series, it overrides the implicit "reading" status of a series with progress
+type SeriesStatus struct {
+	Username  string    `json:"username"`
+	MangaSlug string    `json:"manga_slug"`
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetSeriesStatus sets the status of a series for a user, an empty status clears it
+func SetSeriesStatus(username, mangaSlug, status string) error {
+	if status == "" {
+		return delete("user_series_status", seriesStatusKey(username, mangaSlug))
+	}
+	if !slices.Contains(SeriesStatuses, status) {
+		return fmt.Errorf("%w: %s", ErrInvalidSeriesStatus, status)
+	}
+	if exists, err := MangaExists(mangaSlug); err != nil {
+		return err
+	} else if !exists {
+		return errors.New("manga not found")
+	}
+
+	return create("user_series_status", seriesStatusKey(username, mangaSlug), SeriesStatus{
+		Username:  username,
+		MangaSlug: mangaSlug,
+		Status:    status,
+		UpdatedAt: time.Now(),
+	})
+}
+
+// GetSeriesStatus returns the status of a series for a user. A series without a status is "reading" once the user has
+// read a chapter of it, and has no status otherwise. The explicit flag tells whether the user set the status.
+func GetSeriesStatus(username, mangaSlug string) (status string, explicit bool, err error) {
+	err = db.View(func(tx *bbolt.Tx) error {
+		if data := tx.Bucket([]byte("user_series_status")).Get([]byte(seriesStatusKey(username, mangaSlug))); data != nil {
+			var stored SeriesStatus
+			if err := json.Unmarshal(data, &stored); err != nil {
+				return err
+			}
+			status, explicit = stored.Status, true
+			return nil
+		}
+
+		if len(keysWithPrefix(tx.Bucket([]byte("reading_states")), fmt.Sprintf("%s:%s:", username, mangaSlug))) > 0 {
+			status = SeriesStatusReading
+		}
+		return nil
+	})
+	return status, explicit, err
+}
+
+// GetSeriesStatuses returns the status of every series of a user that has one, explicit or implicit
+func GetSeriesStatuses(username string) (map[string]string, error) {
+	statuses := make(map[string]string)
+	err := db.View(func(tx *bbolt.Tx) error {
+		prefix := username + ":"
+		for _, key := range keysWithPrefix(tx.Bucket([]byte("reading_states")), prefix) {
+			if mangaSlug, _, ok := strings.Cut(strings.TrimPrefix(string(key), prefix), ":"); ok {
+				statuses[mangaSlug] = SeriesStatusReading
+			}
+		}
+
+		bucket := tx.Bucket([]byte("user_series_status"))
+		for _, key := range keysWithPrefix(bucket, prefix) {
+			var stored SeriesStatus
+			if err := json.Unmarshal(bucket.Get(key), &stored); err != nil {
+				return err
+			}
+			statuses[stored.MangaSlug] = stored.Status
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// GetSeriesByStatus returns the series of a user with a status sorted by name, leaving out those above the content
+// rating limit, along with the number of series per status
+func GetSeriesByStatus(username, status, contentRatingLimit string) ([]Manga, map[string]int, error) {
+	statuses, err := GetSeriesStatuses(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	mangas, err := listableMangas("", contentRatingLimit, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	counts := make(map[string]int, len(SeriesStatuses))
+	series := []Manga{}
+	for _, manga := range mangas {
+		mangaStatus, ok := statuses[manga.Slug]
+		if !ok {
+			continue
+		}
+		counts[mangaStatus]++
+		if mangaStatus == status {
+			series = append(series, manga)
+		}
+	}
+	sortMangasByName(series)
+	return series, counts, nil
+}
+
+// DeleteSeriesStatusesByMangaSlug removes the status of a series for every user
+func DeleteSeriesStatusesByMangaSlug(mangaSlug string) error {
+	return deleteKeysWithPattern("user_series_status", fmt.Sprintf("*:%s", mangaSlug))
+}
+
+func seriesStatusKey(username, mangaSlug string) string {
+	return fmt.Sprintf("%s:%s", username, mangaSlug)
+}
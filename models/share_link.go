@@ -0,0 +1,188 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrShareLinkInvalid is returned for a share link that doesn't exist, was revoked or has expired
+var ErrShareLinkInvalid = errors.New("this share link is invalid or has expired")
+
+// ShareTarget is what a share link grants access to, a whole manga when the chapter is empty
+type ShareTarget struct {
+	MangaSlug   string `json:"manga_slug"`
+	ChapterSlug string `json:"chapter_slug,omitempty"`
+}
+
+// Allows reports whether the target covers a chapter of a manga
+func (t ShareTarget) Allows(mangaSlug, chapterSlug string) bool {
+	return t.MangaSlug == mangaSlug && (t.ChapterSlug == "" || t.ChapterSlug == chapterSlug)
+}
+
+// ShareLink grants read-only access to a manga or chapter to anyone holding its token, until it expires or is revoked
+type ShareLink struct {
+	Token string `json:"token"`
+	ShareTarget
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Revoked   bool      `json:"revoked"`
+	// Views counts the times the shared page was opened, pages loaded by the reader aren't counted
+	Views      int       `json:"views"`
+	LastViewed time.Time `json:"last_viewed,omitempty"`
+}
+
+// Active reports whether the link still grants access
+func (l ShareLink) Active(now time.Time) bool {
+	return !l.Revoked && now.Before(l.ExpiresAt)
+}
+
+// CreateShareLink creates a link to a manga or chapter of it that expires after ttl. The token is random and only
+// valid while stored, which is what allows revoking it.
+func CreateShareLink(username string, target ShareTarget, ttl time.Duration) (ShareLink, error) {
+	if ttl <= 0 {
+		return ShareLink{}, errors.New("share link lifetime must be positive")
+	}
+	if _, err := GetManga(target.MangaSlug); err != nil {
+		return ShareLink{}, fmt.Errorf("manga not found: %s", target.MangaSlug)
+	}
+	if target.ChapterSlug != "" {
+		if exists, err := ChapterExists(target.ChapterSlug, target.MangaSlug); err != nil {
+			return ShareLink{}, err
+		} else if !exists {
+			return ShareLink{}, fmt.Errorf("chapter not found: %s", target.ChapterSlug)
+		}
+	}
+
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return ShareLink{}, err
+	}
+	now := time.Now()
+	link := ShareLink{
+		Token:       hex.EncodeToString(token),
+		ShareTarget: target,
+		CreatedBy:   username,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	return link, create("share_links", link.Token, link)
+}
+
+// GetShareLink returns an active share link, ErrShareLinkInvalid for unknown, revoked and expired links
+func GetShareLink(token string) (ShareLink, error) {
+	var link ShareLink
+	if token == "" || get("share_links", token, &link) != nil || !link.Active(time.Now()) {
+		return ShareLink{}, ErrShareLinkInvalid
+	}
+	return link, nil
+}
+
+// RecordShareLinkView counts a visit of a share link
+func RecordShareLinkView(token string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("share_links"))
+		data := bucket.Get([]byte(token))
+		if data == nil {
+			return ErrShareLinkInvalid
+		}
+		var link ShareLink
+		if err := json.Unmarshal(data, &link); err != nil {
+			return err
+		}
+		link.Views++
+		link.LastViewed = time.Now()
+		encoded, err := json.Marshal(link)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(token), encoded)
+	})
+}
+
+// GetShareLinks returns the share links created by a user newest first, every link when the username is empty
+func GetShareLinks(username string) ([]ShareLink, error) {
+	links := []ShareLink{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("share_links")).ForEach(func(_, v []byte) error {
+			var link ShareLink
+			if err := json.Unmarshal(v, &link); err != nil {
+				return err
+			}
+			if username == "" || link.CreatedBy == username {
+				links = append(links, link)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.After(links[j].CreatedAt) })
+	return links, nil
+}
+
+// RevokeShareLink stops a share link from granting access, only its creator or an admin may revoke it. The link is
+// kept so it still shows up as revoked.
+func RevokeShareLink(token, username string, admin bool) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("share_links"))
+		data := bucket.Get([]byte(token))
+		if data == nil {
+			return ErrShareLinkInvalid
+		}
+		var link ShareLink
+		if err := json.Unmarshal(data, &link); err != nil {
+			return err
+		}
+		if link.CreatedBy != username && !admin {
+			return errors.New("only the creator of a share link or an admin can revoke it")
+		}
+		link.Revoked = true
+		encoded, err := json.Marshal(link)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(token), encoded)
+	})
+}
+
+// DeleteShareLinksByMangaSlug removes the share links of a manga
+func DeleteShareLinksByMangaSlug(mangaSlug string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		return deleteShareLinks(tx, func(link ShareLink) bool { return link.MangaSlug == mangaSlug })
+	})
+}
+
+// deleteShareLinks removes the share links matching a condition
+func deleteShareLinks(tx *bbolt.Tx, matches func(ShareLink) bool) error {
+	bucket := tx.Bucket([]byte("share_links"))
+	var tokens [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var link ShareLink
+		if err := json.Unmarshal(v, &link); err != nil {
+			return err
+		}
+		if matches(link) {
+			tokens = append(tokens, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := bucket.Delete(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
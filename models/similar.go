@@ -0,0 +1,179 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// sameAuthorBonus is added to the tag similarity of mangas sharing an author
+const sameAuthorBonus = 0.25
+
+// similarCache holds the tags and authors of every manga and the ranked similar manga slugs per manga, it is
+// cleared whenever a manga changes
+var similarCache = struct {
+	sync.Mutex
+	index  *similarIndex
+	ranked map[string][]string
+}{ranked: make(map[string][]string)}
+
+// similarIndex finds the mangas sharing a tag or the author of a manga without going through every manga
+type similarIndex struct {
+	tags     map[string]map[string]struct{}
+	authors  map[string]string
+	byTag    map[string][]string
+	byAuthor map[string][]string
+}
+
+// GetSimilarMangas returns up to limit mangas sharing the most tags with the given manga, filtered by content rating
+func GetSimilarMangas(slug string, limit int, contentRatingLimit string) ([]Manga, error) {
+	ranked, ok, err := rankSimilarMangas(slug)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	contentRatingLimit = EffectiveContentRatingLimit(contentRatingLimit)
+	var similar []Manga
+	err = db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("mangas"))
+		for _, candidate := range ranked {
+			data := bucket.Get([]byte(candidate))
+			if data == nil {
+				continue
+			}
+			var manga Manga
+			if err := json.Unmarshal(data, &manga); err != nil {
+				return err
+			}
+			if manga.Hidden || !IsContentRatingAllowed(manga.ContentRating, contentRatingLimit) {
+				continue
+			}
+			similar = append(similar, manga)
+			if len(similar) == limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return similar, nil
+}
+
+// rankSimilarMangas returns the slugs of every manga similar to the given one, most similar first, and whether the
+// manga exists. Only the mangas sharing a tag or the author can be similar, so only those are scored.
+func rankSimilarMangas(slug string) ([]string, bool, error) {
+	similarCache.Lock()
+	defer similarCache.Unlock()
+
+	if similarCache.index == nil {
+		var mangas []Manga
+		if err := loadAllMangas(&mangas); err != nil {
+			return nil, false, err
+		}
+		similarCache.index = newSimilarIndex(mangas)
+	}
+	index := similarCache.index
+
+	currentTags, ok := index.tags[slug]
+	if !ok {
+		return nil, false, nil
+	}
+	if ranked, ok := similarCache.ranked[slug]; ok {
+		return ranked, true, nil
+	}
+
+	candidates := make(map[string]struct{})
+	for tag := range currentTags {
+		for _, candidate := range index.byTag[tag] {
+			candidates[candidate] = struct{}{}
+		}
+	}
+	author := index.authors[slug]
+	if author != "" {
+		for _, candidate := range index.byAuthor[author] {
+			candidates[candidate] = struct{}{}
+		}
+	}
+
+	scores := make(map[string]float64, len(candidates))
+	ranked := make([]string, 0, len(candidates))
+	for candidate := range candidates {
+		if candidate == slug {
+			continue
+		}
+		score := jaccard(currentTags, index.tags[candidate])
+		if author != "" && index.authors[candidate] == author {
+			score += sameAuthorBonus
+		}
+		if score > 0 {
+			scores[candidate] = score
+			ranked = append(ranked, candidate)
+		}
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] != scores[ranked[j]] {
+			return scores[ranked[i]] > scores[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+
+	similarCache.ranked[slug] = ranked
+	return ranked, true, nil
+}
+
+func newSimilarIndex(mangas []Manga) *similarIndex {
+	index := &similarIndex{
+		tags:     make(map[string]map[string]struct{}, len(mangas)),
+		authors:  make(map[string]string, len(mangas)),
+		byTag:    make(map[string][]string),
+		byAuthor: make(map[string][]string),
+	}
+	for _, manga := range mangas {
+		tags := tagSet(manga.Tags)
+		index.tags[manga.Slug] = tags
+		for tag := range tags {
+			index.byTag[tag] = append(index.byTag[tag], manga.Slug)
+		}
+		if author := strings.ToLower(manga.Author); author != "" {
+			index.authors[manga.Slug] = author
+			index.byAuthor[author] = append(index.byAuthor[author], manga.Slug)
+		}
+	}
+	return index
+}
+
+// invalidateSimilarMangas drops the index and the cached rankings, as any change can affect the similarity of other
+// mangas
+func invalidateSimilarMangas() {
+	similarCache.Lock()
+	defer similarCache.Unlock()
+	similarCache.index = nil
+	similarCache.ranked = make(map[string][]string)
+}
+
+func tagSet(tags []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		set[strings.ToLower(tag)] = struct{}{}
+	}
+	return set
+}
+
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	intersection := 0
+	for tag := range a {
+		if _, ok := b[tag]; ok {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetSimilarMangas(t *testing.T) {
+	setupTestDB(t)
+	for _, manga := range []Manga{
+		{Name: "Current", Author: "Alice", Tags: []string{"Action", "Fantasy"}, ContentRating: "safe"},
+		{Name: "Same Tags", Tags: []string{"action", "fantasy"}, ContentRating: "safe"},
+		{Name: "One Tag", Tags: []string{"Action", "Romance"}, ContentRating: "safe"},
+		{Name: "Same Author", Author: "alice", Tags: []string{"Horror"}, ContentRating: "safe"},
+		{Name: "Unrelated", Tags: []string{"Horror"}, ContentRating: "safe"},
+		{Name: "Too Mature", Tags: []string{"Action", "Fantasy"}, ContentRating: "pornographic"},
+		{Name: "Hidden", Tags: []string{"Action", "Fantasy"}, ContentRating: "safe", Hidden: true},
+	} {
+		if err := CreateManga(manga); err != nil {
+			t.Fatalf("failed to create '%s': %v", manga.Name, err)
+		}
+	}
+
+	slugs := func(mangas []Manga) []string {
+		var slugs []string
+		for _, manga := range mangas {
+			slugs = append(slugs, manga.Slug)
+		}
+		return slugs
+	}
+
+	similar, err := GetSimilarMangas("current", 10, "suggestive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"same-tags", "one-tag", "same-author"}; !slices.Equal(slugs(similar), want) {
+		t.Errorf("got %v, want %v", slugs(similar), want)
+	}
+
+	// The cached ranking is cut to the limit
+	similar, err = GetSimilarMangas("current", 1, "suggestive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"same-tags"}; !slices.Equal(slugs(similar), want) {
+		t.Errorf("got %v, want %v", slugs(similar), want)
+	}
+
+	// A new manga invalidates the cache and is ranked on the next call
+	if err := CreateManga(Manga{Name: "Newcomer", Tags: []string{"Fantasy", "Action"}, ContentRating: "safe"}); err != nil {
+		t.Fatal(err)
+	}
+	similar, err = GetSimilarMangas("current", 2, "suggestive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"newcomer", "same-tags"}; !slices.Equal(slugs(similar), want) {
+		t.Errorf("got %v, want %v", slugs(similar), want)
+	}
+
+	similar, err = GetSimilarMangas("missing", 10, "suggestive")
+	if err != nil || similar != nil {
+		t.Errorf("got %v, %v for a missing manga, want nothing", similar, err)
+	}
+}
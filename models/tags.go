@@ -0,0 +1,194 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// GetAllTags returns every tag in use, sorted alphabetically
+func GetAllTags() ([]string, error) {
+	var mangas []Manga
+	if err := loadAllMangas(&mangas); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]string)
+	for _, manga := range mangas {
+		for _, tag := range manga.Tags {
+			if _, ok := seen[strings.ToLower(tag)]; !ok {
+				seen[strings.ToLower(tag)] = tag
+			}
+		}
+	}
+
+	tags := make([]string, 0, len(seen))
+	for _, tag := range seen {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i]) < strings.ToLower(tags[j]) })
+	return tags, nil
+}
+
+// FindMangaSlugs returns the slugs of the mangas in a library and with a tag, empty filters match everything
+func FindMangaSlugs(librarySlug, tag string) ([]string, error) {
+	var mangas []Manga
+	if err := loadAllMangas(&mangas); err != nil {
+		return nil, err
+	}
+
+	var slugs []string
+	for _, manga := range mangas {
+		if librarySlug != "" && manga.LibrarySlug != librarySlug {
+			continue
+		}
+		if tag != "" && indexOfTag(manga.Tags, tag) == -1 {
+			continue
+		}
+		slugs = append(slugs, manga.Slug)
+	}
+	return slugs, nil
+}
+
+// AddTagToMedia adds a tag to every given manga in a single transaction, returning how many mangas were changed
+func AddTagToMedia(slugs []string, tag string) (int, error) {
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return 0, err
+	}
+	return updateMangaTags(slugs, func(tags []string) ([]string, bool) {
+		if indexOfTag(tags, tag) != -1 {
+			return tags, false
+		}
+		return append(tags, tag), true
+	})
+}
+
+// RemoveTagFromMedia removes a tag from every given manga in a single transaction, returning how many mangas were changed
+func RemoveTagFromMedia(slugs []string, tag string) (int, error) {
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return 0, err
+	}
+	return updateMangaTags(slugs, func(tags []string) ([]string, bool) {
+		index := indexOfTag(tags, tag)
+		if index == -1 {
+			return tags, false
+		}
+		return slices.Delete(tags, index, index+1), true
+	})
+}
+
+// MergeTags returns the tags with the extra tags they lack appended, normalized like AddTagToMedia so the casing of a
+// tag already in use is reused. Tags that are there already, whatever their casing, are left as they are.
+func MergeTags(tags, extra []string) ([]string, error) {
+	merged := slices.Clone(tags)
+	for _, tag := range extra {
+		if indexOfTag(merged, tag) != -1 {
+			continue
+		}
+		normalized, err := normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, normalized)
+	}
+	return merged, nil
+}
+
+// MergeMangaTags adds the extra tags a manga lacks to its tags, keeping the ones it has, and reports whether it changed
+func MergeMangaTags(slug string, extra []string) (bool, error) {
+	manga, err := GetManga(slug)
+	if err != nil {
+		return false, err
+	}
+	merged, err := MergeTags(manga.Tags, extra)
+	if err != nil {
+		return false, err
+	}
+	if len(merged) == len(manga.Tags) {
+		return false, nil
+	}
+
+	added := merged[len(manga.Tags):]
+	updated, err := updateMangaTags([]string{slug}, func(tags []string) ([]string, bool) {
+		changed := false
+		for _, tag := range added {
+			if indexOfTag(tags, tag) == -1 {
+				tags = append(tags, tag)
+				changed = true
+			}
+		}
+		return tags, changed
+	})
+	return updated > 0, err
+}
+
+// updateMangaTags applies a change to the tags of the given mangas, only storing the mangas that changed
+func updateMangaTags(slugs []string, change func(tags []string) ([]string, bool)) (int, error) {
+	updated := 0
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("mangas"))
+		for _, slug := range slugs {
+			data := bucket.Get([]byte(slug))
+			if data == nil {
+				return fmt.Errorf("manga not found: %s", slug)
+			}
+
+			var manga Manga
+			if err := json.Unmarshal(data, &manga); err != nil {
+				return err
+			}
+			tags, changed := change(manga.Tags)
+			if !changed {
+				continue
+			}
+
+			manga.Tags = tags
+			manga.UpdatedAt = time.Now()
+			encoded, err := json.Marshal(manga)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(slug), encoded); err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if updated > 0 {
+		invalidateSimilarMangas()
+	}
+	return updated, nil
+}
+
+// normalizeTag trims a tag and reuses the casing of an existing tag, so "action" and "Action" stay one tag
+func normalizeTag(tag string) (string, error) {
+	tag = strings.Join(strings.Fields(tag), " ")
+	if tag == "" {
+		return "", fmt.Errorf("tag can't be empty")
+	}
+
+	tags, err := GetAllTags()
+	if err != nil {
+		return "", err
+	}
+	if index := indexOfTag(tags, tag); index != -1 {
+		return tags[index], nil
+	}
+	return tag, nil
+}
+
+func indexOfTag(tags []string, tag string) int {
+	return slices.IndexFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) })
+}
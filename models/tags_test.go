@@ -0,0 +1,45 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeTags(t *testing.T) {
+	setupTestDB(t)
+	if err := CreateManga(Manga{Name: "Tagged", Tags: []string{"Slice of Life"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Provider tags stay, extra tags they lack are appended with the casing already in use
+	merged, err := MergeTags([]string{"Action", "Drama"}, []string{"action", "slice of life", "Completed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Action", "Drama", "Slice of Life", "Completed"}; !slices.Equal(merged, want) {
+		t.Errorf("got %v, want %v", merged, want)
+	}
+}
+
+func TestMergeMangaTags(t *testing.T) {
+	setupTestDB(t)
+	if err := CreateManga(Manga{Name: "Tagged", Tags: []string{"Action"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := MergeMangaTags("tagged", []string{"ACTION", "Completed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manga, err := GetManga("tagged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Action", "Completed"}; !changed || !slices.Equal(manga.Tags, want) {
+		t.Errorf("got %v (changed %v), want %v", manga.Tags, changed, want)
+	}
+
+	if changed, err = MergeMangaTags("tagged", []string{"completed"}); err != nil || changed {
+		t.Errorf("merging tags the manga has got changed %v (%v), want no change", changed, err)
+	}
+}
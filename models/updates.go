@@ -0,0 +1,129 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// visitTimeout is the inactivity after which returning to the home page counts as a new visit
+const visitTimeout = 30 * time.Minute
+
+// UpdatesSummary describes what was added to the libraries since the last visit of a user
+type UpdatesSummary struct {
+	Since            time.Time
+	NewMangas        int
+	NewChapters      int
+	FollowedChapters int
+	// Followed lists the favorites and the mangas the user has been reading that received new chapters, sorted by name
+	Followed []Manga
+}
+
+// Empty reports whether nothing was added since the last visit
+func (s UpdatesSummary) Empty() bool {
+	return s.NewMangas == 0 && s.NewChapters == 0
+}
+
+// RecordVisit refreshes the last visit of a user, a login or a return after visitTimeout starts a new visit
+// and moves the marker of the updates summary to the end of the previous one
+func RecordVisit(username string, login bool) error {
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if user.LastVisitAt.IsZero() {
+		user.UpdatesSince = now
+	} else if login || now.Sub(user.LastVisitAt) > visitTimeout {
+		user.UpdatesSince = user.LastVisitAt
+	}
+	user.LastVisitAt = now
+	return update("users", username, user)
+}
+
+// DismissUpdates moves the marker of the updates summary to now without waiting for the next visit
+func DismissUpdates(username string) error {
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	user.UpdatesSince = time.Now()
+	return update("users", username, user)
+}
+
+// GetUpdatesSince summarizes the mangas and chapters added since the marker of a user, limited to the mangas
+// allowed by the content rating limit, the favorites and mangas the user has been reading are counted separately
+func GetUpdatesSince(username, contentRatingLimit string) (UpdatesSummary, error) {
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return UpdatesSummary{}, err
+	}
+	summary := UpdatesSummary{Since: user.UpdatesSince}
+	if summary.Since.IsZero() {
+		return summary, nil
+	}
+
+	mangas, err := listableMangas("", contentRatingLimit, false)
+	if err != nil {
+		return summary, err
+	}
+	accessible := make(map[string]Manga, len(mangas))
+	for _, manga := range mangas {
+		accessible[manga.Slug] = manga
+		if manga.CreatedAt.After(summary.Since) {
+			summary.NewMangas++
+		}
+	}
+
+	updated := make(map[string]bool)
+	err = db.View(func(tx *bbolt.Tx) error {
+		followed := favoriteSlugs(tx.Bucket([]byte("favorites")), username)
+		prefix := username + ":"
+		for _, key := range keysWithPrefix(tx.Bucket([]byte("reading_states")), prefix) {
+			if mangaSlug, _, ok := strings.Cut(strings.TrimPrefix(string(key), prefix), ":"); ok {
+				followed[mangaSlug] = true
+			}
+		}
+		// Series the user finished or dropped stay off their updates even when new chapters arrive
+		statuses := tx.Bucket([]byte("user_series_status"))
+		for _, key := range keysWithPrefix(statuses, prefix) {
+			var status SeriesStatus
+			if err := json.Unmarshal(statuses.Get(key), &status); err != nil {
+				return err
+			}
+			if status.Status == SeriesStatusCompleted || status.Status == SeriesStatusDropped {
+				followed[status.MangaSlug] = false
+			}
+		}
+
+		return tx.Bucket([]byte("chapters")).ForEach(func(_, v []byte) error {
+			var chapter Chapter
+			if err := json.Unmarshal(v, &chapter); err != nil {
+				return err
+			}
+			if _, ok := accessible[chapter.MangaSlug]; !ok || !chapter.CreatedAt.After(summary.Since) {
+				return nil
+			}
+
+			summary.NewChapters++
+			if followed[chapter.MangaSlug] {
+				summary.FollowedChapters++
+				updated[chapter.MangaSlug] = true
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	for slug := range updated {
+		summary.Followed = append(summary.Followed, accessible[slug])
+	}
+	sortMangasByName(summary.Followed)
+	return summary, nil
+}
@@ -1,20 +1,31 @@
 package models
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/alexander-bruun/magi/utils"
 	"github.com/gofiber/fiber/v2/log"
+	"go.etcd.io/bbolt"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	Username            string `json:"username"`
-	Password            string `json:"password"`
-	RefreshTokenVersion int    `json:"refresh_token_version"`
-	Role                string `json:"role"`
-	Banned              bool   `json:"banned"`
+	Username            string             `json:"username"`
+	Password            string             `json:"password"`
+	RefreshTokenVersion int                `json:"refresh_token_version"`
+	Role                string             `json:"role"`
+	Banned              bool               `json:"banned"`
+	Preferences         *UserPreferences   `json:"preferences,omitempty"`
+	ReaderPreferences   *ReaderPreferences `json:"reader_preferences,omitempty"`
+	LastVisitAt         time.Time          `json:"last_visit_at,omitempty"`
+	UpdatesSince        time.Time          `json:"updates_since,omitempty"`
+	ContentGateAt       time.Time          `json:"content_gate_at,omitempty"`
 }
 
 // roleHierarchy defines the order of roles from lowest to highest.
@@ -40,31 +51,98 @@ func GetUsers() ([]User, error) {
 	return users, nil
 }
 
-// CreateUser creates a new user with hashed password and default role.
+// CreateUser creates a new user with hashed password and the configured role of new users, the first user becomes
+// an admin.
 func CreateUser(username, password string) error {
+	return createUser(username, password, "")
+}
+
+// CreateUserWithRole creates a new user with hashed password and the given role. The account is stored with its role
+// in a single write, so a failure never leaves an account with the role of new users behind.
+func CreateUserWithRole(username, password, role string) error {
+	if !isValidRole(role) {
+		return errors.New("invalid role")
+	}
+	return createUser(username, password, role)
+}
+
+// createUser stores a new user in a single transaction, an empty role gives the configured role of new users
+func createUser(username, password, role string) error {
+	if err := validateCredentials(username, password); err != nil {
+		return err
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
+	config, err := GetAppConfig()
+	if err != nil {
+		return err
+	}
 	user := User{
 		Username:            username,
 		Password:            string(hashedPassword),
 		RefreshTokenVersion: 0,
-		Role:                "reader", // Default role
+		Role:                role,
+	}
+	if user.Role == "" {
+		user.Role = config.NewUserRole
+	}
+	if user.Role == "" {
+		user.Role = "reader"
 	}
 
-	count, err := CountUsers()
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("users"))
+		if bucket.Get([]byte(username)) != nil {
+			return errors.New("user already exists")
+		}
+		if first, _ := bucket.Cursor().First(); first == nil {
+			log.Infof("No users have yet been registered, promoting '%s' to 'admin' role", user.Username)
+			user.Role = "admin"
+		}
+		return putJSON(bucket, username, user)
+	})
+}
+
+// SearchUsers finds users matching the keyword and applies pagination, sorted by username.
+func SearchUsers(keyword string, page, pageSize int) ([]User, int64, error) {
+	users, err := GetUsers()
 	if err != nil {
-		return fmt.Errorf("failed to count users: %w", err)
+		return nil, 0, err
 	}
 
-	if count == 0 {
-		log.Infof("No users have yet been registered, promoting '%s' to 'admin' role", user.Username)
-		user.Role = "admin"
+	if keyword != "" {
+		var usernames []string
+		usernameToUser := make(map[string]User)
+		for _, user := range users {
+			usernames = append(usernames, user.Username)
+			usernameToUser[user.Username] = user
+		}
+
+		var filteredUsers []User
+		for _, username := range utils.BigramSearch(keyword, usernames) {
+			filteredUsers = append(filteredUsers, usernameToUser[username])
+		}
+		users = filteredUsers
 	}
 
-	return create("users", username, user)
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	total := int64(len(users))
+	start := (page - 1) * pageSize
+	if start >= len(users) {
+		return []User{}, total, nil
+	}
+	end := start + pageSize
+	if end > len(users) {
+		end = len(users)
+	}
+	return users[start:end], total, nil
 }
 
 // FindUserByUsername retrieves a user by their username.
@@ -92,6 +170,37 @@ func UpdateUserRole(username, newRole string) error {
 	return update("users", username, user)
 }
 
+// UpdateUserPassword replaces the password of a user and invalidates their existing sessions.
+func UpdateUserPassword(username, password string) error {
+	if err := validateCredentials(username, password); err != nil {
+		return err
+	}
+
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user.Password = string(hashedPassword)
+	user.RefreshTokenVersion++
+	return update("users", username, user)
+}
+
+// DeleteUser removes a user, deleting or anonymizing their data according to the configured policy.
+func DeleteUser(username string) error {
+	if err := deleteUserData(username, true); err != nil {
+		return err
+	}
+
+	log.Infof("User '%s' has been deleted", username)
+	return nil
+}
+
 // IncrementRefreshTokenVersion increments the refresh token version for a user.
 func IncrementRefreshTokenVersion(username string) error {
 	user, err := FindUserByUsername(username)
@@ -103,6 +212,34 @@ func IncrementRefreshTokenVersion(username string) error {
 	return update("users", username, user)
 }
 
+// ConfirmContentGate records that a user confirmed their age, the content gate isn't shown to them again
+func ConfirmContentGate(username string) error {
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if !user.ContentGateAt.IsZero() {
+		return nil
+	}
+
+	user.ContentGateAt = time.Now()
+	return update("users", username, user)
+}
+
+// ResetContentGate forgets the age confirmation of a user, the content gate is shown to them again
+func ResetContentGate(username string) error {
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user.ContentGateAt.IsZero() {
+		return nil
+	}
+
+	user.ContentGateAt = time.Time{}
+	return update("users", username, user)
+}
+
 // CountUsers returns the total number of users.
 func CountUsers() (int64, error) {
 	var dataList [][]byte
@@ -114,6 +251,29 @@ func CountUsers() (int64, error) {
 	return int64(len(dataList)), nil
 }
 
+// validateCredentials checks if the username and password can be stored.
+func validateCredentials(username, password string) error {
+	if strings.TrimSpace(username) == "" {
+		return errors.New("username cannot be empty")
+	}
+	if strings.ContainsAny(username, ": \t\n") {
+		return errors.New("username cannot contain whitespace or colons")
+	}
+	if password == "" {
+		return errors.New("password cannot be empty")
+	}
+	return nil
+}
+
+// anonymousUsername generates a placeholder name used to keep the data of deleted users anonymously.
+func anonymousUsername() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("deleted-%x", suffix), nil
+}
+
 // isValidRole checks if the provided role is valid.
 func isValidRole(role string) bool {
 	switch role {
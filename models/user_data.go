@@ -0,0 +1,213 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"go.etcd.io/bbolt"
+)
+
+// UserProfile is the account of a user as exported, without the password hash and the token version
+type UserProfile struct {
+	Username      string    `json:"username"`
+	Role          string    `json:"role"`
+	Banned        bool      `json:"banned"`
+	LastVisitAt   time.Time `json:"last_visit_at,omitempty"`
+	UpdatesSince  time.Time `json:"updates_since,omitempty"`
+	ContentGateAt time.Time `json:"content_gate_at,omitempty"`
+}
+
+// UserDataExport bundles everything stored about a user. Reading states double as the bookmarks of the user and the
+// series statuses are their reading lists.
+type UserDataExport struct {
+	ExportedAt        time.Time          `json:"exported_at"`
+	Profile           UserProfile        `json:"profile"`
+	Preferences       UserPreferences    `json:"preferences"`
+	ReaderPreferences ReaderPreferences  `json:"reader_preferences"`
+	Favorites         []Favorite         `json:"favorites"`
+	ReadingStates     []ReadingState     `json:"reading_states"`
+	SeriesStatuses    []SeriesStatus     `json:"series_statuses"`
+	Comments          []ChapterComment   `json:"comments"`
+	Reports           []Report           `json:"reports"`
+	ShareLinks        []ShareLink        `json:"share_links"`
+	OfflineChapters   []OfflineChapter   `json:"offline_chapters"`
+	RecentlyViewed    []RecentVisit      `json:"recently_viewed"`
+	Activity          []ActivityLogEntry `json:"activity"`
+}
+
+// ExportUserData collects everything stored about a user in a single transaction. Only the records of the user are
+// included, the replies of others to their comments and the moderators handling their reports are left out.
+func ExportUserData(username string) (*UserDataExport, error) {
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &UserDataExport{
+		ExportedAt: time.Now(),
+		Profile: UserProfile{
+			Username:      user.Username,
+			Role:          user.Role,
+			Banned:        user.Banned,
+			LastVisitAt:   user.LastVisitAt,
+			UpdatesSince:  user.UpdatesSince,
+			ContentGateAt: user.ContentGateAt,
+		},
+		Preferences:       DefaultUserPreferences(),
+		ReaderPreferences: DefaultReaderPreferences(),
+	}
+	if user.Preferences != nil {
+		export.Preferences = *user.Preferences
+	}
+	if user.ReaderPreferences != nil {
+		export.ReaderPreferences = *user.ReaderPreferences
+	}
+
+	err = db.View(func(tx *bbolt.Tx) error {
+		var err error
+		if export.Favorites, err = userRecords(tx, "favorites", username, func(f Favorite) string { return f.Username }); err != nil {
+			return err
+		}
+		if export.ReadingStates, err = userRecords(tx, "reading_states", username, func(s ReadingState) string { return s.Username }); err != nil {
+			return err
+		}
+		if export.SeriesStatuses, err = userRecords(tx, "user_series_status", username, func(s SeriesStatus) string { return s.Username }); err != nil {
+			return err
+		}
+		if export.Comments, err = userRecords(tx, "chapter_comments", username, func(c ChapterComment) string { return c.Username }); err != nil {
+			return err
+		}
+		if export.Reports, err = userRecords(tx, "reports", username, func(r Report) string { return r.Reporter }); err != nil {
+			return err
+		}
+		if export.ShareLinks, err = userRecords(tx, "share_links", username, func(l ShareLink) string { return l.CreatedBy }); err != nil {
+			return err
+		}
+		if export.OfflineChapters, err = userRecords(tx, "offline_chapters", username, func(o OfflineChapter) string { return o.Username }); err != nil {
+			return err
+		}
+		if export.RecentlyViewed, err = recentVisits(tx.Bucket([]byte("recently_viewed")), username); err != nil {
+			return err
+		}
+		export.Activity, err = userRecords(tx, "activity_log", username, func(e ActivityLogEntry) string { return e.Actor })
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range export.Reports {
+		export.Reports[i].ResolvedBy = ""
+	}
+	return export, nil
+}
+
+// DeleteUserData deletes or anonymizes the reading states, comments, reports and activity of a user according to the
+// configured policy and removes the rest of their data, keeping the account itself
+func DeleteUserData(username string) error {
+	if err := deleteUserData(username, false); err != nil {
+		return err
+	}
+	log.Infof("Data of user '%s' has been deleted", username)
+	return nil
+}
+
+// deleteUserData removes the data of a user in a single transaction, along with the account when deleteAccount is
+// set, so a failure leaves everything in place. The reports they resolved name an anonymous placeholder either way.
+func deleteUserData(username string, deleteAccount bool) error {
+	user, err := FindUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	config, err := GetAppConfig()
+	if err != nil {
+		return err
+	}
+	anonymize := config.DeletedUserPolicy == DeletedUserPolicyAnonymize
+	placeholder, err := anonymousUsername()
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if anonymize {
+			if err := anonymizeReadingStates(tx, username, placeholder); err != nil {
+				return fmt.Errorf("failed to anonymize reading states: %w", err)
+			}
+			if err := anonymizeChapterComments(tx, username, placeholder); err != nil {
+				return fmt.Errorf("failed to anonymize comments: %w", err)
+			}
+		} else {
+			if err := deleteKeysWithPrefix(tx.Bucket([]byte("reading_states")), username+":"); err != nil {
+				return fmt.Errorf("failed to delete reading states: %w", err)
+			}
+			if err := deleteChapterCommentsByUsername(tx, username); err != nil {
+				return fmt.Errorf("failed to delete comments: %w", err)
+			}
+		}
+		if err := forgetReportUser(tx, username, placeholder, anonymize); err != nil {
+			return fmt.Errorf("failed to remove the user from reports: %w", err)
+		}
+		if err := forgetActivityActor(tx, username, placeholder, anonymize); err != nil {
+			return fmt.Errorf("failed to remove the user from the activity log: %w", err)
+		}
+
+		if err := deleteKeysWithPrefix(tx.Bucket([]byte("favorites")), username+":"); err != nil {
+			return fmt.Errorf("failed to delete favorites: %w", err)
+		}
+		if err := deleteKeysWithPrefix(tx.Bucket([]byte("user_series_status")), username+":"); err != nil {
+			return fmt.Errorf("failed to delete series statuses: %w", err)
+		}
+		if err := deleteKeysWithPrefix(tx.Bucket([]byte("offline_chapters")), username+":"); err != nil {
+			return fmt.Errorf("failed to delete offline chapters: %w", err)
+		}
+		if err := deleteShareLinks(tx, func(link ShareLink) bool { return link.CreatedBy == username }); err != nil {
+			return fmt.Errorf("failed to delete share links: %w", err)
+		}
+		if err := tx.Bucket([]byte("recently_viewed")).Delete([]byte(username)); err != nil {
+			return fmt.Errorf("failed to delete recently viewed series: %w", err)
+		}
+
+		users := tx.Bucket([]byte("users"))
+		if deleteAccount {
+			if err := users.Delete([]byte(username)); err != nil {
+				return fmt.Errorf("failed to delete user: %w", err)
+			}
+			return nil
+		}
+		user.Preferences = nil
+		user.ReaderPreferences = nil
+		if err := putJSON(users, username, user); err != nil {
+			return fmt.Errorf("failed to reset preferences: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The reports of the deleted comments are closed once they are gone
+	if !anonymize {
+		closeReportsWithoutTarget()
+	}
+	return nil
+}
+
+// userRecords decodes the records of a bucket owned by a user, owner returns the username a record belongs to
+func userRecords[T any](tx *bbolt.Tx, bucket, username string, owner func(T) string) ([]T, error) {
+	records := []T{}
+	err := tx.Bucket([]byte(bucket)).ForEach(func(_, v []byte) error {
+		var record T
+		if err := json.Unmarshal(v, &record); err != nil {
+			return err
+		}
+		if owner(record) == username {
+			records = append(records, record)
+		}
+		return nil
+	})
+	return records, err
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+// seedUserData creates a user "alice" with records in the buckets holding user data and a report by "bob" resolved by
+// alice
+func seedUserData(t *testing.T) {
+	t.Helper()
+	if err := CreateManga(Manga{Name: "Series"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"alice", "bob"} {
+		if err := CreateUser(username, "password123"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := MarkChapterRead("alice", "series", "chapter-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFavorite("alice", "series"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateChapterComment("series", "chapter-1", "alice", "First!", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateReport("alice", ReportTargetManga, "series", "Wrong cover"); err != nil {
+		t.Fatal(err)
+	}
+	report, err := CreateReport("bob", ReportTargetManga, "series", "Wrong title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ResolveReport(report.ID, "alice", ReportStatusResolved); err != nil {
+		t.Fatal(err)
+	}
+	if err := LogActivity("alice", "manga_update", "series"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// owners returns who the records of a bucket belong to
+func owners[T any](t *testing.T, bucket string, owner func(T) string) []string {
+	t.Helper()
+	var names []string
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(_, v []byte) error {
+			var record T
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			names = append(names, owner(record))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestDeleteUserDeletesTheirRecords(t *testing.T) {
+	setupTestDB(t)
+	seedUserData(t)
+
+	if err := DeleteUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := FindUserByUsername("alice"); err == nil {
+		t.Error("the account was kept")
+	}
+	for bucket, got := range map[string][]string{
+		"reading_states":   owners(t, "reading_states", func(s ReadingState) string { return s.Username }),
+		"favorites":        owners(t, "favorites", func(f Favorite) string { return f.Username }),
+		"chapter_comments": owners(t, "chapter_comments", func(c ChapterComment) string { return c.Username }),
+		"activity_log":     owners(t, "activity_log", func(e ActivityLogEntry) string { return e.Actor }),
+	} {
+		if len(got) != 0 {
+			t.Errorf("%s still holds %v", bucket, got)
+		}
+	}
+
+	reports := owners(t, "reports", func(r Report) string { return r.Reporter + " " + r.ResolvedBy })
+	if len(reports) != 1 {
+		t.Fatalf("got reports %v, want only the report filed by bob", reports)
+	}
+	reporter, resolver, _ := strings.Cut(reports[0], " ")
+	if reporter != "bob" || !strings.HasPrefix(resolver, "deleted-") {
+		t.Errorf("got report by '%s' resolved by '%s', want it resolved by a placeholder", reporter, resolver)
+	}
+}
+
+func TestDeleteUserDataAnonymizesTheirRecords(t *testing.T) {
+	setupTestDB(t)
+	seedUserData(t)
+	config, err := GetAppConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DeletedUserPolicy = DeletedUserPolicyAnonymize
+	if err := UpdateAppConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteUserData("alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := FindUserByUsername("alice"); err != nil {
+		t.Errorf("the account was deleted: %v", err)
+	}
+	if got := owners(t, "favorites", func(f Favorite) string { return f.Username }); len(got) != 0 {
+		t.Errorf("favorites still holds %v", got)
+	}
+
+	var placeholder string
+	for bucket, got := range map[string][]string{
+		"reading_states":   owners(t, "reading_states", func(s ReadingState) string { return s.Username }),
+		"chapter_comments": owners(t, "chapter_comments", func(c ChapterComment) string { return c.Username }),
+		"activity_log":     owners(t, "activity_log", func(e ActivityLogEntry) string { return e.Actor }),
+		"reports":          owners(t, "reports", func(r Report) string { return r.Reporter }),
+	} {
+		for _, owner := range got {
+			if owner == "alice" {
+				t.Errorf("%s still names alice", bucket)
+			}
+			if strings.HasPrefix(owner, "deleted-") {
+				if placeholder != "" && owner != placeholder {
+					t.Errorf("%s names '%s', want the placeholder '%s'", bucket, owner, placeholder)
+				}
+				placeholder = owner
+			}
+		}
+	}
+	if placeholder == "" {
+		t.Fatal("no record was moved to a placeholder")
+	}
+	for _, resolver := range owners(t, "reports", func(r Report) string { return r.ResolvedBy }) {
+		if resolver == "alice" {
+			t.Error("a report is still resolved by alice")
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func TestCreateUserWithRole(t *testing.T) {
+	setupTestDB(t)
+
+	// The first user becomes an admin whatever the role
+	if err := CreateUserWithRole("first", "password123", "reader"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateUserWithRole("second", "password123", "moderator"); err != nil {
+		t.Fatal(err)
+	}
+	for username, want := range map[string]string{"first": "admin", "second": "moderator"} {
+		user, err := FindUserByUsername(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != want {
+			t.Errorf("got role '%s' for '%s', want '%s'", user.Role, username, want)
+		}
+	}
+
+	if err := CreateUserWithRole("third", "password123", "superuser"); err == nil {
+		t.Error("created a user with an invalid role")
+	}
+	if _, err := FindUserByUsername("third"); err == nil {
+		t.Error("a failed creation left the account behind")
+	}
+
+	if err := CreateUserWithRole("second", "password123", "reader"); err == nil {
+		t.Error("created the same user twice")
+	}
+	if user, err := FindUserByUsername("second"); err != nil || user.Role != "moderator" {
+		t.Errorf("creating an existing user changed it: %+v, %v", user, err)
+	}
+}
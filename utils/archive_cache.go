@@ -0,0 +1,330 @@
+package utils
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// ArchiveCacheSettings bounds the caches kept for chapter archives
+type ArchiveCacheSettings struct {
+	// IndexEntries is the number of archive page listings kept in memory, 0 disables the listing cache
+	IndexEntries int
+	// ExtractPages extracts every page of an archive to disk on its first open
+	ExtractPages bool
+	// MaxExtractedBytes is the disk space the extracted pages may take
+	MaxExtractedBytes int64
+	// TTL evicts listings and extracted pages unused for longer, 0 keeps them until evicted for space
+	TTL time.Duration
+}
+
+// archiveSource identifies the state of a chapter file, a cached entry is stale once it differs
+type archiveSource struct {
+	size    int64
+	modTime time.Time
+}
+
+func (s archiveSource) matches(other archiveSource) bool {
+	return s.size == other.size && s.modTime.Equal(other.modTime)
+}
+
+type archiveIndex struct {
+	path   string
+	source archiveSource
+	images []string
+	usedAt time.Time
+}
+
+type extractedArchive struct {
+	dir    string
+	source archiveSource
+	pages  []string
+	bytes  int64
+	usedAt time.Time
+}
+
+var (
+	archiveCacheMutex sync.Mutex
+	archiveSettings   ArchiveCacheSettings
+	archiveIndexes    = list.New()
+	archiveIndexByKey = make(map[string]*list.Element)
+	extractedPages    = make(map[string]*extractedArchive)
+	extractedBytes    int64
+	pageCacheDir      string
+
+	// extractMutex serializes extractions, so a chapter opened by several readers at once is extracted once
+	extractMutex sync.Mutex
+)
+
+// InitializeArchiveCache sets the directory of the extracted pages, pages left over from a previous run are removed
+func InitializeArchiveCache(dir string) error {
+	archiveCacheMutex.Lock()
+	defer archiveCacheMutex.Unlock()
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	pageCacheDir = dir
+	return nil
+}
+
+// SetArchiveCacheSettings applies new bounds to the archive caches, evicting what no longer fits
+func SetArchiveCacheSettings(settings ArchiveCacheSettings) {
+	archiveCacheMutex.Lock()
+	defer archiveCacheMutex.Unlock()
+
+	archiveSettings = settings
+	if !settings.ExtractPages {
+		for path := range extractedPages {
+			removeExtractedLocked(path)
+		}
+	}
+	evictArchiveCachesLocked(time.Now())
+}
+
+// CachedChapterImages lists the pages of a chapter like ListChapterImages, reusing the listing of an unchanged archive
+func CachedChapterImages(chapterPath string) ([]string, error) {
+	source, err := statArchive(chapterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	archiveCacheMutex.Lock()
+	if element, ok := archiveIndexByKey[chapterPath]; ok {
+		index := element.Value.(*archiveIndex)
+		if index.source.matches(source) {
+			index.usedAt = time.Now()
+			archiveIndexes.MoveToFront(element)
+			images := index.images
+			archiveCacheMutex.Unlock()
+			return images, nil
+		}
+		archiveIndexes.Remove(element)
+		delete(archiveIndexByKey, chapterPath)
+	}
+	archiveCacheMutex.Unlock()
+
+	images, err := ListChapterImages(chapterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	archiveCacheMutex.Lock()
+	defer archiveCacheMutex.Unlock()
+	if archiveSettings.IndexEntries > 0 {
+		if _, ok := archiveIndexByKey[chapterPath]; !ok {
+			index := &archiveIndex{path: chapterPath, source: source, images: images, usedAt: time.Now()}
+			archiveIndexByKey[chapterPath] = archiveIndexes.PushFront(index)
+		}
+	}
+	evictArchiveCachesLocked(time.Now())
+	return images, nil
+}
+
+// OpenCachedChapterPage opens a page of a chapter as listed by CachedChapterImages, from the extracted pages when
+// extraction is enabled, extracting the whole archive on its first open
+func OpenCachedChapterPage(chapterPath string, images []string, page int) (io.ReadCloser, error) {
+	if page < 0 || page >= len(images) {
+		return nil, fmt.Errorf("page out of range: %d", page+1)
+	}
+
+	format := ChapterFormatOf(chapterPath)
+	if format == nil || format.Archive == ArchiveFolder || !extractionEnabled() {
+		return OpenChapterImage(chapterPath, images[page])
+	}
+
+	source, err := statArchive(chapterPath)
+	if err != nil {
+		return nil, err
+	}
+	if file, ok := openExtractedPage(chapterPath, source, page); ok {
+		return file, nil
+	}
+
+	// Pages are read from the archive while the disk is too full to extract them
+	if err := extractArchive(chapterPath, source, images); errors.Is(err, ErrLowDiskSpace) {
+		return OpenChapterImage(chapterPath, images[page])
+	} else if err != nil {
+		return nil, err
+	}
+	if file, ok := openExtractedPage(chapterPath, source, page); ok {
+		return file, nil
+	}
+	// The pages did not fit the cache or were evicted right away
+	return OpenChapterImage(chapterPath, images[page])
+}
+
+func extractionEnabled() bool {
+	archiveCacheMutex.Lock()
+	defer archiveCacheMutex.Unlock()
+	return archiveSettings.ExtractPages && pageCacheDir != ""
+}
+
+// openExtractedPage opens an extracted page while holding the cache lock, so it can't be evicted in between
+func openExtractedPage(chapterPath string, source archiveSource, page int) (*os.File, bool) {
+	archiveCacheMutex.Lock()
+	defer archiveCacheMutex.Unlock()
+
+	extracted, ok := extractedPages[chapterPath]
+	if !ok {
+		return nil, false
+	}
+	if !extracted.source.matches(source) || len(extracted.pages) <= page {
+		removeExtractedLocked(chapterPath)
+		return nil, false
+	}
+
+	file, err := os.Open(filepath.Join(extracted.dir, extracted.pages[page]))
+	if err != nil {
+		removeExtractedLocked(chapterPath)
+		return nil, false
+	}
+	extracted.usedAt = time.Now()
+	return file, true
+}
+
+// extractArchive writes every page of a chapter archive to the page cache directory
+func extractArchive(chapterPath string, source archiveSource, images []string) error {
+	if err := EnsureCacheSpace(); err != nil {
+		return err
+	}
+
+	extractMutex.Lock()
+	defer extractMutex.Unlock()
+
+	archiveCacheMutex.Lock()
+	if extracted, ok := extractedPages[chapterPath]; ok && extracted.source.matches(source) {
+		archiveCacheMutex.Unlock()
+		return nil
+	}
+	removeExtractedLocked(chapterPath)
+	sum := sha1.Sum([]byte(chapterPath))
+	dir := filepath.Join(pageCacheDir, hex.EncodeToString(sum[:]))
+	archiveCacheMutex.Unlock()
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	pages := make([]string, len(images))
+	var size int64
+	for i, image := range images {
+		pages[i] = fmt.Sprintf("%04d%s", i+1, filepath.Ext(image))
+		written, err := extractPage(chapterPath, image, filepath.Join(dir, pages[i]))
+		if err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+		size += written
+	}
+
+	archiveCacheMutex.Lock()
+	defer archiveCacheMutex.Unlock()
+	extractedPages[chapterPath] = &extractedArchive{dir: dir, source: source, pages: pages, bytes: size, usedAt: time.Now()}
+	extractedBytes += size
+	evictArchiveCachesLocked(time.Now())
+	return nil
+}
+
+func extractPage(chapterPath, image, destination string) (int64, error) {
+	reader, err := OpenChapterImage(chapterPath, image)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	file, err := os.Create(destination)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return io.Copy(file, reader)
+}
+
+// evictArchiveCachesLocked drops expired entries, then the least recently used ones until the caches fit their bounds
+func evictArchiveCachesLocked(now time.Time) {
+	expired := func(usedAt time.Time) bool {
+		return archiveSettings.TTL > 0 && now.Sub(usedAt) > archiveSettings.TTL
+	}
+
+	for element := archiveIndexes.Back(); element != nil; {
+		previous := element.Prev()
+		index := element.Value.(*archiveIndex)
+		if expired(index.usedAt) || archiveIndexes.Len() > archiveSettings.IndexEntries {
+			archiveIndexes.Remove(element)
+			delete(archiveIndexByKey, index.path)
+		}
+		element = previous
+	}
+
+	for path, extracted := range extractedPages {
+		if expired(extracted.usedAt) {
+			removeExtractedLocked(path)
+		}
+	}
+	for extractedBytes > archiveSettings.MaxExtractedBytes && len(extractedPages) > 0 {
+		removeExtractedLocked(oldestExtractedLocked())
+	}
+}
+
+// evictExtractedPages removes the least recently used extracted pages until at least the given number of bytes was
+// freed, returning how many were
+func evictExtractedPages(bytes int64) int64 {
+	archiveCacheMutex.Lock()
+	defer archiveCacheMutex.Unlock()
+
+	var freed int64
+	for freed < bytes && len(extractedPages) > 0 {
+		oldest := oldestExtractedLocked()
+		freed += extractedPages[oldest].bytes
+		removeExtractedLocked(oldest)
+	}
+	return freed
+}
+
+// oldestExtractedLocked returns the chapter whose extracted pages were used the longest ago
+func oldestExtractedLocked() string {
+	oldest := ""
+	for path, extracted := range extractedPages {
+		if oldest == "" || extracted.usedAt.Before(extractedPages[oldest].usedAt) {
+			oldest = path
+		}
+	}
+	return oldest
+}
+
+func removeExtractedLocked(chapterPath string) {
+	extracted, ok := extractedPages[chapterPath]
+	if !ok {
+		return
+	}
+	delete(extractedPages, chapterPath)
+	extractedBytes -= extracted.bytes
+	if err := os.RemoveAll(extracted.dir); err != nil {
+		log.Errorf("Failed to remove extracted pages '%s': %v", extracted.dir, err)
+	}
+}
+
+func statArchive(chapterPath string) (archiveSource, error) {
+	size, modTime, err := ChapterFileInfo(chapterPath)
+	if err != nil {
+		return archiveSource{}, err
+	}
+	return archiveSource{size: size, modTime: modTime}, nil
+}
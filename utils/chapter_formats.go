@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+// Archive kinds a chapter format can be read as
+const (
+	ArchiveZip    = "zip"
+	ArchiveRar    = "rar"
+	ArchiveTar    = "tar"
+	ArchiveFolder = "folder"
+)
+
+// ChapterFormat describes a chapter file format, identified by its file extensions
+type ChapterFormat struct {
+	Name       string
+	Extensions []string
+	Archive    string
+}
+
+// ChapterFormats is the single registry of chapter file formats that can be indexed and read
+var ChapterFormats = []ChapterFormat{
+	{Name: "cbz", Extensions: []string{".cbz"}, Archive: ArchiveZip},
+	{Name: "zip", Extensions: []string{".zip"}, Archive: ArchiveZip},
+	{Name: "cbr", Extensions: []string{".cbr"}, Archive: ArchiveRar},
+	{Name: "rar", Extensions: []string{".rar"}, Archive: ArchiveRar},
+	{Name: "cbt", Extensions: []string{".cbt"}, Archive: ArchiveTar},
+	{Name: "tar", Extensions: []string{".tar", ".tar.gz", ".tgz"}, Archive: ArchiveTar},
+	{Name: "folder", Archive: ArchiveFolder},
+}
+
+// Label describes the format by its extensions, folders of loose images have none
+func (f ChapterFormat) Label() string {
+	if f.Archive == ArchiveFolder {
+		return "image folders"
+	}
+	return strings.Join(f.Extensions, ", ")
+}
+
+// GetChapterFormat returns the chapter format of a file based on its extension, or nil if unsupported
+func GetChapterFormat(fileName string) *ChapterFormat {
+	lowerName := strings.ToLower(fileName)
+	for i, format := range ChapterFormats {
+		for _, ext := range format.Extensions {
+			if strings.HasSuffix(lowerName, ext) {
+				return &ChapterFormats[i]
+			}
+		}
+	}
+	return nil
+}
+
+// ChapterFormatOf returns the chapter format of a file or folder on disk, or nil if unsupported
+func ChapterFormatOf(path string) *ChapterFormat {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if !info.IsDir() {
+		return GetChapterFormat(path)
+	}
+	for i, format := range ChapterFormats {
+		if format.Archive == ArchiveFolder {
+			return &ChapterFormats[i]
+		}
+	}
+	return nil
+}
+
+// ChapterFormatNames returns the names of every registered chapter format
+func ChapterFormatNames() []string {
+	names := make([]string, len(ChapterFormats))
+	for i, format := range ChapterFormats {
+		names[i] = format.Name
+	}
+	return names
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetChapterFormat(t *testing.T) {
+	for name, want := range map[string]string{
+		"Chapter 1.cbz":    "cbz",
+		"Chapter 1.CBR":    "cbr",
+		"Chapter 1.tar.gz": "tar",
+		"Chapter 1.tgz":    "tar",
+		"Chapter 1.zip":    "zip",
+	} {
+		if format := GetChapterFormat(name); format == nil || format.Name != want {
+			t.Errorf("GetChapterFormat(%q) = %v, want '%s'", name, format, want)
+		}
+	}
+	for _, name := range []string{"Chapter 1.pdf", "cover.jpg", "Chapter 1"} {
+		if format := GetChapterFormat(name); format != nil {
+			t.Errorf("GetChapterFormat(%q) = '%s', want no format", name, format.Name)
+		}
+	}
+}
+
+func TestChapterFormatOf(t *testing.T) {
+	dir := t.TempDir()
+	if format := ChapterFormatOf(dir); format == nil || format.Name != "folder" {
+		t.Errorf("got %v for a folder, want 'folder'", format)
+	}
+	archive := filepath.Join(dir, "Chapter 1.cbz")
+	if err := os.WriteFile(archive, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if format := ChapterFormatOf(archive); format == nil || format.Name != "cbz" {
+		t.Errorf("got %v for a cbz file, want 'cbz'", format)
+	}
+	if format := ChapterFormatOf(filepath.Join(dir, "missing.cbz")); format != nil {
+		t.Errorf("got '%s' for a missing file, want no format", format.Name)
+	}
+}
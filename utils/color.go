@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+// accentSampleSize is the width and height covers are downscaled to before counting their colors
+const accentSampleSize = 32
+
+// DominantColor returns the most common color of an image as a hex string, ignoring near black and near white
+// pixels so borders and backgrounds don't win.
+func DominantColor(path string) (string, error) {
+	img, err := openImage(path)
+	if err != nil {
+		return "", err
+	}
+	sample := resize.Resize(accentSampleSize, accentSampleSize, img, resize.Bilinear)
+
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	var best *bucket
+
+	bounds := sample.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r16, g16, b16, a16 := sample.At(x, y).RGBA()
+			if a16 < 0x8000 {
+				continue
+			}
+			r, g, b := int(r16>>8), int(g16>>8), int(b16>>8)
+			if max(r, g, b) < 32 || min(r, g, b) > 224 {
+				continue
+			}
+
+			// Group similar colors by keeping the upper 4 bits of each channel
+			key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+			bk, ok := buckets[key]
+			if !ok {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.r += r
+			bk.g += g
+			bk.b += b
+			if best == nil || bk.count > best.count {
+				best = bk
+			}
+		}
+	}
+
+	if best == nil {
+		return "", fmt.Errorf("no dominant color found in %s", path)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count), nil
+}
+
+// CoverAccentColor returns the dominant color of a cached cover, preferring its uncropped original,
+// or an empty string when the cover is missing or has no usable color
+func CoverAccentColor(cacheDir, coverArtURL string) string {
+	name := filepath.Base(coverArtURL)
+	if !strings.Contains(coverArtURL, "/api/images/") || name == "" {
+		return ""
+	}
+
+	ext := filepath.Ext(name)
+	for _, candidate := range []string{strings.TrimSuffix(name, ext) + "_original" + ext, name} {
+		path := filepath.Join(cacheDir, candidate)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		color, err := DominantColor(path)
+		if err != nil {
+			return ""
+		}
+		return color
+	}
+	return ""
+}
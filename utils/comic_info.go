@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nwaples/rardecode"
+)
+
+const (
+	// comicInfoName is the metadata file ComicRack and most taggers store in chapter archives
+	comicInfoName = "comicinfo.xml"
+	// maxComicInfoSize limits how much of a metadata file is read, real ones are a few kilobytes
+	maxComicInfoSize = 1 << 20
+)
+
+// ComicInfo holds the fields of a ComicInfo.xml used by the indexer
+type ComicInfo struct {
+	Series string `xml:"Series"`
+	Title  string `xml:"Title"`
+}
+
+// ReadComicInfo reads the ComicInfo.xml of a chapter archive or folder, returning nil when the chapter has none
+func ReadComicInfo(chapterPath string) (*ComicInfo, error) {
+	format := ChapterFormatOf(chapterPath)
+	if format == nil {
+		return nil, fmt.Errorf("unsupported file type")
+	}
+
+	var data []byte
+	var err error
+	switch format.Archive {
+	case ArchiveZip:
+		data, err = readZipComicInfo(chapterPath)
+	case ArchiveRar:
+		data, err = readRarComicInfo(chapterPath)
+	case ArchiveFolder:
+		data, err = readFolderComicInfo(chapterPath)
+	default:
+		data, err = readTarComicInfo(chapterPath)
+	}
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var info ComicInfo
+	if err := xml.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", comicInfoName, err)
+	}
+	info.Series = strings.TrimSpace(info.Series)
+	info.Title = strings.TrimSpace(info.Title)
+	return &info, nil
+}
+
+// isComicInfo reports whether an entry of a chapter is its metadata file, wherever it sits in the archive
+func isComicInfo(name string) bool {
+	return strings.EqualFold(path.Base(filepath.ToSlash(name)), comicInfoName)
+}
+
+func readLimited(reader io.Reader) ([]byte, error) {
+	return io.ReadAll(io.LimitReader(reader, maxComicInfoSize))
+}
+
+func readZipComicInfo(zipPath string) ([]byte, error) {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() || !isComicInfo(file.Name) {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return readLimited(rc)
+	}
+	return nil, nil
+}
+
+func readRarComicInfo(rarPath string) ([]byte, error) {
+	file, err := os.Open(rarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := rardecode.NewReader(file, "")
+	if err != nil {
+		return nil, err
+	}
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !header.IsDir && isComicInfo(header.Name) {
+			return readLimited(reader)
+		}
+	}
+}
+
+func readTarComicInfo(tarPath string) ([]byte, error) {
+	reader, closer, err := openTarReader(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && isComicInfo(header.Name) {
+			return readLimited(reader)
+		}
+	}
+}
+
+func readFolderComicInfo(folderPath string) ([]byte, error) {
+	entries, err := os.ReadDir(folderPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !isComicInfo(entry.Name()) {
+			continue
+		}
+		file, err := os.Open(filepath.Join(folderPath, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return readLimited(file)
+	}
+	return nil, nil
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// ErrLowDiskSpace is returned instead of writing to the cache while the free disk space is below the minimum
+var ErrLowDiskSpace = errors.New("not enough free disk space to write to the cache")
+
+// lowSpaceWarningInterval throttles the warning logged for skipped cache writes, an index can attempt thousands
+const lowSpaceWarningInterval = time.Minute
+
+// CacheSpaceSettings configures the guard checking the free disk space before cache writes
+type CacheSpaceSettings struct {
+	// MinFreeBytes is the free space kept on the disk of the cache, 0 disables the guard
+	MinFreeBytes uint64
+	// Evict removes the least recently used extracted pages to get back above the minimum before giving up
+	Evict bool
+}
+
+var (
+	cacheSpaceMutex    sync.Mutex
+	cacheSpaceDir      string
+	cacheSpaceSettings CacheSpaceSettings
+	lowSpaceWarnedAt   time.Time
+)
+
+// InitializeCacheSpaceGuard sets the directory whose disk the free space is checked on
+func InitializeCacheSpaceGuard(dir string) {
+	cacheSpaceMutex.Lock()
+	defer cacheSpaceMutex.Unlock()
+	cacheSpaceDir = dir
+}
+
+// SetCacheSpaceSettings applies new settings to the free disk space guard
+func SetCacheSpaceSettings(settings CacheSpaceSettings) {
+	cacheSpaceMutex.Lock()
+	defer cacheSpaceMutex.Unlock()
+	cacheSpaceSettings = settings
+}
+
+// CacheFreeSpace returns the free space on the disk of the cache and whether it is below the minimum
+func CacheFreeSpace() (uint64, bool, error) {
+	cacheSpaceMutex.Lock()
+	dir, settings := cacheSpaceDir, cacheSpaceSettings
+	cacheSpaceMutex.Unlock()
+
+	if dir == "" {
+		return 0, false, errors.New("the cache space guard is not initialized")
+	}
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		return 0, false, err
+	}
+	return free, free < settings.MinFreeBytes, nil
+}
+
+// EnsureCacheSpace checks the free disk space before writing to the cache, evicting extracted pages when allowed.
+// ErrLowDiskSpace means the write should be skipped, a disk whose free space can't be read doesn't block writes.
+func EnsureCacheSpace() error {
+	cacheSpaceMutex.Lock()
+	settings := cacheSpaceSettings
+	cacheSpaceMutex.Unlock()
+	if settings.MinFreeBytes == 0 {
+		return nil
+	}
+
+	free, low, err := CacheFreeSpace()
+	if err != nil {
+		log.Debugf("Failed to read the free disk space of the cache: %v", err)
+		return nil
+	}
+	if !low {
+		return nil
+	}
+
+	if settings.Evict {
+		if freed := evictExtractedPages(int64(settings.MinFreeBytes - free)); freed > 0 {
+			log.Infof("Evicted %d MB of extracted pages, the cache disk is low on space", freed/(1024*1024))
+			if free, low, err = CacheFreeSpace(); err != nil || !low {
+				return nil
+			}
+		}
+	}
+
+	cacheSpaceMutex.Lock()
+	warn := time.Since(lowSpaceWarnedAt) >= lowSpaceWarningInterval
+	if warn {
+		lowSpaceWarnedAt = time.Now()
+	}
+	cacheSpaceMutex.Unlock()
+	if warn {
+		log.Warnf("Skipping cache writes, only %d MB are free on the cache disk (minimum %d MB)", free/(1024*1024), settings.MinFreeBytes/(1024*1024))
+	}
+	return ErrLowDiskSpace
+}
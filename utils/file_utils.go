@@ -7,147 +7,320 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/nwaples/rardecode"
 )
 
-// CountImageFiles counts the number of image files in an archive (zip, cbz, rar, or cbr).
-func CountImageFiles(archiveFilePath string) (int, error) {
-	lowerPath := strings.ToLower(archiveFilePath)
-	if strings.HasSuffix(lowerPath, ".zip") || strings.HasSuffix(lowerPath, ".cbz") {
-		return countImageFilesInZip(archiveFilePath)
-	} else if strings.HasSuffix(lowerPath, ".rar") || strings.HasSuffix(lowerPath, ".cbr") {
-		return countImageFilesInRar(archiveFilePath)
-	} else {
-		return 0, fmt.Errorf("unsupported file type")
-	}
+// CountImageFiles counts the number of image files in a chapter archive or folder.
+func CountImageFiles(chapterPath string) (int, error) {
+	images, err := ListChapterImages(chapterPath)
+	return len(images), err
 }
 
-// countImageFilesInZip counts the number of image files in a zip archive.
-func countImageFilesInZip(zipFilePath string) (int, error) {
-	zipFile, err := zip.OpenReader(zipFilePath)
+// ChapterFileInfo returns the size and latest modification time of a chapter archive, or of the files in a chapter folder.
+func ChapterFileInfo(chapterPath string) (int64, time.Time, error) {
+	info, err := os.Stat(chapterPath)
 	if err != nil {
-		return 0, err
+		return 0, time.Time{}, err
+	}
+	if !info.IsDir() {
+		return info.Size(), info.ModTime(), nil
 	}
-	defer zipFile.Close()
 
-	imageCount := 0
-	for _, file := range zipFile.File {
-		if isImageFile(file.Name) {
-			imageCount++
+	entries, err := os.ReadDir(chapterPath)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	size, modTime := int64(0), info.ModTime()
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		entryInfo, err := entry.Info()
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		size += entryInfo.Size()
+		if entryInfo.ModTime().After(modTime) {
+			modTime = entryInfo.ModTime()
 		}
 	}
-	return imageCount, nil
+	return size, modTime, nil
 }
 
-// countImageFilesInRar counts the number of image files in a rar archive.
-func countImageFilesInRar(rarFilePath string) (int, error) {
-	rarFile, err := os.Open(rarFilePath)
-	if err != nil {
-		return 0, err
+// ListChapterImages returns the image entries of a chapter archive or folder in natural page order.
+func ListChapterImages(chapterPath string) ([]string, error) {
+	format := ChapterFormatOf(chapterPath)
+	if format == nil {
+		return nil, fmt.Errorf("unsupported file type")
 	}
-	defer rarFile.Close()
 
-	rarReader, err := rardecode.NewReader(rarFile, "")
+	var images []string
+	var err error
+	switch format.Archive {
+	case ArchiveZip:
+		images, err = listZipImages(chapterPath)
+	case ArchiveRar:
+		images, err = listRarImages(chapterPath)
+	case ArchiveFolder:
+		images, err = listFolderImages(chapterPath)
+	default:
+		images, err = ListTarImages(chapterPath)
+	}
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	imageCount := 0
-	for {
-		header, err := rarReader.Next()
+	NaturalSort(images)
+	return images, nil
+}
+
+// OpenChapterImage returns a reader for an image entry of a chapter archive or folder, as listed by ListChapterImages.
+func OpenChapterImage(chapterPath, entryName string) (io.ReadCloser, error) {
+	format := ChapterFormatOf(chapterPath)
+	if format == nil {
+		return nil, fmt.Errorf("unsupported file type")
+	}
+
+	switch format.Archive {
+	case ArchiveZip:
+		return openZipEntry(chapterPath, entryName)
+	case ArchiveRar:
+		return openRarEntry(chapterPath, entryName)
+	case ArchiveFolder:
+		return os.Open(filepath.Join(chapterPath, filepath.Base(entryName)))
+	default:
+		return OpenTarEntry(chapterPath, entryName)
+	}
+}
+
+// ChapterImageSizes returns the uncompressed size of every image entry of a chapter archive or folder, keyed by the
+// entry names listed by ListChapterImages.
+func ChapterImageSizes(chapterPath string) (map[string]int64, error) {
+	format := ChapterFormatOf(chapterPath)
+	if format == nil {
+		return nil, fmt.Errorf("unsupported file type")
+	}
+
+	sizes := make(map[string]int64)
+	switch format.Archive {
+	case ArchiveZip:
+		reader, err := zip.OpenReader(chapterPath)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		for _, file := range reader.File {
+			sizes[file.Name] = int64(file.UncompressedSize64)
+		}
+	case ArchiveRar:
+		file, err := os.Open(chapterPath)
 		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader, err := rardecode.NewReader(file, "")
+		if err != nil {
+			return nil, err
+		}
+		for {
+			header, err := reader.Next()
 			if err == io.EOF {
 				break
 			}
-			return 0, err
+			if err != nil {
+				return nil, err
+			}
+			sizes[header.Name] = header.UnPackedSize
+		}
+	case ArchiveFolder:
+		images, err := listFolderImages(chapterPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			info, err := os.Stat(filepath.Join(chapterPath, image))
+			if err != nil {
+				return nil, err
+			}
+			sizes[image] = info.Size()
 		}
-		if isImageFile(header.Name) {
-			imageCount++
+	default:
+		reader, closer, err := openTarReader(chapterPath)
+		if err != nil {
+			return nil, err
+		}
+		defer closer.Close()
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			sizes[header.Name] = header.Size
 		}
 	}
-	return imageCount, nil
+	return sizes, nil
 }
 
-// ExtractFirstImage extracts the first image from an archive and saves it to the output folder.
-func ExtractFirstImage(archivePath, outputFolder string) error {
-	ext := strings.ToLower(filepath.Ext(archivePath))
-	switch ext {
-	case ".zip", ".cbz":
-		return extractFirstImageFromZip(archivePath, outputFolder)
-	case ".rar", ".cbr":
-		return extractFirstImageFromRar(archivePath, outputFolder)
-	default:
-		return fmt.Errorf("unsupported archive format: %s", ext)
+// ExtractFirstImage extracts the first page of a chapter archive or folder and saves it to the output folder.
+func ExtractFirstImage(chapterPath, outputFolder string) error {
+	images, err := ListChapterImages(chapterPath)
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("no image file found in the archive")
+	}
+
+	reader, err := OpenChapterImage(chapterPath, images[0])
+	if err != nil {
+		return err
 	}
+	defer reader.Close()
+
+	return extractFileFromReader(reader, images[0], outputFolder)
 }
 
-func extractFirstImageFromZip(zipPath, outputFolder string) error {
+// listZipImages lists the image entries of a zip archive, skipping entries with path traversal.
+func listZipImages(zipPath string) ([]string, error) {
 	reader, err := zip.OpenReader(zipPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer reader.Close()
 
+	var images []string
 	for _, file := range reader.File {
-		if !strings.Contains(file.Name, "..") {
-			if isImageFile(file.Name) {
-				return extractZipFile(file, outputFolder)
-			}
+		if !file.FileInfo().IsDir() && !strings.Contains(file.Name, "..") && isImageFile(file.Name) {
+			images = append(images, file.Name)
+		}
+	}
+	return images, nil
+}
+
+// openZipEntry returns a reader for a named entry of a zip archive, closing the archive along with the entry.
+func openZipEntry(zipPath, entryName string) (io.ReadCloser, error) {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range reader.File {
+		if file.Name != entryName {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			reader.Close()
+			return nil, err
 		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{rc, multiCloser{rc, reader}}, nil
 	}
-	return fmt.Errorf("no image file found in the archive")
+
+	reader.Close()
+	return nil, fmt.Errorf("entry not found in archive: %s", entryName)
 }
 
-func extractFirstImageFromRar(rarPath, outputFolder string) error {
+// listRarImages lists the image entries of a rar archive.
+func listRarImages(rarPath string) ([]string, error) {
 	file, err := os.Open(rarPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer file.Close()
 
 	reader, err := rardecode.NewReader(file, "")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var images []string
 	for {
 		header, err := reader.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if isImageFile(header.Name) {
-			return extractRarFile(reader, header.Name, outputFolder)
+		if !header.IsDir && isImageFile(header.Name) {
+			images = append(images, header.Name)
 		}
 	}
-	return fmt.Errorf("no image file found in the archive")
+	return images, nil
 }
 
-func extractZipFile(file *zip.File, outputFolder string) error {
-	src, err := file.Open()
+// openRarEntry returns a reader positioned at the named entry of a rar archive.
+func openRarEntry(rarPath, entryName string) (io.ReadCloser, error) {
+	file, err := os.Open(rarPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer src.Close()
 
-	outputPath := filepath.Join(outputFolder, file.Name)
-	if !strings.HasPrefix(filepath.Clean(outputPath), filepath.Clean(outputFolder) + string(os.PathSeparator)) {
-		return fmt.Errorf("invalid file path: %s", outputPath)
+	reader, err := rardecode.NewReader(file, "")
+	if err != nil {
+		file.Close()
+		return nil, err
 	}
-	dst, err := os.Create(outputPath)
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if !header.IsDir && header.Name == entryName {
+			return struct {
+				io.Reader
+				io.Closer
+			}{reader, file}, nil
+		}
+	}
+
+	file.Close()
+	return nil, fmt.Errorf("entry not found in archive: %s", entryName)
+}
+
+// listFolderImages lists the image files directly inside a chapter folder.
+func listFolderImages(folderPath string) ([]string, error) {
+	entries, err := os.ReadDir(folderPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer dst.Close()
 
-	_, err = io.Copy(dst, src)
-	return err
+	var images []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isImageFile(entry.Name()) {
+			images = append(images, entry.Name())
+		}
+	}
+	return images, nil
+}
+
+// multiCloser closes every closer in order, returning the first error.
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var first error
+	for _, closer := range m {
+		if err := closer.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
 }
 
-func extractRarFile(reader io.Reader, fileName, outputFolder string) error {
+func extractFileFromReader(reader io.Reader, fileName, outputFolder string) error {
 	outputPath := filepath.Join(outputFolder, filepath.Base(fileName))
 	dst, err := os.Create(outputPath)
 	if err != nil {
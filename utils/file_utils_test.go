@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestListChapterImagesOfAFolder(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Chapter 1")
+	if err := os.MkdirAll(filepath.Join(dir, "extras"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"page_10.png", "page_2.png", "page_1.png", "notes.txt", "extras/1.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("page"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	images, err := ListChapterImages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"page_1.png", "page_2.png", "page_10.png"}; !slices.Equal(images, want) {
+		t.Errorf("got %v, want %v", images, want)
+	}
+}
+
+func TestListChapterImagesOfAnArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Chapter 1.cbz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := zip.NewWriter(file)
+	for _, name := range []string{"10.jpg", "9.jpg", "01.jpg", "../escape.jpg", "ComicInfo.xml"} {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write([]byte("page"))
+	}
+	writer.Close()
+	file.Close()
+
+	images, err := ListChapterImages(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"01.jpg", "9.jpg", "10.jpg"}; !slices.Equal(images, want) {
+		t.Errorf("got %v, want %v", images, want)
+	}
+}
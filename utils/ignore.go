@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName is the file in a library folder listing the series and chapters the indexer skips
+const IgnoreFileName = ".magiignore"
+
+// IgnoreRules holds gitignore style patterns, a later matching pattern overrides the earlier ones
+type IgnoreRules []ignoreRule
+
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ParseIgnorePatterns parses one pattern per line, skipping blank lines and # comments.
+// A leading ! re-includes a path, a trailing / only matches folders and a pattern containing
+// a / is matched against the whole path relative to the library folder instead of the name.
+func ParseIgnorePatterns(patterns string) (IgnoreRules, error) {
+	var rules IgnoreRules
+	for i, line := range strings.Split(patterns, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			return nil, fmt.Errorf("invalid ignore pattern on line %d", i+1)
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern on line %d: %s", i+1, line)
+		}
+
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// LoadIgnoreFile reads the ignore file of a library folder, a folder without one has no rules
+func LoadIgnoreFile(folder string) (IgnoreRules, error) {
+	content, err := os.ReadFile(filepath.Join(folder, IgnoreFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseIgnorePatterns(string(content))
+}
+
+// Ignored reports whether a path relative to the library folder should be skipped
+func (r IgnoreRules) Ignored(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(relPath)
+	ignored := false
+	for _, rule := range r {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.matches(relPath) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func (r ignoreRule) matches(relPath string) bool {
+	name := path.Base(relPath)
+	if r.anchored {
+		name = relPath
+	}
+	matched, _ := path.Match(r.pattern, name)
+	return matched
+}
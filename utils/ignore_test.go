@@ -0,0 +1,45 @@
+package utils
+
+import "testing"
+
+func TestIgnoreRules(t *testing.T) {
+	rules, err := ParseIgnorePatterns("# comment\n\nRAW/\n*.txt\n/Series/Extras\nSeries/Chapter *\n!Series/Chapter 1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"RAW", true, true},
+		{"Series/RAW", true, true},
+		{"RAW", false, false}, // a trailing / only matches folders
+		{"notes.txt", false, true},
+		{"Series/notes.txt", false, true},
+		{"Series/Extras", true, true},
+		{"Other/Extras", true, false}, // a pattern with a / is matched against the whole path
+		{"Series/Chapter 2", true, true},
+		{"Series/Chapter 1", true, false}, // re-included by the later negated pattern
+		{"Series", true, false},
+	} {
+		if got := rules.Ignored(test.path, test.isDir); got != test.want {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", test.path, test.isDir, got, test.want)
+		}
+	}
+}
+
+func TestParseIgnorePatternsRejectsInvalidPatterns(t *testing.T) {
+	for _, patterns := range []string{"/", "!", "[chapter"} {
+		if _, err := ParseIgnorePatterns(patterns); err == nil {
+			t.Errorf("ParseIgnorePatterns(%q) succeeded, want an error", patterns)
+		}
+	}
+}
+
+func TestLoadIgnoreFileWithoutAFile(t *testing.T) {
+	rules, err := LoadIgnoreFile(t.TempDir())
+	if err != nil || rules != nil {
+		t.Errorf("got %v, %v, want no rules for a folder without an ignore file", rules, err)
+	}
+}
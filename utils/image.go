@@ -1,15 +1,21 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/nfnt/resize"
 )
@@ -19,17 +25,98 @@ const (
 	targetHeight = 600
 )
 
+// Limits shared by every image download, so a slow provider can't pile up requests during a big index
+var (
+	downloadMutex   sync.RWMutex
+	downloadTimeout = 30 * time.Second
+	downloadSlots   = make(chan struct{}, 4)
+
+	downloadCtx, cancelDownloads = context.WithCancel(context.Background())
+	downloads                    sync.WaitGroup
+
+	// lazyPosters leaves the cropped poster to be generated on its first request
+	lazyPosters bool
+)
+
+// SetImageDownloadLimits sets the timeout of a single download and how many downloads may run at once
+func SetImageDownloadLimits(timeout time.Duration, concurrency int) {
+	downloadMutex.Lock()
+	defer downloadMutex.Unlock()
+
+	downloadTimeout = timeout
+	if cap(downloadSlots) != concurrency {
+		// Downloads in flight keep releasing into the channel they acquired
+		downloadSlots = make(chan struct{}, concurrency)
+	}
+}
+
+// SetLazyPosters sets whether downloaded covers only keep the original, leaving the cropped poster for its first request
+func SetLazyPosters(lazy bool) {
+	downloadMutex.Lock()
+	defer downloadMutex.Unlock()
+	lazyPosters = lazy
+}
+
+// LazyPosters reports whether cropped posters are generated on their first request
+func LazyPosters() bool {
+	downloadMutex.RLock()
+	defer downloadMutex.RUnlock()
+	return lazyPosters
+}
+
+// StopImageDownloads cancels the downloads in flight and waits for them to return, new downloads fail right away
+func StopImageDownloads() {
+	downloadMutex.Lock()
+	cancelDownloads()
+	downloadMutex.Unlock()
+	downloads.Wait()
+}
+
 // DownloadImage downloads an image from the specified URL, saves it in the original and resized formats.
 func DownloadImage(downloadDir, fileName, fileUrl string) error {
+	return downloadImage(downloadDir, fileName, fileUrl, http.DefaultClient, 0)
+}
+
+// DownloadExternalImage downloads an image from a URL given by a user, refusing to connect to internal
+// addresses and to read more than maxBytes.
+func DownloadExternalImage(downloadDir, fileName, fileUrl string, maxBytes int64) error {
+	return downloadImage(downloadDir, fileName, fileUrl, externalClient, maxBytes)
+}
+
+func downloadImage(downloadDir, fileName, fileUrl string, client *http.Client, maxBytes int64) error {
 	if err := ensureDirExists(downloadDir); err != nil {
 		return err
 	}
 
+	downloadMutex.RLock()
+	if downloadCtx.Err() != nil {
+		downloadMutex.RUnlock()
+		return fmt.Errorf("image downloads are stopped")
+	}
+	timeout, slots, lazy := downloadTimeout, downloadSlots, lazyPosters
+	downloads.Add(1)
+	downloadMutex.RUnlock()
+	defer downloads.Done()
+
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-downloadCtx.Done():
+		return fmt.Errorf("image downloads are stopped")
+	}
+
+	if err := EnsureCacheSpace(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(downloadCtx, timeout)
+	defer cancel()
+
 	// Determine file name and extension
 	fileNameWithExtension := getFileNameWithExtension(fileName, fileUrl)
 	originalFilePath := filepath.Join(downloadDir, strings.TrimSuffix(fileNameWithExtension, filepath.Ext(fileNameWithExtension))+"_original"+filepath.Ext(fileNameWithExtension))
 
-	img, format, err := fetchImage(fileUrl)
+	img, format, err := fetchImage(ctx, client, fileUrl, maxBytes)
 	if err != nil {
 		return err
 	}
@@ -37,12 +124,49 @@ func DownloadImage(downloadDir, fileName, fileUrl string) error {
 	if err := saveImage(originalFilePath, img, format); err != nil {
 		return err
 	}
+	if lazy {
+		return nil
+	}
 
 	resizedImg := resizeAndCrop(img, targetWidth, targetHeight)
 	resizedFilePath := filepath.Join(downloadDir, fileNameWithExtension)
 	return saveImage(resizedFilePath, resizedImg, "jpeg")
 }
 
+// externalClient only connects to public addresses, checked on the dialed IP so DNS can't point it elsewhere
+var externalClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+					return fmt.Errorf("refusing to connect to internal address %s", host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return fmt.Errorf("too many redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("unsupported redirect scheme: %s", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// IsPublicIP reports whether an IP is reachable on the internet, as opposed to loopback, private or link-local
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
 // ensureDirExists checks if the directory exists; if not, returns an error.
 func ensureDirExists(dir string) error {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
@@ -60,15 +184,36 @@ func getFileNameWithExtension(fileName, fileUrl string) string {
 	return fileName
 }
 
-// fetchImage downloads and decodes an image from the URL.
-func fetchImage(url string) (image.Image, string, error) {
-	resp, err := http.Get(url)
+// fetchImage downloads and decodes an image from the URL, giving up once the context is done or the image
+// exceeds maxBytes, zero meaning no limit.
+func fetchImage(ctx context.Context, client *http.Client, url string, maxBytes int64) (image.Image, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch image: %v", err)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to fetch image: %v", err)
 	}
 	defer resp.Body.Close()
 
-	img, format, err := image.Decode(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to fetch image: %s", resp.Status)
+	}
+
+	var body io.Reader = resp.Body
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch image: %v", err)
+	}
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return nil, "", fmt.Errorf("image is larger than %d bytes", maxBytes)
+	}
+
+	img, format, err := decodeImage(data)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to decode image: %v", err)
 	}
@@ -126,6 +271,9 @@ func ProcessImage(fromPath, toPath string) error {
 	if err := checkFileExists(fromPath); err != nil {
 		return err
 	}
+	if err := EnsureCacheSpace(); err != nil {
+		return err
+	}
 
 	img, err := openImage(fromPath)
 	if err != nil {
@@ -136,6 +284,29 @@ func ProcessImage(fromPath, toPath string) error {
 	return saveProcessedImage(toPath, processedImg)
 }
 
+// blurScale is the width an image is shrunk to before being stretched back, the smaller the blurrier
+const blurScale = 12
+
+// BlurImage saves a heavily blurred copy of an image, used to hide covers until a viewer asks to see them. Shrinking
+// the image to a few pixels and stretching it back keeps its colors while hiding every detail.
+func BlurImage(fromPath, toPath string) error {
+	if err := checkFileExists(fromPath); err != nil {
+		return err
+	}
+	if err := EnsureCacheSpace(); err != nil {
+		return err
+	}
+
+	img, err := openImage(fromPath)
+	if err != nil {
+		return err
+	}
+
+	bounds := img.Bounds()
+	small := resize.Resize(blurScale, 0, img, resize.Bilinear)
+	return saveProcessedImage(toPath, resize.Resize(uint(bounds.Dx()), uint(bounds.Dy()), small, resize.Bilinear))
+}
+
 // checkFileExists checks if a file exists.
 func checkFileExists(path string) error {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -146,13 +317,12 @@ func checkFileExists(path string) error {
 
 // openImage opens and decodes an image file.
 func openImage(path string) (image.Image, error) {
-	file, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
-	defer file.Close()
 
-	img, _, err := image.Decode(file)
+	img, _, err := decodeImage(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// LogChannelKey is the key of the log fields tagging a line with a stream channel, as in
+	// log.Infow(message, utils.LogChannelKey, "indexer_<library>")
+	LogChannelKey = "channel"
+
+	// LogReplaySize is the number of recent log lines kept to replay to new subscribers
+	LogReplaySize = 500
+
+	// logSubscriberBuffer is the number of lines queued for a subscriber before its lines are dropped
+	logSubscriberBuffer = 256
+)
+
+// LogLevels are the names of the log levels, from the most to the least verbose
+var LogLevels = []string{"trace", "debug", "info", "warn", "error", "fatal", "panic"}
+
+var textLevelNames = map[string]string{
+	"[Trace] ": "trace",
+	"[Debug] ": "debug",
+	"[Info] ":  "info",
+	"[Warn] ":  "warn",
+	"[Error] ": "error",
+	"[Fatal] ": "fatal",
+	"[Panic] ": "panic",
+}
+
+var textChannelPattern = regexp.MustCompile(` ` + LogChannelKey + `=(\S+)`)
+
+// LogEntry is a log line as sent to the log stream
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Channel string    `json:"channel,omitempty"`
+	Line    string    `json:"line"`
+}
+
+// LogFilter selects the log lines of a subscriber, empty fields match every line
+type LogFilter struct {
+	// Level is the least severe level included
+	Level string
+	// Channel only includes the lines tagged with this channel
+	Channel string
+}
+
+// Matches reports whether a log line passes the filter
+func (f LogFilter) Matches(entry LogEntry) bool {
+	if f.Channel != "" && entry.Channel != f.Channel {
+		return false
+	}
+	return f.Level == "" || logLevelRank(entry.Level) >= logLevelRank(f.Level)
+}
+
+// IsLogLevel reports whether a level name is valid
+func IsLogLevel(level string) bool {
+	return logLevelRank(level) >= 0
+}
+
+func logLevelRank(level string) int {
+	for i, name := range LogLevels {
+		if name == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// LogSubscription receives the log lines written after it was made, a subscriber that doesn't keep up loses lines
+// instead of slowing down the logger
+type LogSubscription struct {
+	// Entries is closed once the subscription is cancelled
+	Entries <-chan LogEntry
+	entries chan LogEntry
+	filter  LogFilter
+	dropped atomic.Int64
+}
+
+// Dropped returns the number of lines dropped since the last call, because the subscriber fell behind
+func (s *LogSubscription) Dropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// logStream keeps the recent log lines and hands new ones to the subscribers
+var logStream = struct {
+	sync.Mutex
+	recent      []LogEntry // Ring of the recent lines, next is the oldest once full
+	next        int
+	subscribers map[*LogSubscription]struct{}
+}{
+	subscribers: make(map[*LogSubscription]struct{}),
+}
+
+// SubscribeLogs subscribes to the log lines matching a filter, returning up to replay of the most recent matching
+// lines. Cancel the subscription with UnsubscribeLogs.
+func SubscribeLogs(filter LogFilter, replay int) ([]LogEntry, *LogSubscription) {
+	entries := make(chan LogEntry, logSubscriberBuffer)
+	subscription := &LogSubscription{Entries: entries, entries: entries, filter: filter}
+
+	logStream.Lock()
+	defer logStream.Unlock()
+
+	var recent []LogEntry
+	if replay > 0 {
+		ordered := append(append([]LogEntry(nil), logStream.recent[logStream.next:]...), logStream.recent[:logStream.next]...)
+		for i := len(ordered) - 1; i >= 0 && len(recent) < replay; i-- {
+			if filter.Matches(ordered[i]) {
+				recent = append(recent, ordered[i])
+			}
+		}
+		for i, j := 0, len(recent)-1; i < j; i, j = i+1, j-1 {
+			recent[i], recent[j] = recent[j], recent[i]
+		}
+	}
+	logStream.subscribers[subscription] = struct{}{}
+	return recent, subscription
+}
+
+// UnsubscribeLogs cancels a subscription and closes its channel, cancelling twice is a no-op
+func UnsubscribeLogs(subscription *LogSubscription) {
+	logStream.Lock()
+	defer logStream.Unlock()
+
+	if _, ok := logStream.subscribers[subscription]; ok {
+		subscribers := make(map[*LogSubscription]struct{}, len(logStream.subscribers))
+		for s := range logStream.subscribers {
+			if s != subscription {
+				subscribers[s] = struct{}{}
+			}
+		}
+		logStream.subscribers = subscribers
+		close(subscription.entries)
+	}
+}
+
+// publishLog records a log line and hands it to the matching subscribers without waiting on any of them
+func publishLog(entry LogEntry) {
+	logStream.Lock()
+	defer logStream.Unlock()
+
+	if len(logStream.recent) < LogReplaySize {
+		logStream.recent = append(logStream.recent, entry)
+	} else {
+		logStream.recent[logStream.next] = entry
+		logStream.next = (logStream.next + 1) % LogReplaySize
+	}
+
+	for subscription := range logStream.subscribers {
+		if !subscription.filter.Matches(entry) {
+			continue
+		}
+		select {
+		case subscription.entries <- entry:
+		default:
+			subscription.dropped.Add(1)
+		}
+	}
+}
+
+// logStreamWriter is a log output feeding the log stream, each write of the logger is one line
+type logStreamWriter struct {
+	json bool
+}
+
+func (w logStreamWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	entry := LogEntry{Time: time.Now(), Level: "info", Line: line}
+	if w.json {
+		var fields map[string]any
+		if err := json.Unmarshal(p, &fields); err == nil {
+			if level, ok := fields["level"].(string); ok {
+				entry.Level = level
+			}
+			if channel, ok := fields[LogChannelKey]; ok {
+				entry.Channel = fmt.Sprint(channel)
+			}
+		}
+	} else {
+		// The level follows the date and the caller, the first marker is the one of the logger
+		first := -1
+		for prefix, level := range textLevelNames {
+			if i := strings.Index(line, prefix); i >= 0 && (first < 0 || i < first) {
+				first = i
+				entry.Level = level
+			}
+		}
+		if match := textChannelPattern.FindStringSubmatch(line); match != nil {
+			entry.Channel = match[1]
+		}
+	}
+	publishLog(entry)
+	return len(p), nil
+}
@@ -0,0 +1,336 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// LogSettings selects the format of the logs and where they are written besides stderr
+type LogSettings struct {
+	// JSON writes one JSON object per line instead of the default text lines
+	JSON bool
+	// ToFile also writes the logs to magi.log in the log directory
+	ToFile bool
+	// MaxBytes rotates the log file once it would grow past this size
+	MaxBytes int64
+	// MaxAge removes rotated log files older than this, 0 keeps them regardless of age
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated log files kept, 0 keeps them all
+	MaxBackups int
+}
+
+const logFileName = "magi.log"
+
+var (
+	loggerMutex sync.Mutex
+	logDir      string
+	logFile     *rotatingFile
+	logLevel    = log.LevelInfo
+
+	// textLogger is the logger fiber starts with, kept to switch back from JSON
+	textLogger = log.DefaultLogger()
+)
+
+// InitializeLogDirectory sets the directory the log file and its rotated backups are written to
+func InitializeLogDirectory(dir string) error {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	logDir = dir
+	return nil
+}
+
+// SetLogLevel sets the level of the logger, kept when the format or output changes
+func SetLogLevel(level log.Level) {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+
+	logLevel = level
+	log.SetLevel(level)
+}
+
+// ConfigureLogger switches the format and outputs of the logs, stderr and the log stream always receive them
+func ConfigureLogger(settings LogSettings) error {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+
+	var output io.Writer = os.Stderr
+	var fileErr error
+	if settings.ToFile && logDir != "" {
+		if logFile == nil {
+			logFile, fileErr = openRotatingFile(filepath.Join(logDir, logFileName))
+		}
+		if logFile != nil {
+			logFile.setLimits(settings.MaxBytes, settings.MaxAge, settings.MaxBackups)
+			output = io.MultiWriter(os.Stderr, logFile)
+		}
+	} else if logFile != nil {
+		logFile.Close()
+		logFile = nil
+	}
+	output = io.MultiWriter(output, logStreamWriter{json: settings.JSON})
+
+	if settings.JSON {
+		log.SetLogger(newJSONLogger(output))
+	} else {
+		textLogger.SetOutput(output)
+		log.SetLogger(textLogger)
+	}
+	log.SetLevel(logLevel)
+	return fileErr
+}
+
+// rotatingFile is a log file that is renamed to a timestamped backup once it reaches its size limit
+type rotatingFile struct {
+	mutex      sync.Mutex
+	path       string
+	file       *os.File
+	size       int64
+	maxBytes   int64
+	maxAge     time.Duration
+	maxBackups int
+}
+
+func openRotatingFile(path string) (*rotatingFile, error) {
+	f := &rotatingFile{path: path}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) setLimits(maxBytes int64, maxAge time.Duration, maxBackups int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.maxBytes = maxBytes
+	f.maxAge = maxAge
+	f.maxBackups = maxBackups
+	f.prune()
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current log file, writes after closing fail
+func (f *rotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	ext := filepath.Ext(f.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.path, ext), time.Now().Format("20060102-150405.000"), ext)
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.prune()
+	return nil
+}
+
+// prune removes the rotated backups past the age limit and the oldest ones past the backup limit
+func (f *rotatingFile) prune() {
+	ext := filepath.Ext(f.path)
+	backups, err := filepath.Glob(strings.TrimSuffix(f.path, ext) + "-*" + ext)
+	if err != nil {
+		return
+	}
+	// Timestamped names sort oldest first
+	sort.Strings(backups)
+
+	now := time.Now()
+	for i, backup := range backups {
+		expired := false
+		if f.maxAge > 0 {
+			if info, err := os.Stat(backup); err == nil && now.Sub(info.ModTime()) > f.maxAge {
+				expired = true
+			}
+		}
+		if f.maxBackups > 0 && len(backups)-i > f.maxBackups {
+			expired = true
+		}
+		if expired {
+			os.Remove(backup)
+		}
+	}
+}
+
+// Levels of the JSON logger, slog has no trace, fatal or panic levels of its own
+const (
+	slogLevelTrace = slog.LevelDebug - 4
+	slogLevelFatal = slog.LevelError + 4
+	slogLevelPanic = slog.LevelError + 8
+)
+
+var slogLevelNames = map[slog.Level]string{
+	slogLevelTrace:  "trace",
+	slog.LevelDebug: "debug",
+	slog.LevelInfo:  "info",
+	slog.LevelWarn:  "warn",
+	slog.LevelError: "error",
+	slogLevelFatal:  "fatal",
+	slogLevelPanic:  "panic",
+}
+
+var fiberToSlogLevels = map[log.Level]slog.Level{
+	log.LevelTrace: slogLevelTrace,
+	log.LevelDebug: slog.LevelDebug,
+	log.LevelInfo:  slog.LevelInfo,
+	log.LevelWarn:  slog.LevelWarn,
+	log.LevelError: slog.LevelError,
+	log.LevelFatal: slogLevelFatal,
+	log.LevelPanic: slogLevelPanic,
+}
+
+// jsonLogger implements the fiber logger on top of a slog JSON handler, with keys suited to Loki and ELK
+type jsonLogger struct {
+	level  *slog.LevelVar
+	logger *slog.Logger
+}
+
+func newJSONLogger(output io.Writer) *jsonLogger {
+	l := &jsonLogger{level: new(slog.LevelVar)}
+	l.SetOutput(output)
+	return l
+}
+
+func (l *jsonLogger) log(level log.Level, msg string, keysAndValues ...interface{}) {
+	l.logger.Log(context.Background(), fiberToSlogLevels[level], msg, keysAndValues...)
+	switch level {
+	case log.LevelFatal:
+		os.Exit(1)
+	case log.LevelPanic:
+		panic(msg)
+	}
+}
+
+func (l *jsonLogger) Trace(v ...interface{}) { l.log(log.LevelTrace, fmt.Sprint(v...)) }
+func (l *jsonLogger) Debug(v ...interface{}) { l.log(log.LevelDebug, fmt.Sprint(v...)) }
+func (l *jsonLogger) Info(v ...interface{})  { l.log(log.LevelInfo, fmt.Sprint(v...)) }
+func (l *jsonLogger) Warn(v ...interface{})  { l.log(log.LevelWarn, fmt.Sprint(v...)) }
+func (l *jsonLogger) Error(v ...interface{}) { l.log(log.LevelError, fmt.Sprint(v...)) }
+func (l *jsonLogger) Fatal(v ...interface{}) { l.log(log.LevelFatal, fmt.Sprint(v...)) }
+func (l *jsonLogger) Panic(v ...interface{}) { l.log(log.LevelPanic, fmt.Sprint(v...)) }
+
+func (l *jsonLogger) Tracef(format string, v ...interface{}) {
+	l.log(log.LevelTrace, fmt.Sprintf(format, v...))
+}
+func (l *jsonLogger) Debugf(format string, v ...interface{}) {
+	l.log(log.LevelDebug, fmt.Sprintf(format, v...))
+}
+func (l *jsonLogger) Infof(format string, v ...interface{}) {
+	l.log(log.LevelInfo, fmt.Sprintf(format, v...))
+}
+func (l *jsonLogger) Warnf(format string, v ...interface{}) {
+	l.log(log.LevelWarn, fmt.Sprintf(format, v...))
+}
+func (l *jsonLogger) Errorf(format string, v ...interface{}) {
+	l.log(log.LevelError, fmt.Sprintf(format, v...))
+}
+func (l *jsonLogger) Fatalf(format string, v ...interface{}) {
+	l.log(log.LevelFatal, fmt.Sprintf(format, v...))
+}
+func (l *jsonLogger) Panicf(format string, v ...interface{}) {
+	l.log(log.LevelPanic, fmt.Sprintf(format, v...))
+}
+
+func (l *jsonLogger) Tracew(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelTrace, msg, keysAndValues...)
+}
+func (l *jsonLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelDebug, msg, keysAndValues...)
+}
+func (l *jsonLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelInfo, msg, keysAndValues...)
+}
+func (l *jsonLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelWarn, msg, keysAndValues...)
+}
+func (l *jsonLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelError, msg, keysAndValues...)
+}
+func (l *jsonLogger) Fatalw(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelFatal, msg, keysAndValues...)
+}
+func (l *jsonLogger) Panicw(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelPanic, msg, keysAndValues...)
+}
+
+func (l *jsonLogger) WithContext(_ context.Context) log.CommonLogger {
+	return l
+}
+
+func (l *jsonLogger) SetLevel(level log.Level) {
+	l.level.Set(fiberToSlogLevels[level])
+}
+
+func (l *jsonLogger) SetOutput(output io.Writer) {
+	l.logger = slog.New(slog.NewJSONHandler(output, &slog.HandlerOptions{
+		Level: l.level,
+		ReplaceAttr: func(_ []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.LevelKey {
+				if level, ok := attr.Value.Any().(slog.Level); ok {
+					attr.Value = slog.StringValue(slogLevelNames[level])
+				}
+			}
+			return attr
+		},
+	}))
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+)
+
+// NaturalSort sorts names in place so embedded numbers compare by value, ordering page_2 before page_10
+func NaturalSort(names []string) {
+	sort.SliceStable(names, func(i, j int) bool { return NaturalLess(names[i], names[j]) })
+}
+
+// NaturalLess compares two names chunk by chunk, numbers by value and text case-insensitively.
+// Numbers of equal value are ordered by their padding, so "01" sorts before "1" instead of being equal.
+func NaturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		chunkA, restA := nextChunk(a)
+		chunkB, restB := nextChunk(b)
+
+		if isDigit(chunkA[0]) && isDigit(chunkB[0]) {
+			trimmedA, trimmedB := strings.TrimLeft(chunkA, "0"), strings.TrimLeft(chunkB, "0")
+			if len(trimmedA) != len(trimmedB) {
+				return len(trimmedA) < len(trimmedB)
+			}
+			if trimmedA != trimmedB {
+				return trimmedA < trimmedB
+			}
+			if len(chunkA) != len(chunkB) {
+				return len(chunkA) > len(chunkB)
+			}
+		} else if lowerA, lowerB := strings.ToLower(chunkA), strings.ToLower(chunkB); lowerA != lowerB {
+			return lowerA < lowerB
+		}
+
+		a, b = restA, restB
+	}
+	return len(a) < len(b)
+}
+
+// nextChunk splits off the leading run of digits or non-digits
+func nextChunk(s string) (string, string) {
+	digits := isDigit(s[0])
+	end := strings.IndexFunc(s, func(r rune) bool { return (r >= '0' && r <= '9') != digits })
+	if end == -1 {
+		return s, ""
+	}
+	return s[:end], s[end:]
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNaturalSort(t *testing.T) {
+	for _, test := range []struct {
+		names []string
+		want  []string
+	}{
+		{
+			names: []string{"10.jpg", "2.jpg", "1.jpg"},
+			want:  []string{"1.jpg", "2.jpg", "10.jpg"},
+		},
+		{
+			// Mixed zero-padding compares by value
+			names: []string{"010.jpg", "9.jpg", "001.jpg", "02.jpg"},
+			want:  []string{"001.jpg", "02.jpg", "9.jpg", "010.jpg"},
+		},
+		{
+			names: []string{"page_10.png", "Page_2.png", "page_1.png"},
+			want:  []string{"page_1.png", "Page_2.png", "page_10.png"},
+		},
+		{
+			// Different prefixes sort alphabetically, the pages of one prefix by number
+			names: []string{"p12.jpg", "credits.jpg", "p3.jpg", "cover.jpg"},
+			want:  []string{"cover.jpg", "credits.jpg", "p3.jpg", "p12.jpg"},
+		},
+		{
+			names: []string{"ch2/10.jpg", "ch2/9.jpg", "ch10/1.jpg", "ch1/1.jpg"},
+			want:  []string{"ch1/1.jpg", "ch2/9.jpg", "ch2/10.jpg", "ch10/1.jpg"},
+		},
+		{
+			// Equal values are ordered by padding so the order is total
+			names: []string{"1.jpg", "01.jpg", "001.jpg"},
+			want:  []string{"001.jpg", "01.jpg", "1.jpg"},
+		},
+	} {
+		names := slices.Clone(test.names)
+		NaturalSort(names)
+		if !slices.Equal(names, test.want) {
+			t.Errorf("NaturalSort(%v) = %v, want %v", test.names, names, test.want)
+		}
+	}
+}
+
+func TestNaturalLessPrefix(t *testing.T) {
+	if !NaturalLess("page", "page1") || NaturalLess("page1", "page") {
+		t.Error("a name should sort before the longer names it prefixes")
+	}
+}
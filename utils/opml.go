@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"time"
+)
+
+// OPMLOutline is an entry of an OPML document, series are exported as link outlines
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []OPMLOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// EncodeOPML writes the outlines as an OPML 2.0 document
+func EncodeOPML(title string, outlines []OPMLOutline) ([]byte, error) {
+	var document opmlDocument
+	document.Version = "2.0"
+	document.Head.Title = title
+	document.Head.DateCreated = time.Now().UTC().Format(time.RFC1123Z)
+	document.Body.Outlines = outlines
+
+	encoded, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), encoded...), nil
+}
+
+// ParseOPMLTitles returns the titles of the leaf outlines of an OPML document, nested folders are flattened
+func ParseOPMLTitles(data []byte) ([]string, error) {
+	var document opmlDocument
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return nil, errors.New("the file is not a valid OPML document")
+	}
+
+	var titles []string
+	var collect func(outlines []OPMLOutline)
+	collect = func(outlines []OPMLOutline) {
+		for _, outline := range outlines {
+			if len(outline.Outlines) > 0 {
+				collect(outline.Outlines)
+				continue
+			}
+			title := strings.TrimSpace(outline.Title)
+			if title == "" {
+				title = strings.TrimSpace(outline.Text)
+			}
+			if title != "" {
+				titles = append(titles, title)
+			}
+		}
+	}
+	collect(document.Body.Outlines)
+	return titles, nil
+}
@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"sync/atomic"
+)
+
+// normalizeOrientation bakes the EXIF orientation into served and processed images and strips their metadata
+var normalizeOrientation atomic.Bool
+
+// SetNormalizeOrientation sets whether images have their EXIF orientation applied and their metadata stripped
+func SetNormalizeOrientation(enabled bool) {
+	normalizeOrientation.Store(enabled)
+}
+
+// NormalizeOrientation reports whether images have their EXIF orientation applied and their metadata stripped
+func NormalizeOrientation() bool {
+	return normalizeOrientation.Load()
+}
+
+// JPEG markers of the segments read or dropped while normalizing
+const (
+	markerSOS  = 0xDA
+	markerAPP1 = 0xE1 // EXIF and XMP
+	markerIPTC = 0xED // APP13, IPTC and Photoshop resources
+	markerCOM  = 0xFE
+)
+
+// NormalizeJPEG returns a JPEG without its EXIF, XMP, IPTC and comment segments. A JPEG with an EXIF orientation
+// other than the default is re-encoded with the orientation applied to its pixels, so it displays upright everywhere.
+// Data that isn't a JPEG is returned unchanged.
+func NormalizeJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data, nil
+	}
+
+	if orientation := JPEGOrientation(data); orientation > 1 {
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		var encoded bytes.Buffer
+		if err := jpeg.Encode(&encoded, ApplyOrientation(img, orientation), &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+		return encoded.Bytes(), nil
+	}
+
+	stripped := bytes.NewBuffer(make([]byte, 0, len(data)))
+	stripped.Write(data[:2])
+	removed := false
+	for offset := 2; ; {
+		if offset+4 > len(data) || data[offset] != 0xFF {
+			return nil, fmt.Errorf("malformed JPEG segment at offset %d", offset)
+		}
+		marker := data[offset+1]
+		if marker == markerSOS {
+			stripped.Write(data[offset:])
+			break
+		}
+
+		end := offset + 2 + int(binary.BigEndian.Uint16(data[offset+2:]))
+		if end > len(data) {
+			return nil, fmt.Errorf("truncated JPEG segment at offset %d", offset)
+		}
+		if marker == markerAPP1 || marker == markerIPTC || marker == markerCOM {
+			removed = true
+		} else {
+			stripped.Write(data[offset:end])
+		}
+		offset = end
+	}
+
+	if !removed {
+		return data, nil
+	}
+	return stripped.Bytes(), nil
+}
+
+// JPEGOrientation returns the EXIF orientation of a JPEG, 1 when it has none
+func JPEGOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for offset := 2; offset+4 <= len(data) && data[offset] == 0xFF; {
+		marker := data[offset+1]
+		if marker == markerSOS {
+			break
+		}
+		end := offset + 2 + int(binary.BigEndian.Uint16(data[offset+2:]))
+		if end > len(data) {
+			break
+		}
+		if marker == markerAPP1 {
+			if value, ok := exifOrientation(data[offset+4 : end]); ok {
+				return value
+			}
+		}
+		offset = end
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag of the first IFD of an APP1 payload
+func exifOrientation(payload []byte) (int, bool) {
+	if len(payload) < 14 || !bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+		return 0, false
+	}
+	tiff := payload[6:]
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0, false
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			return value, value >= 1 && value <= 8
+		}
+	}
+	return 0, false
+}
+
+// ApplyOrientation transforms an image so an image stored with the given EXIF orientation is upright
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w, h := bounds.Dx(), bounds.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // Mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // Needs a 90° clockwise rotation
+				dx, dy = h-1-y, x
+			case 7: // Mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // Needs a 90° counter-clockwise rotation
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+// decodeImage decodes an image, applying its EXIF orientation when orientation normalization is enabled
+func decodeImage(data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if NormalizeOrientation() && format == "jpeg" {
+		img = ApplyOrientation(img, JPEGOrientation(data))
+	}
+	return img, format, nil
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// rotatedJPEG encodes a 32x16 image, red on the left and blue on the right, followed by an EXIF segment with the
+// given orientation and a comment segment
+func rotatedJPEG(t *testing.T, orientation uint16) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			if x < 16 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A little endian TIFF header followed by an IFD holding only the orientation tag
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	exif := append([]byte("Exif\x00\x00"), tiff...)
+	comment := []byte("taken by the scanlator")
+
+	data := encoded.Bytes()
+	fixture := append([]byte{}, data[:2]...)
+	fixture = append(fixture, 0xFF, markerAPP1)
+	fixture = binary.BigEndian.AppendUint16(fixture, uint16(len(exif)+2))
+	fixture = append(fixture, exif...)
+	fixture = append(fixture, 0xFF, markerCOM)
+	fixture = binary.BigEndian.AppendUint16(fixture, uint16(len(comment)+2))
+	fixture = append(fixture, comment...)
+	return append(fixture, data[2:]...)
+}
+
+// isRed and isBlue tolerate the changes of lossy JPEG encoding
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xC000 && g < 0x4000 && b < 0x4000
+}
+
+func isBlue(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return b > 0xC000 && r < 0x4000 && g < 0x4000
+}
+
+func TestNormalizeJPEGAppliesTheOrientation(t *testing.T) {
+	data := rotatedJPEG(t, 6)
+	if got := JPEGOrientation(data); got != 6 {
+		t.Fatalf("got orientation %d for the fixture, want 6", got)
+	}
+
+	normalized, err := NormalizeJPEG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(normalized, []byte("Exif")) || bytes.Contains(normalized, []byte("scanlator")) {
+		t.Error("the metadata wasn't stripped")
+	}
+	if got := JPEGOrientation(normalized); got != 1 {
+		t.Errorf("got orientation %d after normalizing, want 1", got)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(normalized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rotated 90° clockwise, the left half of the stored image is now on top
+	if bounds := img.Bounds(); bounds.Dx() != 16 || bounds.Dy() != 32 {
+		t.Fatalf("got a %dx%d image, want 16x32", bounds.Dx(), bounds.Dy())
+	}
+	if !isRed(img.At(8, 8)) || !isBlue(img.At(8, 24)) {
+		t.Errorf("got %v on top and %v at the bottom, want red on top of blue", img.At(8, 8), img.At(8, 24))
+	}
+}
+
+func TestNormalizeJPEGStripsMetadataOfUprightImages(t *testing.T) {
+	data := rotatedJPEG(t, 1)
+	normalized, err := NormalizeJPEG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(normalized, []byte("Exif")) || bytes.Contains(normalized, []byte("scanlator")) {
+		t.Error("the metadata wasn't stripped")
+	}
+	// Upright images aren't re-encoded, only their metadata segments are dropped
+	if !bytes.HasSuffix(data, normalized[2:]) {
+		t.Error("the image data changed, want the segments after the metadata untouched")
+	}
+
+	png := []byte("\x89PNG\r\n\x1a\n")
+	if normalized, err := NormalizeJPEG(png); err != nil || !bytes.Equal(normalized, png) {
+		t.Errorf("got %q, %v, want data that isn't a JPEG unchanged", normalized, err)
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// A 3x2 image whose top-left pixel is the only white one
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.White)
+
+	for orientation, want := range map[int]image.Point{
+		1: {0, 0},
+		2: {2, 0},
+		3: {2, 1},
+		4: {0, 1},
+		5: {0, 0},
+		6: {1, 0},
+		7: {1, 2},
+		8: {0, 2},
+	} {
+		oriented := ApplyOrientation(img, orientation)
+		r, _, _, _ := oriented.At(want.X, want.Y).RGBA()
+		if r != 0xFFFF {
+			t.Errorf("orientation %d: the top-left pixel didn't end up at %v", orientation, want)
+		}
+		if bounds := oriented.Bounds(); (orientation >= 5) != (bounds.Dx() == 2) {
+			t.Errorf("orientation %d: got a %dx%d image", orientation, bounds.Dx(), bounds.Dy())
+		}
+	}
+}
+
+func TestDecodeImageFollowsTheSetting(t *testing.T) {
+	t.Cleanup(func() { SetNormalizeOrientation(false) })
+	data := rotatedJPEG(t, 6)
+
+	img, _, err := decodeImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 32 {
+		t.Errorf("got a %dx%d image with the setting off, want it as stored", bounds.Dx(), bounds.Dy())
+	}
+
+	SetNormalizeOrientation(true)
+	if img, _, err = decodeImage(data); err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 16 || !isRed(img.At(8, 8)) {
+		t.Errorf("got a %dx%d image with the setting on, want it upright", bounds.Dx(), bounds.Dy())
+	}
+}
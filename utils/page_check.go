@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// PageIssue describes a page of a chapter that can't be read or decoded
+type PageIssue struct {
+	// Page is the 1-based position of the page in the chapter
+	Page  int    `json:"page"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// Markers a complete image ends with, a missing one means the file was truncated
+var (
+	jpegEnd = []byte{0xFF, 0xD9}
+	pngEnd  = []byte{0x49, 0x45, 0x4E, 0x44, 0xAE, 0x42, 0x60, 0x82}
+)
+
+// CheckChapterPages reads every page of a chapter archive or folder and returns the pages that fail to decode. Only
+// the image header is decoded, truncation is detected from the end marker of JPEG and PNG pages.
+func CheckChapterPages(chapterPath string) ([]PageIssue, error) {
+	images, err := ListChapterImages(chapterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []PageIssue
+	for i, name := range images {
+		if err := checkPage(chapterPath, name); err != nil {
+			issues = append(issues, PageIssue{Page: i + 1, Name: name, Error: err.Error()})
+		}
+	}
+	return issues, nil
+}
+
+func checkPage(chapterPath, name string) error {
+	reader, err := OpenChapterImage(chapterPath, name)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return checkImageData(name, data)
+}
+
+// checkImageData validates the header of an image, formats without a decoder in the standard library only have their
+// signature checked
+func checkImageData(name string, data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty image")
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".webp":
+		if len(data) < 12 || !bytes.Equal(data[:4], []byte("RIFF")) || !bytes.Equal(data[8:12], []byte("WEBP")) {
+			return errors.New("not a WebP image")
+		}
+		return nil
+	case ".bmp":
+		if !bytes.HasPrefix(data, []byte("BM")) {
+			return errors.New("not a BMP image")
+		}
+		return nil
+	case ".tiff":
+		if !bytes.HasPrefix(data, []byte("II*\x00")) && !bytes.HasPrefix(data, []byte("MM\x00*")) {
+			return errors.New("not a TIFF image")
+		}
+		return nil
+	}
+
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "jpeg":
+		if !bytes.HasSuffix(bytes.TrimRight(data, "\x00"), jpegEnd) {
+			return errors.New("truncated JPEG image")
+		}
+	case "png":
+		if !bytes.HasSuffix(data, pngEnd) {
+			return errors.New("truncated PNG image")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package utils
+
+import "image"
+
+// CountTallPages measures the first pages of a chapter archive or folder, up to maxPages, and returns how many of the
+// measured pages are at least minRatio times taller than wide. Only the image headers are read, pages in a format
+// without a decoder in the standard library aren't measured.
+func CountTallPages(chapterPath string, maxPages int, minRatio float64) (tall, measured int, err error) {
+	images, err := ListChapterImages(chapterPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(images) > maxPages {
+		images = images[:maxPages]
+	}
+
+	for _, name := range images {
+		reader, err := OpenChapterImage(chapterPath, name)
+		if err != nil {
+			continue
+		}
+		config, _, err := image.DecodeConfig(reader)
+		reader.Close()
+		if err != nil || config.Width == 0 {
+			continue
+		}
+		measured++
+		if float64(config.Height)/float64(config.Width) >= minRatio {
+			tall++
+		}
+	}
+	return tall, measured, nil
+}
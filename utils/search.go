@@ -1,14 +1,19 @@
 package utils
 
 import (
+	"sort"
 	"strings"
+	"unicode"
 )
 
+// SearchThreshold is the similarity an item needs to be part of the search results
+const SearchThreshold = 0.3
+
 // BigramSearch finds items that are similar to the given keyword based on bigram similarity.
 func BigramSearch(keyword string, items []string) []string {
 	var results []string
 	for _, item := range items {
-		if score := CompareStrings(keyword, item); score > 0.3 {
+		if score := CompareStrings(keyword, item); score > SearchThreshold {
 			results = append(results, item)
 		}
 	}
@@ -65,3 +70,144 @@ func countCommonBigrams(str string, bigramCounts map[string]int) (commonBigramsC
 	}
 	return
 }
+
+// diacriticFolds maps accented latin letters to their base letters
+var diacriticFolds = buildDiacriticFolds(map[string]string{
+	"a":  "àáâãäåāăąǎ",
+	"ae": "æ",
+	"c":  "çćĉċč",
+	"d":  "ďđð",
+	"e":  "èéêëēĕėęě",
+	"g":  "ĝğġģ",
+	"h":  "ĥħ",
+	"i":  "ìíîïĩīĭįı",
+	"j":  "ĵ",
+	"k":  "ķ",
+	"l":  "ĺļľŀł",
+	"n":  "ñńņňŉ",
+	"o":  "òóôõöøōŏőǒ",
+	"oe": "œ",
+	"r":  "ŕŗř",
+	"s":  "śŝşšș",
+	"ss": "ß",
+	"t":  "ţťŧț",
+	"th": "þ",
+	"u":  "ùúûüũūŭůűųǔ",
+	"w":  "ŵ",
+	"y":  "ýÿŷ",
+	"z":  "źżž",
+})
+
+func buildDiacriticFolds(folds map[string]string) map[rune]string {
+	runes := make(map[rune]string)
+	for base, accented := range folds {
+		for _, r := range accented {
+			runes[r] = base
+		}
+	}
+	return runes
+}
+
+// FoldTitle lowercases a title and strips the diacritics of latin letters, so "Shōnen" and "shonen" compare equal
+func FoldTitle(title string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(title)) {
+		if folded, ok := diacriticFolds[r]; ok {
+			builder.WriteString(folded)
+		} else {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// BestTitleScore returns the highest similarity between a keyword and any of the titles, ignoring case and diacritics
+func BestTitleScore(keyword string, titles []string) float64 {
+	keyword = FoldTitle(keyword)
+	best := 0.0
+	for _, title := range titles {
+		if score := CompareStrings(keyword, FoldTitle(title)); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// HighlightSpan is a matched portion of a text, as byte offsets into the text
+type HighlightSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// HighlightMatches returns the portions of a text matching a keyword, ignoring case and diacritics like
+// BestTitleScore. The whole keyword is looked for first, then each of its words of at least two letters, overlapping
+// matches are merged and the spans come in text order.
+func HighlightMatches(keyword, text string) []HighlightSpan {
+	keyword = FoldTitle(keyword)
+	if keyword == "" || text == "" {
+		return nil
+	}
+
+	// Fold the text rune by rune, keeping where each folded byte comes from in the text
+	var folded strings.Builder
+	var offsets []int
+	for i, r := range text {
+		part := string(unicode.ToLower(r))
+		if base, ok := diacriticFolds[unicode.ToLower(r)]; ok {
+			part = base
+		}
+		folded.WriteString(part)
+		for range len(part) {
+			offsets = append(offsets, i)
+		}
+	}
+	offsets = append(offsets, len(text))
+	haystack := folded.String()
+
+	terms := []string{keyword}
+	if !strings.Contains(haystack, keyword) {
+		terms = nil
+		for _, word := range strings.Fields(keyword) {
+			if len(word) >= 2 {
+				terms = append(terms, word)
+			}
+		}
+	}
+
+	var spans []HighlightSpan
+	for _, term := range terms {
+		for from := 0; from < len(haystack); {
+			index := strings.Index(haystack[from:], term)
+			if index < 0 {
+				break
+			}
+			start, end := from+index, from+index+len(term)
+			// A match ending inside a folded rune covers the whole rune
+			last := offsets[end-1]
+			for end < len(haystack) && offsets[end] == last {
+				end++
+			}
+			spans = append(spans, HighlightSpan{Start: offsets[start], End: offsets[end]})
+			from = end
+		}
+	}
+	return mergeHighlightSpans(spans)
+}
+
+// mergeHighlightSpans sorts spans and merges the ones that overlap or touch
+func mergeHighlightSpans(spans []HighlightSpan) []HighlightSpan {
+	if len(spans) == 0 {
+		return nil
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	merged := spans[:1]
+	for _, span := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if span.Start <= last.End {
+			last.End = max(last.End, span.End)
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"unicode"
@@ -274,3 +275,14 @@ func ExtractNumber(name string) (int, error) {
 
 	return strconv.Atoi(numStr)
 }
+
+var decimalNumberPattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// ExtractDecimalNumber extracts the first number found in the given string, keeping a decimal part such as in 10.5
+func ExtractDecimalNumber(name string) (float64, error) {
+	match := decimalNumberPattern.FindString(name)
+	if match == "" {
+		return 0, fmt.Errorf("no number found in string")
+	}
+	return strconv.ParseFloat(match, 64)
+}
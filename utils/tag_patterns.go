@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ParseTagPatterns compiles one regular expression per line, skipping blank lines and # comments. A pattern with a
+// capture group extracts the group, otherwise the whole match.
+func ParseTagPatterns(patterns string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for i, line := range strings.Split(patterns, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag pattern on line %d: %s", i+1, line)
+		}
+		compiled = append(compiled, pattern)
+	}
+	return compiled, nil
+}
+
+// ExtractTags returns the tags the patterns find in a folder or file name, such as Action and Completed in
+// "[Action][Completed] Title". A token listing several tags is split on commas and semicolons, tokens without a
+// letter such as years are skipped.
+func ExtractTags(name string, patterns []*regexp.Regexp) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		for _, match := range pattern.FindAllStringSubmatch(name, -1) {
+			token := match[0]
+			if len(match) > 1 {
+				token = match[1]
+			}
+			for _, tag := range strings.FieldsFunc(token, func(r rune) bool { return r == ',' || r == ';' }) {
+				tag = strings.Join(strings.Fields(tag), " ")
+				if !strings.ContainsFunc(tag, unicode.IsLetter) || seen[strings.ToLower(tag)] {
+					continue
+				}
+				seen[strings.ToLower(tag)] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractTags(t *testing.T) {
+	for _, test := range []struct {
+		patterns string
+		name     string
+		want     []string
+	}{
+		{`\[([^\]]+)\]`, "[Action][Completed] Title", []string{"Action", "Completed"}},
+		{`\(([^)]+)\)`, "Title (Romance) (2019)", []string{"Romance"}},
+		{`\[([^\]]+)\]` + "\n" + `\(([^)]+)\)`, "[Action] Title (Drama)", []string{"Action", "Drama"}},
+		// A token listing several tags is split, extra spaces are collapsed
+		{`\[([^\]]+)\]`, "[Action, Slice of  Life; Comedy] Title", []string{"Action", "Slice of Life", "Comedy"}},
+		// Tags found twice are kept once, whatever their casing
+		{`\[([^\]]+)\]` + "\n" + `\{([^}]+)\}`, "[Action] Title {action}", []string{"Action"}},
+		// Without a capture group the whole match is the tag
+		{`(?i)oneshot`, "Title Oneshot", []string{"Oneshot"}},
+		{`\[([^\]]+)\]`, "Title", nil},
+	} {
+		patterns, err := ParseTagPatterns(test.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ExtractTags(test.name, patterns); !slices.Equal(got, test.want) {
+			t.Errorf("ExtractTags(%q) with %q = %v, want %v", test.name, test.patterns, got, test.want)
+		}
+	}
+}
+
+func TestParseTagPatterns(t *testing.T) {
+	patterns, err := ParseTagPatterns("# bracketed tags\n\n\\[([^\\]]+)\\]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patterns) != 1 {
+		t.Errorf("got %d patterns, want comments and blank lines skipped", len(patterns))
+	}
+	if _, err := ParseTagPatterns("\\[([^\\]]+)\\]\n[unclosed"); err == nil {
+		t.Error("parsing an invalid pattern succeeded, want an error")
+	}
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// IsTarArchive checks if a file is a tar or gzip compressed tar archive based on its extension.
+func IsTarArchive(fileName string) bool {
+	format := GetChapterFormat(fileName)
+	return format != nil && format.Archive == ArchiveTar
+}
+
+// ListTarImages builds an in-memory index of the image entries in a tar archive, in archive order.
+// Tar archives can't be seeked by entry, so the index is used to resolve pages before streaming them.
+func ListTarImages(tarPath string) ([]string, error) {
+	reader, closer, err := openTarReader(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var entries []string
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isTarImageEntry(header) {
+			entries = append(entries, header.Name)
+		}
+	}
+	return entries, nil
+}
+
+// OpenTarEntry returns a reader positioned at the named entry of a tar archive.
+func OpenTarEntry(tarPath, entryName string) (io.ReadCloser, error) {
+	reader, closer, err := openTarReader(tarPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			closer.Close()
+			return nil, err
+		}
+		if header.Name == entryName && isTarImageEntry(header) {
+			return struct {
+				io.Reader
+				io.Closer
+			}{reader, closer}, nil
+		}
+	}
+
+	closer.Close()
+	return nil, fmt.Errorf("entry not found in archive: %s", entryName)
+}
+
+// openTarReader opens a tar archive, transparently decompressing gzip compressed archives.
+func openTarReader(tarPath string) (*tar.Reader, io.Closer, error) {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lowerPath := strings.ToLower(tarPath)
+	if strings.HasSuffix(lowerPath, ".gz") || strings.HasSuffix(lowerPath, ".tgz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return tar.NewReader(gzipReader), file, nil
+	}
+
+	return tar.NewReader(file), file, nil
+}
+
+// isTarImageEntry checks if a tar entry is a regular image file without path traversal.
+func isTarImageEntry(header *tar.Header) bool {
+	if header.Typeflag != tar.TypeReg || strings.Contains(header.Name, "..") {
+		return false
+	}
+	return isImageFile(header.Name)
+}
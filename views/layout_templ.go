@@ -8,7 +8,7 @@ package views
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
-func Layout(content templ.Component, userRole string) templ.Component {
+func Layout(content templ.Component, userRole string, pwaEnabled bool) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -29,7 +29,17 @@ func Layout(content templ.Component, userRole string) templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<!doctype html><html lang=\"en\" data-theme=\"dim\"><head><meta charset=\"UTF-8\"><meta name=\"viewport\" content=\"width=device-width, initial-scale=1.0\"><link href=\"/assets/css/styles.css\" rel=\"stylesheet\"><script src=\"/assets/js/htmx.min.js\"></script><link rel=\"icon\" type=\"image/x-icon\" href=\"/assets/img/icon.png\"><style>\n\t\t\t\t:root {\n\t\t\t\t\tfont-family: Inter, sans-serif;\n\t\t\t\t\tfont-feature-settings: \"liga\" 1, \"calt\" 1; /* fix for Chrome */\n\t\t\t\t}\n\t\t\t\t@supports (font-variation-settings: normal) {\n\t\t\t\t\t:root {\n\t\t\t\t\t\tfont-family: InterVariable, sans-serif;\n\t\t\t\t\t}\n\t\t\t\t}\n\n\t\t\t\t/* scrollbar */\n\t\t\t\t::-webkit-scrollbar {\n\t\t\t\t\twidth: 5px;\n\t\t\t\t\theight: 5px;\n\t\t\t\t}\n\n\t\t\t\t::-webkit-scrollbar-track {\n\t\t\t\t\t-webkit-box-shadow: inset 0 0 6px rgba(0, 0, 0, 0.3);\n\t\t\t\t\t-webkit-border-radius: 10px;\n\t\t\t\t\tborder-radius: 10px;\n\t\t\t\t}\n\n\t\t\t\t::-webkit-scrollbar-thumb {\n\t\t\t\t\t-webkit-border-radius: 10px;\n\t\t\t\t\tborder-radius: 10px;\n\t\t\t\t\tbackground: rgba(255, 255, 255, 0.3);\n\t\t\t\t\t-webkit-box-shadow: inset 0 0 6px rgba(0, 0, 0, 0.5);\n\t\t\t\t}\n\n\t\t\t\t::-webkit-scrollbar-thumb:window-inactive {\n\t\t\t\t\tbackground: rgba(255, 255, 255, 0.3);\n\t\t\t\t}\n\t\t\t</style><script>\n\t\t\t\tif (\n\t\t\t\t\tlocalStorage.getItem(\"color-theme\") === \"dark\" ||\n\t\t\t\t\t(!(\"color-theme\" in localStorage) &&\n\t\t\t\t\t\twindow.matchMedia(\"(prefers-color-scheme: dark)\").matches)\n\t\t\t\t) {\n\t\t\t\t\tdocument.documentElement.classList.add(\"dark\");\n\t\t\t\t} else {\n\t\t\t\t\tdocument.documentElement.classList.remove(\"dark\");\n\t\t\t\t}\n\t\t\t</script><script src=\"/assets/js/uikit.min.js\"></script><script src=\"/assets/js/uikit-icons.min.js\"></script><title>Magi</title></head><body class=\"bg-background text-foreground\">")
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<!doctype html><html lang=\"en\" data-theme=\"dim\"><head><meta charset=\"UTF-8\"><meta name=\"viewport\" content=\"width=device-width, initial-scale=1.0\"><link href=\"/assets/css/styles.css\" rel=\"stylesheet\"><script src=\"/assets/js/htmx.min.js\"></script><link rel=\"icon\" type=\"image/x-icon\" href=\"/assets/img/icon.png\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		if pwaEnabled {
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<link rel=\"manifest\" href=\"/manifest.webmanifest\"><meta name=\"theme-color\" content=\"#09090b\">")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<style>\n\t\t\t\t:root {\n\t\t\t\t\tfont-family: Inter, sans-serif;\n\t\t\t\t\tfont-feature-settings: \"liga\" 1, \"calt\" 1; /* fix for Chrome */\n\t\t\t\t}\n\t\t\t\t@supports (font-variation-settings: normal) {\n\t\t\t\t\t:root {\n\t\t\t\t\t\tfont-family: InterVariable, sans-serif;\n\t\t\t\t\t}\n\t\t\t\t}\n\n\t\t\t\t/* scrollbar */\n\t\t\t\t::-webkit-scrollbar {\n\t\t\t\t\twidth: 5px;\n\t\t\t\t\theight: 5px;\n\t\t\t\t}\n\n\t\t\t\t::-webkit-scrollbar-track {\n\t\t\t\t\t-webkit-box-shadow: inset 0 0 6px rgba(0, 0, 0, 0.3);\n\t\t\t\t\t-webkit-border-radius: 10px;\n\t\t\t\t\tborder-radius: 10px;\n\t\t\t\t}\n\n\t\t\t\t::-webkit-scrollbar-thumb {\n\t\t\t\t\t-webkit-border-radius: 10px;\n\t\t\t\t\tborder-radius: 10px;\n\t\t\t\t\tbackground: rgba(255, 255, 255, 0.3);\n\t\t\t\t\t-webkit-box-shadow: inset 0 0 6px rgba(0, 0, 0, 0.5);\n\t\t\t\t}\n\n\t\t\t\t::-webkit-scrollbar-thumb:window-inactive {\n\t\t\t\t\tbackground: rgba(255, 255, 255, 0.3);\n\t\t\t\t}\n\t\t\t</style><script>\n\t\t\t\tif (\n\t\t\t\t\tlocalStorage.getItem(\"color-theme\") === \"dark\" ||\n\t\t\t\t\t(!(\"color-theme\" in localStorage) &&\n\t\t\t\t\t\twindow.matchMedia(\"(prefers-color-scheme: dark)\").matches)\n\t\t\t\t) {\n\t\t\t\t\tdocument.documentElement.classList.add(\"dark\");\n\t\t\t\t} else {\n\t\t\t\t\tdocument.documentElement.classList.remove(\"dark\");\n\t\t\t\t}\n\t\t\t</script><script src=\"/assets/js/uikit.min.js\"></script><script src=\"/assets/js/uikit-icons.min.js\"></script><title>Magi</title></head><body class=\"bg-background text-foreground\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -53,7 +63,22 @@ func Layout(content templ.Component, userRole string) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div><script>\n\t\t\t\tvar themeToggleBtn = document.getElementById(\"theme-toggle\");\n\n\t\t\t\tthemeToggleBtn?.addEventListener(\"click\", function () {\n\t\t\t\t\t// if set via local storage previously\n\t\t\t\t\tif (localStorage.getItem(\"color-theme\")) {\n\t\t\t\t\t\tif (localStorage.getItem(\"color-theme\") === \"light\") {\n\t\t\t\t\t\t\tdocument.documentElement.classList.add(\"dark\");\n\t\t\t\t\t\t\tlocalStorage.setItem(\"color-theme\", \"dark\");\n\t\t\t\t\t\t} else {\n\t\t\t\t\t\t\tdocument.documentElement.classList.remove(\"dark\");\n\t\t\t\t\t\t\tlocalStorage.setItem(\"color-theme\", \"light\");\n\t\t\t\t\t\t}\n\n\t\t\t\t\t\t// if NOT set via local storage previously\n\t\t\t\t\t} else {\n\t\t\t\t\t\tif (document.documentElement.classList.contains(\"dark\")) {\n\t\t\t\t\t\t\tdocument.documentElement.classList.remove(\"dark\");\n\t\t\t\t\t\t\tlocalStorage.setItem(\"color-theme\", \"light\");\n\t\t\t\t\t\t} else {\n\t\t\t\t\t\t\tdocument.documentElement.classList.add(\"dark\");\n\t\t\t\t\t\t\tlocalStorage.setItem(\"color-theme\", \"dark\");\n\t\t\t\t\t\t}\n\t\t\t\t\t}\n\t\t\t\t});\n\t\t\t</script></body></html>")
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		if pwaEnabled {
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<script>\n\t\t\t\t\tif (\"serviceWorker\" in navigator) {\n\t\t\t\t\t\tnavigator.serviceWorker.register(\"/assets/js/service-worker.js\", { scope: \"/\" });\n\t\t\t\t\t}\n\t\t\t\t</script>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		} else {
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<script>\n\t\t\t\t\t// Remove a previously installed service worker once the app has been disabled\n\t\t\t\t\tnavigator.serviceWorker?.getRegistrations().then((registrations) => {\n\t\t\t\t\t\tregistrations.forEach((registration) => registration.unregister());\n\t\t\t\t\t});\n\t\t\t\t</script>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<script>\n\t\t\t\tvar themeToggleBtn = document.getElementById(\"theme-toggle\");\n\n\t\t\t\tthemeToggleBtn?.addEventListener(\"click\", function () {\n\t\t\t\t\t// if set via local storage previously\n\t\t\t\t\tif (localStorage.getItem(\"color-theme\")) {\n\t\t\t\t\t\tif (localStorage.getItem(\"color-theme\") === \"light\") {\n\t\t\t\t\t\t\tdocument.documentElement.classList.add(\"dark\");\n\t\t\t\t\t\t\tlocalStorage.setItem(\"color-theme\", \"dark\");\n\t\t\t\t\t\t} else {\n\t\t\t\t\t\t\tdocument.documentElement.classList.remove(\"dark\");\n\t\t\t\t\t\t\tlocalStorage.setItem(\"color-theme\", \"light\");\n\t\t\t\t\t\t}\n\n\t\t\t\t\t\t// if NOT set via local storage previously\n\t\t\t\t\t} else {\n\t\t\t\t\t\tif (document.documentElement.classList.contains(\"dark\")) {\n\t\t\t\t\t\t\tdocument.documentElement.classList.remove(\"dark\");\n\t\t\t\t\t\t\tlocalStorage.setItem(\"color-theme\", \"light\");\n\t\t\t\t\t\t} else {\n\t\t\t\t\t\t\tdocument.documentElement.classList.add(\"dark\");\n\t\t\t\t\t\t\tlocalStorage.setItem(\"color-theme\", \"dark\");\n\t\t\t\t\t\t}\n\t\t\t\t\t}\n\t\t\t\t});\n\t\t\t</script></body></html>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
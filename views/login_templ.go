@@ -29,7 +29,7 @@ func Login() templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<nav aria-label=\"Breadcrumb\"><ul class=\"uk-breadcrumb\"><li><a href=\"/\" hx-get=\"/\" hx-target=\"#content\" hx-push-url=\"true\">Home</a></li><li><span>Login</span></li></ul></nav><h2 class=\"uk-heading-line uk-h2 uk-card-title uk-text-center\"><span>Login</span></h2><div class=\"uk-width-1-3 uk-align-center\"><form hx-post=\"/login\" hx-redirect=\"/\"><div class=\"uk-margin\"><div class=\"uk-inline uk-width-1-1\"><span class=\"uk-form-icon\" uk-icon=\"icon: user\"></span> <input class=\"uk-input\" type=\"text\" name=\"username\" placeholder=\"Username\" aria-label=\"Not clickable icon\" required></div></div><div class=\"uk-margin\"><div class=\"uk-inline uk-width-1-1\"><span class=\"uk-form-icon uk-form-icon-flip\" uk-icon=\"icon: lock\"></span> <input class=\"uk-input\" type=\"password\" name=\"password\" placeholder=\"Password\" aria-label=\"Not clickable icon\" required></div></div><div class=\"mt-4 uk-flex uk-flex-center\"><button type=\"submit\" class=\"uk-button uk-button-default mr-2\">Login</button> <a href=\"/register\" hx-get=\"/register\" hx-target=\"#content\" hx-push-url=\"true\" class=\"uk-button uk-button-default ml-2\">Register</a></div></form></div>")
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<nav aria-label=\"Breadcrumb\"><ul class=\"uk-breadcrumb\"><li><a href=\"/\" hx-get=\"/\" hx-target=\"#content\" hx-push-url=\"true\">Home</a></li><li><span>Login</span></li></ul></nav><h2 class=\"uk-heading-line uk-h2 uk-card-title uk-text-center\"><span>Login</span></h2><div class=\"uk-width-1-3 uk-align-center\"><form hx-post=\"/login\" hx-redirect=\"/\"><div class=\"uk-margin\"><div class=\"uk-inline uk-width-1-1\"><span class=\"uk-form-icon\" uk-icon=\"icon: user\"></span> <input class=\"uk-input\" type=\"text\" name=\"username\" placeholder=\"Username\" aria-label=\"Not clickable icon\" required></div></div><div class=\"uk-margin\"><div class=\"uk-inline uk-width-1-1\"><span class=\"uk-form-icon uk-form-icon-flip\" uk-icon=\"icon: lock\"></span> <input class=\"uk-input\" type=\"password\" name=\"password\" placeholder=\"Password\" aria-label=\"Not clickable icon\" required></div></div><div class=\"uk-margin\"><label><input class=\"uk-checkbox\" type=\"checkbox\" name=\"remember_me\" value=\"true\"> Remember me</label></div><div class=\"mt-4 uk-flex uk-flex-center\"><button type=\"submit\" class=\"uk-button uk-button-default mr-2\">Login</button> <a href=\"/register\" hx-get=\"/register\" hx-target=\"#content\" hx-push-url=\"true\" class=\"uk-button uk-button-default ml-2\">Register</a></div></form></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}